@@ -45,6 +45,9 @@ var (
 	pk                cipher.PubKey
 	sk                cipher.SecKey
 	dmsgPort          uint16
+	preferServers     cipher.PubKeys
+	excludeServers    cipher.PubKeys
+	strictServers     bool
 )
 
 func init() {
@@ -59,6 +62,9 @@ func init() {
 	RootCmd.Flags().BoolVar(&testEnvironment, "test-environment", false, "distinguished between prod and test environment")
 	RootCmd.Flags().Var(&sk, "sk", "dmsg secret key\n")
 	RootCmd.Flags().Uint16Var(&dmsgPort, "dmsgPort", dmsg.DefaultDmsgHTTPPort, "dmsg port value\r")
+	RootCmd.Flags().Var(&preferServers, "prefer-servers", "dmsg servers to use before any others")
+	RootCmd.Flags().Var(&excludeServers, "exclude-servers", "dmsg servers to never use")
+	RootCmd.Flags().BoolVar(&strictServers, "strict-servers", false, "only use preferred dmsg servers")
 	var helpflag bool
 	RootCmd.SetUsageTemplate(help)
 	RootCmd.PersistentFlags().BoolVarP(&helpflag, "help", "h", false, "help for "+RootCmd.Use)
@@ -139,8 +145,11 @@ var RootCmd = &cobra.Command{
 		if !pk.Null() {
 			servers := getServers(ctx, a, log)
 			config := &dmsg.Config{
-				MinSessions:    0, // listen on all available servers
-				UpdateInterval: dmsg.DefaultUpdateInterval,
+				MinSessions:      0, // listen on all available servers
+				UpdateInterval:   dmsg.DefaultUpdateInterval,
+				PreferredServers: preferServers,
+				ExcludedServers:  excludeServers,
+				StrictServers:    strictServers,
 			}
 			var keys cipher.PubKeys
 			keys = append(keys, pk)
@@ -0,0 +1,185 @@
+// Package admin cmd/dmsg-server/commands/admin/root.go
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/spf13/cobra"
+
+	"github.com/skycoin/dmsg/internal/dmsg-server/api"
+)
+
+var (
+	addr        string
+	sk          cipher.SecKey
+	banDuration time.Duration
+	envSKErr    error // error of parsing DMSG_ADMIN_SK
+)
+
+func init() {
+	RootCmd.PersistentFlags().StringVarP(&addr, "addr", "a", "http://127.0.0.1:8082", "address of the dmsg-server api")
+	if os.Getenv("DMSG_ADMIN_SK") != "" {
+		if err := sk.Set(os.Getenv("DMSG_ADMIN_SK")); err != nil {
+			envSKErr = fmt.Errorf("invalid DMSG_ADMIN_SK: %w", err)
+		}
+	}
+	RootCmd.PersistentFlags().VarP(&sk, "sk", "s", "admin secret key (env DMSG_ADMIN_SK)")
+	banCmd.Flags().DurationVarP(&banDuration, "duration", "d", time.Hour, "duration of the ban")
+
+	RootCmd.AddCommand(
+		sessionsCmd,
+		kickSessionCmd,
+		streamsCmd,
+		kickStreamCmd,
+		bansCmd,
+		banCmd,
+		unbanCmd,
+	)
+}
+
+// RootCmd contains commands which call the admin api of a running dmsg-server
+var RootCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Administrate a running dmsg-server",
+}
+
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "List sessions",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		c, err := adminClient()
+		if err != nil {
+			return err
+		}
+		sessions, err := c.Sessions()
+		if err != nil {
+			return err
+		}
+		return printJSON(sessions)
+	},
+}
+
+var kickSessionCmd = &cobra.Command{
+	Use:   "kick-session <pk>",
+	Short: "Close the session with a client",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		var pk cipher.PubKey
+		if err := pk.Set(args[0]); err != nil {
+			return err
+		}
+		c, err := adminClient()
+		if err != nil {
+			return err
+		}
+		return c.CloseSession(pk)
+	},
+}
+
+var streamsCmd = &cobra.Command{
+	Use:   "streams",
+	Short: "List forwarded streams",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		c, err := adminClient()
+		if err != nil {
+			return err
+		}
+		streams, err := c.Streams()
+		if err != nil {
+			return err
+		}
+		return printJSON(streams)
+	},
+}
+
+var kickStreamCmd = &cobra.Command{
+	Use:   "kick-stream <id>",
+	Short: "Close a forwarded stream",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		id, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return err
+		}
+		c, err := adminClient()
+		if err != nil {
+			return err
+		}
+		return c.CloseStream(id)
+	},
+}
+
+var bansCmd = &cobra.Command{
+	Use:   "bans",
+	Short: "List banned public keys",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		c, err := adminClient()
+		if err != nil {
+			return err
+		}
+		bans, err := c.Bans()
+		if err != nil {
+			return err
+		}
+		return printJSON(bans)
+	},
+}
+
+var banCmd = &cobra.Command{
+	Use:   "ban <pk>",
+	Short: "Ban a public key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		var pk cipher.PubKey
+		if err := pk.Set(args[0]); err != nil {
+			return err
+		}
+		c, err := adminClient()
+		if err != nil {
+			return err
+		}
+		return c.Ban(pk, banDuration)
+	},
+}
+
+var unbanCmd = &cobra.Command{
+	Use:   "unban <pk>",
+	Short: "Lift the ban of a public key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		var pk cipher.PubKey
+		if err := pk.Set(args[0]); err != nil {
+			return err
+		}
+		c, err := adminClient()
+		if err != nil {
+			return err
+		}
+		return c.Unban(pk)
+	},
+}
+
+func adminClient() (*api.AdminClient, error) {
+	if envSKErr != nil && !RootCmd.PersistentFlags().Changed("sk") {
+		return nil, envSKErr
+	}
+	if sk.Null() {
+		return nil, errors.New("admin secret key is required (--sk or DMSG_ADMIN_SK)")
+	}
+	return api.NewAdminClient(addr, sk, nil)
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
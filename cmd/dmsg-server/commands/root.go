@@ -8,12 +8,14 @@ import (
 	"github.com/skycoin/skywire-utilities/pkg/buildinfo"
 	"github.com/spf13/cobra"
 
+	"github.com/skycoin/dmsg/cmd/dmsg-server/commands/admin"
 	"github.com/skycoin/dmsg/cmd/dmsg-server/commands/config"
 	"github.com/skycoin/dmsg/cmd/dmsg-server/commands/start"
 )
 
 func init() {
 	rootCmd.AddCommand(
+		admin.RootCmd,
 		config.RootCmd,
 		start.RootCmd,
 	)
@@ -9,7 +9,10 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -24,6 +27,7 @@ import (
 	"github.com/skycoin/dmsg/pkg/disc"
 	dmsg "github.com/skycoin/dmsg/pkg/dmsg"
 	"github.com/skycoin/dmsg/pkg/dmsgserver"
+	"github.com/skycoin/dmsg/pkg/noise"
 )
 
 var (
@@ -90,26 +94,53 @@ var RootCmd = &cobra.Command{
 		srvConf := dmsg.ServerConfig{
 			MaxSessions:    conf.MaxSessions,
 			UpdateInterval: conf.UpdateInterval,
+			ForwardStreams: conf.ForwardStreams,
+			Peers:          conf.Peers,
+			ClientLimits: dmsg.ClientLimits{
+				MaxStreams:              conf.MaxStreamsPerClient,
+				StreamRequestsPerSecond: conf.StreamRequestsPerSecond,
+				StreamRequestsBurst:     conf.StreamRequestsBurst,
+				BytesPerSecond:          conf.BytesPerSecond,
+				BytesBurst:              conf.BytesBurst,
+			},
+			Rekey: noise.RekeyConfig{
+				Bytes:    conf.RekeyBytes,
+				Interval: conf.RekeyInterval,
+			},
+		}
+		if conf.ACLFile != "" {
+			if srvConf.ACL, err = dmsg.LoadACL(conf.ACLFile); err != nil {
+				log.WithError(err).Fatal("Failed to load acl.")
+			}
 		}
 		srv := dmsg.NewServer(conf.PubKey, conf.SecKey, disc.NewHTTP(conf.Discovery, &http.Client{}, log), &srvConf, m)
 		srv.SetLogger(log)
 
 		api.SetDmsgServer(srv)
+		if len(conf.AdminPKs) > 0 {
+			api.EnableAdmin(conf.AdminPKs)
+		}
 		defer func() { log.WithError(api.Close()).Info("Closed server.") }()
 
 		ctx, cancel := cmdutil.SignalContext(context.Background(), log)
 		defer cancel()
 
 		go api.RunBackgroundTasks(ctx)
+		if srvConf.ACL != nil {
+			go reloadACLOnSignal(ctx, log, srv)
+		}
 		log.WithField("addr", conf.HTTPAddress).Info("Serving server API...")
 		go func() {
-			if err := api.ListenAndServe(conf.LocalAddress, conf.PublicAddress, conf.HTTPAddress); err != nil {
+			if err := api.ListenAndServe(conf.LocalAddress, conf.PublicAddress, conf.HTTPAddress, conf.PublicWebSocketAddress); err != nil {
 				log.Errorf("Serve: %v", err)
 				cancel()
 			}
 		}()
 
 		<-ctx.Done()
+		if conf.DrainTimeout > 0 {
+			drainServer(log, srv, conf.DrainTimeout)
+		}
 	},
 }
 
@@ -120,6 +151,40 @@ func Execute() {
 	}
 }
 
+// drainServer drains the dmsg server until all streams finish, 'timeout' passes, or another signal is received.
+func drainServer(log *logging.Logger, srv *dmsg.Server, timeout time.Duration) {
+	log.WithField("timeout", timeout).Info("Draining server... Send another signal to close immediately.")
+
+	ctx, cancel := cmdutil.SignalContext(context.Background(), log)
+	defer cancel()
+	ctx, cancelTimeout := context.WithTimeout(ctx, timeout)
+	defer cancelTimeout()
+
+	if err := srv.Drain(ctx); err != nil {
+		log.WithError(err).Warn("Server did not drain gracefully.")
+	}
+}
+
+// reloadACLOnSignal reloads the acl of the dmsg server whenever SIGHUP is received.
+func reloadACLOnSignal(ctx context.Context, log *logging.Logger, srv *dmsg.Server) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ch:
+			if err := srv.ReloadACL(); err != nil {
+				log.WithError(err).Error("Failed to reload acl.")
+				continue
+			}
+			log.Info("Reloaded acl.")
+		}
+	}
+}
+
 func configNotFound() (io.ReadCloser, error) {
 	return nil, errors.New("no config location specified")
 }
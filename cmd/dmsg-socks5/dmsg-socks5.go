@@ -0,0 +1,239 @@
+// package main cmd/dmsg-socks5/dmsg-socks5.go
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	cc "github.com/ivanpirog/coloredcobra"
+	"github.com/skycoin/skywire-utilities/pkg/buildinfo"
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/skycoin/skywire-utilities/pkg/cmdutil"
+	"github.com/skycoin/skywire-utilities/pkg/logging"
+	"github.com/skycoin/skywire-utilities/pkg/skyenv"
+	"github.com/spf13/cobra"
+
+	"github.com/skycoin/dmsg/pkg/disc"
+	dmsg "github.com/skycoin/dmsg/pkg/dmsg"
+	"github.com/skycoin/dmsg/pkg/dmsgsocks"
+)
+
+var (
+	sk       cipher.SecKey
+	dmsgDisc string
+	proxy    string
+
+	preferServers  cipher.PubKeys
+	excludeServers cipher.PubKeys
+	strictServers  bool
+
+	dmsgPort   uint
+	wl         string
+	allowAll   bool
+	allowLocal bool
+	maxConns   int
+
+	addr   string
+	remote string
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&dmsgDisc, "dmsg-disc", "D", "", "dmsg discovery url default:\n"+skyenv.DmsgDiscAddr)
+	rootCmd.PersistentFlags().StringVarP(&proxy, "proxy", "x", "", "connect to dmsg via SOCKS5 or HTTP CONNECT proxy url")
+	rootCmd.PersistentFlags().Var(&preferServers, "prefer-servers", "dmsg servers to use before any others")
+	rootCmd.PersistentFlags().Var(&excludeServers, "exclude-servers", "dmsg servers to never use")
+	rootCmd.PersistentFlags().BoolVar(&strictServers, "strict-servers", false, "only use preferred dmsg servers")
+	if os.Getenv("DMSGSOCKS5_SK") != "" {
+		sk.Set(os.Getenv("DMSGSOCKS5_SK")) //nolint
+	}
+	rootCmd.PersistentFlags().VarP(&sk, "sk", "s", "a random key is generated if unspecified\n\r")
+
+	hostCmd.Flags().UintVarP(&dmsgPort, "port", "p", uint(dmsgsocks.DefaultPort), "dmsg port to serve the proxy on")
+	hostCmd.Flags().StringVarP(&wl, "wl", "w", "", "whitelist keys, comma separated")
+	hostCmd.Flags().BoolVar(&allowAll, "allow-all", false, "allow all keys if the whitelist is empty (open proxy)")
+	hostCmd.Flags().BoolVar(&allowLocal, "allow-local", false, "allow loopback and link-local targets of the host")
+	hostCmd.Flags().IntVarP(&maxConns, "max-conns", "m", dmsgsocks.DefaultMaxConnsPerClient, "max concurrent connections per public key (0 is unlimited)")
+
+	frontendCmd.Flags().StringVarP(&addr, "addr", "a", "127.0.0.1:1080", "local address to serve the proxy on")
+	frontendCmd.Flags().StringVarP(&remote, "remote", "r", "", "dmsg address of the host '<pk|name>[:port]'")
+
+	rootCmd.AddCommand(hostCmd, frontendCmd)
+
+	var helpflag bool
+	rootCmd.SetUsageTemplate(help)
+	rootCmd.PersistentFlags().BoolVarP(&helpflag, "help", "h", false, "help for "+rootCmd.Use)
+	rootCmd.SetHelpCommand(&cobra.Command{Hidden: true})
+	rootCmd.PersistentFlags().MarkHidden("help") //nolint
+}
+
+var rootCmd = &cobra.Command{
+	Use:   "dmsg-socks5",
+	Short: "SOCKS5 proxy over dmsg",
+	Long: `
+	dmsg-socks5 serves a SOCKS5 proxy on a dmsg port (host), of which connections egress from the network of the host.
+	The proxy is used through a local SOCKS5 proxy (frontend), which tunnels CONNECT requests to the host.`,
+	SilenceErrors:         true,
+	SilenceUsage:          true,
+	DisableSuggestions:    true,
+	DisableFlagsInUseLine: true,
+	Version:               buildinfo.Version(),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if dmsgDisc == "" {
+			dmsgDisc = skyenv.DmsgDiscAddr
+		}
+	},
+}
+
+var hostCmd = &cobra.Command{
+	Use:   "host",
+	Short: "serve SOCKS5 proxy on a dmsg port",
+	Run: func(cmd *cobra.Command, args []string) {
+		log := logging.MustGetLogger("dmsg-socks5")
+
+		ctx, cancel := cmdutil.SignalContext(context.Background(), log)
+		defer cancel()
+
+		conf := dmsgsocks.HostConfig{
+			Port:              uint16(dmsgPort),
+			AllowAll:          allowAll,
+			AllowLocal:        allowLocal,
+			MaxConnsPerClient: maxConns,
+		}
+		if wl != "" {
+			for _, key := range strings.Split(wl, ",") {
+				var pubKey cipher.PubKey
+				if err := pubKey.Set(strings.TrimSpace(key)); err != nil {
+					log.WithError(err).Fatal("Invalid whitelist key.")
+				}
+				conf.Whitelist = append(conf.Whitelist, pubKey)
+			}
+		}
+		if len(conf.Whitelist) == 0 {
+			if !allowAll {
+				log.Fatal("A whitelist is required (--wl), or --allow-all to allow all keys.")
+			}
+			log.Warn("The whitelist is empty: all keys of the dmsg network can use the proxy.")
+		}
+
+		c, closeC := startClient(ctx, log)
+		defer closeC()
+		if c == nil {
+			return
+		}
+
+		if err := dmsgsocks.NewHost(c, conf, log).ListenAndServe(ctx); err != nil {
+			log.WithError(err).Fatal("Failed to serve SOCKS5 proxy.")
+		}
+	},
+}
+
+var frontendCmd = &cobra.Command{
+	Use:   "frontend",
+	Short: "serve local SOCKS5 proxy which tunnels to a host",
+	Run: func(cmd *cobra.Command, args []string) {
+		log := logging.MustGetLogger("dmsg-socks5")
+
+		ctx, cancel := cmdutil.SignalContext(context.Background(), log)
+		defer cancel()
+
+		if remote == "" {
+			log.Fatal("The dmsg address of the host is required (--remote).")
+		}
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to listen on local address.")
+		}
+
+		c, closeC := startClient(ctx, log)
+		defer closeC()
+		if c == nil {
+			return
+		}
+
+		f, err := dmsgsocks.NewFrontend(c, remote, log)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid dmsg address of the host.")
+		}
+		if err := f.Serve(ctx, lis); err != nil {
+			log.WithError(err).Fatal("Failed to serve local SOCKS5 proxy.")
+		}
+	},
+}
+
+// startClient starts a dmsg client, and waits until it is ready.
+// The client is nil if the context is canceled before it is ready.
+func startClient(ctx context.Context, log *logging.Logger) (*dmsg.Client, func()) {
+	pk, err := sk.PubKey()
+	if err != nil {
+		pk, sk = cipher.GenerateKeyPair()
+	}
+
+	conf := dmsg.DefaultConfig()
+	conf.PreferredServers = preferServers
+	conf.ExcludedServers = excludeServers
+	conf.StrictServers = strictServers
+	if proxy != "" {
+		if conf.Proxy, err = url.Parse(proxy); err != nil {
+			log.WithError(err).Fatal("Failed to parse proxy URL.")
+		}
+	}
+
+	c := dmsg.NewClient(pk, sk, disc.NewHTTP(dmsgDisc, &http.Client{}, log, disc.WithProxy(conf.Proxy)), conf)
+	closeC := func() {
+		if err := c.Close(); err != nil {
+			log.WithError(err).Error()
+		}
+	}
+
+	go c.Serve(context.Background())
+
+	select {
+	case <-ctx.Done():
+		log.WithError(ctx.Err()).Warn()
+		return nil, closeC
+
+	case <-c.Ready():
+	}
+
+	log.WithField("pk", pk).Info("Connected to dmsg.")
+	return c, closeC
+}
+
+// Execute executes root CLI command.
+func Execute() {
+	cc.Init(&cc.Config{
+		RootCmd:       rootCmd,
+		Headings:      cc.HiBlue + cc.Bold, //+ cc.Underline,
+		Commands:      cc.HiBlue + cc.Bold,
+		CmdShortDescr: cc.HiBlue,
+		Example:       cc.HiBlue + cc.Italic,
+		ExecName:      cc.HiBlue + cc.Bold,
+		Flags:         cc.HiBlue + cc.Bold,
+		//FlagsDataType: cc.HiBlue,
+		FlagsDescr:      cc.HiBlue,
+		NoExtraNewlines: true,
+		NoBottomNewline: true,
+	})
+	if err := rootCmd.Execute(); err != nil {
+		log.Fatal("Failed to execute command: ", err)
+	}
+}
+
+const help = "Usage:\r\n" +
+	"  {{.UseLine}}{{if .HasAvailableSubCommands}}{{end}} {{if gt (len .Aliases) 0}}\r\n\r\n" +
+	"{{.NameAndAliases}}{{end}}{{if .HasAvailableSubCommands}}\r\n\r\n" +
+	"Available Commands:{{range .Commands}}{{if (or .IsAvailableCommand)}}\r\n  " +
+	"{{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableLocalFlags}}\r\n\r\n" +
+	"Flags:\r\n" +
+	"{{.LocalFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}{{if .HasAvailableInheritedFlags}}\r\n\r\n" +
+	"Global Flags:\r\n" +
+	"{{.InheritedFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}\r\n\r\n"
+
+func main() {
+	Execute()
+}
@@ -0,0 +1,209 @@
+// package main cmd/dmsg-tunnel/dmsg-tunnel.go
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	cc "github.com/ivanpirog/coloredcobra"
+	"github.com/skycoin/skywire-utilities/pkg/buildinfo"
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/skycoin/skywire-utilities/pkg/cmdutil"
+	"github.com/skycoin/skywire-utilities/pkg/logging"
+	"github.com/skycoin/skywire-utilities/pkg/skyenv"
+	"github.com/spf13/cobra"
+
+	"github.com/skycoin/dmsg/pkg/disc"
+	dmsg "github.com/skycoin/dmsg/pkg/dmsg"
+	"github.com/skycoin/dmsg/pkg/dmsgtunnel"
+)
+
+var (
+	sk         cipher.SecKey
+	dmsgDisc   string
+	confPath   string
+	localFwds  []string
+	remoteFwds []string
+	wl         string
+	public     bool
+	proxy      string
+
+	preferServers  cipher.PubKeys
+	excludeServers cipher.PubKeys
+	strictServers  bool
+)
+
+func init() {
+	rootCmd.Flags().StringArrayVarP(&localFwds, "local", "L", nil, "forward local tcp port to remote dmsg address\n'[bind_address:]port:<pk|name>:dmsg_port'")
+	rootCmd.Flags().StringArrayVarP(&remoteFwds, "remote", "R", nil, "expose local tcp service on dmsg port\n'dmsg_port:[host:]port'")
+	rootCmd.Flags().StringVarP(&confPath, "config", "c", "", "json config file of forwards (in addition to flags)")
+	rootCmd.Flags().StringVarP(&wl, "wl", "w", "", "whitelist keys of remote forwards of flags, comma separated")
+	rootCmd.Flags().BoolVar(&public, "public", false, "expose remote forwards of flags to all keys if the whitelist is empty")
+	rootCmd.Flags().StringVarP(&dmsgDisc, "dmsg-disc", "D", "", "dmsg discovery url default:\n"+skyenv.DmsgDiscAddr)
+	rootCmd.Flags().StringVarP(&proxy, "proxy", "x", "", "connect to dmsg via SOCKS5 or HTTP CONNECT proxy url")
+	rootCmd.Flags().Var(&preferServers, "prefer-servers", "dmsg servers to use before any others")
+	rootCmd.Flags().Var(&excludeServers, "exclude-servers", "dmsg servers to never use")
+	rootCmd.Flags().BoolVar(&strictServers, "strict-servers", false, "only use preferred dmsg servers")
+	if os.Getenv("DMSGTUNNEL_SK") != "" {
+		sk.Set(os.Getenv("DMSGTUNNEL_SK")) //nolint
+	}
+	rootCmd.Flags().VarP(&sk, "sk", "s", "a random key is generated if unspecified\n\r")
+	var helpflag bool
+	rootCmd.SetUsageTemplate(help)
+	rootCmd.PersistentFlags().BoolVarP(&helpflag, "help", "h", false, "help for "+rootCmd.Use)
+	rootCmd.SetHelpCommand(&cobra.Command{Hidden: true})
+	rootCmd.PersistentFlags().MarkHidden("help") //nolint
+}
+
+var rootCmd = &cobra.Command{
+	Use:   "dmsg-tunnel",
+	Short: "forward tcp ports over dmsg",
+	Long: `
+	dmsg-tunnel forwards local tcp ports to remote dmsg addresses (like 'ssh -L'),
+	and exposes local tcp services on dmsg ports (like 'ssh -R').`,
+	Example: `  dmsg-tunnel -L 5432:<pk>:5432
+  dmsg-tunnel -R 5432:127.0.0.1:5432 -w <pk1>,<pk2>
+  dmsg-tunnel -R 80:127.0.0.1:8080 --public
+  dmsg-tunnel -c tunnel.json`,
+	SilenceErrors:         true,
+	SilenceUsage:          true,
+	DisableSuggestions:    true,
+	DisableFlagsInUseLine: true,
+	Version:               buildinfo.Version(),
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if dmsgDisc == "" {
+			dmsgDisc = skyenv.DmsgDiscAddr
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		log := logging.MustGetLogger("dmsg-tunnel")
+
+		ctx, cancel := cmdutil.SignalContext(context.Background(), log)
+		defer cancel()
+
+		tConf, err := tunnelConfig()
+		if err != nil {
+			log.WithError(err).Fatal("Invalid forwards.")
+		}
+		if err := tConf.Validate(); err != nil {
+			log.WithError(err).Fatal("Invalid forwards.")
+		}
+
+		pk, err := sk.PubKey()
+		if err != nil {
+			pk, sk = cipher.GenerateKeyPair()
+		}
+
+		conf := dmsg.DefaultConfig()
+		conf.PreferredServers = preferServers
+		conf.ExcludedServers = excludeServers
+		conf.StrictServers = strictServers
+		if proxy != "" {
+			if conf.Proxy, err = url.Parse(proxy); err != nil {
+				log.WithError(err).Fatal("Failed to parse proxy URL.")
+			}
+		}
+
+		c := dmsg.NewClient(pk, sk, disc.NewHTTP(dmsgDisc, &http.Client{}, log, disc.WithProxy(conf.Proxy)), conf)
+		defer func() {
+			if err := c.Close(); err != nil {
+				log.WithError(err).Error()
+			}
+		}()
+
+		go c.Serve(context.Background())
+
+		select {
+		case <-ctx.Done():
+			log.WithError(ctx.Err()).Warn()
+			return
+
+		case <-c.Ready():
+		}
+
+		log.WithField("pk", pk).Info("Connected to dmsg.")
+		if err := dmsgtunnel.New(c, *tConf, log).Serve(ctx); err != nil {
+			log.WithError(err).Fatal("Tunnel stopped.")
+		}
+	},
+}
+
+// tunnelConfig returns the forwards of the config file and of flags.
+func tunnelConfig() (*dmsgtunnel.Config, error) {
+	conf := new(dmsgtunnel.Config)
+	if confPath != "" {
+		var err error
+		if conf, err = dmsgtunnel.ReadConfig(confPath); err != nil {
+			return nil, err
+		}
+	}
+
+	var wlKeys []cipher.PubKey
+	if wl != "" {
+		for _, key := range strings.Split(wl, ",") {
+			var pubKey cipher.PubKey
+			if err := pubKey.Set(strings.TrimSpace(key)); err != nil {
+				return nil, err
+			}
+			wlKeys = append(wlKeys, pubKey)
+		}
+	}
+
+	for _, s := range localFwds {
+		fwd, err := dmsgtunnel.ParseLocalForward(s)
+		if err != nil {
+			return nil, err
+		}
+		conf.Local = append(conf.Local, fwd)
+	}
+	for _, s := range remoteFwds {
+		fwd, err := dmsgtunnel.ParseRemoteForward(s)
+		if err != nil {
+			return nil, err
+		}
+		fwd.Whitelist = wlKeys
+		fwd.Public = public
+		conf.Remote = append(conf.Remote, fwd)
+	}
+	return conf, nil
+}
+
+// Execute executes root CLI command.
+func Execute() {
+	cc.Init(&cc.Config{
+		RootCmd:       rootCmd,
+		Headings:      cc.HiBlue + cc.Bold, //+ cc.Underline,
+		Commands:      cc.HiBlue + cc.Bold,
+		CmdShortDescr: cc.HiBlue,
+		Example:       cc.HiBlue + cc.Italic,
+		ExecName:      cc.HiBlue + cc.Bold,
+		Flags:         cc.HiBlue + cc.Bold,
+		//FlagsDataType: cc.HiBlue,
+		FlagsDescr:      cc.HiBlue,
+		NoExtraNewlines: true,
+		NoBottomNewline: true,
+	})
+	if err := rootCmd.Execute(); err != nil {
+		log.Fatal("Failed to execute command: ", err)
+	}
+}
+
+const help = "Usage:\r\n" +
+	"  {{.UseLine}}{{if .HasAvailableSubCommands}}{{end}} {{if gt (len .Aliases) 0}}\r\n\r\n" +
+	"{{.NameAndAliases}}{{end}}{{if .HasAvailableSubCommands}}\r\n\r\n" +
+	"Available Commands:{{range .Commands}}{{if (or .IsAvailableCommand)}}\r\n  " +
+	"{{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableLocalFlags}}\r\n\r\n" +
+	"Flags:\r\n" +
+	"{{.LocalFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}{{if .HasAvailableInheritedFlags}}\r\n\r\n" +
+	"Global Flags:\r\n" +
+	"{{.InheritedFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}{{if .HasExample}}\r\n\r\n" +
+	"Examples:\r\n" +
+	"{{.Example}}{{end}}\r\n\r\n"
+
+func main() {
+	Execute()
+}
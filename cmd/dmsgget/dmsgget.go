@@ -39,6 +39,10 @@ var (
 	dmsggetAgent  string
 	stdout        bool
 	logLvl        string
+	preferServers cipher.PubKeys
+	excludeServer cipher.PubKeys
+	strictServers bool
+	proxyAddr     string
 )
 
 func init() {
@@ -50,6 +54,10 @@ func init() {
 	rootCmd.Flags().IntVarP(&dmsggetTries, "try", "t", 1, "download attempts (0 unlimits)")
 	rootCmd.Flags().IntVarP(&dmsggetWait, "wait", "w", 0, "time to wait between fetches")
 	rootCmd.Flags().StringVarP(&dmsggetAgent, "agent", "a", "dmsgget/"+buildinfo.Version(), "identify as `AGENT`")
+	rootCmd.Flags().Var(&preferServers, "prefer-servers", "dmsg servers to use before any others")
+	rootCmd.Flags().Var(&excludeServer, "exclude-servers", "dmsg servers to never use")
+	rootCmd.Flags().BoolVar(&strictServers, "strict-servers", false, "only use preferred dmsg servers")
+	rootCmd.Flags().StringVarP(&proxyAddr, "proxy", "x", "", "connect to dmsg via SOCKS5 or HTTP CONNECT proxy `URL`")
 	if os.Getenv("DMSGGET_SK") != "" {
 		sk.Set(os.Getenv("DMSGGET_SK")) //nolint
 	}
@@ -171,8 +179,9 @@ var rootCmd = &cobra.Command{
 }
 
 // URL represents a dmsg http URL.
+// The host of the URL is either a public key, or a name which is registered in dmsg discovery.
 type URL struct {
-	dmsg.Addr
+	dmsg.NamedAddr
 	url.URL
 }
 
@@ -192,7 +201,7 @@ func (du *URL) fill(str string) error {
 	}
 
 	du.URL = *u
-	return du.Addr.Set(u.Host)
+	return du.NamedAddr.Set(u.Host)
 }
 
 func parseURL(args []string) (*URL, error) {
@@ -237,7 +246,21 @@ func parseOutputFile(name string, urlPath string) (*os.File, error) {
 }
 
 func startDmsg(ctx context.Context, pk cipher.PubKey, sk cipher.SecKey) (dmsgC *dmsg.Client, stop func(), err error) {
-	dmsgC = dmsg.NewClient(pk, sk, disc.NewHTTP(dmsgDisc, &http.Client{}, dmsggetLog), &dmsg.Config{MinSessions: dmsgSessions})
+	var proxyURL *url.URL
+	if proxyAddr != "" {
+		if proxyURL, err = url.Parse(proxyAddr); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse proxy URL: %w", err)
+		}
+	}
+
+	dc := disc.NewHTTP(dmsgDisc, &http.Client{}, dmsggetLog, disc.WithProxy(proxyURL))
+	dmsgC = dmsg.NewClient(pk, sk, dc, &dmsg.Config{
+		MinSessions:      dmsgSessions,
+		PreferredServers: preferServers,
+		ExcludedServers:  excludeServer,
+		StrictServers:    strictServers,
+		Proxy:            proxyURL,
+	})
 	go dmsgC.Serve(context.Background())
 
 	stop = func() {
@@ -6,8 +6,8 @@ import (
 	"fmt"
 	"log"
 	"mime"
-	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -33,6 +33,12 @@ var (
 	dmsgPort uint
 	wl       string
 	wlkeys   []cipher.PubKey
+	proxy    string
+	name     string
+
+	preferServers  cipher.PubKeys
+	excludeServers cipher.PubKeys
+	strictServers  bool
 )
 
 func init() {
@@ -40,6 +46,11 @@ func init() {
 	rootCmd.Flags().UintVarP(&dmsgPort, "port", "p", 80, "dmsg port to serve from")
 	rootCmd.Flags().StringVarP(&wl, "wl", "w", "", "whitelist keys, comma separated")
 	rootCmd.Flags().StringVarP(&dmsgDisc, "dmsg-disc", "D", "", "dmsg discovery url default:\n"+skyenv.DmsgDiscAddr)
+	rootCmd.Flags().StringVarP(&proxy, "proxy", "x", "", "connect to dmsg via SOCKS5 or HTTP CONNECT proxy url")
+	rootCmd.Flags().StringVarP(&name, "name", "n", "", "register (or renew) a name for the public key in dmsg discovery")
+	rootCmd.Flags().Var(&preferServers, "prefer-servers", "dmsg servers to use before any others")
+	rootCmd.Flags().Var(&excludeServers, "exclude-servers", "dmsg servers to never use")
+	rootCmd.Flags().BoolVar(&strictServers, "strict-servers", false, "only use preferred dmsg servers")
 	if os.Getenv("DMSGHTTP_SK") != "" {
 		sk.Set(os.Getenv("DMSGHTTP_SK")) //nolint
 	}
@@ -95,7 +106,17 @@ var rootCmd = &cobra.Command{
 			}
 		}
 
-		c := dmsg.NewClient(pk, sk, disc.NewHTTP(dmsgDisc, &http.Client{}, log), dmsg.DefaultConfig())
+		conf := dmsg.DefaultConfig()
+		conf.PreferredServers = preferServers
+		conf.ExcludedServers = excludeServers
+		conf.StrictServers = strictServers
+		if proxy != "" {
+			if conf.Proxy, err = url.Parse(proxy); err != nil {
+				log.WithError(err).Fatal("Failed to parse proxy URL.")
+			}
+		}
+
+		c := dmsg.NewClient(pk, sk, disc.NewHTTP(dmsgDisc, &http.Client{}, log, disc.WithProxy(conf.Proxy)), conf)
 		defer func() {
 			if err := c.Close(); err != nil {
 				log.WithError(err).Error()
@@ -112,10 +133,18 @@ var rootCmd = &cobra.Command{
 		case <-c.Ready():
 		}
 
+		if name != "" {
+			if err := c.RegisterName(ctx, name); err != nil {
+				log.WithError(err).Fatal("Failed to register name.")
+			}
+			log.WithField("name", name).Info("Registered name.")
+		}
+
 		lis, err := c.Listen(uint16(dmsgPort))
 		if err != nil {
 			log.WithError(err).Fatal()
 		}
+		lis.SetAcceptFilter(whitelistFilter)
 		go func() {
 			<-ctx.Done()
 			if err := lis.Close(); err != nil {
@@ -139,52 +168,36 @@ var rootCmd = &cobra.Command{
 func fileServerHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
-	// Get the remote PK.
-	remotePK, _, err := net.SplitHostPort(r.RemoteAddr)
+	// Streams from public keys which are not whitelisted are already rejected by the accept filter of the listener.
+	filePath := serveDir + r.URL.Path
+	file, err := os.Open(filePath) //nolint
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
 	}
+	defer file.Close() //nolint
+
+	_, filename := path.Split(filePath)
+	w.Header().Set("Content-Type", mime.TypeByExtension(filepath.Ext(filename)))
+	http.ServeContent(w, r, filename, time.Time{}, file)
+
+	// Log the response status and time taken.
+	elapsed := time.Since(start)
+	log.Printf("[DMSGHTTP] %s %s | %d | %v | %s | %s %s\n", start.Format("2006/01/02 - 15:04:05"), r.RemoteAddr, http.StatusOK, elapsed, r.Method, r.Proto, r.URL)
+}
 
-	// Check if the remote PK is whitelisted.
-	whitelisted := false
+// whitelistFilter rejects streams from public keys which are not whitelisted. All streams are accepted if the
+// whitelist is empty.
+func whitelistFilter(remote dmsg.Addr) error {
 	if len(wlkeys) == 0 {
-		whitelisted = true
-	} else {
-		for _, pubKey := range wlkeys {
-			if remotePK == pubKey.String() {
-				whitelisted = true
-				break
-			}
-		}
+		return nil
 	}
-
-	// If the remote PK is whitelisted, serve the file.
-	if whitelisted {
-		filePath := serveDir + r.URL.Path
-		file, err := os.Open(filePath) //nolint
-		if err != nil {
-			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
-			return
+	for _, pubKey := range wlkeys {
+		if remote.PK == pubKey {
+			return nil
 		}
-		defer file.Close() //nolint
-
-		_, filename := path.Split(filePath)
-		w.Header().Set("Content-Type", mime.TypeByExtension(filepath.Ext(filename)))
-		http.ServeContent(w, r, filename, time.Time{}, file)
-
-		// Log the response status and time taken.
-		elapsed := time.Since(start)
-		log.Printf("[DMSGHTTP] %s %s | %d | %v | %s | %s %s\n", start.Format("2006/01/02 - 15:04:05"), r.RemoteAddr, http.StatusOK, elapsed, r.Method, r.Proto, r.URL)
-		return
 	}
-
-	// Otherwise, return a 403 Forbidden error.
-	http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
-
-	// Log the response status and time taken.
-	elapsed := time.Since(start)
-	log.Printf("[DMSGHTTP] %s %s | %d | %v | %s | %s %s\n", start.Format("2006/01/02 - 15:04:05"), r.RemoteAddr, http.StatusForbidden, elapsed, r.Method, r.Proto, r.URL)
+	return dmsg.ErrReqRejected
 }
 
 // Execute executes root CLI command.
@@ -34,6 +34,10 @@ var (
 	dmsgpostLog   *logging.Logger
 	dmsgpostAgent string
 	logLvl        string
+	proxyAddr     string
+	preferServers cipher.PubKeys
+	excludeServer cipher.PubKeys
+	strictServers bool
 )
 
 func init() {
@@ -43,6 +47,10 @@ func init() {
 	rootCmd.Flags().StringVarP(&dmsgpostData, "data", "d", "", "dmsghttp POST data")
 	//	rootCmd.Flags().StringVarP(&dmsgpostHeader, "header", "H", "", "Pass custom header(s) to server")
 	rootCmd.Flags().StringVarP(&dmsgpostAgent, "agent", "a", "dmsgpost/"+buildinfo.Version(), "identify as `AGENT`")
+	rootCmd.Flags().StringVarP(&proxyAddr, "proxy", "x", "", "connect to dmsg via SOCKS5 or HTTP CONNECT proxy `URL`")
+	rootCmd.Flags().Var(&preferServers, "prefer-servers", "dmsg servers to use before any others")
+	rootCmd.Flags().Var(&excludeServer, "exclude-servers", "dmsg servers to never use")
+	rootCmd.Flags().BoolVar(&strictServers, "strict-servers", false, "only use preferred dmsg servers")
 	if os.Getenv("dmsgpost_SK") != "" {
 		sk.Set(os.Getenv("dmsgpost_SK")) //nolint
 	}
@@ -127,8 +135,9 @@ var rootCmd = &cobra.Command{
 }
 
 // URL represents a dmsg http URL.
+// The host of the URL is either a public key, or a name which is registered in dmsg discovery.
 type URL struct {
-	dmsg.Addr
+	dmsg.NamedAddr
 	url.URL
 }
 
@@ -148,7 +157,7 @@ func (du *URL) fill(str string) error {
 	}
 
 	du.URL = *u
-	return du.Addr.Set(u.Host)
+	return du.NamedAddr.Set(u.Host)
 }
 
 func parseURL(args []string) (*URL, error) {
@@ -169,7 +178,21 @@ func parseURL(args []string) (*URL, error) {
 }
 
 func startDmsg(ctx context.Context, pk cipher.PubKey, sk cipher.SecKey) (dmsgC *dmsg.Client, stop func(), err error) {
-	dmsgC = dmsg.NewClient(pk, sk, disc.NewHTTP(dmsgDisc, &http.Client{}, dmsgpostLog), &dmsg.Config{MinSessions: dmsgSessions})
+	var proxyURL *url.URL
+	if proxyAddr != "" {
+		if proxyURL, err = url.Parse(proxyAddr); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse proxy URL: %w", err)
+		}
+	}
+
+	dc := disc.NewHTTP(dmsgDisc, &http.Client{}, dmsgpostLog, disc.WithProxy(proxyURL))
+	dmsgC = dmsg.NewClient(pk, sk, dc, &dmsg.Config{
+		MinSessions:      dmsgSessions,
+		Proxy:            proxyURL,
+		PreferredServers: preferServers,
+		ExcludedServers:  excludeServer,
+		StrictServers:    strictServers,
+	})
 	go dmsgC.Serve(context.Background())
 
 	stop = func() {
@@ -24,7 +24,7 @@ var (
 	confPath        string
 	// conf to update whitelists
 	conf       dmsgpty.Config
-	remoteAddr dmsg.Addr
+	remoteAddr dmsg.NamedAddr
 	cmdName    = dmsgpty.DefaultCmd
 	cmdArgs    []string
 )
@@ -34,7 +34,7 @@ func init() {
 	RootCmd.PersistentFlags().StringVar(&cli.Addr, "cliaddr", cli.Addr, "address to use for dialing to dmsgpty-host")
 	RootCmd.PersistentFlags().StringVarP(&confPath, "confpath", confPath, defaultConfPath, "config path")
 	cobra.OnInitialize(initConfig)
-	RootCmd.Flags().Var(&remoteAddr, "addr", "remote dmsg address of format 'pk:port'\n If unspecified, the pty will start locally\n")
+	RootCmd.Flags().Var(&remoteAddr, "addr", "remote dmsg address of format 'pk:port' or 'name:port'\n If unspecified, the pty will start locally\n")
 	RootCmd.Flags().StringVarP(&cmdName, "cmd", "c", cmdName, "name of command to run\n")
 	RootCmd.Flags().StringSliceVarP(&cmdArgs, "args", "a", cmdArgs, "command arguments")
 	var helpflag bool
@@ -69,6 +69,10 @@ var RootCmd = &cobra.Command{
 		ctx, cancel := cmdutil.SignalContext(context.Background(), nil)
 		defer cancel()
 
+		if remoteAddr.Name != "" {
+			// Remote pty of a registered name.
+			return cli.StartNamedRemotePty(ctx, remoteAddr.Name, remoteAddr.Port, cmdName, cmdArgs...)
+		}
 		if remoteAddr.PK.Null() {
 			// Local pty.
 			return cli.StartLocalPty(ctx, cmdName, cmdArgs...)
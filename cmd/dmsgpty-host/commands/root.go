@@ -7,6 +7,7 @@ import (
 	stdlog "log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -43,6 +44,11 @@ var (
 	sk           cipher.SecKey
 	pk           cipher.PubKey
 	wl           cipher.PubKeys
+	proxy        string
+
+	preferServers  cipher.PubKeys
+	excludeServers cipher.PubKeys
+	strictServers  bool
 
 	// persistent flags
 	envPrefix = defaultEnvPrefix
@@ -62,6 +68,10 @@ func init() {
 	RootCmd.PersistentFlags().Uint16Var(&dmsgPort, "dmsgport", dmsgPort, "dmsg port for listening for remote hosts")
 	RootCmd.PersistentFlags().StringVar(&cliNet, "clinet", cliNet, "network used for listening for cli connections")
 	RootCmd.PersistentFlags().StringVar(&cliAddr, "cliaddr", cliAddr, "address used for listening for cli connections")
+	RootCmd.PersistentFlags().StringVar(&proxy, "proxy", proxy, "SOCKS5 or HTTP CONNECT proxy url to connect to dmsg through")
+	RootCmd.PersistentFlags().Var(&preferServers, "preferservers", "dmsg servers to use before any others")
+	RootCmd.PersistentFlags().Var(&excludeServers, "excludeservers", "dmsg servers to never use")
+	RootCmd.PersistentFlags().BoolVar(&strictServers, "strictservers", strictServers, "only use preferred dmsg servers")
 	// Prepare flags without associated env/config references.
 	RootCmd.PersistentFlags().StringVar(&envPrefix, "envprefix", envPrefix, "env prefix")
 	RootCmd.Flags().BoolVar(&confStdin, "confstdin", confStdin, "config will be read from stdin if set")
@@ -104,9 +114,21 @@ var RootCmd = &cobra.Command{
 			return fmt.Errorf("failed to derive public key from secret key: %w", err)
 		}
 
+		var proxyURL *url.URL
+		if conf.Proxy != "" {
+			if proxyURL, err = url.Parse(conf.Proxy); err != nil {
+				return fmt.Errorf("failed to parse proxy url: %w", err)
+			}
+		}
+
 		// Prepare and serve dmsg client and wait until ready.
-		dmsgC := dmsg.NewClient(pk, sk, disc.NewHTTP(conf.DmsgDisc, &http.Client{}, log), &dmsg.Config{
-			MinSessions: conf.DmsgSessions,
+		dc := disc.NewHTTP(conf.DmsgDisc, &http.Client{}, log, disc.WithProxy(proxyURL))
+		dmsgC := dmsg.NewClient(pk, sk, dc, &dmsg.Config{
+			MinSessions:      conf.DmsgSessions,
+			Proxy:            proxyURL,
+			PreferredServers: conf.PreferServers,
+			ExcludedServers:  conf.ExcludeServers,
+			StrictServers:    conf.StrictServers,
 		})
 		go dmsgC.Serve(context.Background())
 		select {
@@ -260,6 +282,22 @@ func configFromJSON(conf dmsgpty.Config) (dmsgpty.Config, error) {
 		conf.CLIAddr = dmsgpty.DefaultCLIAddr()
 	}
 
+	if jsonConf.Proxy != "" {
+		conf.Proxy = jsonConf.Proxy
+	}
+
+	if len(jsonConf.PreferServers) > 0 {
+		conf.PreferServers = jsonConf.PreferServers
+	}
+
+	if len(jsonConf.ExcludeServers) > 0 {
+		conf.ExcludeServers = jsonConf.ExcludeServers
+	}
+
+	if jsonConf.StrictServers {
+		conf.StrictServers = true
+	}
+
 	return conf, nil
 }
 
@@ -295,6 +333,34 @@ func fillConfigFromENV(conf dmsgpty.Config) (dmsgpty.Config, error) {
 		conf.CLIAddr = val
 	}
 
+	if val, ok := os.LookupEnv(envPrefix + "_PROXY"); ok {
+		conf.Proxy = val
+	}
+
+	if val, ok := os.LookupEnv(envPrefix + "_PREFERSERVERS"); ok {
+		var pks cipher.PubKeys
+		if err := pks.Set(val); err != nil {
+			return conf, fmt.Errorf("failed to parse preferred dmsg servers: %w", err)
+		}
+		conf.PreferServers = pks
+	}
+
+	if val, ok := os.LookupEnv(envPrefix + "_EXCLUDESERVERS"); ok {
+		var pks cipher.PubKeys
+		if err := pks.Set(val); err != nil {
+			return conf, fmt.Errorf("failed to parse excluded dmsg servers: %w", err)
+		}
+		conf.ExcludeServers = pks
+	}
+
+	if val, ok := os.LookupEnv(envPrefix + "_STRICTSERVERS"); ok {
+		strict, err := strconv.ParseBool(val)
+		if err != nil {
+			return conf, fmt.Errorf("failed to parse strict dmsg servers: %w", err)
+		}
+		conf.StrictServers = strict
+	}
+
 	return conf, nil
 }
 
@@ -319,6 +385,22 @@ func fillConfigFromFlags(conf dmsgpty.Config) dmsgpty.Config {
 		conf.CLIAddr = cliAddr
 	}
 
+	if proxy != "" {
+		conf.Proxy = proxy
+	}
+
+	if len(preferServers) > 0 {
+		conf.PreferServers = preferServers
+	}
+
+	if len(excludeServers) > 0 {
+		conf.ExcludeServers = excludeServers
+	}
+
+	if strictServers {
+		conf.StrictServers = true
+	}
+
 	return conf
 }
 
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -85,6 +86,9 @@ func New(log logrus.FieldLogger, db store.Storer, m discmetrics.Metrics, testMod
 	r.Delete("/dmsg-discovery/deregister", api.deregisterEntry())
 	r.Get("/dmsg-discovery/available_servers", api.getAvailableServers())
 	r.Get("/dmsg-discovery/all_servers", api.getAllServers())
+	r.Get("/dmsg-discovery/services/{name}", api.getServices())
+	r.Get("/dmsg-discovery/name/{name}", api.getName())
+	r.Post("/dmsg-discovery/name", api.setName())
 	r.Get("/health", api.serviceHealth)
 
 	return api
@@ -412,6 +416,88 @@ func (a *API) getAllServers() http.HandlerFunc {
 	}
 }
 
+// getServices returns the entries of clients which offer the named service as an array of json codified entry objects
+// URI: /dmsg-discovery/services/:name
+// Method: GET
+func (a *API) getServices() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, err := url.PathUnescape(chi.URLParam(r, "name"))
+		if err != nil || name == "" {
+			a.handleError(w, r, disc.ErrBadInput)
+			return
+		}
+
+		entries, err := a.db.Services(r.Context(), name)
+		if err != nil {
+			a.handleError(w, r, err)
+			return
+		}
+
+		a.writeJSON(w, r, http.StatusOK, entries)
+	}
+}
+
+// getName returns the record of a registered name
+// URI: /dmsg-discovery/name/:name
+// Method: GET
+func (a *API) getName() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, err := url.PathUnescape(chi.URLParam(r, "name"))
+		if err != nil || !disc.ValidName(name) {
+			a.handleError(w, r, disc.ErrValidationInvalidName)
+			return
+		}
+
+		record, err := a.db.NameRecord(r.Context(), name)
+		if err != nil {
+			a.handleError(w, r, err)
+			return
+		}
+
+		a.writeJSON(w, r, http.StatusOK, record)
+	}
+}
+
+// setName registers or renews a name
+// Names are registered first-come, first-served. Only the owner of a registered name can renew it.
+// URI: /dmsg-discovery/name
+// Method: POST
+// Args:
+//
+//	json serialized name record object
+func (a *API) setName() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := r.Body.Close(); err != nil {
+				log.WithError(err).Warn("Failed to decode HTTP response body")
+			}
+		}()
+
+		record := new(disc.NameRecord)
+		if err := json.NewDecoder(r.Body).Decode(record); err != nil {
+			a.handleError(w, r, disc.ErrBadInput)
+			return
+		}
+
+		if err := record.Validate(); err != nil {
+			a.handleError(w, r, err)
+			return
+		}
+		if err := record.VerifySignature(); err != nil {
+			a.handleError(w, r, disc.ErrUnauthorized)
+			return
+		}
+
+		// Ownership and timestamp of the current record are checked by the store.
+		if err := a.db.SetNameRecord(r.Context(), record); err != nil {
+			a.handleError(w, r, err)
+			return
+		}
+
+		a.writeJSON(w, r, http.StatusOK, disc.MsgNameSet)
+	}
+}
+
 func (a *API) serviceHealth(w http.ResponseWriter, r *http.Request) {
 	info := buildinfo.Get()
 	a.writeJSON(w, r, http.StatusOK, httputil.HealthCheckResponse{
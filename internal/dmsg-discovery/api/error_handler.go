@@ -24,6 +24,14 @@ var apiErrors = map[error]func() (int, string){
 	disc.ErrBadInput: func() (int, string) {
 		return http.StatusBadRequest, disc.ErrBadInput.Error()
 	},
+
+	disc.ErrNameNotFound: func() (int, string) {
+		return http.StatusNotFound, disc.ErrNameNotFound.Error()
+	},
+
+	disc.ErrNameTaken: func() (int, string) {
+		return http.StatusConflict, disc.ErrNameTaken.Error()
+	},
 }
 
 func (a *API) handleError(w http.ResponseWriter, r *http.Request, e error) {
@@ -0,0 +1,60 @@
+// Package api internal/dmsg-discovery/api/get_services_test.go
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/skycoin/skywire-utilities/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/dmsg/internal/discmetrics"
+	store2 "github.com/skycoin/dmsg/internal/dmsg-discovery/store"
+	"github.com/skycoin/dmsg/pkg/disc"
+)
+
+func TestGetServices(t *testing.T) {
+	ctx := context.TODO()
+	log := logging.MustGetLogger("test")
+	db, err := store2.NewStore(ctx, "mock", nil, log)
+	require.NoError(t, err)
+
+	api := New(nil, db, discmetrics.NewEmpty(), true, false, true, "")
+	srv := httptest.NewServer(api.Handler)
+	defer srv.Close()
+	dc := disc.NewHTTP(srv.URL, &http.Client{}, log)
+
+	// Post client entries, of which the first two offer the "site one" service.
+	services := [][]disc.Service{
+		{{Name: "site one", Port: 80, Protocol: "http", Metadata: map[string]string{"title": "one"}}},
+		{{Name: "pty", Port: 22, Protocol: "pty"}, {Name: "site one", Port: 8080, Protocol: "http"}},
+		{{Name: "pty", Port: 22, Protocol: "pty"}},
+	}
+	pks := make([]cipher.PubKey, len(services))
+	for i, svcs := range services {
+		pk, sk := cipher.GenerateKeyPair()
+		entry := disc.NewClientEntry(pk, 0, []cipher.PubKey{})
+		entry.Client.Services = svcs
+		require.NoError(t, entry.Sign(sk))
+		require.NoError(t, dc.PostEntry(ctx, entry))
+		pks[i] = pk
+	}
+
+	entries, err := dc.Services(ctx, "site one")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	for _, entry := range entries {
+		assert.Contains(t, pks[:2], entry.Static)
+		svc, ok := entry.Client.Service("site one")
+		require.True(t, ok)
+		assert.Equal(t, "http", svc.Protocol)
+	}
+
+	entries, err = dc.Services(ctx, "unknown")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
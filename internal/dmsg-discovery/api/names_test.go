@@ -0,0 +1,102 @@
+// Package api internal/dmsg-discovery/api/names_test.go
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/skycoin/skywire-utilities/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/dmsg/internal/discmetrics"
+	store2 "github.com/skycoin/dmsg/internal/dmsg-discovery/store"
+	"github.com/skycoin/dmsg/pkg/disc"
+)
+
+func TestNames(t *testing.T) {
+	const name = "my-site"
+
+	ctx := context.TODO()
+	log := logging.MustGetLogger("test")
+	db, err := store2.NewStore(ctx, "mock", nil, log)
+	require.NoError(t, err)
+
+	api := New(nil, db, discmetrics.NewEmpty(), true, false, true, "")
+	srv := httptest.NewServer(api.Handler)
+	defer srv.Close()
+	dc := disc.NewHTTP(srv.URL, &http.Client{}, log)
+
+	pk1, sk1 := cipher.GenerateKeyPair()
+	pk2, sk2 := cipher.GenerateKeyPair()
+
+	newRecord := func(name string, pk cipher.PubKey, sk cipher.SecKey) *disc.NameRecord {
+		record := disc.NewNameRecord(name, pk)
+		require.NoError(t, record.Sign(sk))
+		return record
+	}
+
+	t.Run("not_found", func(t *testing.T) {
+		_, err := dc.Resolve(ctx, name)
+		assert.Equal(t, disc.ErrNameNotFound, err)
+	})
+
+	t.Run("register", func(t *testing.T) {
+		record := newRecord(name, pk1, sk1)
+		require.NoError(t, dc.PostName(ctx, record))
+
+		pk, err := dc.Resolve(ctx, name)
+		require.NoError(t, err)
+		assert.Equal(t, pk1, pk)
+
+		// Records of the same (or an older) timestamp are rejected.
+		assert.Equal(t, disc.ErrValidationWrongTime, dc.PostName(ctx, record))
+	})
+
+	t.Run("taken", func(t *testing.T) {
+		assert.Equal(t, disc.ErrNameTaken, dc.PostName(ctx, newRecord(name, pk2, sk2)))
+
+		pk, err := dc.Resolve(ctx, name)
+		require.NoError(t, err)
+		assert.Equal(t, pk1, pk)
+	})
+
+	t.Run("renew", func(t *testing.T) {
+		time.Sleep(time.Millisecond)
+		require.NoError(t, dc.PostName(ctx, newRecord(name, pk1, sk1)))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		assert.Equal(t, disc.ErrValidationInvalidName, dc.PostName(ctx, newRecord("Not A Name", pk2, sk2)))
+
+		// Records must be signed by the public key which the name resolves to.
+		record := newRecord("other-site", pk2, sk1)
+		assert.Error(t, dc.PostName(ctx, record))
+		_, err := dc.Resolve(ctx, "other-site")
+		assert.Equal(t, disc.ErrNameNotFound, err)
+	})
+	t.Run("concurrent", func(t *testing.T) {
+		const n = 10
+		errCh := make(chan error, n)
+		for i := 0; i < n; i++ {
+			pk, sk := cipher.GenerateKeyPair()
+			record := newRecord("contested-site", pk, sk)
+			go func() { errCh <- dc.PostName(ctx, record) }()
+		}
+
+		// Exactly one of the concurrent registrations of a new name succeeds.
+		registered := 0
+		for i := 0; i < n; i++ {
+			if err := <-errCh; err == nil {
+				registered++
+			} else {
+				assert.Equal(t, disc.ErrNameTaken, err)
+			}
+		}
+		assert.Equal(t, 1, registered)
+	})
+}
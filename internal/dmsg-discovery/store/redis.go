@@ -93,6 +93,15 @@ func (r *redisStore) SetEntry(ctx context.Context, entry *disc.Entry, timeout ti
 			return disc.ErrUnexpected
 		}
 	}
+	if entry.Client != nil {
+		for _, svc := range entry.Client.Services {
+			err = r.client.SAdd(ctx, serviceKey(svc.Name), entry.Static.Hex()).Err()
+			if err != nil {
+				log.WithError(err).Errorf("Failed to add to service (SAdd) from redis")
+				return disc.ErrUnexpected
+			}
+		}
+	}
 
 	return nil
 }
@@ -143,6 +152,12 @@ func (r *redisStore) AvailableServers(ctx context.Context, maxCount int) ([]*dis
 			continue
 		}
 
+		if entry.Server.Draining {
+			log.WithField("server_pk", entry.Static).
+				Debug("Server is draining. Skipping...")
+			continue
+		}
+
 		if entry.Server.AvailableSessions <= 0 {
 			log.WithField("server_pk", entry.Static).
 				Warn("Server is at max capacity. Skipping...")
@@ -233,3 +248,148 @@ func (r *redisStore) AllEntries(ctx context.Context) ([]string, error) {
 	}
 	return clients, err
 }
+
+// serviceKey returns the key of the set of PKs which offer the service of the given name.
+func serviceKey(name string) string {
+	return "service:" + name
+}
+
+// Services implements Storer Services method for redisdb database.
+// PKs of entries which expired or no longer offer the service are removed from the service set.
+func (r *redisStore) Services(ctx context.Context, name string) ([]*disc.Entry, error) {
+	entries := make([]*disc.Entry, 0)
+
+	pks, err := r.client.SMembers(ctx, serviceKey(name)).Result()
+	if err != nil {
+		log.WithError(err).Errorf("Failed to get service (SMembers) from redis")
+		return nil, disc.ErrUnexpected
+	}
+
+	if len(pks) == 0 {
+		return entries, nil
+	}
+
+	payloads, err := r.client.MGet(ctx, pks...).Result()
+	if err != nil {
+		log.WithError(err).Errorf("Failed to get service entries (MGet) from redis")
+		return nil, disc.ErrUnexpected
+	}
+
+	for i, payload := range payloads {
+		// if there's no record for this PK, nil is returned. The below
+		// type assertion will panic in this case, so we skip
+		if payload == nil {
+			r.client.SRem(ctx, serviceKey(name), pks[i])
+			continue
+		}
+
+		var entry *disc.Entry
+		if err := json.Unmarshal([]byte(payload.(string)), &entry); err != nil {
+			log.WithError(err).Warnf("Failed to unmarshal payload %s", payload.(string))
+			continue
+		}
+
+		if entry.Client == nil {
+			r.client.SRem(ctx, serviceKey(name), pks[i])
+			continue
+		}
+		if _, ok := entry.Client.Service(name); !ok {
+			r.client.SRem(ctx, serviceKey(name), pks[i])
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// nameKey returns the key of the record of the given name.
+func nameKey(name string) string {
+	return "name:" + name
+}
+
+// NameRecord implements Storer NameRecord method for redisdb database
+func (r *redisStore) NameRecord(ctx context.Context, name string) (*disc.NameRecord, error) {
+	payload, err := r.client.Get(ctx, nameKey(name)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, disc.ErrNameNotFound
+		}
+
+		log.WithError(err).WithField("name", name).Errorf("Failed to get name record from redis")
+		return nil, disc.ErrUnexpected
+	}
+
+	var record disc.NameRecord
+	if err := json.Unmarshal(payload, &record); err != nil {
+		log.WithError(err).Warnf("Failed to unmarshal payload %q", payload)
+		return nil, disc.ErrUnexpected
+	}
+
+	return &record, nil
+}
+
+// nameRecordRetries is the number of times which setting a name record is retried, when the record is changed
+// concurrently.
+const nameRecordRetries = 5
+
+// SetNameRecord implements Storer SetNameRecord method for redisdb database
+// New names are set with SET NX. Renewals are set in a transaction which is watching the current record, so that the
+// checks of ownership and timestamp are not raced by concurrent requests.
+func (r *redisStore) SetNameRecord(ctx context.Context, record *disc.NameRecord) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return disc.ErrUnexpected
+	}
+	key := nameKey(record.Name)
+
+	txf := func(tx *redis.Tx) error {
+		oldPayload, err := tx.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			ok, err := tx.SetNX(ctx, key, payload, time.Until(record.Expiry())).Result()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return redis.TxFailedErr
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var oldRecord disc.NameRecord
+		if err := json.Unmarshal(oldPayload, &oldRecord); err != nil {
+			return err
+		}
+		if err := checkNameRecord(&oldRecord, record); err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, payload, time.Until(record.Expiry()))
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < nameRecordRetries; i++ {
+		err = r.client.Watch(ctx, txf, key)
+		switch err {
+		case nil:
+			return nil
+		case redis.TxFailedErr:
+			continue
+		case disc.ErrNameTaken, disc.ErrValidationWrongTime:
+			return err
+		default:
+			log.WithError(err).Errorf("Failed to set name record in redis")
+			return disc.ErrUnexpected
+		}
+	}
+
+	log.WithField("name", record.Name).Warn("Name record is changed concurrently, giving up.")
+	return disc.ErrUnexpected
+}
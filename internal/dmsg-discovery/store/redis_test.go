@@ -143,3 +143,27 @@ func TestRedisCountEntries(t *testing.T) {
 	assert.Equal(t, numberOfServers, int64(1))
 	assert.Equal(t, numberOfClients, int64(1))
 }
+
+func TestRedisSetNameRecord(t *testing.T) {
+	ctx := context.TODO()
+	log := logging.MustGetLogger("test")
+	redis, err := newRedis(ctx, redisURL, redisPassword, 0, log)
+	require.NoError(t, err)
+	require.NoError(t, redis.(*redisStore).client.FlushDB(ctx).Err())
+
+	pk1, _ := cipher.GenerateKeyPair()
+	pk2, _ := cipher.GenerateKeyPair()
+
+	record := disc.NewNameRecord("my-site", pk1)
+	require.NoError(t, redis.SetNameRecord(ctx, record))
+	assert.Equal(t, disc.ErrValidationWrongTime, redis.SetNameRecord(ctx, record))
+	assert.Equal(t, disc.ErrNameTaken, redis.SetNameRecord(ctx, disc.NewNameRecord("my-site", pk2)))
+
+	renewed := disc.NewNameRecord("my-site", pk1)
+	renewed.Timestamp = record.Timestamp + 1
+	require.NoError(t, redis.SetNameRecord(ctx, renewed))
+
+	res, err := redis.NameRecord(ctx, "my-site")
+	require.NoError(t, err)
+	assert.Equal(t, renewed, res)
+}
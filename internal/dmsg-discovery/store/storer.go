@@ -46,6 +46,29 @@ type Storer interface {
 
 	// AllEntries returns all clients PKs.
 	AllEntries(ctx context.Context) ([]string, error)
+
+	// Services returns the entries of clients which offer a service of the given name.
+	Services(ctx context.Context, name string) ([]*disc.Entry, error)
+
+	// NameRecord obtains the record of a registered name.
+	NameRecord(ctx context.Context, name string) (*disc.NameRecord, error)
+
+	// SetNameRecord sets the record of a name, until the record expires.
+	// It fails with disc.ErrNameTaken if the name is registered to another public key, and with
+	// disc.ErrValidationWrongTime if the record is not newer than the current one. The checks and the update are atomic.
+	// The signature of the record is not checked.
+	SetNameRecord(ctx context.Context, record *disc.NameRecord) error
+}
+
+// checkNameRecord checks whether the record may replace the current record of the name.
+func checkNameRecord(cur, record *disc.NameRecord) error {
+	if cur.PK != record.PK {
+		return disc.ErrNameTaken
+	}
+	if record.Timestamp <= cur.Timestamp {
+		return disc.ErrValidationWrongTime
+	}
+	return nil
 }
 
 // Config configures the Store object.
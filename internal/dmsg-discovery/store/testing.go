@@ -17,6 +17,7 @@ type MockStore struct {
 	serversLock sync.RWMutex
 	m           map[string][]byte
 	servers     map[string][]byte
+	names       map[string]disc.NameRecord
 }
 
 func (ms *MockStore) setEntry(staticPubKey string, payload []byte) {
@@ -53,6 +54,7 @@ func NewMock() Storer {
 	return &MockStore{
 		m:       map[string][]byte{},
 		servers: map[string][]byte{},
+		names:   map[string]disc.NameRecord{},
 	}
 }
 
@@ -217,3 +219,54 @@ func (ms *MockStore) AllEntries(ctx context.Context) ([]string, error) {
 	}
 	return entries, nil
 }
+
+// Services implements Storer Services method for MockStore
+func (ms *MockStore) Services(ctx context.Context, name string) ([]*disc.Entry, error) {
+	entries := make([]*disc.Entry, 0)
+
+	ms.mLock.RLock()
+	defer ms.mLock.RUnlock()
+
+	for _, entryString := range arrayFromMap(ms.m) {
+		var e disc.Entry
+
+		err := json.Unmarshal(entryString, &e)
+		if err != nil {
+			return nil, disc.ErrUnexpected
+		}
+
+		if e.Client == nil {
+			continue
+		}
+		if _, ok := e.Client.Service(name); ok {
+			entries = append(entries, &e)
+		}
+	}
+	return entries, nil
+}
+
+// NameRecord implements Storer NameRecord method for MockStore
+func (ms *MockStore) NameRecord(ctx context.Context, name string) (*disc.NameRecord, error) {
+	ms.mLock.RLock()
+	defer ms.mLock.RUnlock()
+
+	record, ok := ms.names[name]
+	if !ok || time.Now().After(record.Expiry()) {
+		return nil, disc.ErrNameNotFound
+	}
+	return &record, nil
+}
+
+// SetNameRecord implements Storer SetNameRecord method for MockStore
+func (ms *MockStore) SetNameRecord(ctx context.Context, record *disc.NameRecord) error {
+	ms.mLock.Lock()
+	defer ms.mLock.Unlock()
+
+	if cur, ok := ms.names[record.Name]; ok && time.Now().Before(cur.Expiry()) {
+		if err := checkNameRecord(&cur, record); err != nil {
+			return err
+		}
+	}
+	ms.names[record.Name] = *record
+	return nil
+}
@@ -0,0 +1,273 @@
+// Package api internal/dmsg-server/api/admin.go
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/skycoin/skywire-utilities/pkg/httputil"
+)
+
+// Headers of signed admin requests.
+// The signature is over the payload returned by AdminPayload, and is made by the secret key of an admin public key.
+const (
+	AdminPKHeader        = "Admin-PK"
+	AdminTimestampHeader = "Admin-Timestamp"
+	AdminSignHeader      = "Admin-Sign"
+)
+
+// AdminRequestMaxAge is the maximum difference between the timestamp of a signed admin request and the time that the
+// server receives it.
+const AdminRequestMaxAge = time.Minute
+
+// maxAdminBodySize is the maximum size of the body of an admin request.
+const maxAdminBodySize = 1 << 20
+
+var (
+	errAdminUnauthorized = errors.New("admin request is not signed by an admin public key")
+	errAdminExpired      = errors.New("admin request timestamp is too old or too far in the future")
+	errAdminReplayed     = errors.New("admin request is already served")
+)
+
+// BanRequest is the body of a request to ban a public key.
+type BanRequest struct {
+	PK       cipher.PubKey `json:"pk"`
+	Duration time.Duration `json:"duration"`
+}
+
+// BanInfo describes a banned public key.
+type BanInfo struct {
+	PK     cipher.PubKey `json:"pk"`
+	Expiry time.Time     `json:"expiry"`
+}
+
+// AdminPayload returns the payload which is signed for an admin request.
+// 'uri' is the request URI (path and query) and 'ts' is the unix timestamp (in nanoseconds) of the request.
+func AdminPayload(method, uri string, ts int64, body []byte) []byte {
+	payload := []byte(fmt.Sprintf("%s\n%s\n%d\n", method, uri, ts))
+	return append(payload, body...)
+}
+
+// SignAdminRequest signs the request with the admin key pair.
+// 'body' should be the body of the request.
+func SignAdminRequest(req *http.Request, body []byte, pk cipher.PubKey, sk cipher.SecKey) error {
+	ts := time.Now().UnixNano()
+	sig, err := cipher.SignPayload(AdminPayload(req.Method, req.URL.RequestURI(), ts, body), sk)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(AdminPKHeader, pk.Hex())
+	req.Header.Set(AdminTimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(AdminSignHeader, sig.Hex())
+	return nil
+}
+
+// EnableAdmin serves the admin endpoints under '/admin'.
+// Admin requests need to be signed (see SignAdminRequest) by one of the admin public keys.
+func (a *API) EnableAdmin(adminPKs []cipher.PubKey) {
+	pks := make(map[cipher.PubKey]struct{}, len(adminPKs))
+	for _, pk := range adminPKs {
+		pks[pk] = struct{}{}
+	}
+
+	a.router.Route("/admin", func(r chi.Router) {
+		r.Use(a.adminAuth(pks, newAdminReplays()))
+		r.Get("/sessions", a.listSessions)
+		r.Delete("/sessions/{pk}", a.closeSession)
+		r.Get("/streams", a.listStreams)
+		r.Delete("/streams/{id}", a.closeStream)
+		r.Get("/bans", a.listBans)
+		r.Post("/bans", a.ban)
+		r.Delete("/bans/{pk}", a.unban)
+	})
+}
+
+// adminReplays remembers the signed admin requests which are served, until their timestamps expire.
+// Requests are identified by the hash of the signed payload rather than the signature, so that the same request with
+// a malleated signature is also rejected.
+type adminReplays struct {
+	seen map[cipher.SHA256]time.Time // expiry of each served request
+	mx   sync.Mutex
+}
+
+func newAdminReplays() *adminReplays {
+	return &adminReplays{seen: make(map[cipher.SHA256]time.Time)}
+}
+
+// add records the request of the given signed payload and timestamp.
+// It returns false if the request is already recorded.
+func (ar *adminReplays) add(pk cipher.PubKey, payload []byte, ts int64) bool {
+	now := time.Now()
+	h := cipher.SumSHA256(append(pk[:], payload...))
+
+	ar.mx.Lock()
+	defer ar.mx.Unlock()
+
+	for k, expiry := range ar.seen {
+		if now.After(expiry) {
+			delete(ar.seen, k)
+		}
+	}
+	if _, ok := ar.seen[h]; ok {
+		return false
+	}
+	ar.seen[h] = time.Unix(0, ts).Add(AdminRequestMaxAge)
+	return true
+}
+
+// adminAuth only lets through requests which are signed by one of the admin public keys.
+// Each signed request is only served once.
+func (a *API) adminAuth(adminPKs map[cipher.PubKey]struct{}, replays *adminReplays) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var pk cipher.PubKey
+			if err := pk.UnmarshalText([]byte(r.Header.Get(AdminPKHeader))); err != nil {
+				a.writeError(w, r, http.StatusUnauthorized, errAdminUnauthorized)
+				return
+			}
+			if _, ok := adminPKs[pk]; !ok {
+				a.writeError(w, r, http.StatusForbidden, errAdminUnauthorized)
+				return
+			}
+
+			ts, err := strconv.ParseInt(r.Header.Get(AdminTimestampHeader), 10, 64)
+			if err != nil {
+				a.writeError(w, r, http.StatusBadRequest, fmt.Errorf("invalid %s header: %w", AdminTimestampHeader, err))
+				return
+			}
+			if age := time.Since(time.Unix(0, ts)); age > AdminRequestMaxAge || age < -AdminRequestMaxAge {
+				a.writeError(w, r, http.StatusUnauthorized, errAdminExpired)
+				return
+			}
+
+			var sig cipher.Sig
+			if err := sig.UnmarshalText([]byte(r.Header.Get(AdminSignHeader))); err != nil {
+				a.writeError(w, r, http.StatusBadRequest, fmt.Errorf("invalid %s header: %w", AdminSignHeader, err))
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxAdminBodySize))
+			if err != nil {
+				a.writeError(w, r, http.StatusBadRequest, err)
+				return
+			}
+			payload := AdminPayload(r.Method, r.URL.RequestURI(), ts, body)
+			if err := cipher.VerifyPubKeySignedPayload(pk, sig, payload); err != nil {
+				a.writeError(w, r, http.StatusUnauthorized, errAdminUnauthorized)
+				return
+			}
+			if !replays.add(pk, payload, ts) {
+				a.writeError(w, r, http.StatusUnauthorized, errAdminReplayed)
+				return
+			}
+
+			a.log(r).WithField("admin_pk", pk).WithField("method", r.Method).WithField("uri", r.URL.RequestURI()).
+				Info("Serving admin request.")
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// listSessions lists the sessions of the dmsg server.
+// URI: /admin/sessions
+// Method: GET
+func (a *API) listSessions(w http.ResponseWriter, r *http.Request) {
+	a.writeJSON(w, r, http.StatusOK, a.dmsgServer.Sessions())
+}
+
+// closeSession closes the session with the given remote public key.
+// URI: /admin/sessions/:pk
+// Method: DELETE
+func (a *API) closeSession(w http.ResponseWriter, r *http.Request) {
+	var pk cipher.PubKey
+	if err := pk.UnmarshalText([]byte(chi.URLParam(r, "pk"))); err != nil {
+		a.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := a.dmsgServer.CloseSession(pk); err != nil {
+		a.writeError(w, r, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listStreams lists the streams which are forwarded by the dmsg server.
+// URI: /admin/streams
+// Method: GET
+func (a *API) listStreams(w http.ResponseWriter, r *http.Request) {
+	a.writeJSON(w, r, http.StatusOK, a.dmsgServer.Streams())
+}
+
+// closeStream closes the forwarded stream of the given ID.
+// URI: /admin/streams/:id
+// Method: DELETE
+func (a *API) closeStream(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		a.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := a.dmsgServer.CloseStream(id); err != nil {
+		a.writeError(w, r, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listBans lists the banned public keys.
+// URI: /admin/bans
+// Method: GET
+func (a *API) listBans(w http.ResponseWriter, r *http.Request) {
+	bans := a.dmsgServer.Bans()
+	out := make([]BanInfo, 0, len(bans))
+	for pk, expiry := range bans {
+		out = append(out, BanInfo{PK: pk, Expiry: expiry})
+	}
+	a.writeJSON(w, r, http.StatusOK, out)
+}
+
+// ban bans a public key for a duration.
+// URI: /admin/bans
+// Method: POST
+func (a *API) ban(w http.ResponseWriter, r *http.Request) {
+	var req BanRequest
+	if err := httputil.ReadJSON(r, &req); err != nil {
+		a.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if req.PK.Null() || req.Duration <= 0 {
+		a.writeError(w, r, http.StatusBadRequest, errors.New("ban requires a public key and a positive duration"))
+		return
+	}
+	a.dmsgServer.Ban(req.PK, req.Duration)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unban lifts the ban of a public key.
+// URI: /admin/bans/:pk
+// Method: DELETE
+func (a *API) unban(w http.ResponseWriter, r *http.Request) {
+	var pk cipher.PubKey
+	if err := pk.UnmarshalText([]byte(chi.URLParam(r, "pk"))); err != nil {
+		a.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if !a.dmsgServer.Unban(pk) {
+		a.writeError(w, r, http.StatusNotFound, errors.New("public key is not banned"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) writeError(w http.ResponseWriter, r *http.Request, code int, err error) {
+	a.writeJSON(w, r, code, httputil.Error{Error: err.Error()})
+}
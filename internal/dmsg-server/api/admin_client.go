@@ -0,0 +1,107 @@
+// Package api internal/dmsg-server/api/admin_client.go
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/skycoin/skywire-utilities/pkg/httputil"
+
+	dmsg "github.com/skycoin/dmsg/pkg/dmsg"
+)
+
+// AdminClient calls the admin endpoints of a dmsg server.
+type AdminClient struct {
+	addr   string
+	pk     cipher.PubKey
+	sk     cipher.SecKey
+	client *http.Client
+}
+
+// NewAdminClient creates an AdminClient for the server API at 'addr' (e.g. "http://127.0.0.1:8082").
+// Requests are signed with the admin secret key 'sk'.
+func NewAdminClient(addr string, sk cipher.SecKey, client *http.Client) (*AdminClient, error) {
+	pk, err := sk.PubKey()
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &AdminClient{addr: addr, pk: pk, sk: sk, client: client}, nil
+}
+
+// Sessions lists the sessions of the dmsg server.
+func (c *AdminClient) Sessions() (out []dmsg.SessionInfo, err error) {
+	return out, c.do(http.MethodGet, "/admin/sessions", nil, &out)
+}
+
+// CloseSession closes the session with the remote public key 'pk'.
+func (c *AdminClient) CloseSession(pk cipher.PubKey) error {
+	return c.do(http.MethodDelete, "/admin/sessions/"+pk.Hex(), nil, nil)
+}
+
+// Streams lists the streams which are forwarded by the dmsg server.
+func (c *AdminClient) Streams() (out []dmsg.StreamInfo, err error) {
+	return out, c.do(http.MethodGet, "/admin/streams", nil, &out)
+}
+
+// CloseStream closes the forwarded stream of the given ID.
+func (c *AdminClient) CloseStream(id uint64) error {
+	return c.do(http.MethodDelete, "/admin/streams/"+strconv.FormatUint(id, 10), nil, nil)
+}
+
+// Bans lists the banned public keys.
+func (c *AdminClient) Bans() (out []BanInfo, err error) {
+	return out, c.do(http.MethodGet, "/admin/bans", nil, &out)
+}
+
+// Ban bans the public key 'pk' for the duration 'd'.
+func (c *AdminClient) Ban(pk cipher.PubKey, d time.Duration) error {
+	return c.do(http.MethodPost, "/admin/bans", BanRequest{PK: pk, Duration: d}, nil)
+}
+
+// Unban lifts the ban of the public key 'pk'.
+func (c *AdminClient) Unban(pk cipher.PubKey) error {
+	return c.do(http.MethodDelete, "/admin/bans/"+pk.Hex(), nil, nil)
+}
+
+// do sends a signed admin request with the JSON encoded 'in' (if non-nil) as body, and decodes the JSON response
+// into 'out' (if non-nil).
+func (c *AdminClient) do(method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, c.addr+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if err := SignAdminRequest(req, body, c.pk, c.sk); err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }() //nolint:errcheck
+
+	if err := httputil.ErrorFromResp(resp); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,146 @@
+// Package api internal/dmsg-server/api/admin_test.go
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/skycoin/skywire-utilities/pkg/httputil"
+	"github.com/skycoin/skywire-utilities/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/dmsg/internal/servermetrics"
+	"github.com/skycoin/dmsg/pkg/disc"
+	dmsg "github.com/skycoin/dmsg/pkg/dmsg"
+)
+
+func TestAdminAPI(t *testing.T) {
+	const port = uint16(80)
+
+	dc := disc.NewMock(0)
+	tp := dmsg.NewPipeTransport()
+
+	srvPK, srvSK := cipher.GenerateKeyPair()
+	srv := dmsg.NewServer(srvPK, srvSK, dc, &dmsg.ServerConfig{MaxSessions: 10, Transport: tp}, nil)
+	chSrv := make(chan error, 1)
+	go func() { chSrv <- srv.ListenAndServe("admin server", "admin server") }()
+	defer func() {
+		assert.NoError(t, srv.Close())
+		assert.NoError(t, <-chSrv)
+	}()
+	<-srv.Ready()
+
+	adminPK, adminSK := cipher.GenerateKeyPair()
+	a := New(chi.NewRouter(), logging.MustGetLogger("admin api"), servermetrics.NewEmpty())
+	a.SetDmsgServer(srv)
+	a.EnableAdmin([]cipher.PubKey{adminPK})
+	httpSrv := httptest.NewServer(a.router)
+	defer httpSrv.Close()
+
+	admin, err := NewAdminClient(httpSrv.URL, adminSK, nil)
+	require.NoError(t, err)
+
+	// Connect clients, and dial a stream between them.
+	srvEntry, err := dc.Entry(context.TODO(), srvPK)
+	require.NoError(t, err)
+	newClient := func() *dmsg.Client {
+		pk, sk := cipher.GenerateKeyPair()
+		c := dmsg.NewClient(pk, sk, dc, &dmsg.Config{Transport: tp})
+		require.NoError(t, c.EnsureSession(context.TODO(), srvEntry))
+		return c
+	}
+	client1 := newClient()
+	defer func() { assert.NoError(t, client1.Close()) }()
+	client2 := newClient()
+	defer func() { assert.NoError(t, client2.Close()) }()
+
+	lis, err := client2.Listen(port)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, lis.Close()) }()
+	str, err := client1.DialStream(context.TODO(), dmsg.Addr{PK: client2.LocalPK(), Port: port})
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, str.Close()) }()
+
+	t.Run("unauthorized", func(t *testing.T) {
+		_, otherSK := cipher.GenerateKeyPair()
+		other, err := NewAdminClient(httpSrv.URL, otherSK, nil)
+		require.NoError(t, err)
+		_, err = other.Sessions()
+		var hErr *httputil.HTTPError
+		require.True(t, errors.As(err, &hErr))
+		assert.Equal(t, http.StatusForbidden, hErr.Status)
+
+		// Requests with a stale timestamp are rejected, even if they are signed by an admin.
+		req, err := http.NewRequest(http.MethodGet, httpSrv.URL+"/admin/sessions", nil)
+		require.NoError(t, err)
+		ts := time.Now().Add(-2 * AdminRequestMaxAge).UnixNano()
+		sig, err := cipher.SignPayload(AdminPayload(req.Method, req.URL.RequestURI(), ts, nil), adminSK)
+		require.NoError(t, err)
+		req.Header.Set(AdminPKHeader, adminPK.Hex())
+		req.Header.Set(AdminTimestampHeader, strconv.FormatInt(ts, 10))
+		req.Header.Set(AdminSignHeader, sig.Hex())
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		// Signed requests are only served once.
+		req, err = http.NewRequest(http.MethodGet, httpSrv.URL+"/admin/sessions", nil)
+		require.NoError(t, err)
+		require.NoError(t, SignAdminRequest(req, nil, adminPK, adminSK))
+		for _, status := range []int{http.StatusOK, http.StatusUnauthorized} {
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, status, resp.StatusCode)
+		}
+	})
+
+	t.Run("sessions", func(t *testing.T) {
+		sessions, err := admin.Sessions()
+		require.NoError(t, err)
+		require.Len(t, sessions, 2)
+		for _, ses := range sessions {
+			assert.Equal(t, 1, ses.Streams)
+			assert.NotZero(t, ses.BytesReceived)
+		}
+	})
+
+	t.Run("streams", func(t *testing.T) {
+		streams, err := admin.Streams()
+		require.NoError(t, err)
+		require.Len(t, streams, 1)
+		assert.Equal(t, str.RawLocalAddr(), streams[0].SrcAddr)
+		assert.Equal(t, str.RawRemoteAddr(), streams[0].DstAddr)
+
+		require.NoError(t, admin.CloseStream(streams[0].ID))
+		require.Eventually(t, func() bool { return len(srv.Streams()) == 0 }, 5*time.Second, 10*time.Millisecond)
+		require.Error(t, admin.CloseStream(streams[0].ID))
+	})
+
+	t.Run("bans", func(t *testing.T) {
+		require.NoError(t, admin.Ban(client1.LocalPK(), time.Hour))
+		bans, err := admin.Bans()
+		require.NoError(t, err)
+		require.Len(t, bans, 1)
+		assert.Equal(t, client1.LocalPK(), bans[0].PK)
+
+		// The session of the banned client is closed, and streams to it are denied.
+		require.Eventually(t, func() bool { return len(srv.GetSessions()) == 1 }, 5*time.Second, 10*time.Millisecond)
+		require.Error(t, admin.CloseSession(client1.LocalPK()))
+		_, err = client2.DialStream(context.TODO(), dmsg.Addr{PK: client1.LocalPK(), Port: port})
+		require.Error(t, err)
+
+		require.NoError(t, admin.Unban(client1.LocalPK()))
+		require.Error(t, admin.Unban(client1.LocalPK()))
+		require.NoError(t, admin.CloseSession(client2.LocalPK()))
+	})
+}
@@ -4,10 +4,9 @@ package api
 import (
 	"context"
 	"encoding/json"
-	"math"
-	"math/big"
 	"net"
 	"net/http"
+	"net/url"
 	"sync"
 	"time"
 
@@ -25,27 +24,23 @@ import (
 
 // API main object of the server
 type API struct {
-	metrics         servermetrics.Metrics
-	startedAt       time.Time
-	dmsgServer      *dmsg.Server
-	sMu             sync.Mutex
-	minuteDecValues map[*dmsg.SessionCommon]uint64
-	minuteEncValues map[*dmsg.SessionCommon]uint64
-	secondDecValues map[*dmsg.SessionCommon]uint64
-	secondEncValues map[*dmsg.SessionCommon]uint64
-	router          *chi.Mux
+	metrics     servermetrics.Metrics
+	startedAt   time.Time
+	dmsgServer  *dmsg.Server
+	sMu         sync.Mutex
+	minuteStats map[*dmsg.SessionCommon]dmsg.Stats
+	secondStats map[*dmsg.SessionCommon]dmsg.Stats
+	router      *chi.Mux
 }
 
 // New returns a new API object, which can be started as a server
 func New(r *chi.Mux, log *logging.Logger, m servermetrics.Metrics) *API {
 	api := &API{
-		metrics:         m,
-		startedAt:       time.Now(),
-		minuteDecValues: make(map[*dmsg.SessionCommon]uint64),
-		minuteEncValues: make(map[*dmsg.SessionCommon]uint64),
-		secondDecValues: make(map[*dmsg.SessionCommon]uint64),
-		secondEncValues: make(map[*dmsg.SessionCommon]uint64),
-		router:          r,
+		metrics:     m,
+		startedAt:   time.Now(),
+		minuteStats: make(map[*dmsg.SessionCommon]dmsg.Stats),
+		secondStats: make(map[*dmsg.SessionCommon]dmsg.Stats),
+		router:      r,
 	}
 	r.Use(httputil.SetLoggerMiddleware(log))
 	r.Get("/health", api.health)
@@ -55,10 +50,10 @@ func New(r *chi.Mux, log *logging.Logger, m servermetrics.Metrics) *API {
 // RunBackgroundTasks is function which runs periodic tasks of dmsg-server.
 func (a *API) RunBackgroundTasks(ctx context.Context) {
 	ticker := time.NewTicker(time.Second * 10)
-	//tickerEverySecond := time.NewTicker(time.Second * 1)
+	tickerEverySecond := time.NewTicker(time.Second * 1)
 	tickerEveryMinute := time.NewTicker(time.Second * 60)
 	defer ticker.Stop()
-	//defer tickerEverySecond.Stop()
+	defer tickerEverySecond.Stop()
 	defer tickerEveryMinute.Stop()
 	a.updateInternalState()
 	for {
@@ -68,9 +63,9 @@ func (a *API) RunBackgroundTasks(ctx context.Context) {
 		case <-ticker.C:
 			a.updateInternalState()
 		case <-tickerEveryMinute.C:
-			a.updateAverageNumberOfPacketsPerMinute()
-			/*case <-tickerEverySecond.C:
-			a.updateAverageNumberOfPacketsPerSecond()*/
+			a.updateThroughputPerMinute()
+		case <-tickerEverySecond.C:
+			a.updateThroughputPerSecond()
 		}
 	}
 }
@@ -81,10 +76,11 @@ func (a *API) SetDmsgServer(srv *dmsg.Server) {
 }
 
 // ListenAndServe runs dmsg Serve function alongside health endpoint
-func (a *API) ListenAndServe(lAddr, pAddr, httpAddr string) error {
+// If 'wsAddr' is not empty, dmsg sessions are also accepted over WebSocket on the path of the 'wsAddr' URL.
+func (a *API) ListenAndServe(lAddr, pAddr, httpAddr, wsAddr string) error {
 	errCh := make(chan error)
 
-	dmsgLn, err := net.Listen("tcp", lAddr)
+	dmsgLn, err := a.dmsgServer.Transport().Listen(lAddr)
 	if err != nil {
 		return err
 	}
@@ -102,6 +98,25 @@ func (a *API) ListenAndServe(lAddr, pAddr, httpAddr string) error {
 	}
 	lis := &proxyproto.Listener{Listener: ln}
 	defer lis.Close() // nolint:errcheck
+
+	if wsAddr != "" {
+		u, err := url.Parse(wsAddr)
+		if err != nil {
+			return err
+		}
+		path := u.Path
+		if path == "" {
+			path = "/"
+		}
+		wsLis := dmsg.NewWebSocketListener(lis.Addr())
+		a.router.Handle(path, wsLis)
+		go func(l net.Listener, address string) {
+			if err := a.dmsgServer.ServeTransport(l, dmsg.TransportWebSocket, address); err != nil {
+				errCh <- err
+			}
+		}(wsLis, wsAddr)
+	}
+
 	srv := &http.Server{
 		ReadTimeout:       3 * time.Second,
 		WriteTimeout:      3 * time.Second,
@@ -158,102 +173,50 @@ func (a *API) updateInternalState() {
 	}
 }
 
-// UpdateAverageNumberOfPacketsPerMinute is function which needs to called every minute.
-func (a *API) updateAverageNumberOfPacketsPerMinute() {
+// updateThroughputPerMinute is function which needs to called every minute.
+func (a *API) updateThroughputPerMinute() {
 	if a.dmsgServer != nil {
-		newDecValues, newEncValues, average := calculateThroughput(
-			a.dmsgServer.GetSessions(),
-			a.minuteDecValues,
-			a.minuteEncValues,
-		)
-
-		a.metrics.SetPacketsPerMinute(average)
-
 		a.sMu.Lock()
 		defer a.sMu.Unlock()
-		a.minuteDecValues = newDecValues
-		a.minuteEncValues = newEncValues
+
+		var packets, bytes uint64
+		a.minuteStats, packets, bytes = calculateThroughput(a.dmsgServer.GetSessions(), a.minuteStats)
+		a.metrics.SetPacketsPerMinute(packets)
+		a.metrics.SetBytesPerMinute(bytes)
 	}
 }
 
-// TODO (darkrengarius): reimplement efficiently
-/*// UpdateAverageNumberOfPacketsPerSecond is function which needs to called every second.
-func (a *API) updateAverageNumberOfPacketsPerSecond() {
+// updateThroughputPerSecond is function which needs to called every second.
+func (a *API) updateThroughputPerSecond() {
 	if a.dmsgServer != nil {
-		newDecValues, newEncValues, average := calculateThroughput(
-			a.dmsgServer.GetSessions(),
-			a.secondDecValues,
-			a.secondEncValues,
-		)
-
-		a.metrics.SetPacketsPerSecond(average)
-
 		a.sMu.Lock()
 		defer a.sMu.Unlock()
-		a.secondDecValues = newDecValues
-		a.secondEncValues = newEncValues
+
+		var packets, bytes uint64
+		a.secondStats, packets, bytes = calculateThroughput(a.dmsgServer.GetSessions(), a.secondStats)
+		a.metrics.SetPacketsPerSecond(packets)
+		a.metrics.SetBytesPerSecond(bytes)
 	}
-}*/
+}
 
+// calculateThroughput returns the current statistics of the sessions, and the total number of session frames and
+// bytes (sent and received) since the previous statistics.
 func calculateThroughput(
 	sessions map[cipher.PubKey]*dmsg.SessionCommon,
-	previousDecValues map[*dmsg.SessionCommon]uint64,
-	previousEncValues map[*dmsg.SessionCommon]uint64,
+	previous map[*dmsg.SessionCommon]dmsg.Stats,
 ) (
-	map[*dmsg.SessionCommon]uint64,
-	map[*dmsg.SessionCommon]uint64,
-	uint64,
+	current map[*dmsg.SessionCommon]dmsg.Stats,
+	packets uint64,
+	bytes uint64,
 ) {
-
-	var average uint64 = math.MaxUint64
-	total := big.NewInt(0)
-	count := big.NewInt(0)
-	bigOne := big.NewInt(1)
-	newDecValues := make(map[*dmsg.SessionCommon]uint64)
-	newEncValues := make(map[*dmsg.SessionCommon]uint64)
+	current = make(map[*dmsg.SessionCommon]dmsg.Stats, len(sessions))
 	for _, session := range sessions {
-		currentDecValue := session.GetDecNonce()
-		currentEncValue := session.GetEncNonce()
+		stats := session.Stats()
+		current[session] = stats
 
-		newDecValues[session] = currentDecValue
-		newEncValues[session] = currentEncValue
-
-		previousDecValue := previousDecValues[session]
-		previousEncValue := previousEncValues[session]
-		if currentDecValue != previousDecValue {
-			if currentDecValue < previousDecValue {
-				// overflow happened
-				tmp := new(big.Int).SetUint64(currentDecValue)
-				total = total.Add(total, tmp)
-				tmp = new(big.Int).SetUint64(math.MaxUint64 - previousDecValue)
-				total = total.Add(total, tmp)
-			} else {
-				tmp := new(big.Int).SetUint64(currentDecValue - previousDecValue)
-				total = total.Add(total, tmp)
-			}
-			count = count.Add(count, bigOne)
-		}
-		if currentEncValue != previousEncValue {
-			if currentEncValue < previousEncValue {
-				// overflow happened
-				tmp := new(big.Int).SetUint64(currentEncValue)
-				total = total.Add(total, tmp)
-				tmp = new(big.Int).SetUint64(math.MaxUint64 - previousEncValue)
-				total = total.Add(total, tmp)
-			} else {
-				tmp := new(big.Int).SetUint64(currentEncValue - previousEncValue)
-				total = total.Add(total, tmp)
-			}
-			count = count.Add(count, bigOne)
-		}
-	}
-	if count.Uint64() == uint64(0) {
-		average = 0
-	} else {
-		res := total.Div(total, count)
-		if res.IsUint64() {
-			average = res.Uint64()
-		}
+		prev := previous[session] // zero for new sessions
+		packets += (stats.FramesSent - prev.FramesSent) + (stats.FramesReceived - prev.FramesReceived)
+		bytes += (stats.BytesSent - prev.BytesSent) + (stats.BytesReceived - prev.BytesReceived)
 	}
-	return newDecValues, newEncValues, average
+	return current, packets, bytes
 }
@@ -10,3 +10,13 @@ const (
 	DeltaConnect    DeltaType = 1
 	DeltaDisconnect DeltaType = -1
 )
+
+// LimitType represents a per-client limit which was triggered.
+type LimitType int
+
+// Limit types.
+const (
+	LimitStreams        LimitType = iota // max concurrent streams reached
+	LimitStreamRequests                  // stream request rate exceeded
+	LimitBandwidth                       // stream data was throttled
+)
@@ -21,5 +21,14 @@ func (Empty) SetPacketsPerMinute(_ uint64) {}
 // SetPacketsPerSecond implements `Metrics`.
 func (Empty) SetPacketsPerSecond(_ uint64) {}
 
+// SetBytesPerMinute implements `Metrics`.
+func (Empty) SetBytesPerMinute(_ uint64) {}
+
+// SetBytesPerSecond implements `Metrics`.
+func (Empty) SetBytesPerSecond(_ uint64) {}
+
 // SetClientsCount implements `Metrics`.
 func (Empty) SetClientsCount(_ int64) {}
+
+// RecordLimit implements `Metrics`.
+func (Empty) RecordLimit(_ LimitType) {}
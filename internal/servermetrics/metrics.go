@@ -8,4 +8,7 @@ type Metrics interface {
 	SetClientsCount(val int64)
 	SetPacketsPerSecond(val uint64)
 	SetPacketsPerMinute(val uint64)
+	SetBytesPerSecond(val uint64)
+	SetBytesPerMinute(val uint64)
+	RecordLimit(limit LimitType)
 }
@@ -12,6 +12,8 @@ import (
 type VictoriaMetrics struct {
 	packetsPerMinute   *metricsutil.VictoriaMetricsUintGaugeWrapper
 	packetsPerSecond   *metricsutil.VictoriaMetricsUintGaugeWrapper
+	bytesPerMinute     *metricsutil.VictoriaMetricsUintGaugeWrapper
+	bytesPerSecond     *metricsutil.VictoriaMetricsUintGaugeWrapper
 	clientsCount       *metricsutil.VictoriaMetricsIntGaugeWrapper
 	activeSessions     *metricsutil.VictoriaMetricsIntGaugeWrapper
 	successfulSessions *metrics.Counter
@@ -19,6 +21,9 @@ type VictoriaMetrics struct {
 	activeStreams      *metricsutil.VictoriaMetricsIntGaugeWrapper
 	successfulStreams  *metrics.Counter
 	failedStreams      *metrics.Counter
+	limitedStreams     *metrics.Counter
+	limitedRequests    *metrics.Counter
+	limitedBandwidth   *metrics.Counter
 }
 
 // NewVictoriaMetrics returns the Victoria Metrics implementation of Metrics.
@@ -26,6 +31,8 @@ func NewVictoriaMetrics() *VictoriaMetrics {
 	return &VictoriaMetrics{
 		packetsPerMinute:   metricsutil.NewVictoriaMetricsUintGauge("dmsg_server_packets_per_minute"),
 		packetsPerSecond:   metricsutil.NewVictoriaMetricsUintGauge("dmsg_server_packets_per_second"),
+		bytesPerMinute:     metricsutil.NewVictoriaMetricsUintGauge("dmsg_server_bytes_per_minute"),
+		bytesPerSecond:     metricsutil.NewVictoriaMetricsUintGauge("dmsg_server_bytes_per_second"),
 		clientsCount:       metricsutil.NewVictoriaMetricsIntGauge("dmsg_server_clients_count"),
 		activeSessions:     metricsutil.NewVictoriaMetricsIntGauge("dmsg_server_vm_active_sessions_count"),
 		successfulSessions: metrics.GetOrCreateCounter("dmsg_server_vm_session_success_total"),
@@ -33,6 +40,9 @@ func NewVictoriaMetrics() *VictoriaMetrics {
 		activeStreams:      metricsutil.NewVictoriaMetricsIntGauge("dmsg_server_vm_active_streams_count"),
 		successfulStreams:  metrics.GetOrCreateCounter("dmsg_server_vm_stream_success_total"),
 		failedStreams:      metrics.GetOrCreateCounter("dmsg_server_vm_stream_fail_total"),
+		limitedStreams:     metrics.GetOrCreateCounter("dmsg_server_vm_limit_streams_total"),
+		limitedRequests:    metrics.GetOrCreateCounter("dmsg_server_vm_limit_stream_requests_total"),
+		limitedBandwidth:   metrics.GetOrCreateCounter("dmsg_server_vm_limit_bandwidth_total"),
 	}
 }
 
@@ -46,6 +56,16 @@ func (m *VictoriaMetrics) SetPacketsPerSecond(val uint64) {
 	m.packetsPerSecond.Set(val)
 }
 
+// SetBytesPerMinute implements `Metrics`.
+func (m *VictoriaMetrics) SetBytesPerMinute(val uint64) {
+	m.bytesPerMinute.Set(val)
+}
+
+// SetBytesPerSecond implements `Metrics`.
+func (m *VictoriaMetrics) SetBytesPerSecond(val uint64) {
+	m.bytesPerSecond.Set(val)
+}
+
 // SetClientsCount implements `Metrics`.
 func (m *VictoriaMetrics) SetClientsCount(val int64) {
 	m.clientsCount.Set(val)
@@ -80,3 +100,17 @@ func (m *VictoriaMetrics) RecordStream(delta DeltaType) {
 		panic(fmt.Errorf("invalid delta: %d", delta))
 	}
 }
+
+// RecordLimit implements Metrics.
+func (m *VictoriaMetrics) RecordLimit(limit LimitType) {
+	switch limit {
+	case LimitStreams:
+		m.limitedStreams.Inc()
+	case LimitStreamRequests:
+		m.limitedRequests.Inc()
+	case LimitBandwidth:
+		m.limitedBandwidth.Inc()
+	default:
+		panic(fmt.Errorf("invalid limit: %d", limit))
+	}
+}
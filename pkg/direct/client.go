@@ -17,6 +17,7 @@ import (
 // it implements disc.APIClient
 type directClient struct {
 	entries map[cipher.PubKey]*disc.Entry
+	names   map[string]cipher.PubKey
 	mx      sync.RWMutex
 }
 
@@ -30,6 +31,7 @@ func NewClient(entries []*disc.Entry, log *logging.Logger) disc.APIClient {
 		Debug("Created Direct client.")
 	return &directClient{
 		entries: entriesMap,
+		names:   make(map[string]cipher.PubKey),
 	}
 }
 
@@ -102,3 +104,37 @@ func (c *directClient) AllEntries(ctx context.Context) (entries []string, err er
 	}
 	return entries, nil
 }
+
+// Services return list of client entries of directClient which offer a service of the given name
+func (c *directClient) Services(ctx context.Context, name string) (entries []*disc.Entry, err error) {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	for _, entry := range c.entries {
+		if entry.Client == nil {
+			continue
+		}
+		if _, ok := entry.Client.Service(name); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// PostName adds the name of a NameRecord to the names field of directClient.
+func (c *directClient) PostName(_ context.Context, record *disc.NameRecord) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.names[record.Name] = record.PK
+	return nil
+}
+
+// Resolve returns the public key of a name from the names field of directClient.
+func (c *directClient) Resolve(_ context.Context, name string) (cipher.PubKey, error) {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	pk, ok := c.names[name]
+	if !ok {
+		return cipher.PubKey{}, disc.ErrNameNotFound
+	}
+	return pk, nil
+}
@@ -0,0 +1,319 @@
+// Package disc pkg/disc/cache.go
+package disc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+)
+
+// Default values of CacheConfig.
+const (
+	DefaultCacheTTL         = 30 * time.Second
+	DefaultCacheNegativeTTL = 5 * time.Second
+	DefaultCacheStaleTTL    = 2 * time.Minute
+	DefaultCacheMaxItems    = 10000
+)
+
+// cacheRefreshTimeout is the timeout of background refreshes of stale cache items.
+const cacheRefreshTimeout = 20 * time.Second
+
+// CacheConfig configures the APIClient returned by NewCachingClient.
+type CacheConfig struct {
+	// TTL is the duration for which cached entries and resolved names are fresh.
+	TTL time.Duration
+
+	// NegativeTTL is the duration for which 'not found' results are cached. Zero disables negative caching.
+	NegativeTTL time.Duration
+
+	// StaleTTL is the duration after TTL for which an expired entry (or resolved name) is still returned, while it is
+	// refreshed in the background. Zero disables stale-while-revalidate.
+	StaleTTL time.Duration
+
+	// MaxItems is the maximum number of cached results.
+	MaxItems int
+}
+
+// DefaultCacheConfig returns the default cache config.
+func DefaultCacheConfig() *CacheConfig {
+	return &CacheConfig{
+		TTL:         DefaultCacheTTL,
+		NegativeTTL: DefaultCacheNegativeTTL,
+		StaleTTL:    DefaultCacheStaleTTL,
+		MaxItems:    DefaultCacheMaxItems,
+	}
+}
+
+// cacheKey identifies a cached result, which is either the entry of a public key or a resolved name.
+type cacheKey struct {
+	pk   cipher.PubKey
+	name string
+}
+
+// cacheItem is a cached result.
+// Negative results (of which 'err' is set) are never stale, they are dropped once they expire.
+type cacheItem struct {
+	entry      *Entry
+	pk         cipher.PubKey
+	err        error
+	expiry     time.Time
+	refreshing bool
+}
+
+// CachingClient is an APIClient which caches the entries and resolved names obtained from the underlying APIClient.
+// Entries posted through the CachingClient are written through to the cache.
+// Results which are known to be outdated (for example, when a dial through the delegated servers of an entry failed)
+// should be dropped with Invalidate.
+type CachingClient struct {
+	dc    APIClient
+	conf  CacheConfig
+	items map[cacheKey]*cacheItem
+	mx    sync.Mutex
+}
+
+// NewCachingClient returns a CachingClient which caches the results of 'dc'.
+// If 'dc' already is a CachingClient, it is returned as is. If 'conf' is nil, DefaultCacheConfig is used.
+func NewCachingClient(dc APIClient, conf *CacheConfig) *CachingClient {
+	if c, ok := dc.(*CachingClient); ok {
+		return c
+	}
+	if conf == nil {
+		conf = DefaultCacheConfig()
+	}
+	return &CachingClient{
+		dc:    dc,
+		conf:  *conf,
+		items: make(map[cacheKey]*cacheItem),
+	}
+}
+
+// Entry returns the entry of the public key, from the cache if it is available.
+func (c *CachingClient) Entry(ctx context.Context, pk cipher.PubKey) (*Entry, error) {
+	key := cacheKey{pk: pk}
+	fetch := func(ctx context.Context) (*cacheItem, error) {
+		entry, err := c.dc.Entry(ctx, pk)
+		if err != nil {
+			return nil, err
+		}
+		return &cacheItem{entry: entry}, nil
+	}
+
+	item, err := c.get(ctx, key, fetch)
+	if err != nil {
+		return nil, err
+	}
+	entry := &Entry{}
+	Copy(entry, item.entry)
+	return entry, nil
+}
+
+// Resolve returns the public key which the name is registered to, from the cache if it is available.
+func (c *CachingClient) Resolve(ctx context.Context, name string) (cipher.PubKey, error) {
+	key := cacheKey{name: name}
+	fetch := func(ctx context.Context) (*cacheItem, error) {
+		pk, err := c.dc.Resolve(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		return &cacheItem{pk: pk}, nil
+	}
+
+	item, err := c.get(ctx, key, fetch)
+	if err != nil {
+		return cipher.PubKey{}, err
+	}
+	return item.pk, nil
+}
+
+// PostEntry posts the entry, and caches it on success.
+func (c *CachingClient) PostEntry(ctx context.Context, entry *Entry) error {
+	err := c.dc.PostEntry(ctx, entry)
+	c.writeEntry(entry, err)
+	return err
+}
+
+// PutEntry updates the entry, and caches it on success.
+func (c *CachingClient) PutEntry(ctx context.Context, sk cipher.SecKey, entry *Entry) error {
+	err := c.dc.PutEntry(ctx, sk, entry)
+	c.writeEntry(entry, err)
+	return err
+}
+
+// DelEntry deletes the entry, and drops it from the cache.
+func (c *CachingClient) DelEntry(ctx context.Context, entry *Entry) error {
+	c.Invalidate(entry.Static)
+	return c.dc.DelEntry(ctx, entry)
+}
+
+// PostName registers the name, and caches it on success.
+func (c *CachingClient) PostName(ctx context.Context, record *NameRecord) error {
+	err := c.dc.PostName(ctx, record)
+	if err != nil {
+		c.InvalidateName(record.Name)
+		return err
+	}
+	c.set(cacheKey{name: record.Name}, &cacheItem{pk: record.PK})
+	return nil
+}
+
+// AvailableServers obtains the available servers, which are not cached.
+func (c *CachingClient) AvailableServers(ctx context.Context) ([]*Entry, error) {
+	return c.dc.AvailableServers(ctx)
+}
+
+// AllServers obtains all servers, which are not cached.
+func (c *CachingClient) AllServers(ctx context.Context) ([]*Entry, error) {
+	return c.dc.AllServers(ctx)
+}
+
+// AllEntries obtains all entries, which are not cached.
+func (c *CachingClient) AllEntries(ctx context.Context) ([]string, error) {
+	return c.dc.AllEntries(ctx)
+}
+
+// Services obtains the entries of clients which offer the named service, which are not cached.
+func (c *CachingClient) Services(ctx context.Context, name string) ([]*Entry, error) {
+	return c.dc.Services(ctx, name)
+}
+
+// Invalidate drops the cached entry of the public key.
+// It returns true if an entry (or a negative result) was cached.
+func (c *CachingClient) Invalidate(pk cipher.PubKey) bool {
+	return c.invalidate(cacheKey{pk: pk})
+}
+
+// InvalidateName drops the cached resolution of the name.
+// It returns true if a resolution (or a negative result) was cached.
+func (c *CachingClient) InvalidateName(name string) bool {
+	return c.invalidate(cacheKey{name: name})
+}
+
+func (c *CachingClient) invalidate(key cacheKey) bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	_, ok := c.items[key]
+	delete(c.items, key)
+	return ok
+}
+
+// get returns the cached result of the key, or fetches (and caches) it if there is no fresh result.
+// Stale results are returned as is, and are refreshed in the background.
+func (c *CachingClient) get(ctx context.Context, key cacheKey, fetch func(ctx context.Context) (*cacheItem, error)) (*cacheItem, error) {
+	now := time.Now()
+
+	c.mx.Lock()
+	item, ok := c.items[key]
+	if ok && now.Before(item.expiry) {
+		c.mx.Unlock()
+		return item, item.err
+	}
+	if ok && item.err == nil && now.Before(item.expiry.Add(c.conf.StaleTTL)) {
+		if !item.refreshing {
+			item.refreshing = true
+			go c.refresh(key, item, fetch)
+		}
+		c.mx.Unlock()
+		return item, nil
+	}
+	c.mx.Unlock()
+
+	item, err := fetch(ctx)
+	if err != nil {
+		if c.conf.NegativeTTL > 0 && isNotFound(err) {
+			c.set(key, &cacheItem{err: err})
+		}
+		return nil, err
+	}
+	c.set(key, item)
+	return item, nil
+}
+
+// refresh fetches the result of a stale item in the background.
+// The refreshed result is dropped if the item was replaced in the meantime.
+// If the refresh fails (other than with a 'not found' result), the stale item is kept.
+func (c *CachingClient) refresh(key cacheKey, stale *cacheItem, fetch func(ctx context.Context) (*cacheItem, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), cacheRefreshTimeout)
+	defer cancel()
+
+	item, err := fetch(ctx)
+	if err != nil && !isNotFound(err) {
+		c.mx.Lock()
+		stale.refreshing = false
+		c.mx.Unlock()
+		return
+	}
+	if err != nil {
+		item = &cacheItem{err: err}
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.items[key] != stale {
+		return
+	}
+	if item.err != nil && c.conf.NegativeTTL <= 0 {
+		delete(c.items, key)
+		return
+	}
+	c.setLocked(key, item, time.Now())
+}
+
+// writeEntry caches an entry which was written to discovery, or drops it from the cache if the write failed.
+func (c *CachingClient) writeEntry(entry *Entry, err error) {
+	if err != nil {
+		c.Invalidate(entry.Static)
+		return
+	}
+	cached := &Entry{}
+	Copy(cached, entry)
+	c.set(cacheKey{pk: entry.Static}, &cacheItem{entry: cached})
+}
+
+func (c *CachingClient) set(key cacheKey, item *cacheItem) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.setLocked(key, item, time.Now())
+}
+
+func (c *CachingClient) setLocked(key cacheKey, item *cacheItem, now time.Time) {
+	if item.err != nil {
+		item.expiry = now.Add(c.conf.NegativeTTL)
+	} else {
+		item.expiry = now.Add(c.conf.TTL)
+	}
+
+	if _, ok := c.items[key]; !ok && c.conf.MaxItems > 0 && len(c.items) >= c.conf.MaxItems {
+		c.evictLocked(now)
+	}
+	c.items[key] = item
+}
+
+// evictLocked drops the results which can no longer be returned, and an arbitrary result if the cache is still full.
+func (c *CachingClient) evictLocked(now time.Time) {
+	for key, item := range c.items {
+		deadline := item.expiry
+		if item.err == nil {
+			deadline = deadline.Add(c.conf.StaleTTL)
+		}
+		if !now.Before(deadline) {
+			delete(c.items, key)
+		}
+	}
+	for key := range c.items {
+		if len(c.items) < c.conf.MaxItems {
+			return
+		}
+		delete(c.items, key)
+	}
+}
+
+// isNotFound returns true if the error is a 'not found' result of discovery.
+func isNotFound(err error) bool {
+	return errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrNameNotFound)
+}
@@ -0,0 +1,152 @@
+// Package disc pkg/disc/cache_test.go
+package disc
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingClient counts the lookups of entries and names.
+type countingClient struct {
+	APIClient
+	entries int32
+	names   int32
+}
+
+func (c *countingClient) Entry(ctx context.Context, pk cipher.PubKey) (*Entry, error) {
+	atomic.AddInt32(&c.entries, 1)
+	return c.APIClient.Entry(ctx, pk)
+}
+
+func (c *countingClient) Resolve(ctx context.Context, name string) (cipher.PubKey, error) {
+	atomic.AddInt32(&c.names, 1)
+	return c.APIClient.Resolve(ctx, name)
+}
+
+func TestCachingClient(t *testing.T) {
+	ctx := context.TODO()
+
+	newCache := func(conf *CacheConfig) (*CachingClient, *countingClient, APIClient) {
+		mock := NewMock(0)
+		counter := &countingClient{APIClient: mock}
+		return NewCachingClient(counter, conf), counter, mock
+	}
+	postEntry := func(t *testing.T, dc APIClient) (*Entry, cipher.SecKey) {
+		pk, sk := cipher.GenerateKeyPair()
+		entry := NewClientEntry(pk, 0, []cipher.PubKey{})
+		require.NoError(t, entry.Sign(sk))
+		require.NoError(t, dc.PostEntry(ctx, entry))
+		return entry, sk
+	}
+
+	t.Run("ttl", func(t *testing.T) {
+		cc, counter, mock := newCache(&CacheConfig{TTL: 100 * time.Millisecond})
+		entry, _ := postEntry(t, mock)
+
+		for i := 0; i < 3; i++ {
+			got, err := cc.Entry(ctx, entry.Static)
+			require.NoError(t, err)
+			assert.Equal(t, entry, got)
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(&counter.entries))
+
+		// Returned entries are copies, which can be modified by the caller.
+		got, err := cc.Entry(ctx, entry.Static)
+		require.NoError(t, err)
+		got.Sequence++
+		got, err = cc.Entry(ctx, entry.Static)
+		require.NoError(t, err)
+		assert.Equal(t, entry.Sequence, got.Sequence)
+
+		time.Sleep(150 * time.Millisecond)
+		_, err = cc.Entry(ctx, entry.Static)
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&counter.entries))
+	})
+
+	t.Run("negative", func(t *testing.T) {
+		cc, counter, mock := newCache(&CacheConfig{TTL: time.Minute, NegativeTTL: 100 * time.Millisecond})
+		pk, sk := cipher.GenerateKeyPair()
+
+		for i := 0; i < 3; i++ {
+			_, err := cc.Entry(ctx, pk)
+			assert.ErrorIs(t, err, ErrKeyNotFound)
+			_, err = cc.Resolve(ctx, "unknown")
+			assert.ErrorIs(t, err, ErrNameNotFound)
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(&counter.entries))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&counter.names))
+
+		// Negative results expire after NegativeTTL.
+		entry := NewClientEntry(pk, 0, []cipher.PubKey{})
+		require.NoError(t, entry.Sign(sk))
+		require.NoError(t, mock.PostEntry(ctx, entry))
+		time.Sleep(150 * time.Millisecond)
+		got, err := cc.Entry(ctx, pk)
+		require.NoError(t, err)
+		assert.Equal(t, entry, got)
+	})
+
+	t.Run("stale_while_revalidate", func(t *testing.T) {
+		cc, counter, mock := newCache(&CacheConfig{TTL: 50 * time.Millisecond, StaleTTL: time.Minute})
+		entry, sk := postEntry(t, mock)
+
+		_, err := cc.Entry(ctx, entry.Static)
+		require.NoError(t, err)
+		require.NoError(t, mock.PutEntry(ctx, sk, entry))
+		time.Sleep(100 * time.Millisecond)
+
+		// The stale entry is returned, while it is refreshed in the background.
+		got, err := cc.Entry(ctx, entry.Static)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), got.Sequence)
+		require.Eventually(t, func() bool {
+			got, err := cc.Entry(ctx, entry.Static)
+			return err == nil && got.Sequence == entry.Sequence
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&counter.entries))
+	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		cc, counter, mock := newCache(nil)
+		entry, _ := postEntry(t, mock)
+
+		_, err := cc.Entry(ctx, entry.Static)
+		require.NoError(t, err)
+		assert.True(t, cc.Invalidate(entry.Static))
+		assert.False(t, cc.Invalidate(entry.Static))
+		_, err = cc.Entry(ctx, entry.Static)
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&counter.entries))
+	})
+
+	t.Run("write_through", func(t *testing.T) {
+		cc, counter, _ := newCache(nil)
+		entry, sk := postEntry(t, cc)
+		require.NoError(t, cc.PutEntry(ctx, sk, entry))
+
+		got, err := cc.Entry(ctx, entry.Static)
+		require.NoError(t, err)
+		assert.Equal(t, entry, got)
+
+		record := NewNameRecord("site", entry.Static)
+		require.NoError(t, record.Sign(sk))
+		require.NoError(t, cc.PostName(ctx, record))
+		pk, err := cc.Resolve(ctx, "site")
+		require.NoError(t, err)
+		assert.Equal(t, entry.Static, pk)
+
+		assert.Equal(t, int32(0), atomic.LoadInt32(&counter.names))
+		assert.Equal(t, int32(0), atomic.LoadInt32(&counter.entries))
+
+		require.NoError(t, cc.DelEntry(ctx, entry))
+		_, err = cc.Entry(ctx, entry.Static)
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+	})
+}
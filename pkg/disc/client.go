@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"sync"
 	"time"
 
@@ -15,7 +16,14 @@ import (
 	"github.com/skycoin/skywire-utilities/pkg/logging"
 )
 
-var json = jsoniter.ConfigFastest
+// json is jsoniter.ConfigFastest with sorted map keys, so that entries (which are signed over their JSON encoding)
+// encode deterministically.
+var json = jsoniter.Config{
+	EscapeHTML:                    false,
+	MarshalFloatWith6Digits:       true,
+	ObjectFieldMustBeSimpleString: true,
+	SortMapKeys:                   true,
+}.Froze()
 
 // APIClient implements dmsg discovery API client.
 type APIClient interface {
@@ -26,6 +34,9 @@ type APIClient interface {
 	AvailableServers(context.Context) ([]*Entry, error)
 	AllServers(context.Context) ([]*Entry, error)
 	AllEntries(ctx context.Context) ([]string, error)
+	Services(ctx context.Context, name string) ([]*Entry, error)
+	PostName(ctx context.Context, record *NameRecord) error
+	Resolve(ctx context.Context, name string) (cipher.PubKey, error)
 }
 
 // HTTPClient represents a client that communicates with a dmsg-discovery service through http, it
@@ -37,16 +48,58 @@ type httpClient struct {
 	log       *logging.Logger
 }
 
+// HTTPOption configures the APIClient returned by NewHTTP.
+type HTTPOption func(c *httpClient)
+
+// WithProxy makes the APIClient reach the discovery through the upstream proxy of the given URL.
+// SOCKS5 ('socks5://') and HTTP CONNECT ('http://') proxies are supported.
+func WithProxy(proxyURL *url.URL) HTTPOption {
+	return func(c *httpClient) {
+		c.client = ProxyHTTPClient(c.client, proxyURL)
+	}
+}
+
 // NewHTTP constructs a new APIClient that communicates with discovery via http.
-func NewHTTP(address string, client *http.Client, log *logging.Logger) APIClient {
+func NewHTTP(address string, client *http.Client, log *logging.Logger, opts ...HTTPOption) APIClient {
 	log.WithField("func", "disc.NewHTTP").
 		WithField("addr", address).
 		Debug("Created HTTP client.")
-	return &httpClient{
+	c := &httpClient{
 		client:  client,
 		address: address,
 		log:     log,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ProxyHTTPClient returns a copy of the given http client which sends requests through the upstream proxy of the
+// given URL. A nil 'client' is treated as http.DefaultClient.
+// Clients with a custom RoundTripper which is not an *http.Transport are returned as is.
+func ProxyHTTPClient(client *http.Client, proxyURL *url.URL) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if proxyURL == nil {
+		return client
+	}
+
+	rt := client.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	tr, ok := rt.(*http.Transport)
+	if !ok {
+		return client
+	}
+	tr = tr.Clone()
+	tr.Proxy = http.ProxyURL(proxyURL)
+
+	proxyC := *client
+	proxyC.Transport = tr
+	return &proxyC
 }
 
 // Entry retrieves an entry associated with the given public key.
@@ -357,3 +410,130 @@ func (c *httpClient) AllEntries(ctx context.Context) ([]string, error) {
 
 	return entries, nil
 }
+
+// Services returns the entries of clients which offer a service of the given name.
+func (c *httpClient) Services(ctx context.Context, name string) ([]*Entry, error) {
+	var entries []*Entry
+	endpoint := c.address + "/dmsg-discovery/services/" + url.PathEscape(name)
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := c.client.Do(req)
+	if resp != nil {
+		defer func() {
+			if err := resp.Body.Close(); err != nil {
+				c.log.WithError(err).Warn("Failed to close response body")
+			}
+		}()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// if the response is an error it will be codified as an HTTPMessage
+	if resp.StatusCode != http.StatusOK {
+		var message HTTPMessage
+		err = json.NewDecoder(resp.Body).Decode(&message)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, errFromString(message.Message)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// PostName registers (or renews) the name of a signed NameRecord.
+func (c *httpClient) PostName(ctx context.Context, record *NameRecord) error {
+	endpoint := c.address + "/dmsg-discovery/name"
+	log := c.log.WithField("endpoint", endpoint)
+
+	marshaledRecord, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewBuffer(marshaledRecord))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(ctx)
+
+	resp, err := c.client.Do(req)
+	if resp != nil {
+		defer func() {
+			if err := resp.Body.Close(); err != nil {
+				log.WithError(err).Warn("Failed to close response body.")
+			}
+		}()
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to perform request.")
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var message HTTPMessage
+		if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
+			return err
+		}
+		return errFromString(message.Message)
+	}
+	return nil
+}
+
+// Resolve returns the public key which the given name is registered to.
+func (c *httpClient) Resolve(ctx context.Context, name string) (cipher.PubKey, error) {
+	endpoint := c.address + "/dmsg-discovery/name/" + url.PathEscape(name)
+	log := c.log.WithField("endpoint", endpoint)
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return cipher.PubKey{}, err
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := c.client.Do(req)
+	if resp != nil {
+		defer func() {
+			if err := resp.Body.Close(); err != nil {
+				log.WithError(err).Warn("Failed to close response body.")
+			}
+		}()
+	}
+	if err != nil {
+		return cipher.PubKey{}, err
+	}
+
+	// if the response is an error it will be codified as an HTTPMessage
+	if resp.StatusCode != http.StatusOK {
+		var message HTTPMessage
+		if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
+			return cipher.PubKey{}, err
+		}
+		return cipher.PubKey{}, errFromString(message.Message)
+	}
+
+	var record NameRecord
+	if err := json.NewDecoder(resp.Body).Decode(&record); err != nil {
+		return cipher.PubKey{}, err
+	}
+	if record.Name != name {
+		return cipher.PubKey{}, ErrUnexpected
+	}
+	if err := record.VerifySignature(); err != nil {
+		return cipher.PubKey{}, ErrUnauthorized
+	}
+	return record.PK, nil
+}
@@ -11,6 +11,9 @@ import (
 )
 
 const (
+	// DefaultTransportType is the session transport type assumed for server entries which do not advertise transports.
+	DefaultTransportType = "tcp"
+
 	currentVersion             = "0.0.1"
 	entryLifetime              = 1 * time.Minute
 	allowedEntryTimestampError = 5 * time.Second
@@ -51,6 +54,16 @@ var (
 	ErrValidationServerAddress = NewEntryValidationError("advertising localhost listening address is not allowed in production mode")
 	// ErrValidationEmptyServerAddress occurs when a server entry is submitted with an empty address.
 	ErrValidationEmptyServerAddress = NewEntryValidationError("server address cannot be empty")
+	// ErrValidationInvalidTransport occurs when a server entry advertises a transport with an empty type or address.
+	ErrValidationInvalidTransport = NewEntryValidationError("server transport type and address cannot be empty")
+	// ErrValidationInvalidService occurs when a client entry advertises a service with an empty name or port.
+	ErrValidationInvalidService = NewEntryValidationError("client service name and port cannot be empty")
+	// ErrNameNotFound occurs when a name is not registered (or its registration expired).
+	ErrNameNotFound = errors.New("name is not registered")
+	// ErrNameTaken occurs when a name is already registered to another public key.
+	ErrNameTaken = errors.New("name is registered to another public key")
+	// ErrValidationInvalidName occurs when a name record has an invalid name.
+	ErrValidationInvalidName = NewEntryValidationError("name must be 1-63 lowercase letters, digits or hyphens, starting with a letter")
 	// ErrUnauthorizedNetworkMonitor occurs in case of invalid network monitor key
 	ErrUnauthorizedNetworkMonitor = errors.New("invalid network monitor key")
 
@@ -72,6 +85,11 @@ var (
 		ErrValidationOutdatedTime.Error():       ErrValidationOutdatedTime,
 		ErrValidationServerAddress.Error():      ErrValidationServerAddress,
 		ErrValidationEmptyServerAddress.Error(): ErrValidationEmptyServerAddress,
+		ErrValidationInvalidTransport.Error():   ErrValidationInvalidTransport,
+		ErrValidationInvalidService.Error():     ErrValidationInvalidService,
+		ErrNameNotFound.Error():                 ErrNameNotFound,
+		ErrNameTaken.Error():                    ErrNameTaken,
+		ErrValidationInvalidName.Error():        ErrValidationInvalidName,
 	}
 )
 
@@ -147,6 +165,27 @@ func (e *Entry) String() string {
 type Client struct {
 	// DelegatedServers contains a list of delegated servers represented by their public keys.
 	DelegatedServers []cipher.PubKey `json:"delegated_servers"`
+
+	// Services contains the services which the DMSG Client offers on its dmsg ports.
+	// Services are part of the signed entry. They are omitted if there are none, so that such entries are signed the
+	// same as before services were introduced. Older discovery servers drop the unknown field before verifying the
+	// signature, so they reject entries which do have services.
+	Services []Service `json:"services,omitempty"`
+}
+
+// Service describes a service which a DMSG Client offers on a dmsg port.
+type Service struct {
+	// Name of the service, which the service is searched for by.
+	Name string `json:"name"`
+
+	// Port is the dmsg port which the service listens on.
+	Port uint16 `json:"port"`
+
+	// Protocol spoken by the service (such as "http" or "pty").
+	Protocol string `json:"protocol,omitempty"`
+
+	// Metadata contains additional information about the service.
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 // String implements stringer
@@ -157,9 +196,27 @@ func (c *Client) String() string {
 		res += fmt.Sprintf("\t%s\n", ds)
 	}
 
+	if len(c.Services) > 0 {
+		res += "services: \n"
+		for _, svc := range c.Services {
+			res += fmt.Sprintf("\t%s: port %d (%s)\n", svc.Name, svc.Port, svc.Protocol)
+		}
+	}
+
 	return res
 }
 
+// Service returns the service of the given name.
+// False is returned if the client does not advertise the service.
+func (c *Client) Service(name string) (Service, bool) {
+	for _, svc := range c.Services {
+		if svc.Name == name {
+			return svc, true
+		}
+	}
+	return Service{}, false
+}
+
 // Server contains parameters for Server instances.
 type Server struct {
 	// IPv4 or IPv6 public address of the DMSG Server.
@@ -167,6 +224,23 @@ type Server struct {
 
 	// AvailableSessions is the number of available sessions that the server can currently accept.
 	AvailableSessions int `json:"availableSessions"`
+
+	// Transports contains the session transports which the DMSG Server accepts sessions over.
+	// If empty, the server is assumed to only accept TCP sessions on Address.
+	Transports []Transport `json:"transports,omitempty"`
+
+	// Draining is true when the DMSG Server is shutting down gracefully.
+	// Draining servers do not accept new sessions, and clients are expected to migrate to other servers.
+	Draining bool `json:"draining,omitempty"`
+}
+
+// Transport describes a session transport which a DMSG Server accepts sessions over.
+type Transport struct {
+	// Type of the session transport (such as "tcp").
+	Type string `json:"type"`
+
+	// Address in which the session transport is reachable.
+	Address string `json:"address"`
 }
 
 // String implements stringer
@@ -174,16 +248,41 @@ func (s *Server) String() string {
 	res := fmt.Sprintf("\taddress: %s\n", s.Address)
 	res += fmt.Sprintf("\tavailable sessions: %d\n", s.AvailableSessions)
 
+	if len(s.Transports) > 0 {
+		res += "\ttransports: \n"
+		for _, tp := range s.Transports {
+			res += fmt.Sprintf("\t\t%s: %s\n", tp.Type, tp.Address)
+		}
+	}
+
+	if s.Draining {
+		res += "\tdraining: true\n"
+	}
+
 	return res
 }
 
+// TransportAddr returns the address of the given session transport type.
+// False is returned if the server does not advertise support of the transport type.
+func (s *Server) TransportAddr(tpType string) (string, bool) {
+	if len(s.Transports) == 0 && tpType == DefaultTransportType {
+		return s.Address, true
+	}
+	for _, tp := range s.Transports {
+		if tp.Type == tpType {
+			return tp.Address, true
+		}
+	}
+	return "", false
+}
+
 // NewClientEntry is a convenience function that returns a valid client entry, but this entry
 // should be signed with the private key before sending it to the server
 func NewClientEntry(pubkey cipher.PubKey, sequence uint64, delegatedServers []cipher.PubKey) *Entry {
 	return &Entry{
 		Version:   currentVersion,
 		Sequence:  sequence,
-		Client:    &Client{delegatedServers},
+		Client:    &Client{DelegatedServers: delegatedServers},
 		Static:    pubkey,
 		Timestamp: time.Now().UnixNano(),
 	}
@@ -263,8 +362,23 @@ func (e *Entry) Validate(validateTimestamp bool) error {
 		return ErrValidationNoClientOrServer
 	}
 
-	if e.Server != nil && e.Server.Address == "" {
-		return ErrValidationEmptyServerAddress
+	if e.Server != nil {
+		if e.Server.Address == "" {
+			return ErrValidationEmptyServerAddress
+		}
+		for _, tp := range e.Server.Transports {
+			if tp.Type == "" || tp.Address == "" {
+				return ErrValidationInvalidTransport
+			}
+		}
+	}
+
+	if e.Client != nil {
+		for _, svc := range e.Client.Services {
+			if svc.Name == "" || svc.Port == 0 {
+				return ErrValidationInvalidService
+			}
+		}
 	}
 
 	if validateTimestamp {
@@ -312,11 +426,26 @@ func Copy(dst, src *Entry) {
 		dst.Server = nil
 	} else {
 		*dst.Server = *src.Server
+		if src.Server.Transports != nil {
+			dst.Server.Transports = append([]Transport(nil), src.Server.Transports...)
+		}
 	}
 	if src.Client == nil {
 		dst.Client = nil
 	} else {
 		*dst.Client = *src.Client
+		if src.Client.Services != nil {
+			dst.Client.Services = make([]Service, len(src.Client.Services))
+			for i, svc := range src.Client.Services {
+				dst.Client.Services[i] = svc
+				if svc.Metadata != nil {
+					dst.Client.Services[i].Metadata = make(map[string]string, len(svc.Metadata))
+					for k, v := range svc.Metadata {
+						dst.Client.Services[i].Metadata[k] = v
+					}
+				}
+			}
+		}
 	}
 
 	dst.Static = src.Static
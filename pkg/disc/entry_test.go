@@ -2,6 +2,7 @@
 package disc_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -297,3 +298,77 @@ func TestCopy(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_TransportAddr(t *testing.T) {
+	t.Run("no advertised transports", func(t *testing.T) {
+		srv := disc.Server{Address: "localhost:8080"}
+
+		addr, ok := srv.TransportAddr(disc.DefaultTransportType)
+		assert.True(t, ok)
+		assert.Equal(t, "localhost:8080", addr)
+
+		_, ok = srv.TransportAddr("unix")
+		assert.False(t, ok)
+	})
+
+	t.Run("advertised transports", func(t *testing.T) {
+		srv := disc.Server{
+			Address:    "/tmp/dmsg.sock",
+			Transports: []disc.Transport{{Type: "unix", Address: "/tmp/dmsg.sock"}},
+		}
+
+		addr, ok := srv.TransportAddr("unix")
+		assert.True(t, ok)
+		assert.Equal(t, "/tmp/dmsg.sock", addr)
+
+		_, ok = srv.TransportAddr(disc.DefaultTransportType)
+		assert.False(t, ok)
+	})
+}
+
+func TestValidateServerTransports(t *testing.T) {
+	pk, sk := cipher.GenerateKeyPair()
+
+	entry := disc.NewServerEntry(pk, 0, "localhost:8080", 5)
+	entry.Server.Transports = []disc.Transport{{Type: disc.DefaultTransportType}}
+	require.NoError(t, entry.Sign(sk))
+
+	assert.Equal(t, disc.ErrValidationInvalidTransport, entry.Validate(true))
+}
+
+func TestClientServices(t *testing.T) {
+	pk, sk := cipher.GenerateKeyPair()
+
+	entry := disc.NewClientEntry(pk, 0, []cipher.PubKey{})
+	entry.Client.Services = []disc.Service{{
+		Name:     "files",
+		Port:     80,
+		Protocol: "http",
+		Metadata: map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"},
+	}}
+	require.NoError(t, entry.Sign(sk))
+
+	// The signature does not depend on the iteration order of the metadata.
+	for i := 0; i < 10; i++ {
+		var copied disc.Entry
+		disc.Copy(&copied, entry)
+		require.NoError(t, copied.VerifySignature())
+	}
+	require.NoError(t, entry.Validate(true))
+
+	svc, ok := entry.Client.Service("files")
+	assert.True(t, ok)
+	assert.Equal(t, uint16(80), svc.Port)
+	_, ok = entry.Client.Service("pty")
+	assert.False(t, ok)
+
+	entry.Client.Services = append(entry.Client.Services, disc.Service{Name: "pty"})
+	require.NoError(t, entry.Sign(sk))
+	assert.Equal(t, disc.ErrValidationInvalidService, entry.Validate(true))
+
+	// Entries without services are signed the same as before services were introduced.
+	entry.Client.Services = nil
+	b, err := json.Marshal(entry.Client)
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "services")
+}
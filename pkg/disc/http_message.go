@@ -11,6 +11,7 @@ var (
 	MsgEntrySet     = HTTPMessage{Code: http.StatusOK, Message: "wrote a new entry"}
 	MsgEntryUpdated = HTTPMessage{Code: http.StatusOK, Message: "wrote new entry iteration"}
 	MsgEntryDeleted = HTTPMessage{Code: http.StatusOK, Message: "deleted entry"}
+	MsgNameSet      = HTTPMessage{Code: http.StatusOK, Message: "wrote name record"}
 )
 
 // HTTPMessage represents a message to be returned as an http response
@@ -0,0 +1,107 @@
+// Package disc pkg/disc/name.go
+package disc
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+)
+
+// NameLifetime is the duration for which a name is registered after the timestamp of its record.
+// The owner of a name renews it by submitting a newer record before the name expires.
+const NameLifetime = 30 * 24 * time.Hour
+
+// Names start with a letter, so that they can never be mistaken for hex-encoded public keys.
+var nameRegexp = regexp.MustCompile(`^[a-z]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ValidName returns true if 'name' is a valid name to be registered in dmsg discovery.
+func ValidName(name string) bool {
+	return nameRegexp.MatchString(name)
+}
+
+// NameRecord claims a name for a public key in dmsg discovery.
+// Names are registered on a first-come, first-served basis. A registered name can only be renewed by its owner (with a
+// record of a later timestamp), until it expires.
+type NameRecord struct {
+	// Name which is claimed.
+	Name string `json:"name"`
+
+	// PK is the public key which the name resolves to.
+	PK cipher.PubKey `json:"pk"`
+
+	// Timestamp (in unix nanoseconds) of the record.
+	Timestamp int64 `json:"timestamp"`
+
+	// Signature of the record by PK.
+	Signature string `json:"signature,omitempty"`
+}
+
+// NewNameRecord returns a name record for the public key, which should be signed before it is submitted.
+func NewNameRecord(name string, pk cipher.PubKey) *NameRecord {
+	return &NameRecord{
+		Name:      name,
+		PK:        pk,
+		Timestamp: time.Now().UnixNano(),
+	}
+}
+
+// Expiry returns when the name registration of the record expires.
+func (r *NameRecord) Expiry() time.Time {
+	return time.Unix(0, r.Timestamp).Add(NameLifetime)
+}
+
+// Sign signs the NameRecord with provided SecKey.
+func (r *NameRecord) Sign(sk cipher.SecKey) error {
+	r.Signature = ""
+
+	recordJSON, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	sig, err := cipher.SignPayload(recordJSON, sk)
+	if err != nil {
+		return err
+	}
+	r.Signature = sig.Hex()
+	return nil
+}
+
+// VerifySignature checks if the signature of the NameRecord is made by its PK.
+func (r *NameRecord) VerifySignature() error {
+	record := *r
+
+	signature := cipher.Sig{}
+	if err := signature.UnmarshalText([]byte(r.Signature)); err != nil {
+		return err
+	}
+	record.Signature = ""
+
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return cipher.VerifyPubKeySignedPayload(r.PK, signature, recordJSON)
+}
+
+// Validate checks if the NameRecord is valid to be submitted.
+func (r *NameRecord) Validate() error {
+	if !ValidName(r.Name) {
+		return ErrValidationInvalidName
+	}
+	if r.PK.Null() {
+		return ErrValidationNilKeys
+	}
+	if r.Signature == "" {
+		return ErrValidationNoSignature
+	}
+
+	now, ts := time.Now(), time.Unix(0, r.Timestamp)
+	if ts.After(now.Add(allowedEntryTimestampError)) || ts.Before(now.Add(-entryLifetime)) {
+		return ErrValidationOutdatedTime
+	}
+
+	return nil
+}
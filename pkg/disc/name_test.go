@@ -0,0 +1,92 @@
+// Package disc pkg/disc/name_test.go
+package disc
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidName(t *testing.T) {
+	cases := map[string]bool{
+		"a":                     true,
+		"my-site":               true,
+		"site42":                true,
+		"":                      false,
+		"-site":                 false,
+		"site-":                 false,
+		"4site":                 false,
+		"My-Site":               false,
+		"my_site":               false,
+		"my.site":               false,
+		strings.Repeat("a", 64): false,
+	}
+	for name, ok := range cases {
+		assert.Equal(t, ok, ValidName(name), name)
+	}
+
+	pk, _ := cipher.GenerateKeyPair()
+	assert.False(t, ValidName(pk.Hex()))
+}
+
+func TestNameRecord_Validate(t *testing.T) {
+	pk, sk := cipher.GenerateKeyPair()
+	otherPK, _ := cipher.GenerateKeyPair()
+
+	cases := []struct {
+		name   string
+		record func() *NameRecord
+		err    error
+	}{
+		{
+			name: "valid",
+			record: func() *NameRecord {
+				r := NewNameRecord("site", pk)
+				require.NoError(t, r.Sign(sk))
+				return r
+			},
+		},
+		{
+			name: "invalid name",
+			record: func() *NameRecord {
+				r := NewNameRecord("-site", pk)
+				require.NoError(t, r.Sign(sk))
+				return r
+			},
+			err: ErrValidationInvalidName,
+		},
+		{
+			name: "no signature",
+			record: func() *NameRecord {
+				return NewNameRecord("site", pk)
+			},
+			err: ErrValidationNoSignature,
+		},
+		{
+			name: "outdated",
+			record: func() *NameRecord {
+				r := NewNameRecord("site", pk)
+				r.Timestamp = time.Now().Add(-2 * entryLifetime).UnixNano()
+				require.NoError(t, r.Sign(sk))
+				return r
+			},
+			err: ErrValidationOutdatedTime,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.err, tc.record().Validate())
+		})
+	}
+
+	r := NewNameRecord("site", pk)
+	require.NoError(t, r.Sign(sk))
+	assert.NoError(t, r.VerifySignature())
+	r.PK = otherPK
+	assert.Error(t, r.VerifySignature())
+}
@@ -3,7 +3,7 @@ package disc
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"net/http"
 	"sync"
 	"time"
@@ -15,6 +15,7 @@ import (
 // real client, and it mimics it's functionality not being 100% accurate.
 type mockClient struct {
 	entries map[cipher.PubKey]Entry
+	names   map[string]NameRecord
 	mx      sync.RWMutex
 
 	timeout time.Duration
@@ -24,6 +25,7 @@ type mockClient struct {
 func NewMock(timeout time.Duration) APIClient {
 	return &mockClient{
 		entries: make(map[cipher.PubKey]Entry),
+		names:   make(map[string]NameRecord),
 		timeout: timeout,
 	}
 }
@@ -69,7 +71,8 @@ func (m *mockClient) setEntry(entry Entry) {
 func (m *mockClient) Entry(_ context.Context, pk cipher.PubKey) (*Entry, error) {
 	entry, ok := m.entry(pk)
 	if !ok {
-		return nil, errors.New(HTTPMessage{ErrKeyNotFound.Error(), http.StatusNotFound}.String())
+		// The error message mimics that of an HTTPMessage, while it can still be matched against ErrKeyNotFound.
+		return nil, fmt.Errorf("status code: %d. message: %w", http.StatusNotFound, ErrKeyNotFound)
 	}
 	res := &Entry{}
 	Copy(res, &entry)
@@ -166,3 +169,55 @@ func (m *mockClient) AllEntries(_ context.Context) ([]string, error) {
 	}
 	return list, nil
 }
+
+// Services returns the entries of clients which offer a service of the given name that the APIClient mock has
+func (m *mockClient) Services(_ context.Context, name string) ([]*Entry, error) {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+	list := make([]*Entry, 0)
+	for _, e := range m.entries {
+		if e.Client == nil {
+			continue
+		}
+		if _, ok := e.Client.Service(name); ok {
+			res := &Entry{}
+			Copy(res, &e)
+			list = append(list, res)
+		}
+	}
+	return list, nil
+}
+
+// PostName registers the name of a NameRecord on the APIClient mock
+func (m *mockClient) PostName(_ context.Context, record *NameRecord) error {
+	if err := record.Validate(); err != nil {
+		return err
+	}
+	if err := record.VerifySignature(); err != nil {
+		return ErrUnauthorized
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if prev, ok := m.names[record.Name]; ok && time.Now().Before(prev.Expiry()) {
+		if prev.PK != record.PK {
+			return ErrNameTaken
+		}
+		if record.Timestamp <= prev.Timestamp {
+			return ErrValidationWrongTime
+		}
+	}
+	m.names[record.Name] = *record
+	return nil
+}
+
+// Resolve returns the public key which the name is registered to on the APIClient mock
+func (m *mockClient) Resolve(_ context.Context, name string) (cipher.PubKey, error) {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+	record, ok := m.names[name]
+	if !ok || time.Now().After(record.Expiry()) {
+		return cipher.PubKey{}, ErrNameNotFound
+	}
+	return record.PK, nil
+}
@@ -0,0 +1,122 @@
+// Package dmsg pkg/dmsg/acl.go
+package dmsg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+)
+
+// PKRules allows or denies public keys.
+type PKRules struct {
+	// Allow is the allowlist. If non-empty, only the listed public keys are allowed.
+	Allow []cipher.PubKey `json:"allow,omitempty"`
+
+	// Deny is the denylist. Listed public keys are denied even if they are also allowlisted.
+	Deny []cipher.PubKey `json:"deny,omitempty"`
+}
+
+// Allowed returns true if the public key is allowed by the rules.
+func (r PKRules) Allowed(pk cipher.PubKey) bool {
+	for _, dPK := range r.Deny {
+		if dPK == pk {
+			return false
+		}
+	}
+	if len(r.Allow) == 0 {
+		return true
+	}
+	for _, aPK := range r.Allow {
+		if aPK == pk {
+			return true
+		}
+	}
+	return false
+}
+
+// ACLRules are the rules of an ACL.
+type ACLRules struct {
+	// Sessions restricts the remote public keys of sessions, and the source public keys of streams.
+	// Note that when the server forwards streams, other dmsg servers establish sessions with it as well.
+	Sessions PKRules `json:"sessions"`
+
+	// Destinations restricts the destination public keys which streams can be dialed to.
+	Destinations PKRules `json:"destinations"`
+}
+
+// ACL is an access control list which restricts the sessions and streams that a dmsg server serves.
+// The rules can be loaded from a JSON file and reloaded at runtime.
+type ACL struct {
+	path  string // empty if the ACL is not backed by a file
+	rules ACLRules
+	mx    sync.RWMutex
+}
+
+// NewACL creates an ACL with the given rules.
+func NewACL(rules ACLRules) *ACL {
+	return &ACL{rules: rules}
+}
+
+// LoadACL creates an ACL with the rules of the JSON file at 'path'.
+func LoadACL(path string) (*ACL, error) {
+	acl := &ACL{path: path}
+	if err := acl.Reload(); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+// Reload reloads the rules from the file which backs the ACL.
+// The current rules are kept if the file cannot be read or parsed.
+func (acl *ACL) Reload() error {
+	if acl.path == "" {
+		return errors.New("acl is not backed by a file")
+	}
+	raw, err := os.ReadFile(acl.path)
+	if err != nil {
+		return fmt.Errorf("failed to read acl file: %w", err)
+	}
+	var rules ACLRules
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		return fmt.Errorf("failed to parse acl file: %w", err)
+	}
+	acl.SetRules(rules)
+	return nil
+}
+
+// Rules returns the current rules.
+func (acl *ACL) Rules() ACLRules {
+	acl.mx.RLock()
+	defer acl.mx.RUnlock()
+	return acl.rules
+}
+
+// SetRules replaces the current rules.
+func (acl *ACL) SetRules(rules ACLRules) {
+	acl.mx.Lock()
+	acl.rules = rules
+	acl.mx.Unlock()
+}
+
+// AllowSession returns true if a session with the remote public key 'pk' is allowed.
+// A nil ACL allows everything.
+func (acl *ACL) AllowSession(pk cipher.PubKey) bool {
+	if acl == nil {
+		return true
+	}
+	return acl.Rules().Sessions.Allowed(pk)
+}
+
+// AllowStream returns true if a stream from the source public key 'srcPK' to the destination public key 'dstPK' is
+// allowed. A nil ACL allows everything.
+func (acl *ACL) AllowStream(srcPK, dstPK cipher.PubKey) bool {
+	if acl == nil {
+		return true
+	}
+	rules := acl.Rules()
+	return rules.Sessions.Allowed(srcPK) && rules.Destinations.Allowed(dstPK)
+}
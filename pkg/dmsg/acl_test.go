@@ -0,0 +1,109 @@
+// Package dmsg pkg/dmsg/acl_test.go
+package dmsg
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKRules_Allowed(t *testing.T) {
+	pkA, _ := GenKeyPair(t, "acl A")
+	pkB, _ := GenKeyPair(t, "acl B")
+
+	tests := []struct {
+		name  string
+		rules PKRules
+		pk    cipher.PubKey
+		want  bool
+	}{
+		{"empty", PKRules{}, pkA, true},
+		{"allowlisted", PKRules{Allow: []cipher.PubKey{pkA}}, pkA, true},
+		{"not_allowlisted", PKRules{Allow: []cipher.PubKey{pkA}}, pkB, false},
+		{"denylisted", PKRules{Deny: []cipher.PubKey{pkA}}, pkA, false},
+		{"not_denylisted", PKRules{Deny: []cipher.PubKey{pkA}}, pkB, true},
+		{"allowlisted_and_denylisted", PKRules{Allow: []cipher.PubKey{pkA}, Deny: []cipher.PubKey{pkA}}, pkA, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.rules.Allowed(tt.pk))
+		})
+	}
+}
+
+// Ensure that dmsg servers enforce their ACL.
+// Arrange:
+// - Dmsg server with a file-backed ACL, and clients A, B and C.
+// Act:
+// - Clients establish sessions and dial streams, and the ACL file is changed and reloaded.
+// Assert:
+// - Denied sessions are rejected, denied stream requests are answered with ErrReqDenied.
+// - Sessions which are denied after reloading the ACL are closed.
+func TestServer_ACL(t *testing.T) {
+	const port = uint16(80)
+
+	pkA, _ := GenKeyPair(t, "acl client A")
+	pkB, _ := GenKeyPair(t, "acl client B")
+	pkD, _ := GenKeyPair(t, "acl client D")
+
+	aclPath := filepath.Join(t.TempDir(), "acl.json")
+	writeACL := func(rules ACLRules) {
+		raw, err := json.Marshal(rules)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(aclPath, raw, 0600))
+	}
+	writeACL(ACLRules{
+		Sessions:     PKRules{Allow: []cipher.PubKey{pkA, pkB}},
+		Destinations: PKRules{Deny: []cipher.PubKey{pkD}},
+	})
+	acl, err := LoadACL(aclPath)
+	require.NoError(t, err)
+
+	env := newTestEnv(t)
+	srv := env.newServer("acl server", &ServerConfig{MaxSessions: 10, ACL: acl})
+	pkSrv := srv.LocalPK()
+	entry := env.entry(pkSrv)
+
+	clientA := env.connectClient("acl client A", nil, srv)
+	clientB := env.connectClient("acl client B", nil, srv)
+
+	// Client C is not allowlisted.
+	clientC := env.newClient("acl client C", nil)
+	require.Error(t, clientC.EnsureSession(context.TODO(), entry))
+
+	// Streams to allowed destinations are served.
+	lis, err := clientB.Listen(port)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, lis.Close()) }()
+
+	dSes, ok := clientA.Session(pkSrv)
+	require.True(t, ok)
+	str, err := dSes.DialStream(Addr{PK: pkB, Port: port})
+	require.NoError(t, err)
+	require.NoError(t, str.Close())
+
+	// Streams to denied destinations are rejected.
+	_, err = dSes.DialStream(Addr{PK: pkD, Port: port})
+	require.Equal(t, ErrReqDenied, err)
+
+	// Client B is denied after reloading the ACL.
+	writeACL(ACLRules{Sessions: PKRules{Deny: []cipher.PubKey{pkB}}})
+	require.NoError(t, srv.ReloadACL())
+
+	require.Eventually(t, func() bool {
+		_, ok := srv.GetSessions()[pkB]
+		return !ok
+	}, 5*time.Second, 50*time.Millisecond)
+	_, err = dSes.DialStream(Addr{PK: pkB, Port: port})
+	require.Error(t, err)
+
+	// Client C is now allowed.
+	require.NoError(t, clientC.EnsureSession(context.TODO(), entry))
+}
@@ -0,0 +1,124 @@
+// Package dmsg pkg/dmsg/capabilities.go
+package dmsg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/skycoin/dmsg/pkg/noise"
+)
+
+// Fields of the session handshake payload (see docs/wire-format.md).
+// Fields are of format [ type (1 byte) | len (2 bytes) | value ], and fields of unknown types are ignored.
+const (
+	hsFieldPayloadVersion = uint8(1) // HandshakePayloadVersion
+	hsFieldWireVersions   = uint8(2) // supported wire versions, a byte each
+	hsFieldFeatures       = uint8(3) // supported features, a 4-byte bitmask
+	hsFieldFrameSize      = uint8(4) // largest accepted noise frame size, a 4-byte integer
+)
+
+// Feature is an optional feature of the dmsg protocol.
+// A feature is only used within a session if both sides of the session support it.
+type Feature uint32
+
+// Features of the dmsg protocol.
+const (
+	// FeatureDatagrams is the relay of datagrams over datagram channels (see PacketConn).
+	FeatureDatagrams Feature = 1 << iota
+	// FeatureRekey is the rekeying of noise cipher states after the thresholds of noise.RekeyConfig.
+	FeatureRekey
+	// FeatureAdmission is the explicit admission (or redirect) of a session by the dmsg server once the session is
+	// registered (see SessionAdmission).
+	FeatureAdmission
+)
+
+// localFeatures are the features which are supported by us.
+const localFeatures = FeatureDatagrams | FeatureRekey | FeatureAdmission
+
+var featureNames = []struct {
+	f    Feature
+	name string
+}{
+	{f: FeatureDatagrams, name: "datagrams"},
+	{f: FeatureRekey, name: "rekey"},
+	{f: FeatureAdmission, name: "admission"},
+}
+
+// String implements fmt.Stringer
+func (f Feature) String() string {
+	var names []string
+	for _, fn := range featureNames {
+		if f&fn.f != 0 {
+			names = append(names, fn.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// Capabilities are negotiated by both sides of a session within the session handshake.
+// Remotes which do not negotiate (older versions of dmsg) have zero capabilities, and accept frames of
+// noise.DefaultFrameSize.
+type Capabilities struct {
+	Version     string  // protocol version of the remote (HandshakePayloadVersion), empty if it does not negotiate
+	WireVersion uint8   // wire version of stream requests and responses, 0 is gob (see docs/wire-format.md)
+	Features    Feature // features which are supported by both sides
+	FrameSize   int     // largest noise frame size which the remote accepts
+}
+
+// Has returns true if both sides of the session support the feature.
+func (c Capabilities) Has(f Feature) bool {
+	return c.Features&f == f
+}
+
+// String implements fmt.Stringer
+func (c Capabilities) String() string {
+	return fmt.Sprintf("version=%q wire=%d features=%s frame_size=%d", c.Version, c.WireVersion, c.Features, c.FrameSize)
+}
+
+// makeHandshakePayload returns the payload of the session handshake, which advertises our capabilities.
+func makeHandshakePayload() []byte {
+	var features, frameSize [4]byte
+	binary.BigEndian.PutUint32(features[:], uint32(localFeatures))
+	binary.BigEndian.PutUint32(frameSize[:], noise.MaxFrameSize)
+
+	var b []byte
+	b = appendField(b, hsFieldPayloadVersion, []byte(HandshakePayloadVersion))
+	b = appendField(b, hsFieldWireVersions, wireVersions)
+	b = appendField(b, hsFieldFeatures, features[:])
+	b = appendField(b, hsFieldFrameSize, frameSize[:])
+	return b
+}
+
+// negotiateCapabilities returns the capabilities of a session, of which the remote sent the given handshake payload.
+// Malformed payloads are treated as no payload.
+func negotiateCapabilities(payload []byte) Capabilities {
+	fields, err := readFields(payload)
+	if err != nil {
+		return Capabilities{FrameSize: noise.DefaultFrameSize}
+	}
+	caps := Capabilities{
+		Version:     string(fields[hsFieldPayloadVersion]),
+		WireVersion: negotiateWire(fields[hsFieldWireVersions]),
+		FrameSize:   noise.DefaultFrameSize,
+	}
+	// Features which are unknown to us are ignored.
+	if features := fields[hsFieldFeatures]; len(features) == 4 {
+		caps.Features = Feature(binary.BigEndian.Uint32(features)) & localFeatures
+	}
+	if frameSize := fields[hsFieldFrameSize]; len(frameSize) == 4 {
+		caps.FrameSize = boundFrameSize(int(binary.BigEndian.Uint32(frameSize)))
+	}
+	return caps
+}
+
+// boundFrameSize bounds the noise frame size by noise.DefaultFrameSize and noise.MaxFrameSize.
+func boundFrameSize(size int) int {
+	if size < noise.DefaultFrameSize {
+		return noise.DefaultFrameSize
+	}
+	if size > noise.MaxFrameSize {
+		return noise.MaxFrameSize
+	}
+	return size
+}
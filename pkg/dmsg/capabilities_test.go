@@ -0,0 +1,144 @@
+// Package dmsg pkg/dmsg/capabilities_test.go
+package dmsg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/dmsg/pkg/noise"
+)
+
+// ourCaps are the capabilities which are negotiated between two sides of this version.
+var ourCaps = Capabilities{
+	Version:     HandshakePayloadVersion,
+	WireVersion: wireV1,
+	Features:    localFeatures,
+	FrameSize:   noise.MaxFrameSize,
+}
+
+// legacyCaps are the capabilities of remotes which do not negotiate.
+var legacyCaps = Capabilities{FrameSize: noise.DefaultFrameSize}
+
+func TestNegotiateCapabilities(t *testing.T) {
+	uint32Bytes := func(v uint32) []byte {
+		return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	}
+
+	cases := []struct {
+		name    string
+		payload []byte
+		want    Capabilities
+	}{
+		{
+			name:    "no_payload",
+			payload: nil,
+			want:    legacyCaps,
+		},
+		{
+			name:    "ours",
+			payload: makeHandshakePayload(),
+			want:    ourCaps,
+		},
+		{
+			name:    "unknown_features",
+			payload: appendField(nil, hsFieldFeatures, uint32Bytes(uint32(FeatureRekey)|1<<31)),
+			want:    Capabilities{Features: FeatureRekey, FrameSize: noise.DefaultFrameSize},
+		},
+		{
+			name:    "frame_size",
+			payload: appendField(nil, hsFieldFrameSize, uint32Bytes(16*1024)),
+			want:    Capabilities{FrameSize: 16 * 1024},
+		},
+		{
+			name:    "frame_size_out_of_range",
+			payload: appendField(nil, hsFieldFrameSize, uint32Bytes(1<<20)),
+			want:    Capabilities{FrameSize: noise.MaxFrameSize},
+		},
+		{
+			name:    "unknown_fields",
+			payload: appendField(appendField(nil, 0xFF, []byte("unknown")), hsFieldPayloadVersion, []byte("3.0")),
+			want:    Capabilities{Version: "3.0", FrameSize: noise.DefaultFrameSize},
+		},
+		{
+			name:    "malformed",
+			payload: append(makeHandshakePayload(), hsFieldFeatures, 0x00),
+			want:    legacyCaps,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, negotiateCapabilities(tc.payload))
+		})
+	}
+}
+
+// Ensure that rekeying is disabled when the remote does not negotiate capabilities.
+// Arrange:
+// - Noise XK initiator and responder which rekey after every frame, of which only the initiator sends a handshake payload.
+// Act:
+// - Both sides negotiate the capabilities after the handshake.
+// Assert:
+// - The responder negotiates our capabilities, and still rekeys.
+// - The initiator negotiates legacy capabilities (as if the responder was an older version), and stops rekeying.
+func TestNegotiateCaps_Legacy(t *testing.T) {
+	rekey := noise.RekeyConfig{Bytes: 1}
+	pkI, skI := GenKeyPair(t, "caps initiator")
+	pkR, skR := GenKeyPair(t, "caps responder")
+
+	nI, err := noise.New(noise.HandshakeXK, noise.Config{LocalPK: pkI, LocalSK: skI, RemotePK: pkR, Initiator: true, Rekey: rekey})
+	require.NoError(t, err)
+	nR, err := noise.New(noise.HandshakeXK, noise.Config{LocalPK: pkR, LocalSK: skR, Initiator: false, Rekey: rekey})
+	require.NoError(t, err)
+	nI.SetHandshakePayload(makeHandshakePayload())
+
+	// -> e, es
+	msg, err := nI.MakeHandshakeMessage()
+	require.NoError(t, err)
+	require.NoError(t, nR.ProcessHandshakeMessage(msg))
+	// <- e, ee
+	msg, err = nR.MakeHandshakeMessage()
+	require.NoError(t, err)
+	require.NoError(t, nI.ProcessHandshakeMessage(msg))
+	// -> s, se
+	msg, err = nI.MakeHandshakeMessage()
+	require.NoError(t, err)
+	require.NoError(t, nR.ProcessHandshakeMessage(msg))
+
+	assert.Equal(t, legacyCaps, negotiateCaps(nI))
+	assert.Equal(t, ourCaps, negotiateCaps(nR))
+
+	nI.EncryptUnsafe([]byte("foo"))
+	nR.EncryptUnsafe([]byte("bar"))
+	assert.False(t, nI.RekeyDue())
+	assert.True(t, nR.RekeyDue())
+}
+
+// Ensure that both sides of a session negotiate the same capabilities.
+// Arrange:
+// - Dmsg server, and a client with a session to the server.
+// Act:
+// - Obtain the capabilities of the session from both sides.
+// Assert:
+// - Both sides negotiate all of our capabilities.
+func TestSessionCommon_Capabilities(t *testing.T) {
+	env := newTestEnv(t)
+	srv := env.newServer("caps server", nil)
+	srvPK := srv.LocalPK()
+	client := env.connectClient("caps client", &Config{}, srv)
+	pk := client.LocalPK()
+
+	cSes, ok := client.clientSession(client.porter, srvPK)
+	require.True(t, ok)
+	assert.Equal(t, ourCaps, cSes.Capabilities())
+	assert.True(t, cSes.Capabilities().Has(FeatureDatagrams|FeatureRekey))
+
+	var sSes *SessionCommon
+	require.Eventually(t, func() bool {
+		sSes, ok = srv.session(pk)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, ourCaps, sSes.Capabilities())
+}
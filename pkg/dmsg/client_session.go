@@ -28,7 +28,20 @@ func makeClientSession(entity *EntityCommon, porter *netutil.Porter, conn net.Co
 }
 
 // DialStream attempts to dial a stream to a remote client via the dmsg server that this session is connected to.
-func (cs *ClientSession) DialStream(dst Addr) (dStr *Stream, err error) {
+// The request is of the wire version which is negotiated with the dmsg server. If a session on the route of the
+// request does not support it, the stream is dialed again with a gob-encoded request.
+func (cs *ClientSession) DialStream(dst Addr) (*Stream, error) {
+	dStr, err := cs.dialStream(dst, cs.caps.WireVersion)
+	if errors.Is(err, ErrReqUnsupportedWire) && cs.caps.WireVersion != wireGob {
+		cs.log.WithError(err).
+			WithField("dst_addr", dst).
+			Debug("Dialing stream again with gob-encoded request.")
+		dStr, err = cs.dialStream(dst, wireGob)
+	}
+	return dStr, err
+}
+
+func (cs *ClientSession) dialStream(dst Addr, ver uint8) (dStr *Stream, err error) {
 	log := cs.log.
 		WithField("func", "ClientSession.DialStream").
 		WithField("dst_addr", dst)
@@ -47,12 +60,13 @@ func (cs *ClientSession) DialStream(dst Addr) (dStr *Stream, err error) {
 	}()
 
 	// Prepare deadline.
-	if err = dStr.SetDeadline(time.Now().Add(HandshakeTimeout)); err != nil {
+	hsStart := time.Now()
+	if err = dStr.SetDeadline(hsStart.Add(HandshakeTimeout)); err != nil {
 		return nil, err
 	}
 
 	// Do stream handshake.
-	req, err := dStr.writeRequest(dst)
+	req, err := dStr.writeRequest(dst, ver)
 	if err != nil {
 		return nil, err
 	}
@@ -66,11 +80,13 @@ func (cs *ClientSession) DialStream(dst Addr) (dStr *Stream, err error) {
 		return nil, err
 	}
 
+	dStr.markOpened(EventStreamDialed, hsStart)
 	return dStr, err
 }
 
 // serve accepts incoming streams from remote clients.
-func (cs *ClientSession) serve() error {
+// When the dmsg server informs us that it is draining, the session is marked as draining and 'onDrain' is called.
+func (cs *ClientSession) serve(onDrain func(rErr *RedirectError)) error {
 	defer func() {
 		if err := cs.Close(); err != nil {
 			cs.log.WithError(err).
@@ -79,6 +95,16 @@ func (cs *ClientSession) serve() error {
 	}()
 	for {
 		if _, err := cs.acceptStream(); err != nil {
+			var rErr *RedirectError
+			if errors.As(err, &rErr) {
+				cs.log.Info("Dmsg server is draining.")
+				cs.setDraining()
+				onDrain(rErr)
+				continue
+			}
+			if err == ErrReqRejected {
+				continue
+			}
 			if netErr, ok := err.(net.Error); ok && netErr.Temporary() { //nolint
 				cs.log.
 					WithError(err).
@@ -112,7 +138,8 @@ func (cs *ClientSession) acceptStream() (dStr *Stream, err error) {
 	}()
 
 	// Prepare deadline.
-	if err = dStr.SetDeadline(time.Now().Add(HandshakeTimeout)); err != nil {
+	hsStart := time.Now()
+	if err = dStr.SetDeadline(hsStart.Add(HandshakeTimeout)); err != nil {
 		return nil, err
 	}
 
@@ -121,7 +148,33 @@ func (cs *ClientSession) acceptStream() (dStr *Stream, err error) {
 	if err != nil {
 		return nil, err
 	}
-	if err = dStr.writeResponse(req.raw.Hash()); err != nil {
+
+	// Stale and replayed requests are rejected without ending the session, as the dmsg server may be relaying them.
+	if tErr := cs.entity.reqs.check(req.SrcAddr.PK, req.Timestamp, time.Now()); tErr != nil {
+		cs.log.WithError(tErr).
+			WithField("src_addr", req.SrcAddr).
+			WithField("dst_addr", req.DstAddr).
+			Warn("Rejecting stale or replayed stream request.")
+		if err = dStr.writeRejection(req, tErr); err != nil {
+			return nil, err
+		}
+		return nil, ErrReqRejected
+	}
+	lis, err := dStr.listener()
+	if err != nil {
+		return nil, err
+	}
+	if fErr := lis.filterStream(req.SrcAddr); fErr != nil {
+		cs.log.WithError(fErr).
+			WithField("src_addr", req.SrcAddr).
+			WithField("dst_addr", req.DstAddr).
+			Debug("Stream rejected by accept filter.")
+		if err = dStr.writeRejection(req, fErr); err != nil {
+			return nil, err
+		}
+		return nil, ErrReqRejected
+	}
+	if err = dStr.writeResponse(req, lis, hsStart); err != nil {
 		return nil, err
 	}
 
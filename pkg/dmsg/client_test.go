@@ -0,0 +1,87 @@
+// Package dmsg pkg/dmsg/client_test.go
+package dmsg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Ensure that a dial with a stale cached entry of the remote client is retried with a fresh entry.
+// Arrange:
+// - Dmsg servers 1 and 2, and clients A and B with sessions to server 1.
+// - Client A dials client B, which caches the entry of client B.
+// Act:
+// - Server 1 closes, and client B establishes a session with server 2.
+// - Client A dials client B again.
+// Assert:
+// - The dial through the cached delegated server (server 1) fails, and the dial is retried through server 2.
+func TestClient_DialStream_StaleEntry(t *testing.T) {
+	const port = uint16(80)
+
+	env := newTestEnv(t)
+	srv1 := env.newServer("stale server 1", nil)
+	srv2 := env.newServer("stale server 2", nil)
+
+	clientA := env.connectClient("stale client A", &Config{}, srv1)
+	clientB := env.connectClient("stale client B", &Config{}, srv1)
+
+	lis, err := clientB.Listen(port)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, lis.Close()) }()
+	dstAddr := Addr{PK: clientB.LocalPK(), Port: port}
+
+	dial := func() {
+		strA, err := clientA.DialStream(context.TODO(), dstAddr)
+		require.NoError(t, err)
+		strB, err := lis.AcceptStream()
+		require.NoError(t, err)
+		assert.NoError(t, strA.Close())
+		assert.NoError(t, strB.Close())
+	}
+	dial()
+
+	// Client B migrates to server 2, while client A holds the entry of client B which delegates server 1.
+	require.NoError(t, srv1.Close())
+	require.NoError(t, clientB.EnsureSession(context.TODO(), env.entry(srv2.LocalPK())))
+
+	entry, err := clientA.dc.Entry(context.TODO(), clientB.LocalPK())
+	require.NoError(t, err)
+	assert.Equal(t, []cipher.PubKey{srv1.LocalPK()}, entry.Client.DelegatedServers)
+
+	dial()
+}
+
+// Ensure that a dial through an established session, of which the remote client rejects the stream, is not retried
+// through other dmsg servers.
+// Arrange:
+// - Dmsg servers 1 and 2 which forward streams, client A with a session to server 1.
+// - Client B with a session to server 2, which rejects streams with a RejectError.
+// Act:
+// - Client A dials client B.
+// Assert:
+// - The dial is forwarded from server 1 to server 2, and fails with the RejectError.
+// - Client A does not establish a session with server 2 to dial again.
+func TestClient_DialStream_Rejected(t *testing.T) {
+	const port = uint16(80)
+	const rejectCode = MinRejectCode + 1
+
+	env := newTestEnv(t)
+	srv1 := env.newServer("rejected server 1", &ServerConfig{MaxSessions: 10, ForwardStreams: true})
+	srv2 := env.newServer("rejected server 2", &ServerConfig{MaxSessions: 10, ForwardStreams: true})
+
+	clientA := env.connectClient("rejected client A", &Config{}, srv1)
+	clientB := env.connectClient("rejected client B", &Config{}, srv2)
+
+	lis, err := clientB.Listen(port)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, lis.Close()) }()
+	lis.SetAcceptFilter(func(Addr) error { return &RejectError{Code: rejectCode} })
+
+	_, err = clientA.DialStream(context.TODO(), Addr{PK: clientB.LocalPK(), Port: port})
+	assert.ErrorIs(t, err, &RejectError{Code: rejectCode})
+	assert.Len(t, clientA.AllSessions(), 1)
+}
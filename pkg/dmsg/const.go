@@ -11,6 +11,8 @@ const (
 
 	DefaultUpdateInterval = time.Minute
 
+	DefaultReselectInterval = time.Minute * 10
+
 	DefaultMaxSessions = 100
 
 	DefaultDmsgHTTPPort = uint16(80)
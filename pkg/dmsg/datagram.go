@@ -0,0 +1,221 @@
+// Package dmsg pkg/dmsg/datagram.go
+package dmsg
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/yamux"
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+
+	"github.com/skycoin/dmsg/pkg/noise"
+)
+
+// MaxDatagramSize is the maximum payload size of a single datagram.
+// Datagrams, their headers and encryption overhead must fit in a single session frame.
+const MaxDatagramSize = 64000
+
+var (
+	// DatagramBufferSize defines the number of received datagrams which a PacketConn buffers before further
+	// datagrams are dropped.
+	DatagramBufferSize = 128
+)
+
+const (
+	pkLen             = len(cipher.PubKey{})
+	datagramHeaderLen = pkLen + 4 // public key, source port, destination port
+	nonceLen          = 8
+)
+
+var (
+	errInvalidDatagram        = errors.New("invalid datagram")
+	errStaleDatagramHandshake = errors.New("datagram handshake is not newer than the current one")
+)
+
+// datagramFrame is a single datagram as carried by a datagram channel.
+// When sent from a client to the dmsg server, 'pk' is that of the destination client. When sent from the dmsg server to
+// a client, 'pk' is that of the source client.
+type datagramFrame struct {
+	pk      cipher.PubKey
+	srcPort uint16
+	dstPort uint16
+	payload []byte // end-to-end encrypted, see datagramSealer
+}
+
+func (f datagramFrame) encode() []byte {
+	b := make([]byte, datagramHeaderLen+len(f.payload))
+	copy(b, f.pk[:])
+	binary.BigEndian.PutUint16(b[pkLen:], f.srcPort)
+	binary.BigEndian.PutUint16(b[pkLen+2:], f.dstPort)
+	copy(b[datagramHeaderLen:], f.payload)
+	return b
+}
+
+func decodeDatagramFrame(b []byte) (datagramFrame, error) {
+	if len(b) < datagramHeaderLen {
+		return datagramFrame{}, errInvalidDatagram
+	}
+	var f datagramFrame
+	copy(f.pk[:], b)
+	f.srcPort = binary.BigEndian.Uint16(b[pkLen:])
+	f.dstPort = binary.BigEndian.Uint16(b[pkLen+2:])
+	f.payload = b[datagramHeaderLen:]
+	return f, nil
+}
+
+// datagramChannel is a yamux stream of a session which carries datagram frames.
+// Frames are encrypted with the noise state of the session (the same as stream handshake objects).
+type datagramChannel struct {
+	ses  *SessionCommon
+	yStr *yamux.Stream
+	wMx  sync.Mutex
+}
+
+func (ch *datagramChannel) write(f datagramFrame) error {
+	ch.wMx.Lock()
+	defer ch.wMx.Unlock()
+	return ch.ses.writeObject(ch.yStr, f.encode())
+}
+
+func (ch *datagramChannel) read() (datagramFrame, error) {
+	obj, err := ch.ses.readObject(ch.yStr)
+	if err != nil {
+		return datagramFrame{}, err
+	}
+	return decodeDatagramFrame(obj)
+}
+
+// datagramSealer encrypts datagrams for a remote client with the one-way noise K handshake pattern.
+// The handshake message is prepended to every datagram, so that each datagram can be decrypted regardless of which
+// datagrams before it were lost. The receiving side only processes the handshake message once (see datagramOpener).
+// The K pattern has no freshness, so the handshake payload carries the time at which the sealer is created. The payload
+// is authenticated by the static keys of both clients, so that relaying servers cannot replace it.
+type datagramSealer struct {
+	mx sync.Mutex
+	ns *noise.Noise
+	hs []byte
+}
+
+func newDatagramSealer(lPK cipher.PubKey, lSK cipher.SecKey, rPK cipher.PubKey) (*datagramSealer, error) {
+	ns, err := noise.New(noise.HandshakeK, noise.Config{
+		LocalPK:   lPK,
+		LocalSK:   lSK,
+		RemotePK:  rPK,
+		Initiator: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(time.Now().UnixNano()))
+	ns.SetHandshakePayload(ts[:])
+	hs, err := ns.MakeHandshakeMessage()
+	if err != nil {
+		return nil, err
+	}
+	return &datagramSealer{ns: ns, hs: hs}, nil
+}
+
+// seal encrypts the datagram into the format: [handshake length (1)][handshake][nonce (8)][ciphertext]
+func (s *datagramSealer) seal(p []byte) []byte {
+	s.mx.Lock()
+	ct := s.ns.EncryptUnsafe(p)
+	s.mx.Unlock()
+
+	b := make([]byte, 1+len(s.hs)+len(ct))
+	b[0] = byte(len(s.hs))
+	copy(b[1:], s.hs)
+	copy(b[1+len(s.hs):], ct)
+	return b
+}
+
+// splitSealedDatagram splits a sealed datagram into the handshake message and the ciphertext.
+func splitSealedDatagram(b []byte) (hs, ct []byte, err error) {
+	if len(b) < 1 || len(b) < 1+int(b[0])+nonceLen {
+		return nil, nil, errInvalidDatagram
+	}
+	return b[1 : 1+int(b[0])], b[1+int(b[0]):], nil
+}
+
+// datagramOpener decrypts datagrams which are sealed by the datagramSealer of a remote client.
+type datagramOpener struct {
+	mx  sync.Mutex
+	ns  *noise.Noise
+	hs  []byte
+	ts  int64 // time at which the remote sealer is created (unix nano)
+	win replayWindow
+}
+
+func newDatagramOpener(lPK cipher.PubKey, lSK cipher.SecKey, rPK cipher.PubKey, hs []byte) (*datagramOpener, error) {
+	ns, err := noise.New(noise.HandshakeK, noise.Config{
+		LocalPK:   lPK,
+		LocalSK:   lSK,
+		RemotePK:  rPK,
+		Initiator: false,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := ns.ProcessHandshakeMessage(hs); err != nil {
+		return nil, err
+	}
+	ts := ns.RemoteHandshakePayload()
+	if len(ts) != 8 {
+		return nil, errInvalidDatagram
+	}
+	return &datagramOpener{
+		ns: ns,
+		hs: append([]byte(nil), hs...),
+		ts: int64(binary.BigEndian.Uint64(ts)),
+	}, nil
+}
+
+// open decrypts the ciphertext of a sealed datagram.
+// Datagrams may arrive out of order, but replayed datagrams are rejected.
+func (o *datagramOpener) open(ct []byte) ([]byte, error) {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	p, err := o.ns.DecryptWithNonceMap(nil, ct)
+	if err != nil {
+		return nil, err
+	}
+	if !o.win.accept(binary.BigEndian.Uint64(ct)) {
+		return nil, errInvalidDatagram
+	}
+	return p, nil
+}
+
+// replayWindowSize is the number of most recent nonces which are tracked by a replayWindow.
+const replayWindowSize = 64
+
+// replayWindow is a sliding window of received nonces.
+// Nonces which are received twice, or which are older than the window, are not accepted.
+type replayWindow struct {
+	max    uint64 // highest nonce received so far
+	bitmap uint64 // bit i is set if nonce (max - i) has been received
+}
+
+func (w *replayWindow) accept(nonce uint64) bool {
+	switch {
+	case nonce > w.max:
+		if shift := nonce - w.max; shift < replayWindowSize {
+			w.bitmap = w.bitmap<<shift | 1
+		} else {
+			w.bitmap = 1
+		}
+		w.max = nonce
+		return true
+	case w.max-nonce >= replayWindowSize:
+		return false
+	default:
+		bit := uint64(1) << (w.max - nonce)
+		if w.bitmap&bit != 0 {
+			return false
+		}
+		w.bitmap |= bit
+		return true
+	}
+}
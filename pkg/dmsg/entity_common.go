@@ -4,6 +4,8 @@ package dmsg
 import (
 	"context"
 	"errors"
+	"io"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -14,6 +16,7 @@ import (
 	"github.com/skycoin/skywire-utilities/pkg/netutil"
 
 	"github.com/skycoin/dmsg/pkg/disc"
+	"github.com/skycoin/dmsg/pkg/noise"
 )
 
 // EntityCommon contains the common fields and methods for server and client entities.
@@ -28,13 +31,22 @@ type EntityCommon struct {
 	sessions   map[cipher.PubKey]*SessionCommon
 	sessionsMx *sync.Mutex
 
+	services map[uint16]disc.Service // services advertised in the client entry, protected by 'sessionsMx'
+
 	updateInterval time.Duration // Minimum duration between discovery entry updates.
 
+	rekey     noise.RekeyConfig // rekeying of the noise cipher states of sessions and streams
+	frameSize int               // size of noise frames which are written to streams
+
+	reqs *reqTracker // timestamps of received stream requests (for replay protection)
+
 	log  logrus.FieldLogger
 	mlog *logging.MasterLogger
 
 	setSessionCallback func(ctx context.Context) error
 	delSessionCallback func(ctx context.Context) error
+
+	events eventBus
 }
 
 func (c *EntityCommon) init(pk cipher.PubKey, sk cipher.SecKey, dc disc.APIClient, log logrus.FieldLogger, updateInterval time.Duration) {
@@ -46,7 +58,9 @@ func (c *EntityCommon) init(pk cipher.PubKey, sk cipher.SecKey, dc disc.APIClien
 	c.dc = dc
 	c.sessions = make(map[cipher.PubKey]*SessionCommon)
 	c.sessionsMx = new(sync.Mutex)
+	c.services = make(map[uint16]disc.Service)
 	c.updateInterval = updateInterval
+	c.reqs = newReqTracker(DefaultReqFreshness, reqTrackerSize)
 	c.log = log
 }
 
@@ -70,6 +84,15 @@ func (c *EntityCommon) MasterLogger() *logging.MasterLogger { return c.mlog }
 // This should be called before we serve.
 func (c *EntityCommon) SetMasterLogger(mlog *logging.MasterLogger) { c.mlog = mlog }
 
+// writeFrameSize returns the size of noise frames which are written to a remote that accepts frames of up to
+// 'accepted' bytes.
+func (c *EntityCommon) writeFrameSize(accepted int) int {
+	if c.frameSize < accepted {
+		return boundFrameSize(c.frameSize)
+	}
+	return boundFrameSize(accepted)
+}
+
 func (c *EntityCommon) session(pk cipher.PubKey) (*SessionCommon, bool) {
 	c.sessionsMx.Lock()
 	dSes, ok := c.sessions[pk]
@@ -143,26 +166,37 @@ func (c *EntityCommon) delSession(ctx context.Context, pk cipher.PubKey) {
 
 // updateServerEntry updates the dmsg server's entry within dmsg discovery.
 // If 'addr' is an empty string, the Entry.addr field will not be updated in discovery.
-func (c *EntityCommon) updateServerEntry(ctx context.Context, addr string, maxSessions int) (err error) {
+// A draining server advertises no available sessions.
+func (c *EntityCommon) updateServerEntry(ctx context.Context, addr string, transports []disc.Transport, maxSessions int, draining bool) (err error) {
 	if addr == "" {
 		panic("updateServerEntry cannot accept empty 'addr' input") // this should never happen
 	}
 
-	// Record last update on success.
+	// Record last update on success, and emit the result of submitted updates.
+	var submitted bool
 	defer func() {
 		if err == nil {
 			c.recordUpdate()
 		}
+		if submitted || err != nil {
+			c.emitEntryUpdate(err)
+		}
 	}()
 
 	availableSessions := maxSessions - len(c.sessions)
+	if draining {
+		availableSessions = 0
+	}
 
 	entry, err := c.dc.Entry(ctx, c.pk)
 	if err != nil {
 		entry = disc.NewServerEntry(c.pk, 0, addr, availableSessions)
+		entry.Server.Transports = transports
+		entry.Server.Draining = draining
 		if err := entry.Sign(c.sk); err != nil {
 			return err
 		}
+		submitted = true
 		return c.dc.PostEntry(ctx, entry)
 	}
 
@@ -172,9 +206,11 @@ func (c *EntityCommon) updateServerEntry(ctx context.Context, addr string, maxSe
 
 	sessionsDelta := entry.Server.AvailableSessions != availableSessions
 	addrDelta := entry.Server.Address != addr
+	transportsDelta := !transportsEqual(entry.Server.Transports, transports)
+	drainingDelta := entry.Server.Draining != draining
 
 	// No update needed if entry has no delta AND update is not due.
-	if _, due := c.updateIsDue(); !sessionsDelta && !addrDelta && !due {
+	if _, due := c.updateIsDue(); !sessionsDelta && !addrDelta && !transportsDelta && !drainingDelta && !due {
 		return nil
 	}
 
@@ -187,12 +223,22 @@ func (c *EntityCommon) updateServerEntry(ctx context.Context, addr string, maxSe
 		entry.Server.Address = addr
 		log = log.WithField("addr", entry.Server.Address)
 	}
+	if transportsDelta {
+		entry.Server.Transports = transports
+		log = log.WithField("transports", entry.Server.Transports)
+	}
+	if drainingDelta {
+		entry.Server.Draining = draining
+		log = log.WithField("draining", entry.Server.Draining)
+	}
 	log.Debug("Updating entry.")
 
+	submitted = true
 	return c.dc.PutEntry(ctx, c.sk, entry)
 }
 
-func (c *EntityCommon) updateServerEntryLoop(ctx context.Context, addr string, maxSessions int) {
+// updateServerEntryLoop periodically calls 'update' (with sessionsMx locked) to update the server's discovery entry.
+func (c *EntityCommon) updateServerEntryLoop(ctx context.Context, update func(ctx context.Context) error) {
 	t := time.NewTimer(c.updateInterval)
 	defer t.Stop()
 
@@ -208,7 +254,7 @@ func (c *EntityCommon) updateServerEntryLoop(ctx context.Context, addr string, m
 			}
 
 			c.sessionsMx.Lock()
-			err := c.updateServerEntry(ctx, addr, maxSessions)
+			err := update(ctx)
 			c.sessionsMx.Unlock()
 
 			if err != nil {
@@ -221,34 +267,77 @@ func (c *EntityCommon) updateServerEntryLoop(ctx context.Context, addr string, m
 	}
 }
 
-func (c *EntityCommon) updateClientEntry(ctx context.Context, done chan struct{}) (err error) {
+// clientEntryState is the state of a client which is advertised in its discovery entry.
+type clientEntryState struct {
+	srvPKs   []cipher.PubKey
+	services []disc.Service
+}
+
+// snapshotClientEntry returns the state to advertise in the client entry.
+// 'sessionsMx' should be locked.
+func (c *EntityCommon) snapshotClientEntry() clientEntryState {
+	// Sessions with draining servers are only advertised if there are no others.
+	srvPKs := make([]cipher.PubKey, 0, len(c.sessions))
+	var drainingPKs []cipher.PubKey
+	for pk, ses := range c.sessions {
+		if ses.IsDraining() {
+			drainingPKs = append(drainingPKs, pk)
+			continue
+		}
+		srvPKs = append(srvPKs, pk)
+	}
+	if len(srvPKs) == 0 {
+		srvPKs = drainingPKs
+	}
+
+	// Services are advertised in the order of their ports.
+	var services []disc.Service
+	for _, svc := range c.services {
+		services = append(services, svc)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Port < services[j].Port })
+
+	return clientEntryState{srvPKs: srvPKs, services: services}
+}
+
+// updateClientEntry updates the client entry with the current state. 'sessionsMx' should be locked.
+func (c *EntityCommon) updateClientEntry(ctx context.Context, done chan struct{}) error {
+	return c.submitClientEntry(ctx, done, c.snapshotClientEntry())
+}
+
+// submitClientEntry updates the client entry with the given state.
+// It does not access the sessions, so 'sessionsMx' does not need to be locked.
+func (c *EntityCommon) submitClientEntry(ctx context.Context, done chan struct{}, state clientEntryState) (err error) {
 	if isClosed(done) {
 		return nil
 	}
 
-	// Record last update on success.
+	// Record last update on success, and emit the result of submitted updates.
+	var submitted bool
 	defer func() {
 		if err == nil {
 			c.recordUpdate()
 		}
+		if submitted || err != nil {
+			c.emitEntryUpdate(err)
+		}
 	}()
 
-	srvPKs := make([]cipher.PubKey, 0, len(c.sessions))
-	for pk := range c.sessions {
-		srvPKs = append(srvPKs, pk)
-	}
-
 	entry, err := c.dc.Entry(ctx, c.pk)
 	if err != nil {
-		entry = disc.NewClientEntry(c.pk, 0, srvPKs)
+		entry = disc.NewClientEntry(c.pk, 0, state.srvPKs)
+		entry.Client.Services = state.services
 		if err := entry.Sign(c.sk); err != nil {
 			return err
 		}
+		submitted = true
 		return c.dc.PostEntry(ctx, entry)
 	}
 
-	entry.Client.DelegatedServers = srvPKs
+	entry.Client.DelegatedServers = state.srvPKs
+	entry.Client.Services = state.services
 	c.log.WithField("entry", entry).Debug("Updating entry.")
+	submitted = true
 	return c.dc.PutEntry(ctx, c.sk, entry)
 }
 
@@ -269,6 +358,31 @@ func (c *EntityCommon) delEntry(ctx context.Context) (err error) {
 	return c.dc.DelEntry(ctx, entry)
 }
 
+// invalidateEntry drops the cached discovery entry of the public key (if discovery results are cached).
+// It returns true if an entry was cached.
+func (c *EntityCommon) invalidateEntry(pk cipher.PubKey) bool {
+	if cc, ok := c.dc.(*disc.CachingClient); ok {
+		return cc.Invalidate(pk)
+	}
+	return false
+}
+
+// entryMayBeStale returns true if the error of a dial may be caused by an outdated entry of the remote client.
+func entryMayBeStale(err error) bool {
+	return errors.Is(err, ErrCannotConnectToDelegated) ||
+		errors.Is(err, ErrReqNoNextSession) ||
+		errors.Is(err, ErrDiscEntryHasNoDelegated)
+}
+
+// isRoutingErr returns true if the error of a dial is due to the route of the stream request through a dmsg server,
+// rather than due to the remote client. Such dials may still succeed through other dmsg servers.
+// Older dmsg servers close the stream without a response when there is no next session, which is read as io.EOF.
+func isRoutingErr(err error) bool {
+	return errors.Is(err, ErrReqNoNextSession) ||
+		errors.Is(err, ErrReqUnsupportedWire) ||
+		errors.Is(err, io.EOF)
+}
+
 func getServerEntry(ctx context.Context, dc disc.APIClient, srvPK cipher.PubKey) (*disc.Entry, error) {
 	entry, err := dc.Entry(ctx, srvPK)
 	if err != nil {
@@ -2,8 +2,11 @@
 package dmsg
 
 import (
+	"errors"
 	"fmt"
 	"sync"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
 )
 
 // Errors for dmsg discovery (1xx).
@@ -16,10 +19,18 @@ var (
 
 // Entity Errors (2xx).
 var (
-	ErrEntityClosed               = registerErr(Error{code: 200, msg: "local entity closed"})
-	ErrSessionClosed              = registerErr(Error{code: 201, msg: "local session closed"})
-	ErrCannotConnectToDelegated   = registerErr(Error{code: 202, msg: "cannot connect to delegated server"})
+	ErrEntityClosed             = registerErr(Error{code: 200, msg: "local entity closed"})
+	ErrSessionClosed            = registerErr(Error{code: 201, msg: "local session closed"})
+	ErrCannotConnectToDelegated = registerErr(Error{code: 202, msg: "cannot connect to delegated server"})
+	// ErrSessionHandshakeExtraBytes was returned when extra bytes were received during the session handshake.
+	//
+	// Deprecated: session handshakes no longer read extra bytes, so it is never returned. Code 203 stays reserved.
 	ErrSessionHandshakeExtraBytes = registerErr(Error{code: 203, msg: "extra bytes received during session handshake"})
+	ErrSessionDenied              = registerErr(Error{code: 204, msg: "session denied by server access control list"})
+	ErrSessionRedirected          = registerErr(Error{code: 205, msg: "session redirected as server is full"})
+	ErrServerNotAllowed           = registerErr(Error{code: 206, msg: "server is excluded by client config"})
+	ErrSessionNotFound            = registerErr(Error{code: 207, msg: "session not found"})
+	ErrStreamNotFound             = registerErr(Error{code: 208, msg: "stream not found"})
 )
 
 // Errors for dial request/response (3xx).
@@ -32,6 +43,12 @@ var (
 	ErrReqInvalidDstPort   = registerErr(Error{code: 305, msg: "request has invalid destination port"})
 	ErrReqNoListener       = registerErr(Error{code: 306, msg: "request has no associated listener", temp: true})
 	ErrReqNoNextSession    = registerErr(Error{code: 307, msg: "request cannot be forwarded because the next session is non-existent"})
+	ErrReqRateLimited      = registerErr(Error{code: 308, msg: "request rejected as client exceeded stream request rate limit", temp: true})
+	ErrReqMaxStreams       = registerErr(Error{code: 309, msg: "request rejected as client reached max concurrent streams", temp: true})
+	ErrReqDenied           = registerErr(Error{code: 310, msg: "request denied by server access control list"})
+	ErrReqServerDraining   = registerErr(Error{code: 311, msg: "request rejected as server is draining", temp: true})
+	ErrReqRejected         = registerErr(Error{code: 312, msg: "request rejected by accept filter of remote listener"})
+	ErrReqUnsupportedWire  = registerErr(Error{code: 313, msg: "request wire version is not supported by a session on its route"})
 
 	ErrDialRespInvalidSig  = registerErr(Error{code: 350, msg: "response has invalid signature"})
 	ErrDialRespInvalidHash = registerErr(Error{code: 351, msg: "response has invalid hash of associated request"})
@@ -42,10 +59,80 @@ var (
 
 // Listener errors (4xx).
 var (
-	ErrPortOccupied    = registerErr(Error{code: 400, msg: "port already occupied"})
-	ErrAcceptChanMaxed = registerErr(Error{code: 401, msg: "listener accept chan maxed", temp: true})
+	ErrPortOccupied        = registerErr(Error{code: 400, msg: "port already occupied"})
+	ErrAcceptChanMaxed     = registerErr(Error{code: 401, msg: "listener accept chan maxed", temp: true})
+	ErrDatagramTooLarge    = registerErr(Error{code: 402, msg: "datagram exceeds maximum datagram size"})
+	ErrNotConnected        = registerErr(Error{code: 403, msg: "packet conn has no remote address"})
+	ErrDatagramUnsupported = registerErr(Error{code: 404, msg: "dmsg server does not support datagrams"})
 )
 
+// RedirectError is returned when a full dmsg server redirects a session to alternative dmsg servers.
+type RedirectError struct {
+	Server       cipher.PubKey   // The dmsg server which redirected the session.
+	Alternatives []cipher.PubKey // The dmsg servers which the session is redirected to.
+}
+
+// Error implements error
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("%s: %d alternative servers offered by %s", ErrSessionRedirected.Error(), len(e.Alternatives), e.Server)
+}
+
+// Unwrap allows the error to be matched against ErrSessionRedirected.
+func (e *RedirectError) Unwrap() error {
+	return ErrSessionRedirected
+}
+
+// MinRejectCode is the lowest error code which applications can use to reject streams (see RejectError).
+// Lower codes are reserved for dmsg errors.
+const MinRejectCode = 1000
+
+// RejectError can be returned by an AcceptFilter to reject a stream with an application-defined code.
+// The code is sent to the dialer in the signed stream response, and the dialer obtains it as a *RejectError.
+// Codes lower than MinRejectCode are reserved, and are sent as the code of ErrReqRejected instead.
+type RejectError struct {
+	Code uint16
+}
+
+// Error implements error
+func (e *RejectError) Error() string {
+	return fmt.Sprintf("%s: code %d", ErrReqRejected.Error(), e.Code)
+}
+
+// Unwrap allows the error to be matched against ErrReqRejected.
+func (e *RejectError) Unwrap() error {
+	return ErrReqRejected
+}
+
+// Is matches rejection errors of the same code.
+func (e *RejectError) Is(target error) bool {
+	t, ok := target.(*RejectError)
+	return ok && t.Code == e.Code
+}
+
+// rejectCode returns the error code which a stream response sends to the dialer to reject a stream with 'err'.
+func rejectCode(err error) errorCode {
+	var rErr *RejectError
+	if errors.As(err, &rErr) && rErr.Code >= MinRejectCode {
+		return errorCode(rErr.Code)
+	}
+	var dErr Error
+	if errors.As(err, &dErr) {
+		return dErr.code
+	}
+	return ErrReqRejected.code
+}
+
+// rejectError returns the error of a stream response which rejects a stream with 'code'.
+func rejectError(code errorCode) error {
+	if code >= MinRejectCode {
+		return &RejectError{Code: uint16(code)}
+	}
+	if ok, err := ErrorFromCode(code); ok {
+		return err
+	}
+	return ErrDialRespNotAccepted
+}
+
 // ErrorFromCode returns a saved error (if exists) from given error code.
 func ErrorFromCode(code errorCode) (bool, error) {
 	errMx.RLock()
@@ -0,0 +1,151 @@
+// Package dmsg pkg/dmsg/events.go
+package dmsg
+
+import (
+	"sync"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+)
+
+// EventType is the type of an Event.
+type EventType string
+
+// Event types.
+const (
+	// EventSessionEstablished is emitted once a session is established and served.
+	EventSessionEstablished EventType = "session_established"
+	// EventSessionClosed is emitted once a session stops being served. Duration is the lifetime of the session.
+	EventSessionClosed EventType = "session_closed"
+
+	// EventStreamDialed is emitted once a client dials a stream.
+	EventStreamDialed EventType = "stream_dialed"
+	// EventStreamAccepted is emitted once a client accepts a stream, or once a server starts serving a stream.
+	EventStreamAccepted EventType = "stream_accepted"
+	// EventStreamClosed is emitted once a stream is closed. Duration is the lifetime of the stream.
+	EventStreamClosed EventType = "stream_closed"
+
+	// EventEntryUpdated is emitted once the entity's entry is updated in discovery.
+	EventEntryUpdated EventType = "entry_updated"
+	// EventEntryUpdateFailed is emitted if updating the entity's entry in discovery fails.
+	EventEntryUpdateFailed EventType = "entry_update_failed"
+
+	// EventBackoff is emitted when a client backs off before retrying to establish sessions.
+	// Duration is the backoff duration.
+	EventBackoff EventType = "backoff"
+)
+
+// Event is a lifecycle event of a dmsg client or server.
+// Fields which are not relevant to the event type are left empty.
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	// RemotePK is the public key of the remote entity of the session (the server for clients, and the client for
+	// servers).
+	RemotePK cipher.PubKey
+
+	// SrcAddr and DstAddr are the addresses of the initiating and responding sides of a stream.
+	SrcAddr Addr
+	DstAddr Addr
+
+	Duration time.Duration
+	Err      error
+}
+
+// EventSubscriber is notified of events.
+// Events are delivered in order, by a goroutine dedicated to the subscriber.
+type EventSubscriber interface {
+	OnEvent(e Event)
+}
+
+// EventSubscriberFunc implements EventSubscriber for a function.
+type EventSubscriberFunc func(e Event)
+
+// OnEvent implements EventSubscriber
+func (fn EventSubscriberFunc) OnEvent(e Event) { fn(e) }
+
+// DefaultEventBufferSize is the default number of events which are buffered per subscription.
+// Events are dropped for a subscription whose buffer is full, so that slow subscribers never hold back the entity.
+const DefaultEventBufferSize = 128
+
+type eventSubscription struct {
+	ch   chan Event
+	once sync.Once
+}
+
+// eventBus fans out events to subscriptions.
+type eventBus struct {
+	subs map[*eventSubscription]struct{}
+	mx   sync.RWMutex
+}
+
+func (b *eventBus) subscribe(bufSize int) (*eventSubscription, func()) {
+	if bufSize <= 0 {
+		bufSize = DefaultEventBufferSize
+	}
+	sub := &eventSubscription{ch: make(chan Event, bufSize)}
+
+	b.mx.Lock()
+	if b.subs == nil {
+		b.subs = make(map[*eventSubscription]struct{})
+	}
+	b.subs[sub] = struct{}{}
+	b.mx.Unlock()
+
+	unsubscribe := func() {
+		sub.once.Do(func() {
+			b.mx.Lock()
+			delete(b.subs, sub)
+			close(sub.ch)
+			b.mx.Unlock()
+		})
+	}
+	return sub, unsubscribe
+}
+
+// emit delivers the event to all subscriptions without blocking.
+func (b *eventBus) emit(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mx.RLock()
+	defer b.mx.RUnlock()
+
+	for sub := range b.subs {
+		select {
+		case sub.ch <- e:
+		default:
+		}
+	}
+}
+
+// Events returns a chan which receives the entity's events, and a function to stop receiving them (which closes the
+// chan). Up to 'bufSize' events are buffered (DefaultEventBufferSize if 'bufSize' is not positive), further events are
+// dropped until the chan is read from.
+func (c *EntityCommon) Events(bufSize int) (<-chan Event, func()) {
+	sub, unsubscribe := c.events.subscribe(bufSize)
+	return sub.ch, unsubscribe
+}
+
+// Subscribe notifies the subscriber of the entity's events until the returned function is called.
+// Events are buffered as with Events.
+func (c *EntityCommon) Subscribe(s EventSubscriber) (unsubscribe func()) {
+	sub, unsubscribe := c.events.subscribe(DefaultEventBufferSize)
+	go func() {
+		for e := range sub.ch {
+			s.OnEvent(e)
+		}
+	}()
+	return unsubscribe
+}
+
+// emitEntryUpdate emits the result of updating the entity's entry in discovery.
+func (c *EntityCommon) emitEntryUpdate(err error) {
+	if err != nil {
+		c.events.emit(Event{Type: EventEntryUpdateFailed, Err: err})
+		return
+	}
+	c.events.emit(Event{Type: EventEntryUpdated})
+}
@@ -0,0 +1,99 @@
+// Package dmsg pkg/dmsg/events_test.go
+package dmsg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// awaitEvent reads events until one of the given type is received.
+func awaitEvent(t *testing.T, ch <-chan Event, typ EventType) Event {
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case e, ok := <-ch:
+			require.True(t, ok, "event chan closed while waiting for %s", typ)
+			if e.Type == typ {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", typ)
+		}
+	}
+}
+
+// Ensure that dmsg clients and servers emit lifecycle events.
+// Arrange:
+// - Dmsg server with event chan.
+// - Client 1 with event chan, client 2 with event subscriber.
+// Act:
+// - Clients establish sessions with the server, client 1 dials a stream to client 2 and closes it.
+// - Client 1 is closed.
+// Assert:
+// - Session, stream and discovery entry events are emitted with the right public keys and addresses.
+func TestEntityCommon_Events(t *testing.T) {
+	const port = uint16(80)
+
+	env := newTestEnv(t)
+	srv := env.makeServer("events server", nil)
+	srvPK := srv.LocalPK()
+	srvEvents, stopSrvEvents := srv.Events(0)
+	defer stopSrvEvents()
+	env.startServer(srv, func() error { return srv.ListenAndServe("events server", "events server") })
+	srvEntry := env.entry(srvPK)
+
+	client1 := env.newClient("events client 1", &Config{})
+	events1, stopEvents1 := client1.Events(0)
+	defer stopEvents1()
+
+	client2 := env.newClient("events client 2", &Config{})
+	events2 := make(chan Event, DefaultEventBufferSize)
+	defer client2.Subscribe(EventSubscriberFunc(func(e Event) { events2 <- e }))()
+
+	require.NoError(t, client1.EnsureSession(context.TODO(), srvEntry))
+	awaitEvent(t, events1, EventEntryUpdated) // delegated servers are updated as the session is set
+	e := awaitEvent(t, events1, EventSessionEstablished)
+	assert.Equal(t, srvPK, e.RemotePK)
+	e = awaitEvent(t, srvEvents, EventSessionEstablished)
+	assert.Equal(t, client1.LocalPK(), e.RemotePK)
+
+	require.NoError(t, client2.EnsureSession(context.TODO(), srvEntry))
+	awaitEvent(t, events2, EventSessionEstablished)
+	lis, err := client2.Listen(port)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, lis.Close()) }()
+
+	// Stream events.
+	dst := Addr{PK: client2.LocalPK(), Port: port}
+	str, err := client1.DialStream(context.TODO(), dst)
+	require.NoError(t, err)
+	src := str.LocalAddr().(Addr)
+
+	for _, ch := range []<-chan Event{events1, events2, srvEvents} {
+		typ := EventStreamAccepted
+		if ch == events1 {
+			typ = EventStreamDialed
+		}
+		e = awaitEvent(t, ch, typ)
+		assert.Equal(t, src, e.SrcAddr)
+		assert.Equal(t, dst, e.DstAddr)
+	}
+
+	require.NoError(t, str.Close())
+	e = awaitEvent(t, events1, EventStreamClosed)
+	assert.Equal(t, src, e.SrcAddr)
+	assert.Equal(t, dst, e.DstAddr)
+	assert.Equal(t, srvPK, e.RemotePK)
+	assert.True(t, e.Duration > 0)
+	awaitEvent(t, srvEvents, EventStreamClosed)
+
+	// Session events.
+	require.NoError(t, client1.Close())
+	e = awaitEvent(t, srvEvents, EventSessionClosed)
+	assert.Equal(t, client1.LocalPK(), e.RemotePK)
+	assert.True(t, e.Duration > 0)
+}
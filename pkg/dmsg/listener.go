@@ -10,6 +10,11 @@ import (
 	"github.com/skycoin/skywire-utilities/pkg/netutil"
 )
 
+// AcceptFilter decides whether a stream from the remote address is accepted.
+// A non-nil error rejects the stream before the stream handshake completes. The dialer obtains the rejection from
+// DialStream as a *RejectError if the filter returns one, or as ErrReqRejected otherwise.
+type AcceptFilter func(remote Addr) error
+
 // Listener listens for remote-initiated streams.
 type Listener struct {
 	porter *netutil.Porter
@@ -18,6 +23,8 @@ type Listener struct {
 	accept chan *Stream
 	mx     sync.Mutex // protects 'accept'
 
+	filter atomic.Value // type: AcceptFilter
+
 	doneFunc atomic.Value // callback when done, type: func()
 	done     chan struct{}
 	once     sync.Once
@@ -36,6 +43,18 @@ func newListener(porter *netutil.Porter, addr Addr) *Listener {
 // This should be called right after the listener is created and is not thread safe.
 func (l *Listener) addCloseCallback(cb func()) { l.doneFunc.Store(cb) }
 
+// SetAcceptFilter sets the filter which is run on the remote address of each stream request, before the stream is
+// accepted. A nil filter accepts all streams.
+func (l *Listener) SetAcceptFilter(f AcceptFilter) { l.filter.Store(f) }
+
+// filterStream runs the accept filter (if any) on the remote address.
+func (l *Listener) filterStream(remote Addr) error {
+	if f, ok := l.filter.Load().(AcceptFilter); ok && f != nil {
+		return f(remote)
+	}
+	return nil
+}
+
 // introduceStream handles a stream after receiving a REQUEST frame.
 func (l *Listener) introduceStream(tp *Stream) error {
 	if tp.LocalAddr() != l.addr {
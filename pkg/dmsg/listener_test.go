@@ -0,0 +1,122 @@
+// Package dmsg pkg/dmsg/listener_test.go
+package dmsg
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/dmsg/pkg/disc"
+)
+
+// Ensure that the accept filter of a listener rejects streams with signed responses.
+// Arrange:
+// - Dmsg server, and clients 1, 2 and 3 with sessions to the server.
+// - Client 3 listens with an accept filter which only accepts streams from client 1.
+// Act:
+// - Clients 1 and 2 dial streams to client 3, with different filter outcomes.
+// Assert:
+// - The stream of client 1 is accepted.
+// - The stream of client 2 is rejected with the application-defined code, or with ErrReqRejected for other errors.
+// - The listener keeps accepting streams after rejections.
+func TestListener_SetAcceptFilter(t *testing.T) {
+	const port = uint16(80)
+	const rejectCode = MinRejectCode + 7
+
+	env := newTestEnv(t)
+	srv := env.newServer("filter server", nil)
+	client1 := env.connectClient("filter client 1", &Config{}, srv)
+	client2 := env.connectClient("filter client 2", &Config{}, srv)
+	client3 := env.connectClient("filter client 3", &Config{}, srv)
+
+	lis, err := client3.Listen(port)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, lis.Close()) }()
+
+	var filterErr error
+	lis.SetAcceptFilter(func(remote Addr) error {
+		if remote.PK == client1.LocalPK() {
+			return nil
+		}
+		return filterErr
+	})
+	dstAddr := Addr{PK: client3.LocalPK(), Port: port}
+
+	t.Run("reject_with_code", func(t *testing.T) {
+		filterErr = &RejectError{Code: rejectCode}
+		_, err := client2.DialStream(context.TODO(), dstAddr)
+		var rErr *RejectError
+		require.True(t, errors.As(err, &rErr))
+		assert.Equal(t, uint16(rejectCode), rErr.Code)
+		assert.True(t, errors.Is(err, ErrReqRejected))
+		assert.True(t, errors.Is(err, &RejectError{Code: rejectCode}))
+	})
+
+	t.Run("reject_without_code", func(t *testing.T) {
+		filterErr = errors.New("not today")
+		_, err := client2.DialStream(context.TODO(), dstAddr)
+		assert.Equal(t, ErrReqRejected, err)
+
+		// Reserved codes are not sent to the dialer.
+		filterErr = &RejectError{Code: 1}
+		_, err = client2.DialStream(context.TODO(), dstAddr)
+		assert.Equal(t, ErrReqRejected, err)
+	})
+
+	t.Run("accept", func(t *testing.T) {
+		str1, err := client1.DialStream(context.TODO(), dstAddr)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, str1.Close()) }()
+
+		str3, err := lis.AcceptStream()
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, str3.Close()) }()
+		assert.Equal(t, client1.LocalPK(), str3.RawRemoteAddr().PK)
+
+		// Removing the filter accepts all streams.
+		lis.SetAcceptFilter(nil)
+		str2, err := client2.DialStream(context.TODO(), dstAddr)
+		require.NoError(t, err)
+		assert.NoError(t, str2.Close())
+	})
+}
+
+// Ensure that services of listeners are advertised in discovery.
+// Arrange:
+// - Dmsg server, and a client with a session to the server.
+// Act:
+// - The client listens on a service, and then closes the listener.
+// Assert:
+// - The service is found in discovery while the listener is open, and removed after it is closed.
+// - Listening on the port of the service again fails while the listener is open.
+func TestClient_ListenService(t *testing.T) {
+	svc := disc.Service{Name: "test site", Port: 80, Protocol: "http", Metadata: map[string]string{"title": "test"}}
+
+	env := newTestEnv(t)
+	srv := env.newServer("service server", nil)
+	c := env.connectClient("service client", &Config{}, srv)
+
+	_, err := c.ListenService(disc.Service{Name: "no port"})
+	assert.Equal(t, disc.ErrValidationInvalidService, err)
+
+	lis, err := c.ListenService(svc)
+	require.NoError(t, err)
+	_, err = c.Listen(svc.Port)
+	assert.Equal(t, ErrPortOccupied, err)
+
+	entries, err := env.dc.Services(context.TODO(), svc.Name)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, c.LocalPK(), entries[0].Static)
+	assert.Equal(t, []disc.Service{svc}, entries[0].Client.Services)
+	assert.Equal(t, []cipher.PubKey{srv.LocalPK()}, entries[0].Client.DelegatedServers)
+
+	require.NoError(t, lis.Close())
+	entries, err = env.dc.Services(context.TODO(), svc.Name)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
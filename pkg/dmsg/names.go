@@ -0,0 +1,93 @@
+// Package dmsg pkg/dmsg/names.go
+package dmsg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+
+	"github.com/skycoin/dmsg/pkg/disc"
+)
+
+// NamedAddr is a dmsg address of which the host is either a public key, or a name which is registered in dmsg
+// discovery (see disc.NameRecord).
+// It implements pflag.Value, and accepts strings of format '<pk|name>[:<port>]'.
+type NamedAddr struct {
+	Addr
+	Name string // Set if the host is a name, in which case Addr.PK is null until the address is resolved.
+}
+
+// Set implements pflag.Value for NamedAddr.
+func (a *NamedAddr) Set(s string) error {
+	host, port := s, ""
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		host, port = s[:i], s[i:]
+	}
+	host = strings.TrimSpace(host)
+
+	if !disc.ValidName(host) {
+		a.Name = ""
+		return a.Addr.Set(s)
+	}
+
+	a.Name = host
+	a.Addr = Addr{}
+	if port == "" {
+		return nil
+	}
+	return a.Addr.Set(port)
+}
+
+// String returns the name (or public key) and port of the address split by colon.
+func (a NamedAddr) String() string {
+	if a.Name == "" {
+		return a.Addr.String()
+	}
+	if a.Port == 0 {
+		return fmt.Sprintf("%s:~", a.Name)
+	}
+	return fmt.Sprintf("%s:%d", a.Name, a.Port)
+}
+
+// Type implements pflag.Value for NamedAddr.
+func (NamedAddr) Type() string {
+	return "dmsg.NamedAddr"
+}
+
+// Resolve returns the address with the name (if any) resolved into a public key via dmsg discovery.
+func (a NamedAddr) Resolve(ctx context.Context, dc disc.APIClient) (Addr, error) {
+	if a.Name == "" {
+		return a.Addr, nil
+	}
+	pk, err := dc.Resolve(ctx, a.Name)
+	if err != nil {
+		return Addr{}, fmt.Errorf("failed to resolve name '%s': %w", a.Name, err)
+	}
+	return Addr{PK: pk, Port: a.Port}, nil
+}
+
+// RegisterName registers (or renews) the name for the client's public key in dmsg discovery.
+// Registered names expire after disc.NameLifetime, unless they are renewed.
+func (ce *Client) RegisterName(ctx context.Context, name string) error {
+	record := disc.NewNameRecord(name, ce.pk)
+	if err := record.Sign(ce.sk); err != nil {
+		return err
+	}
+	return ce.dc.PostName(ctx, record)
+}
+
+// ResolveName returns the public key which the name is registered to in dmsg discovery.
+func (ce *Client) ResolveName(ctx context.Context, name string) (cipher.PubKey, error) {
+	return ce.dc.Resolve(ctx, name)
+}
+
+// ResolveAddr parses an address of format '<pk|name>[:<port>]', and resolves the name (if any) via dmsg discovery.
+func (ce *Client) ResolveAddr(ctx context.Context, s string) (Addr, error) {
+	var addr NamedAddr
+	if err := addr.Set(s); err != nil {
+		return Addr{}, err
+	}
+	return addr.Resolve(ctx, ce.dc)
+}
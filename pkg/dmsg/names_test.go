@@ -0,0 +1,62 @@
+// Package dmsg pkg/dmsg/names_test.go
+package dmsg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/dmsg/pkg/disc"
+)
+
+func TestNamedAddr_Set(t *testing.T) {
+	pk, _ := cipher.GenerateKeyPair()
+
+	cases := []struct {
+		in   string
+		want NamedAddr
+	}{
+		{in: "site", want: NamedAddr{Name: "site"}},
+		{in: "site:80", want: NamedAddr{Name: "site", Addr: Addr{Port: 80}}},
+		{in: pk.Hex(), want: NamedAddr{Addr: Addr{PK: pk}}},
+		{in: pk.Hex() + ":80", want: NamedAddr{Addr: Addr{PK: pk, Port: 80}}},
+	}
+	for _, tc := range cases {
+		var addr NamedAddr
+		require.NoError(t, addr.Set(tc.in), tc.in)
+		assert.Equal(t, tc.want, addr, tc.in)
+	}
+
+	var addr NamedAddr
+	assert.Error(t, addr.Set("Not A Name:80"))
+}
+
+// Ensure that names registered by clients are resolved into their public keys.
+// Arrange:
+// - A dmsg client with a discovery mock.
+// Act:
+// - The client registers a name, and resolves addresses of the name.
+// Assert:
+// - Addresses of the name resolve into the public key of the client, and unknown names fail to resolve.
+func TestClient_RegisterName(t *testing.T) {
+	dc := disc.NewMock(0)
+	pk, sk := GenKeyPair(t, "name client")
+	c := NewClient(pk, sk, dc, &Config{Transport: NewPipeTransport()})
+	defer func() { _ = c.Close() }() // The client has no entry in discovery, so closing it errors.
+
+	require.NoError(t, c.RegisterName(context.TODO(), "my-site"))
+
+	rPK, err := c.ResolveName(context.TODO(), "my-site")
+	require.NoError(t, err)
+	assert.Equal(t, pk, rPK)
+
+	addr, err := c.ResolveAddr(context.TODO(), "my-site:80")
+	require.NoError(t, err)
+	assert.Equal(t, Addr{PK: pk, Port: 80}, addr)
+
+	_, err = c.ResolveAddr(context.TODO(), "unknown:80")
+	assert.ErrorIs(t, err, disc.ErrNameNotFound)
+}
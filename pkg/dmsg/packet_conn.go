@@ -0,0 +1,542 @@
+// Package dmsg pkg/dmsg/packet_conn.go
+package dmsg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/skycoin/skywire-utilities/pkg/netutil"
+)
+
+// datagramRouteTTL is the duration for which the dmsg server that datagrams to a remote client are sent through is
+// remembered, before the client entry of the remote client is looked up again.
+const datagramRouteTTL = time.Minute
+
+// ListenPacket listens for datagrams on a given dmsg port.
+// Datagram ports are separate from stream ports. If 'port' is 0, an ephemeral port is used.
+func (ce *Client) ListenPacket(port uint16) (*PacketConn, error) {
+	return ce.dgrams.bind(port, Addr{})
+}
+
+// DialPacket returns a PacketConn which is connected to the given remote address.
+// Only datagrams from the remote address are received by the returned PacketConn.
+func (ce *Client) DialPacket(ctx context.Context, addr Addr) (*PacketConn, error) {
+	pc, err := ce.dgrams.bind(0, addr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ce.dgrams.route(ctx, addr.PK); err != nil {
+		_ = pc.Close() //nolint:errcheck
+		return nil, err
+	}
+	return pc, nil
+}
+
+type datagramRoute struct {
+	srvPK  cipher.PubKey
+	expiry time.Time
+}
+
+// datagramMux multiplexes the datagrams of a client's packet conns over datagram channels with the dmsg servers.
+// Datagrams are sent to the remote client via one of its delegated servers, which forwards them best-effort (datagrams
+// are not forwarded between dmsg servers).
+type datagramMux struct {
+	ce     *Client
+	porter *netutil.Porter // ports of packet conns (separate from those of streams)
+
+	mx       sync.Mutex
+	enabled  bool                               // once true, datagram channels are opened for all sessions
+	channels map[cipher.PubKey]*datagramChannel // key: dmsg server pk
+	routes   map[cipher.PubKey]datagramRoute    // key: remote client pk
+	sealers  map[cipher.PubKey]*datagramSealer  // key: remote client pk
+	openers  map[cipher.PubKey]*datagramOpener  // key: remote client pk
+}
+
+func newDatagramMux(ce *Client) *datagramMux {
+	return &datagramMux{
+		ce:       ce,
+		porter:   netutil.NewPorter(netutil.PorterMinEphemeral),
+		channels: make(map[cipher.PubKey]*datagramChannel),
+		routes:   make(map[cipher.PubKey]datagramRoute),
+		sealers:  make(map[cipher.PubKey]*datagramSealer),
+		openers:  make(map[cipher.PubKey]*datagramOpener),
+	}
+}
+
+// bind creates a packet conn on the given port (or an ephemeral port if 'port' is 0).
+func (m *datagramMux) bind(port uint16, rAddr Addr) (*PacketConn, error) {
+	if isClosed(m.ce.done) {
+		return nil, ErrEntityClosed
+	}
+
+	pc := newPacketConn(m, rAddr)
+	if port == 0 {
+		ephPort, doneFn, err := m.porter.ReserveEphemeral(context.Background(), pc)
+		if err != nil {
+			return nil, err
+		}
+		port, pc.doneFunc = ephPort, doneFn
+	} else {
+		ok, doneFn := m.porter.Reserve(port, pc)
+		if !ok {
+			return nil, ErrPortOccupied
+		}
+		pc.doneFunc = doneFn
+	}
+	pc.lAddr = Addr{PK: m.ce.pk, Port: port}
+
+	m.enable()
+	return pc, nil
+}
+
+// enable opens datagram channels for all current sessions.
+// Once enabled, datagram channels are also opened for sessions established later on (see sessionAdded), so that
+// datagrams can be received via all of our delegated servers.
+func (m *datagramMux) enable() {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if m.enabled {
+		return
+	}
+	m.enabled = true
+
+	for _, dSes := range m.ce.allClientSessions(m.ce.porter) {
+		if _, err := m.openChannel(dSes); err != nil {
+			dSes.log.WithError(err).Warn("Failed to open datagram channel.")
+		}
+	}
+}
+
+// sessionAdded is called once a session is established.
+func (m *datagramMux) sessionAdded(dSes ClientSession) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if !m.enabled {
+		return
+	}
+	if _, ok := m.channels[dSes.RemotePK()]; ok {
+		return
+	}
+	if _, err := m.openChannel(dSes); err != nil {
+		dSes.log.WithError(err).Warn("Failed to open datagram channel.")
+	}
+}
+
+// ensureChannel obtains the datagram channel of the session, and opens one if it does not exist.
+func (m *datagramMux) ensureChannel(dSes ClientSession) (*datagramChannel, error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if ch, ok := m.channels[dSes.RemotePK()]; ok {
+		return ch, nil
+	}
+	return m.openChannel(dSes)
+}
+
+// openChannel should only be called when 'm.mx' is locked.
+// Servers which do not support datagrams are not asked to open a channel.
+func (m *datagramMux) openChannel(dSes ClientSession) (*datagramChannel, error) {
+	if !dSes.Capabilities().Has(FeatureDatagrams) {
+		return nil, ErrDatagramUnsupported
+	}
+	yStr, err := dSes.ys.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+	obj := MakeSignedDatagramChannel(&DatagramChannel{OpenedAt: time.Now().UnixNano()}, m.ce.sk)
+	if err := dSes.writeObject(yStr, obj); err != nil {
+		_ = yStr.Close() //nolint:errcheck
+		return nil, err
+	}
+
+	ch := &datagramChannel{ses: dSes.SessionCommon, yStr: yStr}
+	m.channels[dSes.RemotePK()] = ch
+	go m.serveChannel(ch)
+	return ch, nil
+}
+
+// serveChannel delivers datagrams received over the datagram channel until the channel is closed.
+func (m *datagramMux) serveChannel(ch *datagramChannel) {
+	log := ch.ses.log.WithField("func", "datagramMux.serveChannel")
+	defer func() {
+		m.mx.Lock()
+		if m.channels[ch.ses.RemotePK()] == ch {
+			delete(m.channels, ch.ses.RemotePK())
+		}
+		m.mx.Unlock()
+		log.WithError(ch.yStr.Close()).Debug("Datagram channel closed.")
+	}()
+
+	for {
+		f, err := ch.read()
+		if err != nil {
+			log.WithError(err).Debug("Stopped reading datagrams.")
+			return
+		}
+		if err := m.deliver(f); err != nil {
+			log.WithError(err).WithField("src_pk", f.pk).Debug("Dropped datagram.")
+		}
+	}
+}
+
+// deliver decrypts the datagram and introduces it to the packet conn of the destination port.
+func (m *datagramMux) deliver(f datagramFrame) error {
+	v, ok := m.porter.PortValue(f.dstPort)
+	if !ok {
+		return fmt.Errorf("no packet conn on port %d", f.dstPort)
+	}
+	pc, ok := v.(*PacketConn)
+	if !ok {
+		return fmt.Errorf("no packet conn on port %d", f.dstPort)
+	}
+	src := Addr{PK: f.pk, Port: f.srcPort}
+	if !pc.rAddr.PK.Null() && src != pc.rAddr {
+		return fmt.Errorf("packet conn on port %d is connected to %s", f.dstPort, pc.rAddr)
+	}
+
+	hs, ct, err := splitSealedDatagram(f.payload)
+	if err != nil {
+		return err
+	}
+	o, err := m.opener(f.pk, hs)
+	if err != nil {
+		return err
+	}
+	p, err := o.open(ct)
+	if err != nil {
+		return err
+	}
+	return pc.introduceDatagram(src, p)
+}
+
+// opener obtains the datagram opener of the remote client, for datagrams which are sealed with handshake 'hs'.
+// Remote clients use a new handshake when they restart, in which case the opener is replaced. Handshakes which are not
+// newer than that of the current opener are rejected, as they may be replayed (which would reset the replay window).
+func (m *datagramMux) opener(rPK cipher.PubKey, hs []byte) (*datagramOpener, error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	cur, ok := m.openers[rPK]
+	if ok && bytes.Equal(cur.hs, hs) {
+		return cur, nil
+	}
+	o, err := newDatagramOpener(m.ce.pk, m.ce.sk, rPK, hs)
+	if err != nil {
+		return nil, err
+	}
+	if ok && o.ts <= cur.ts {
+		return nil, errStaleDatagramHandshake
+	}
+	m.openers[rPK] = o
+	return o, nil
+}
+
+// sealer obtains the datagram sealer for the remote client.
+func (m *datagramMux) sealer(rPK cipher.PubKey) (*datagramSealer, error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if s, ok := m.sealers[rPK]; ok {
+		return s, nil
+	}
+	s, err := newDatagramSealer(m.ce.pk, m.ce.sk, rPK)
+	if err != nil {
+		return nil, err
+	}
+	m.sealers[rPK] = s
+	return s, nil
+}
+
+// route obtains the datagram channel which datagrams to the remote client are sent over.
+// The channel must be with one of the remote client's delegated servers, a session is established if needed.
+func (m *datagramMux) route(ctx context.Context, rPK cipher.PubKey) (*datagramChannel, error) {
+	m.mx.Lock()
+	if r, ok := m.routes[rPK]; ok && time.Now().Before(r.expiry) {
+		if ch, ok := m.channels[r.srvPK]; ok {
+			m.mx.Unlock()
+			return ch, nil
+		}
+	}
+	m.mx.Unlock()
+
+	entry, err := getClientEntry(ctx, m.ce.dc, rPK)
+	if err != nil {
+		return nil, err
+	}
+
+	// See if we are already connected to a delegated server.
+	// Draining servers are skipped as the remote client is likely to be migrating away from them.
+	delegated := m.ce.config().preferServers(entry.Client.DelegatedServers)
+	for _, srvPK := range delegated {
+		if dSes, ok := m.ce.clientSession(m.ce.porter, srvPK); ok && !dSes.IsDraining() {
+			if ch, err := m.ensureChannel(dSes); err == nil {
+				m.setRoute(rPK, srvPK)
+				return ch, nil
+			}
+		}
+	}
+
+	// Attempt to connect to a delegated server.
+	for _, srvPK := range delegated {
+		dSes, err := m.ce.EnsureAndObtainSession(ctx, srvPK)
+		if err != nil {
+			continue
+		}
+		if ch, err := m.ensureChannel(dSes); err == nil {
+			m.setRoute(rPK, srvPK)
+			return ch, nil
+		}
+	}
+
+	// The cached entry of the remote client may be outdated, it is refreshed on the next attempt.
+	m.ce.invalidateEntry(rPK)
+	return nil, ErrCannotConnectToDelegated
+}
+
+func (m *datagramMux) setRoute(rPK, srvPK cipher.PubKey) {
+	m.mx.Lock()
+	m.routes[rPK] = datagramRoute{srvPK: srvPK, expiry: time.Now().Add(datagramRouteTTL)}
+	m.mx.Unlock()
+}
+
+func (m *datagramMux) delRoute(rPK cipher.PubKey) {
+	m.mx.Lock()
+	delete(m.routes, rPK)
+	m.mx.Unlock()
+}
+
+// send seals and sends a datagram to the remote address.
+func (m *datagramMux) send(ctx context.Context, srcPort uint16, dst Addr, p []byte) error {
+	if len(p) > MaxDatagramSize {
+		return ErrDatagramTooLarge
+	}
+	ch, err := m.route(ctx, dst.PK)
+	if err != nil {
+		return err
+	}
+	s, err := m.sealer(dst.PK)
+	if err != nil {
+		return err
+	}
+	f := datagramFrame{
+		pk:      dst.PK,
+		srcPort: srcPort,
+		dstPort: dst.Port,
+		payload: s.seal(p),
+	}
+	if err := ch.write(f); err != nil {
+		m.delRoute(dst.PK)
+		return err
+	}
+	return nil
+}
+
+// datagram is a received datagram.
+type datagram struct {
+	src  Addr
+	data []byte
+}
+
+// PacketConn implements net.PacketConn for unreliable dmsg datagrams.
+// Datagrams are end-to-end encrypted, and relayed best-effort by the dmsg servers without stream handshakes.
+// Datagrams may be lost, duplicated datagrams are dropped, and the order of datagrams is not guaranteed.
+// A PacketConn obtained via Client.DialPacket also implements net.Conn.
+type PacketConn struct {
+	m     *datagramMux
+	lAddr Addr
+	rAddr Addr // remote address of a connected packet conn
+
+	recv      chan datagram
+	rDeadline deadline
+	wDeadline deadline
+
+	doneFunc func() // frees the port
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newPacketConn(m *datagramMux, rAddr Addr) *PacketConn {
+	return &PacketConn{
+		m:         m,
+		rAddr:     rAddr,
+		recv:      make(chan datagram, DatagramBufferSize),
+		rDeadline: makeDeadline(),
+		wDeadline: makeDeadline(),
+		done:      make(chan struct{}),
+	}
+}
+
+// introduceDatagram buffers a received datagram.
+// The datagram is dropped if the buffer is full.
+func (pc *PacketConn) introduceDatagram(src Addr, p []byte) error {
+	select {
+	case <-pc.done:
+		return ErrEntityClosed
+	case pc.recv <- datagram{src: src, data: p}:
+		return nil
+	default:
+		return fmt.Errorf("receive buffer of packet conn on port %d is full", pc.lAddr.Port)
+	}
+}
+
+// ReadFrom implements net.PacketConn
+// If 'p' is smaller than the datagram, the rest of the datagram is discarded.
+func (pc *PacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	select {
+	case <-pc.done:
+		return 0, nil, ErrEntityClosed
+	default:
+	}
+
+	select {
+	case d := <-pc.recv:
+		return copy(p, d.data), d.src, nil
+	case <-pc.done:
+		return 0, nil, ErrEntityClosed
+	case <-pc.rDeadline.wait():
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+// WriteTo implements net.PacketConn
+func (pc *PacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	dst, ok := addr.(Addr)
+	if !ok {
+		return 0, fmt.Errorf("invalid dmsg address type %T", addr)
+	}
+	select {
+	case <-pc.done:
+		return 0, ErrEntityClosed
+	case <-pc.wDeadline.wait():
+		return 0, os.ErrDeadlineExceeded
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout)
+	defer cancel()
+
+	if err := pc.m.send(ctx, pc.lAddr.Port, dst, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Read implements net.Conn
+// It is only supported by packet conns which are obtained via Client.DialPacket.
+func (pc *PacketConn) Read(p []byte) (int, error) {
+	if pc.rAddr.PK.Null() {
+		return 0, ErrNotConnected
+	}
+	n, _, err := pc.ReadFrom(p)
+	return n, err
+}
+
+// Write implements net.Conn
+// It is only supported by packet conns which are obtained via Client.DialPacket.
+func (pc *PacketConn) Write(p []byte) (int, error) {
+	if pc.rAddr.PK.Null() {
+		return 0, ErrNotConnected
+	}
+	return pc.WriteTo(p, pc.rAddr)
+}
+
+// Close implements net.PacketConn
+func (pc *PacketConn) Close() error {
+	closed := false
+	pc.once.Do(func() {
+		closed = true
+		close(pc.done)
+		if pc.doneFunc != nil {
+			pc.doneFunc()
+		}
+	})
+	if !closed {
+		return ErrEntityClosed
+	}
+	return nil
+}
+
+// LocalAddr implements net.PacketConn
+func (pc *PacketConn) LocalAddr() net.Addr { return pc.lAddr }
+
+// RemoteAddr implements net.Conn
+// It returns the zero address if the packet conn is not connected.
+func (pc *PacketConn) RemoteAddr() net.Addr { return pc.rAddr }
+
+// SetDeadline implements net.PacketConn
+func (pc *PacketConn) SetDeadline(t time.Time) error {
+	pc.rDeadline.set(t)
+	pc.wDeadline.set(t)
+	return nil
+}
+
+// SetReadDeadline implements net.PacketConn
+func (pc *PacketConn) SetReadDeadline(t time.Time) error {
+	pc.rDeadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline implements net.PacketConn
+func (pc *PacketConn) SetWriteDeadline(t time.Time) error {
+	pc.wDeadline.set(t)
+	return nil
+}
+
+// Type returns the packet conn type.
+func (pc *PacketConn) Type() string { return Type }
+
+// deadline is a deadline which unblocks pending operations once it is exceeded (as that of net.Pipe).
+type deadline struct {
+	mx     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{} // closed once the deadline is exceeded
+}
+
+func makeDeadline() deadline {
+	return deadline{cancel: make(chan struct{})}
+}
+
+// set sets the deadline, a zero value means no deadline.
+func (d *deadline) set(t time.Time) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // wait for the timer callback to finish and close cancel
+	}
+	d.timer = nil
+
+	exceeded := isClosed(d.cancel)
+	if t.IsZero() {
+		if exceeded {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+	if dur := time.Until(t); dur > 0 {
+		if exceeded {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() { close(cancel) })
+		return
+	}
+	if !exceeded {
+		close(d.cancel)
+	}
+}
+
+// wait returns a chan which is closed once the deadline is exceeded.
+func (d *deadline) wait() chan struct{} {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	return d.cancel
+}
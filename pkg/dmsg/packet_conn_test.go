@@ -0,0 +1,156 @@
+// Package dmsg pkg/dmsg/packet_conn_test.go
+package dmsg
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayWindow_Accept(t *testing.T) {
+	var w replayWindow
+	for _, n := range []uint64{1, 3, 2, 100} {
+		assert.True(t, w.accept(n), n)
+	}
+	for _, n := range []uint64{1, 2, 3, 100} {
+		assert.False(t, w.accept(n), n) // replayed
+	}
+	assert.True(t, w.accept(99))
+	assert.True(t, w.accept(37))
+	assert.False(t, w.accept(36)) // older than the window
+}
+
+// Ensure that replayed datagram handshakes neither replace the current opener, nor reset its replay window.
+// Arrange:
+// - Datagram mux of client B, and an old and a new datagram sealer of client A (as if client A restarted).
+// Act:
+// - Datagrams of the old sealer, then of the new sealer are delivered.
+// - A relaying server replays the datagram of the old sealer.
+// Assert:
+// - The opener is replaced by that of the newer handshake.
+// - The replayed handshake is rejected, and the datagrams of the new sealer are still opened (but not replayed).
+func TestDatagramMux_ReplayedHandshake(t *testing.T) {
+	pkA, skA := GenKeyPair(t, "datagram A")
+	pkB, skB := GenKeyPair(t, "datagram B")
+	m := newDatagramMux(&Client{EntityCommon: EntityCommon{pk: pkB, sk: skB}})
+
+	open := func(b []byte) ([]byte, error) {
+		hs, ct, err := splitSealedDatagram(b)
+		require.NoError(t, err)
+		o, err := m.opener(pkA, hs)
+		if err != nil {
+			return nil, err
+		}
+		return o.open(ct)
+	}
+
+	oldS, err := newDatagramSealer(pkA, skA, pkB)
+	require.NoError(t, err)
+	oldDgram := oldS.seal([]byte("old"))
+	p, err := open(oldDgram)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("old"), p)
+
+	newS, err := newDatagramSealer(pkA, skA, pkB)
+	require.NoError(t, err)
+	newDgram := newS.seal([]byte("new"))
+	p, err = open(newDgram)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("new"), p)
+
+	_, err = open(oldDgram)
+	assert.ErrorIs(t, err, errStaleDatagramHandshake)
+	_, err = open(newDgram)
+	assert.ErrorIs(t, err, errInvalidDatagram)
+
+	p, err = open(newS.seal([]byte("still new")))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("still new"), p)
+}
+
+// Ensure that datagrams are delivered between dmsg clients.
+// Arrange:
+// - Dmsg servers A and B.
+// - Client 1 with a session to server A, client 2 with a session to server B.
+// Act:
+// - Client 2 listens for datagrams, client 1 dials a packet conn to client 2.
+// Assert:
+// - Datagrams are delivered in both directions and are attributed to the right source address.
+// - Client 1 establishes a session with server B (the delegated server of client 2) to send datagrams.
+// - Oversized datagrams are rejected, and read deadlines are respected.
+func TestClient_PacketConn(t *testing.T) {
+	const port = uint16(53)
+
+	env := newTestEnv(t)
+	srvA := env.newServer("packet server A", nil)
+	srvB := env.newServer("packet server B", nil)
+	client1 := env.connectClient("packet client 1", nil, srvA)
+	client2 := env.connectClient("packet client 2", nil, srvB)
+
+	pc2, err := client2.ListenPacket(port)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, pc2.Close()) }()
+
+	_, err = client2.ListenPacket(port)
+	require.Equal(t, ErrPortOccupied, err)
+
+	pc1, err := client1.DialPacket(context.TODO(), Addr{PK: client2.LocalPK(), Port: port})
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, pc1.Close()) }()
+
+	_, ok := client1.Session(srvB.LocalPK())
+	require.True(t, ok)
+
+	// Client 1 -> client 2.
+	// The datagram channel of client 1 may not be served by server B yet, so we retry.
+	data := cipher.RandByte(1024)
+	buf := make([]byte, MaxDatagramSize)
+	var (
+		n   int
+		src = Addr{}
+	)
+	require.Eventually(t, func() bool {
+		_, err := pc1.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, pc2.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+
+		var addr interface{}
+		n, addr, err = pc2.ReadFrom(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return false
+		}
+		require.NoError(t, err)
+		src = addr.(Addr)
+		return true
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, data, buf[:n])
+	assert.Equal(t, pc1.LocalAddr(), src)
+
+	// Client 2 -> client 1.
+	require.NoError(t, pc2.SetReadDeadline(time.Time{}))
+	_, err = pc2.WriteTo(data, src)
+	require.NoError(t, err)
+	require.NoError(t, pc1.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, err = pc1.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, data, buf[:n])
+
+	// Oversized datagrams are rejected.
+	_, err = pc1.Write(make([]byte, MaxDatagramSize+1))
+	require.Equal(t, ErrDatagramTooLarge, err)
+
+	// Read deadline is respected.
+	require.NoError(t, pc1.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err = pc1.Read(buf)
+	require.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+
+	// Unconnected packet conns do not support Read/Write.
+	_, err = pc2.Write(data)
+	require.Equal(t, ErrNotConnected, err)
+}
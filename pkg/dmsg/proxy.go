@@ -0,0 +1,114 @@
+// Package dmsg pkg/dmsg/proxy.go
+package dmsg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+
+	"github.com/skycoin/dmsg/pkg/disc"
+)
+
+// ErrProxyConnectFailed occurs when a HTTP CONNECT proxy does not accept the tunnel request.
+var ErrProxyConnectFailed = errors.New("proxy rejected CONNECT request")
+
+// proxyDialer dials connections through an upstream SOCKS5 or HTTP CONNECT proxy.
+type proxyDialer struct {
+	u       *url.URL
+	forward net.Dialer
+}
+
+// DialContext implements proxy.ContextDialer.
+func (d *proxyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch d.u.Scheme {
+	case "socks5", "socks5h":
+		dialer, err := proxy.FromURL(d.u, &d.forward)
+		if err != nil {
+			return nil, err
+		}
+		return dialer.(proxy.ContextDialer).DialContext(ctx, network, addr)
+
+	case "http":
+		return d.dialConnect(ctx, addr)
+
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme '%s'", d.u.Scheme)
+	}
+}
+
+// dialConnect establishes a tunnel to 'addr' via a HTTP CONNECT request.
+func (d *proxyDialer) dialConnect(ctx context.Context, addr string) (_ net.Conn, err error) {
+	conn, err := d.forward.DialContext(ctx, "tcp", d.u.Host)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = conn.Close() //nolint:errcheck
+		}
+	}()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+		defer func() { _ = conn.SetDeadline(time.Time{}) }() //nolint:errcheck
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user := d.u.User; user != nil {
+		pass, _ := user.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + pass))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", ErrProxyConnectFailed, resp.Status)
+	}
+
+	// The proxy may have already relayed data from the remote.
+	if n := br.Buffered(); n > 0 {
+		b, _ := br.Peek(n) //nolint:errcheck
+		return &bufferedConn{Conn: conn, r: io.MultiReader(bytes.NewReader(b), conn)}, nil
+	}
+	return conn, nil
+}
+
+// withProxy returns a copy of the session transport which dials through the upstream proxy of the given URL.
+// Session transports which cannot be proxied are returned as is.
+func withProxy(tp SessionTransport, proxyURL *url.URL) SessionTransport {
+	switch t := tp.(type) {
+	case *netTransport:
+		if t.network == TransportTCP {
+			return &netTransport{network: t.network, dialer: &proxyDialer{u: proxyURL}}
+		}
+	case *wsTransport:
+		return &wsTransport{httpC: disc.ProxyHTTPClient(t.httpC, proxyURL)}
+	}
+	return tp
+}
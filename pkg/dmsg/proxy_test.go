@@ -0,0 +1,266 @@
+// Package dmsg pkg/dmsg/proxy_test.go
+package dmsg
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/skycoin/skywire-utilities/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/nettest"
+
+	"github.com/skycoin/dmsg/pkg/disc"
+)
+
+// Ensure that dmsg clients can reach dmsg servers (and discovery) through an upstream proxy.
+// Arrange:
+// - Dmsg server listening on TCP.
+// - In-process SOCKS5 (with username/password auth) and HTTP CONNECT proxies.
+// Act:
+// - Start a dmsg client for each proxy, and dial a stream between them.
+// Assert:
+// - The proxies relayed connections to the dmsg server.
+// - Data passes through the stream both ways.
+func TestClient_Proxy(t *testing.T) {
+	const port = uint16(80)
+
+	// The server listens on TCP, which the clients connect to via the proxies.
+	env := newTestEnv(t)
+	env.tp = nil
+	srv := env.makeServer("proxy server", nil)
+	lis, err := nettest.NewLocalListener("tcp")
+	require.NoError(t, err)
+	env.startServer(srv, func() error { return srv.Serve(lis, "") })
+
+	socks := newTestSOCKS5Proxy(t, "user", "pass")
+	connect := newTestConnectProxy(t)
+
+	newClient := func(seed string, proxyURL *url.URL) *Client {
+		conf := DefaultConfig()
+		conf.Proxy = proxyURL
+		return env.serveClient(seed, conf)
+	}
+	clientA := newClient("socks5 client A", &url.URL{Scheme: "socks5", User: url.UserPassword("user", "pass"), Host: socks.addr})
+	clientB := newClient("connect client B", &url.URL{Scheme: "http", Host: connect.addr})
+
+	assert.Equal(t, []string{lis.Addr().String()}, socks.targets())
+	assert.Equal(t, []string{lis.Addr().String()}, connect.targets())
+
+	dmsgLis, err := clientB.Listen(port)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, dmsgLis.Close()) }()
+
+	strA, err := clientA.DialStream(context.TODO(), Addr{PK: clientB.LocalPK(), Port: port})
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, strA.Close()) }()
+
+	strB, err := dmsgLis.AcceptStream()
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, strB.Close()) }()
+
+	for _, pair := range [][2]io.ReadWriter{{strA, strB}, {strB, strA}} {
+		data := cipher.RandByte(1024)
+		_, err := pair[0].Write(data)
+		require.NoError(t, err)
+
+		readData := make([]byte, len(data))
+		_, err = io.ReadFull(pair[1], readData)
+		require.NoError(t, err)
+		require.Equal(t, data, readData)
+	}
+
+	t.Run("wrong_credentials", func(t *testing.T) {
+		pk, sk := GenKeyPair(t, "socks5 client C")
+		conf := DefaultConfig()
+		conf.Proxy = &url.URL{Scheme: "socks5", User: url.UserPassword("user", "wrong"), Host: socks.addr}
+		c := NewClient(pk, sk, env.dc, conf)
+		t.Cleanup(func() { _ = c.Close() }) //nolint:errcheck
+		require.Error(t, c.EnsureSession(context.TODO(), env.entry(srv.LocalPK())))
+	})
+
+	t.Run("discovery", func(t *testing.T) {
+		hs := httptest.NewServer(http.NotFoundHandler())
+		t.Cleanup(hs.Close)
+
+		proxyURL := &url.URL{Scheme: "socks5", User: url.UserPassword("user", "pass"), Host: socks.addr}
+		httpDC := disc.NewHTTP(hs.URL, &http.Client{}, logging.MustGetLogger("disc"), disc.WithProxy(proxyURL))
+
+		_, err := httpDC.Entry(context.TODO(), srv.LocalPK())
+		require.Error(t, err)
+		require.Contains(t, socks.targets(), hs.Listener.Addr().String())
+	})
+}
+
+// testProxy records the targets which an in-process proxy relayed connections to.
+type testProxy struct {
+	addr string
+	tgts []string
+	mx   sync.Mutex
+}
+
+func (p *testProxy) targets() []string {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	return append([]string(nil), p.tgts...)
+}
+
+func (p *testProxy) relay(conn net.Conn, r io.Reader, target string) {
+	p.mx.Lock()
+	p.tgts = append(p.tgts, target)
+	p.mx.Unlock()
+
+	tConn, err := net.Dial("tcp", target)
+	if err != nil {
+		_ = conn.Close() //nolint:errcheck
+		return
+	}
+	go func() {
+		_, _ = io.Copy(tConn, r) //nolint:errcheck
+		_ = tConn.Close()        //nolint:errcheck
+	}()
+	_, _ = io.Copy(conn, tConn) //nolint:errcheck
+	_ = conn.Close()            //nolint:errcheck
+}
+
+func serveTestProxy(t *testing.T, handle func(conn net.Conn)) string {
+	lis, err := nettest.NewLocalListener("tcp")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = lis.Close() }) //nolint:errcheck
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	return lis.Addr().String()
+}
+
+// newTestSOCKS5Proxy serves a minimal SOCKS5 proxy which only supports the CONNECT command with
+// username/password authentication.
+func newTestSOCKS5Proxy(t *testing.T, user, pass string) *testProxy {
+	p := new(testProxy)
+	p.addr = serveTestProxy(t, func(conn net.Conn) {
+		target, err := socks5Handshake(conn, user, pass)
+		if err != nil {
+			_ = conn.Close() //nolint:errcheck
+			return
+		}
+		p.relay(conn, conn, target)
+	})
+	return p
+}
+
+func socks5Handshake(conn net.Conn, user, pass string) (string, error) {
+	// Method selection: only username/password (0x02) is accepted.
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(conn, hdr); err != nil {
+		return "", err
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+	if _, err := conn.Write([]byte{5, 2}); err != nil {
+		return "", err
+	}
+
+	// Username/password sub-negotiation.
+	readField := func() (string, error) {
+		l := make([]byte, 1)
+		if _, err := io.ReadFull(conn, l); err != nil {
+			return "", err
+		}
+		b := make([]byte, l[0])
+		_, err := io.ReadFull(conn, b)
+		return string(b), err
+	}
+	if _, err := io.ReadFull(conn, make([]byte, 1)); err != nil {
+		return "", err
+	}
+	u, err := readField()
+	if err != nil {
+		return "", err
+	}
+	pw, err := readField()
+	if err != nil {
+		return "", err
+	}
+	if u != user || pw != pass {
+		_, _ = conn.Write([]byte{1, 1}) //nolint:errcheck
+		return "", errors.New("invalid credentials")
+	}
+	if _, err := conn.Write([]byte{1, 0}); err != nil {
+		return "", err
+	}
+
+	// Request.
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return "", err
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		b := make([]byte, net.IPv4len)
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return "", err
+		}
+		host = net.IP(b).String()
+	case 3:
+		if host, err = readField(); err != nil {
+			return "", err
+		}
+	case 4:
+		b := make([]byte, net.IPv6len)
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return "", err
+		}
+		host = net.IP(b).String()
+	default:
+		return "", errors.New("unsupported address type")
+	}
+	portB := make([]byte, 2)
+	if _, err := io.ReadFull(conn, portB); err != nil {
+		return "", err
+	}
+
+	if _, err := conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(portB)))), nil
+}
+
+// newTestConnectProxy serves a minimal HTTP CONNECT proxy.
+func newTestConnectProxy(t *testing.T) *testProxy {
+	p := new(testProxy)
+	p.addr = serveTestProxy(t, func(conn net.Conn) {
+		br := bufio.NewReader(conn)
+		req, err := http.ReadRequest(br)
+		if err != nil || req.Method != http.MethodConnect {
+			_ = conn.Close() //nolint:errcheck
+			return
+		}
+		if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+			_ = conn.Close() //nolint:errcheck
+			return
+		}
+		p.relay(conn, br, req.Host)
+	})
+	return p
+}
@@ -0,0 +1,145 @@
+// Package dmsg pkg/dmsg/replay.go
+package dmsg
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+)
+
+// DefaultReqFreshness is the maximum difference between the timestamp of a stream request and the local time.
+// Requests of timestamps outside this window are rejected as stale (or as from the future).
+const DefaultReqFreshness = 5 * time.Minute
+
+const (
+	reqTrackerSize     = 4096 // maximum number of source public keys which are tracked
+	reqTrackerMaxPerPK = 1024 // maximum number of timestamps which are tracked per source public key
+)
+
+// reqTracker protects against replayed stream requests by tracking the timestamps of accepted requests per source
+// public key. Requests of a source may be received out of order (as they are dialed concurrently), so all timestamps
+// within the freshness window are tracked instead of only the last one.
+// Sources are evicted in least recently used order, so memory usage is bounded. Only the newest timestamp of evicted
+// sources is remembered (until it is out of the freshness window), and their requests are rejected unless they are
+// newer. Sources which are not evicted are not affected, so flooding the tracker cannot block other sources.
+type reqTracker struct {
+	window   time.Duration
+	size     int
+	srcs     map[cipher.PubKey]*list.Element // values are *srcTimestamps
+	lru      *list.List                      // most recently used at the front
+	evicted  map[cipher.PubKey]int64         // newest timestamps of evicted sources
+	prunedAt time.Time                       // when evicted sources are last pruned
+	mx       sync.Mutex
+}
+
+// srcTimestamps are the tracked timestamps of a single source public key.
+type srcTimestamps struct {
+	pk     cipher.PubKey
+	floor  int64              // timestamps which are not larger than the floor are rejected
+	seen   map[int64]struct{} // accepted timestamps which are larger than the floor
+	newest int64              // newest accepted timestamp
+}
+
+func newReqTracker(window time.Duration, size int) *reqTracker {
+	return &reqTracker{
+		window:  window,
+		size:    size,
+		srcs:    make(map[cipher.PubKey]*list.Element),
+		lru:     list.New(),
+		evicted: make(map[cipher.PubKey]int64),
+	}
+}
+
+// check records the timestamp of a stream request of the source public key.
+// It returns ErrReqInvalidTimestamp if the timestamp is out of the freshness window, or if it is already recorded
+// (the request is replayed).
+func (t *reqTracker) check(pk cipher.PubKey, ts int64, now time.Time) error {
+	minTS := now.Add(-t.window).UnixNano()
+	if ts < minTS || ts > now.Add(t.window).UnixNano() {
+		return ErrReqInvalidTimestamp
+	}
+
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	var src *srcTimestamps
+	if el, ok := t.srcs[pk]; ok {
+		t.lru.MoveToFront(el)
+		src = el.Value.(*srcTimestamps)
+	} else {
+		// The source may have been evicted, in which case the request may be replayed.
+		floor, wasEvicted := t.evicted[pk]
+		if wasEvicted && ts <= floor {
+			return ErrReqInvalidTimestamp
+		}
+		delete(t.evicted, pk)
+		src = &srcTimestamps{pk: pk, floor: floor, seen: make(map[int64]struct{})}
+		t.srcs[pk] = t.lru.PushFront(src)
+		if t.lru.Len() > t.size {
+			t.evict(now)
+		}
+	}
+
+	if _, ok := src.seen[ts]; ok || ts <= src.floor {
+		return ErrReqInvalidTimestamp
+	}
+	src.seen[ts] = struct{}{}
+	if ts > src.newest {
+		src.newest = ts
+	}
+	if len(src.seen) > reqTrackerMaxPerPK {
+		src.prune(minTS)
+	}
+	return nil
+}
+
+// evict forgets the least recently used source, apart from its newest timestamp.
+// Newest timestamps of evicted sources are forgotten once they are out of the freshness window, as older requests are
+// rejected as stale anyway.
+func (t *reqTracker) evict(now time.Time) {
+	oldest := t.lru.Back()
+	t.lru.Remove(oldest)
+	src := oldest.Value.(*srcTimestamps)
+	delete(t.srcs, src.pk)
+
+	minTS := now.Add(-t.window).UnixNano()
+	if src.newest >= minTS {
+		t.evicted[src.pk] = src.newest
+	}
+	if now.Sub(t.prunedAt) < t.window {
+		return
+	}
+	t.prunedAt = now
+	for pk, newest := range t.evicted {
+		if newest < minTS {
+			delete(t.evicted, pk)
+		}
+	}
+}
+
+// prune forgets the timestamps which are out of the freshness window. If too many timestamps remain, the older half
+// is forgotten, and the floor is raised so that they are still rejected.
+func (s *srcTimestamps) prune(minTS int64) {
+	if minTS-1 > s.floor {
+		s.floor = minTS - 1
+	}
+	tss := make([]int64, 0, len(s.seen))
+	for ts := range s.seen {
+		if ts <= s.floor {
+			delete(s.seen, ts)
+			continue
+		}
+		tss = append(tss, ts)
+	}
+	if len(tss) <= reqTrackerMaxPerPK/2 {
+		return
+	}
+	sort.Slice(tss, func(i, j int) bool { return tss[i] < tss[j] })
+	s.floor = tss[len(tss)/2]
+	for _, ts := range tss[:len(tss)/2+1] {
+		delete(s.seen, ts)
+	}
+}
@@ -0,0 +1,194 @@
+// Package dmsg pkg/dmsg/replay_test.go
+package dmsg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/dmsg/pkg/noise"
+)
+
+func TestReqTracker(t *testing.T) {
+	now := time.Now()
+	pk1, _ := cipher.GenerateKeyPair()
+	pk2, _ := cipher.GenerateKeyPair()
+	pk3, _ := cipher.GenerateKeyPair()
+
+	t.Run("replay", func(t *testing.T) {
+		tr := newReqTracker(time.Minute, 10)
+		ts := now.UnixNano()
+		require.NoError(t, tr.check(pk1, ts, now))
+		assert.Equal(t, ErrReqInvalidTimestamp, tr.check(pk1, ts, now))
+
+		// Requests may be received out of order.
+		assert.NoError(t, tr.check(pk1, ts-1, now))
+		assert.Equal(t, ErrReqInvalidTimestamp, tr.check(pk1, ts-1, now))
+
+		// Timestamps are tracked per source.
+		assert.NoError(t, tr.check(pk2, ts, now))
+	})
+
+	t.Run("freshness", func(t *testing.T) {
+		tr := newReqTracker(time.Minute, 10)
+		assert.Equal(t, ErrReqInvalidTimestamp, tr.check(pk1, now.Add(-time.Minute-1).UnixNano(), now))
+		assert.Equal(t, ErrReqInvalidTimestamp, tr.check(pk1, now.Add(time.Minute+1).UnixNano(), now))
+		assert.NoError(t, tr.check(pk1, now.Add(-time.Minute).UnixNano(), now))
+		assert.NoError(t, tr.check(pk1, now.Add(time.Minute).UnixNano(), now))
+	})
+
+	t.Run("lru", func(t *testing.T) {
+		tr := newReqTracker(time.Minute, 2)
+		for _, pk := range []cipher.PubKey{pk1, pk2, pk1, pk3} {
+			require.NoError(t, tr.check(pk, time.Now().UnixNano(), now))
+		}
+		assert.Len(t, tr.srcs, 2)
+		assert.Contains(t, tr.srcs, pk1)
+		assert.Contains(t, tr.srcs, pk3)
+	})
+
+	t.Run("evicted", func(t *testing.T) {
+		const size = 10
+		tr := newReqTracker(time.Minute, size)
+		ts := now.Add(-time.Second).UnixNano()
+		require.NoError(t, tr.check(pk1, ts, now))
+
+		// Flood the tracker with fresh public keys, of which requests have future timestamps.
+		for i := 0; i <= size; i++ {
+			pk, _ := cipher.GenerateKeyPair()
+			require.NoError(t, tr.check(pk, now.Add(30*time.Second).UnixNano(), now))
+		}
+		require.NotContains(t, tr.srcs, pk1)
+
+		// The request of the evicted source is still rejected, but newer requests are accepted.
+		assert.Equal(t, ErrReqInvalidTimestamp, tr.check(pk1, ts, now))
+		assert.NoError(t, tr.check(pk1, ts+1, now))
+
+		// Sources which are not evicted are not affected by the flood.
+		assert.NoError(t, tr.check(pk2, now.UnixNano(), now))
+
+		// Evicted sources are forgotten once they are out of the freshness window.
+		later := now.Add(2 * time.Minute)
+		for i := 0; i <= size; i++ {
+			pk, _ := cipher.GenerateKeyPair()
+			require.NoError(t, tr.check(pk, later.UnixNano(), later))
+		}
+		assert.NotContains(t, tr.evicted, pk1)
+	})
+
+	t.Run("max_per_pk", func(t *testing.T) {
+		tr := newReqTracker(time.Minute, 10)
+		ts := now.UnixNano()
+		for i := 0; i <= reqTrackerMaxPerPK; i++ {
+			require.NoError(t, tr.check(pk1, ts+int64(i), now))
+		}
+		src := tr.srcs[pk1].Value.(*srcTimestamps)
+		assert.True(t, len(src.seen) <= reqTrackerMaxPerPK/2)
+
+		// Forgotten timestamps are still rejected.
+		for i := 0; i <= reqTrackerMaxPerPK; i++ {
+			assert.Equal(t, ErrReqInvalidTimestamp, tr.check(pk1, ts+int64(i), now))
+		}
+	})
+}
+
+// Ensure that replayed stream requests are rejected by dmsg servers and by responding clients.
+// Arrange:
+// - Dmsg servers 1 and 2, and clients A and B with sessions to both servers. Client B listens on a port.
+// - A stream request from client A to client B is recorded.
+// Act:
+// - The recorded request is sent via server 1, and replayed via server 1 and server 2.
+// Assert:
+// - The request is accepted once.
+// - Server 1 rejects the replayed request with ErrReqInvalidTimestamp.
+// - Client B rejects the request which is replayed via server 2 (which has not seen it), and keeps its session.
+func TestStreamRequest_Replay(t *testing.T) {
+	const port = uint16(80)
+
+	env := newTestEnv(t)
+	srv1 := env.newServer("replay server 1", nil)
+	srv2 := env.newServer("replay server 2", nil)
+	clientA := env.connectClient("replay client A", &Config{}, srv1, srv2)
+	clientB := env.connectClient("replay client B", &Config{}, srv1, srv2)
+
+	lis, err := clientB.Listen(port)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, lis.Close()) }()
+
+	// newRequest records a signed stream request from client A to client B.
+	newRequest := func() StreamRequest {
+		ns, err := noise.New(noise.HandshakeKK, noise.Config{
+			LocalPK:   clientA.LocalPK(),
+			LocalSK:   clientA.LocalSK(),
+			RemotePK:  clientB.LocalPK(),
+			Initiator: true,
+		})
+		require.NoError(t, err)
+		nsMsg, err := ns.MakeHandshakeMessage()
+		require.NoError(t, err)
+		req := StreamRequest{
+			Timestamp: time.Now().UnixNano(),
+			SrcAddr:   Addr{PK: clientA.LocalPK(), Port: 49152},
+			DstAddr:   Addr{PK: clientB.LocalPK(), Port: port},
+			NoiseMsg:  nsMsg,
+		}
+		req, err = MakeSignedStreamRequest(&req, clientA.LocalSK()).ObtainStreamRequest()
+		require.NoError(t, err)
+		return req
+	}
+
+	// send sends the signed object of the request via the server, and returns the response.
+	send := func(srvPK cipher.PubKey, req StreamRequest) (StreamResponse, error) {
+		ses, ok := clientA.session(srvPK)
+		require.True(t, ok)
+		yStr, err := ses.ys.OpenStream()
+		require.NoError(t, err)
+		defer func() { _ = yStr.Close() }() //nolint:errcheck
+		require.NoError(t, ses.writeObject(yStr, req.raw))
+		obj, err := ses.readObject(yStr)
+		if err != nil {
+			return StreamResponse{}, err
+		}
+		return obj.ObtainStreamResponse()
+	}
+	accept := func() {
+		str, err := lis.AcceptStream()
+		require.NoError(t, err)
+		assert.NoError(t, str.Close())
+	}
+
+	req := newRequest()
+	resp, err := send(srv1.LocalPK(), req)
+	require.NoError(t, err)
+	require.True(t, resp.Accepted)
+	accept()
+
+	t.Run("server", func(t *testing.T) {
+		resp, err := send(srv1.LocalPK(), req)
+		require.NoError(t, err)
+		ok, rErr := resp.VerifyServerRejection(req, srv1.LocalPK())
+		require.True(t, ok)
+		assert.Equal(t, ErrReqInvalidTimestamp, rErr)
+	})
+
+	t.Run("client", func(t *testing.T) {
+		// Fresh requests are accepted via server 2.
+		resp, err := send(srv2.LocalPK(), newRequest())
+		require.NoError(t, err)
+		require.True(t, resp.Accepted)
+		accept()
+
+		resp, err = send(srv2.LocalPK(), req)
+		require.NoError(t, err)
+		assert.False(t, resp.Accepted)
+		assert.Equal(t, ErrReqInvalidTimestamp, resp.Verify(req))
+
+		resp, err = send(srv2.LocalPK(), newRequest())
+		require.NoError(t, err)
+		require.True(t, resp.Accepted)
+		accept()
+	})
+}
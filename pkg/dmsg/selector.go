@@ -0,0 +1,395 @@
+// Package dmsg pkg/dmsg/selector.go
+package dmsg
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+
+	"github.com/skycoin/dmsg/pkg/disc"
+	"github.com/skycoin/dmsg/pkg/noise"
+)
+
+// ServerProber measures the round trip time to a dmsg server.
+type ServerProber func(ctx context.Context, entry *disc.Entry) (time.Duration, error)
+
+// ServerSelector decides which dmsg servers a client prefers to establish sessions with.
+type ServerSelector interface {
+	// Rank returns the candidate dmsg servers in the order of preference (most preferred first).
+	// Candidates may be omitted from the result to avoid them altogether.
+	// 'probe' may be used to measure the round trip time to a candidate.
+	Rank(ctx context.Context, candidates []*disc.Entry, probe ServerProber) []*disc.Entry
+}
+
+const (
+	// DefaultProbeTimeout is the default timeout for probing a single dmsg server.
+	DefaultProbeTimeout = time.Second * 5
+
+	// DefaultProbeConcurrency is the default number of dmsg servers which are probed concurrently.
+	DefaultProbeConcurrency = 8
+
+	// DefaultProbeTTL is the default duration for which the results of probing a dmsg server are used, before the
+	// server is probed again. It matches the interval of re-evaluating sessions, so that each re-evaluation probes once.
+	DefaultProbeTTL = DefaultReselectInterval
+
+	// latencySmoothing is the weight of the latest round trip time in the smoothed round trip time of a server.
+	latencySmoothing = 0.5
+)
+
+// LatencySelector ranks dmsg servers by their round trip time, lowest first.
+// Round trip times are smoothed over successive probes. Servers which cannot be probed are ranked last.
+// The results of probes are cached, so that servers are not probed on every ranking.
+type LatencySelector struct {
+	Timeout     time.Duration // Timeout of probing a single server.
+	Concurrency int           // Number of servers which are probed concurrently.
+	TTL         time.Duration // Duration for which the result of probing a server is used.
+
+	rtts map[cipher.PubKey]serverRTT
+	mx   sync.Mutex
+}
+
+// serverRTT is the result of probing a dmsg server.
+type serverRTT struct {
+	rtt      time.Duration // smoothed round trip time
+	ok       bool          // false if the last probe failed
+	probedAt time.Time
+}
+
+// NewLatencySelector creates a LatencySelector with default values.
+func NewLatencySelector() *LatencySelector {
+	return &LatencySelector{
+		Timeout:     DefaultProbeTimeout,
+		Concurrency: DefaultProbeConcurrency,
+		TTL:         DefaultProbeTTL,
+		rtts:        make(map[cipher.PubKey]serverRTT),
+	}
+}
+
+// Rank implements ServerSelector
+func (s *LatencySelector) Rank(ctx context.Context, candidates []*disc.Entry, probe ServerProber) []*disc.Entry {
+	rtts := s.probeAll(ctx, candidates, probe)
+
+	ranked := append([]*disc.Entry(nil), candidates...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		rttI, okI := rtts[ranked[i].Static]
+		rttJ, okJ := rtts[ranked[j].Static]
+		if okI != okJ {
+			return okI
+		}
+		return rttI < rttJ
+	})
+	return ranked
+}
+
+// RTT returns the smoothed round trip time of the dmsg server of the given public key.
+// It returns false if the server has not been probed successfully.
+func (s *LatencySelector) RTT(srvPK cipher.PubKey) (time.Duration, bool) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	r := s.rtts[srvPK]
+	return r.rtt, r.ok
+}
+
+// probeAll probes the candidates of which the cached results are expired, and returns the smoothed round trip times of
+// the candidates which are probed successfully.
+func (s *LatencySelector) probeAll(ctx context.Context, candidates []*disc.Entry, probe ServerProber) map[cipher.PubKey]time.Duration {
+	concurrency := s.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultProbeConcurrency
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
+	}
+	ttl := s.TTL
+	if ttl <= 0 {
+		ttl = DefaultProbeTTL
+	}
+
+	out := make(map[cipher.PubKey]time.Duration, len(candidates))
+	sem := make(chan struct{}, concurrency)
+	wg := new(sync.WaitGroup)
+
+	for _, entry := range candidates {
+		s.mx.Lock()
+		if s.rtts == nil {
+			s.rtts = make(map[cipher.PubKey]serverRTT)
+		}
+		r, ok := s.rtts[entry.Static]
+		if ok && time.Since(r.probedAt) < ttl {
+			if r.ok {
+				out[entry.Static] = r.rtt
+			}
+			s.mx.Unlock()
+			continue
+		}
+		s.mx.Unlock()
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(entry *disc.Entry) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			pCtx, cancel := context.WithTimeout(ctx, timeout)
+			rtt, err := probe(pCtx, entry)
+			cancel()
+
+			s.mx.Lock()
+			defer s.mx.Unlock()
+			prev := s.rtts[entry.Static]
+			if err != nil {
+				s.rtts[entry.Static] = serverRTT{probedAt: time.Now()}
+				return
+			}
+			if prev.ok {
+				rtt = time.Duration(latencySmoothing*float64(rtt) + (1-latencySmoothing)*float64(prev.rtt))
+			}
+			s.rtts[entry.Static] = serverRTT{rtt: rtt, ok: true, probedAt: time.Now()}
+			out[entry.Static] = rtt
+		}(entry)
+	}
+	wg.Wait()
+	return out
+}
+
+// probeServer measures the round trip time to the dmsg server.
+// Established sessions are pinged. Otherwise, the first round trip of the session handshake is measured, and the
+// connection is closed before the handshake completes (so that the server does not establish a session).
+func (ce *Client) probeServer(ctx context.Context, entry *disc.Entry) (time.Duration, error) {
+	if dSes, ok := ce.clientSession(ce.porter, entry.Static); ok {
+		return dSes.Ping()
+	}
+
+	network := ce.config().Transport.Type()
+	addr, ok := entry.Server.TransportAddr(network)
+	if !ok {
+		return 0, fmt.Errorf("dmsg server does not support session transport '%s'", network)
+	}
+	ns, err := noise.New(noise.HandshakeXK, noise.Config{
+		LocalPK:   ce.pk,
+		LocalSK:   ce.sk,
+		RemotePK:  entry.Static,
+		Initiator: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	msg, err := ns.MakeHandshakeMessage()
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := ce.config().Transport.Dial(ctx, addr)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = conn.Close() }() //nolint:errcheck
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return 0, err
+		}
+	}
+
+	start := time.Now()
+	if _, err := noise.WriteRawFrame(conn, msg); err != nil {
+		return 0, err
+	}
+	res, err := noise.ReadRawFrame(bufio.NewReader(conn))
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+
+	// The response is only valid if it is of the server of the entry.
+	if err := ns.ProcessHandshakeMessage(res); err != nil {
+		return 0, err
+	}
+	return rtt, nil
+}
+
+// rankServers orders the dmsg servers with the configured ServerSelector.
+// There is nothing to rank (or probe) when there is only a single server.
+func (ce *Client) rankServers(ctx context.Context, entries []*disc.Entry) []*disc.Entry {
+	sel := ce.config().ServerSelector
+	if sel == nil || len(entries) < 2 {
+		return entries
+	}
+	return sel.Rank(ctx, entries, ce.probeServer)
+}
+
+// orderServers orders the dmsg servers as configured: servers which are not allowed are removed, preferred servers
+// come first (in the configured order) and the rest are ranked with the ServerSelector.
+func (ce *Client) orderServers(ctx context.Context, entries []*disc.Entry) []*disc.Entry {
+	conf := ce.config()
+	preferred := make([]*disc.Entry, 0, len(conf.PreferredServers))
+	for _, pk := range conf.PreferredServers {
+		for _, entry := range entries {
+			if entry.Static == pk && conf.serverAllowed(pk) {
+				preferred = append(preferred, entry)
+				break
+			}
+		}
+	}
+	others := make([]*disc.Entry, 0, len(entries))
+	for _, entry := range entries {
+		if !hasPK(conf.PreferredServers, entry.Static) && conf.serverAllowed(entry.Static) {
+			others = append(others, entry)
+		}
+	}
+	return append(preferred, ce.rankServers(ctx, others)...)
+}
+
+// reselectThreshold is the number of consecutive re-evaluations in which an established session is outranked,
+// before it is replaced.
+const reselectThreshold = 3
+
+// reselectLoop periodically re-evaluates established sessions with the ServerSelector.
+// Sessions which are consistently outranked by servers that we are not connected to are replaced: a session with the
+// better server is established, and the replaced session is marked as draining (so that new streams avoid it) and
+// closed once it has no more streams.
+func (ce *Client) reselectLoop(ctx context.Context) {
+	t := time.NewTicker(ce.config().ReselectInterval)
+	defer t.Stop()
+
+	outranked := make(map[cipher.PubKey]int)
+	replaced := make(map[cipher.PubKey]struct{})
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ce.done:
+			return
+		case <-t.C:
+			ce.closeReplacedSessions(replaced)
+			ce.reselect(ctx, outranked, replaced)
+		}
+	}
+}
+
+// reselect re-evaluates established sessions once.
+func (ce *Client) reselect(ctx context.Context, outranked map[cipher.PubKey]int, replaced map[cipher.PubKey]struct{}) {
+	log := ce.log.WithField("func", "Client.reselect")
+
+	candidates, err := ce.dc.AvailableServers(ctx)
+	if err != nil {
+		log.WithError(err).Debug("Failed to discover dmsg servers.")
+		return
+	}
+
+	// Established sessions are always candidates (even if their servers are no longer available to new clients).
+	current := make(map[cipher.PubKey]struct{})
+	for _, dSes := range ce.allClientSessions(ce.porter) {
+		if !dSes.IsDraining() {
+			current[dSes.RemotePK()] = struct{}{}
+		}
+	}
+	if len(current) == 0 {
+		return
+	}
+	network := ce.config().Transport.Type()
+	listed := make(map[cipher.PubKey]struct{}, len(candidates))
+	filtered := candidates[:0]
+	for _, entry := range candidates {
+		if _, ok := current[entry.Static]; !ok {
+			if _, ok := entry.Server.TransportAddr(network); !ok || entry.Server.Draining {
+				continue
+			}
+		}
+		listed[entry.Static] = struct{}{}
+		filtered = append(filtered, entry)
+	}
+	candidates = filtered
+	for srvPK := range current {
+		if _, ok := listed[srvPK]; ok {
+			continue
+		}
+		if entry, err := getServerEntry(ctx, ce.dc, srvPK); err == nil {
+			candidates = append(candidates, entry)
+		}
+	}
+
+	// Sessions with servers outside of the most preferred servers are outranked.
+	ranked := ce.orderServers(ctx, candidates)
+	if len(ranked) > len(current) {
+		ranked = ranked[:len(current)]
+	}
+	preferred := make(map[cipher.PubKey]struct{}, len(ranked))
+	for _, entry := range ranked {
+		preferred[entry.Static] = struct{}{}
+	}
+
+	for srvPK := range current {
+		if _, ok := preferred[srvPK]; ok {
+			delete(outranked, srvPK)
+			continue
+		}
+		if outranked[srvPK]++; outranked[srvPK] < reselectThreshold {
+			continue
+		}
+		delete(outranked, srvPK)
+
+		for _, entry := range ranked {
+			if _, ok := ce.clientSession(ce.porter, entry.Static); ok {
+				continue
+			}
+			if _, err := ce.EnsureAndObtainSession(ctx, entry.Static); err != nil {
+				log.WithError(err).WithField("remote_pk", entry.Static).Debug("Failed to establish session with preferred server.")
+				continue
+			}
+			ce.replaceSession(srvPK, replaced)
+			log.WithField("old_pk", srvPK).WithField("new_pk", entry.Static).Info("Replaced outranked session.")
+			break
+		}
+	}
+}
+
+// replaceSession marks the session as draining, so that it is no longer advertised in discovery and new streams
+// avoid it. The session is closed once it has no more streams (see closeReplacedSessions).
+func (ce *Client) replaceSession(srvPK cipher.PubKey, replaced map[cipher.PubKey]struct{}) {
+	dSes, ok := ce.clientSession(ce.porter, srvPK)
+	if !ok {
+		return
+	}
+	dSes.setDraining()
+	replaced[srvPK] = struct{}{}
+
+	ce.sessionsMx.Lock()
+	err := ce.updateClientEntry(context.Background(), ce.done)
+	ce.sessionsMx.Unlock()
+	if err != nil {
+		ce.log.WithError(err).Warn("Failed to update discovery entry after replacing session.")
+	}
+	ce.closeReplacedSessions(replaced)
+}
+
+// closeReplacedSessions closes replaced sessions which have no more streams.
+func (ce *Client) closeReplacedSessions(replaced map[cipher.PubKey]struct{}) {
+	if len(replaced) == 0 {
+		return
+	}
+	streams := make(map[cipher.PubKey]int)
+	for _, dStr := range ce.AllStreams() {
+		streams[dStr.ServerPK()]++
+	}
+	for srvPK := range replaced {
+		dSes, ok := ce.clientSession(ce.porter, srvPK)
+		if !ok {
+			delete(replaced, srvPK)
+			continue
+		}
+		if streams[srvPK] > 0 {
+			continue
+		}
+		ce.log.WithField("remote_pk", srvPK).WithError(dSes.Close()).Debug("Closed replaced session.")
+		delete(replaced, srvPK)
+	}
+}
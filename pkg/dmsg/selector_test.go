@@ -0,0 +1,243 @@
+// Package dmsg pkg/dmsg/selector_test.go
+package dmsg
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/dmsg/pkg/disc"
+)
+
+func TestLatencySelector_Rank(t *testing.T) {
+	entries := make([]*disc.Entry, 4)
+	for i := range entries {
+		pk, _ := GenKeyPair(t, "selector "+string(rune('A'+i)))
+		entries[i] = &disc.Entry{Static: pk, Server: &disc.Server{}}
+	}
+	rtts := map[cipher.PubKey]time.Duration{
+		entries[0].Static: 30 * time.Millisecond,
+		entries[1].Static: 10 * time.Millisecond,
+		entries[3].Static: 20 * time.Millisecond,
+	}
+	var mx sync.Mutex
+	probes := 0
+	probe := func(_ context.Context, entry *disc.Entry) (time.Duration, error) {
+		mx.Lock()
+		defer mx.Unlock()
+		probes++
+		rtt, ok := rtts[entry.Static]
+		if !ok {
+			return 0, errors.New("unreachable")
+		}
+		return rtt, nil
+	}
+
+	s := NewLatencySelector()
+	ranked := s.Rank(context.TODO(), entries, probe)
+	assert.Equal(t, []*disc.Entry{entries[1], entries[3], entries[0], entries[2]}, ranked)
+
+	// Results are cached within the TTL (including failed probes).
+	mx.Lock()
+	rtts[entries[0].Static] = 10 * time.Millisecond
+	mx.Unlock()
+	ranked = s.Rank(context.TODO(), entries, probe)
+	assert.Equal(t, []*disc.Entry{entries[1], entries[3], entries[0], entries[2]}, ranked)
+	mx.Lock()
+	assert.Equal(t, len(entries), probes)
+	mx.Unlock()
+
+	// Round trip times are smoothed when servers are probed again.
+	s.TTL = time.Nanosecond
+	ranked = s.Rank(context.TODO(), entries, probe)
+	assert.Equal(t, []*disc.Entry{entries[1], entries[0], entries[3], entries[2]}, ranked)
+
+	rtt, ok := s.RTT(entries[0].Static)
+	require.True(t, ok)
+	assert.Equal(t, 20*time.Millisecond, rtt)
+	_, ok = s.RTT(entries[2].Static)
+	assert.False(t, ok)
+}
+
+// Ensure that clients probe dmsg servers with the session handshake, and ping servers which they have sessions with.
+// Arrange:
+// - Dmsg server A, and dmsg server B which the client has a session with.
+// - Entry of a server which is not of the key of the listening server.
+// Act:
+// - Client probes the servers.
+// Assert:
+// - Both servers are probed.
+// - Probing fails if the server does not hold the key of the entry.
+func TestClient_probeServer(t *testing.T) {
+	env := newTestEnv(t)
+	pkA := env.newServer("probe server A", nil).LocalPK()
+	pkB := env.newServer("probe server B", nil).LocalPK()
+	c := env.serveClient("probe client", &Config{MinSessions: 1, PreferredServers: []cipher.PubKey{pkB}, StrictServers: true})
+	_, ok := c.clientSession(c.porter, pkB)
+	require.True(t, ok)
+
+	for _, srvPK := range []cipher.PubKey{pkA, pkB} {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultProbeTimeout)
+		rtt, err := c.probeServer(ctx, env.entry(srvPK))
+		cancel()
+		assert.NoError(t, err)
+		assert.True(t, rtt > 0)
+	}
+
+	otherPK, _ := GenKeyPair(t, "probe other")
+	entry := &disc.Entry{Static: otherPK, Server: env.entry(pkA).Server}
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultProbeTimeout)
+	defer cancel()
+	_, err := c.probeServer(ctx, entry)
+	assert.Error(t, err)
+}
+
+// prefSelector ranks the preferred server first.
+type prefSelector struct {
+	mx        sync.Mutex
+	preferred cipher.PubKey
+}
+
+func (s *prefSelector) prefer(pk cipher.PubKey) {
+	s.mx.Lock()
+	s.preferred = pk
+	s.mx.Unlock()
+}
+
+func (s *prefSelector) Rank(_ context.Context, candidates []*disc.Entry, _ ServerProber) []*disc.Entry {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	out := make([]*disc.Entry, 0, len(candidates))
+	for _, entry := range candidates {
+		if entry.Static == s.preferred {
+			out = append([]*disc.Entry{entry}, out...)
+		} else {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+// Ensure that clients establish sessions with, and migrate to, the servers ranked by their ServerSelector.
+// Arrange:
+// - Dmsg servers A and B.
+// - Client with a ServerSelector which prefers server B.
+// Act:
+// - Client serves, then the ServerSelector prefers server A instead.
+// Assert:
+// - Client initially delegates server B, then replaces its session with one to server A.
+func TestClient_ServerSelector(t *testing.T) {
+	env := newTestEnv(t)
+	pkA := env.newServer("selector server A", nil).LocalPK()
+	pkB := env.newServer("selector server B", nil).LocalPK()
+
+	sel := &prefSelector{preferred: pkB}
+	c := env.serveClient("selector client", &Config{
+		MinSessions:      1,
+		ServerSelector:   sel,
+		ReselectInterval: 50 * time.Millisecond,
+	})
+
+	delegated := func() []cipher.PubKey {
+		entry, err := env.dc.Entry(context.TODO(), c.LocalPK())
+		if err != nil {
+			return nil
+		}
+		return entry.Client.DelegatedServers
+	}
+	assert.Equal(t, []cipher.PubKey{pkB}, delegated())
+
+	sel.prefer(pkA)
+	require.Eventually(t, func() bool {
+		_, okA := c.Session(pkA)
+		_, okB := c.Session(pkB)
+		return okA && !okB
+	}, 10*time.Second, 50*time.Millisecond)
+	assert.Equal(t, []cipher.PubKey{pkA}, delegated())
+}
+
+func TestConfig_PreferServers(t *testing.T) {
+	pkA, _ := GenKeyPair(t, "pref A")
+	pkB, _ := GenKeyPair(t, "pref B")
+	pkC, _ := GenKeyPair(t, "pref C")
+	all := []cipher.PubKey{pkA, pkB, pkC}
+
+	tests := []struct {
+		name string
+		conf Config
+		want []cipher.PubKey
+	}{
+		{"default", Config{}, []cipher.PubKey{pkA, pkB, pkC}},
+		{"preferred", Config{PreferredServers: []cipher.PubKey{pkC, pkB}}, []cipher.PubKey{pkC, pkB, pkA}},
+		{"excluded", Config{ExcludedServers: []cipher.PubKey{pkB}}, []cipher.PubKey{pkA, pkC}},
+		{"preferred_and_excluded", Config{PreferredServers: []cipher.PubKey{pkB}, ExcludedServers: []cipher.PubKey{pkB}}, []cipher.PubKey{pkA, pkC}},
+		{"strict", Config{PreferredServers: []cipher.PubKey{pkC}, StrictServers: true}, []cipher.PubKey{pkC}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.conf.preferServers(all))
+		})
+	}
+}
+
+func TestClient_applyLegacyServerCtx(t *testing.T) {
+	pk, sk := GenKeyPair(t, "legacy client")
+	srvPK, _ := GenKeyPair(t, "legacy server")
+	conf := &Config{PreferredServers: []cipher.PubKey{pk}}
+	c := NewClient(pk, sk, disc.NewMock(0), conf)
+
+	c.applyLegacyServerCtx(context.Background())
+	assert.Equal(t, conf, c.config())
+
+	c.applyLegacyServerCtx(context.WithValue(context.Background(), legacyServerCtxKey, "invalid")) //nolint:staticcheck
+	assert.Equal(t, conf, c.config())
+
+	c.applyLegacyServerCtx(context.WithValue(context.Background(), legacyServerCtxKey, srvPK.Hex())) //nolint:staticcheck
+	assert.Equal(t, []cipher.PubKey{srvPK}, c.config().PreferredServers)
+	assert.True(t, c.config().StrictServers)
+	assert.Equal(t, []cipher.PubKey{pk}, conf.PreferredServers, "the given config should not be modified")
+}
+
+// Ensure that clients honor preferred and excluded servers.
+// Arrange:
+// - Dmsg servers A, B and C.
+// Act:
+// - Client 1 prefers server C and excludes server A, client 2 strictly prefers server A.
+// Assert:
+// - Client 1 delegates server C, and does not establish sessions with server A.
+// - Client 2 does not establish sessions with servers other than server A, even for dialing streams.
+func TestClient_PreferredServers(t *testing.T) {
+	env := newTestEnv(t)
+	entryA := env.entry(env.newServer("pinning server A", nil).LocalPK())
+	entryB := env.entry(env.newServer("pinning server B", nil).LocalPK())
+	entryC := env.entry(env.newServer("pinning server C", nil).LocalPK())
+
+	client1 := env.serveClient("pinning client 1", &Config{
+		MinSessions:      1,
+		PreferredServers: []cipher.PubKey{entryC.Static},
+		ExcludedServers:  []cipher.PubKey{entryA.Static},
+	})
+	_, ok := client1.Session(entryC.Static)
+	assert.True(t, ok)
+	require.Equal(t, ErrServerNotAllowed, client1.EnsureSession(context.TODO(), entryA))
+	require.NoError(t, client1.EnsureSession(context.TODO(), entryB))
+
+	client2 := env.newClient("pinning client 2", &Config{
+		PreferredServers: []cipher.PubKey{entryA.Static},
+		StrictServers:    true,
+	})
+	require.Equal(t, ErrServerNotAllowed, client2.EnsureSession(context.TODO(), entryB))
+	require.NoError(t, client2.EnsureSession(context.TODO(), entryA))
+
+	// Client 1 is not delegated to server A, and client 2 may not use other servers.
+	_, err := client2.DialStream(context.TODO(), Addr{PK: client1.LocalPK(), Port: 80})
+	require.Equal(t, ErrCannotConnectToDelegated, err)
+	assert.Len(t, client2.AllSessions(), 1)
+}
@@ -3,22 +3,48 @@ package dmsg
 
 import (
 	"context"
+	"errors"
 	"net"
 	"sync"
 	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/skycoin/skywire-utilities/pkg/cipher"
 	"github.com/skycoin/skywire-utilities/pkg/logging"
 	"github.com/skycoin/skywire-utilities/pkg/netutil"
 
 	"github.com/skycoin/dmsg/internal/servermetrics"
 	"github.com/skycoin/dmsg/pkg/disc"
+	"github.com/skycoin/dmsg/pkg/noise"
 )
 
 // ServerConfig configues the Server
 type ServerConfig struct {
 	MaxSessions    int
 	UpdateInterval time.Duration
+
+	// Transport is the session transport which the server accepts sessions over.
+	// If nil, TCP is used.
+	Transport SessionTransport
+
+	// ForwardStreams allows the server to forward streams to (and accept forwarded streams from) other dmsg servers.
+	// This lets clients which are delegated to different servers reach one another.
+	ForwardStreams bool
+
+	// Peers restricts the dmsg servers which streams are forwarded to and accepted from.
+	// If empty, any dmsg server which is registered in discovery is a peer.
+	Peers []cipher.PubKey
+
+	// ClientLimits limits the streams which each client can initiate through the server.
+	ClientLimits ClientLimits
+
+	// ACL restricts the sessions and streams which the server serves.
+	// If nil, everything is allowed.
+	ACL *ACL
+
+	// Rekey configures periodic rekeying of the noise cipher states of sessions.
+	// Rekeying is disabled if unset, as clients must also support it.
+	Rekey noise.RekeyConfig
 }
 
 // DefaultServerConfig returns the default server config.
@@ -26,6 +52,7 @@ func DefaultServerConfig() *ServerConfig {
 	return &ServerConfig{
 		MaxSessions:    DefaultMaxSessions,
 		UpdateInterval: DefaultUpdateInterval,
+		ForwardStreams: true,
 	}
 }
 
@@ -42,12 +69,53 @@ type Server struct {
 	once sync.Once
 	wg   sync.WaitGroup
 
+	// Closed once the server starts draining (see Drain).
+	drain     chan struct{}
+	drainOnce sync.Once
+	streams   int64 // number of streams being served (accessed atomically)
+
 	// Public TCP address which the dmsg server advertises itself as.
 	// This should only be set once. Once set, addrDone closes.
 	addr     string
 	addrDone chan struct{}
 
-	maxSessions int
+	maxSessions    int
+	forwardStreams bool
+	transport      SessionTransport
+	limits         *clientLimiters // nil if clients are not limited
+	acl            *ACL            // nil if everything is allowed
+
+	// Additional session transports which the server accepts sessions over (see ServeTransport).
+	transports   []disc.Transport
+	advertised   int  // number of additional transports which the entry is last updated with
+	serving      bool // whether the entry is updated since the server started serving
+	transportsMx sync.Mutex
+
+	// Discovery entries of the remotes of new sessions (see shouldRedirect), and the dmsg servers which sessions are
+	// redirected to (see refreshAlternatives).
+	entries *disc.CachingClient
+	alts    []cipher.PubKey
+	altsMx  sync.Mutex
+
+	// Sessions which we dialed to other dmsg servers (used for forwarding streams).
+	peers     map[cipher.PubKey]ServerSession
+	peerDials map[cipher.PubKey]*peerDial
+	peersMx   sync.Mutex
+
+	// Configured peers (nil if any dmsg server is a peer), and cached lookups of whether public keys belong to dmsg
+	// servers (see isPeer).
+	peerPKs     map[cipher.PubKey]struct{}
+	peerCache   map[cipher.PubKey]peerLookup
+	peerCacheMx sync.Mutex
+
+	// Datagram channels of connected clients (see PacketConn).
+	dgramChs   map[cipher.PubKey]*serverDatagramChannel
+	dgramChsMx sync.RWMutex
+
+	// Streams which are being forwarded, and banned public keys (see server_admin.go).
+	fwdStreams serverStreams
+	bans       map[cipher.PubKey]time.Time
+	bansMx     sync.Mutex
 }
 
 // NewServer creates a new dmsg server entity.
@@ -62,16 +130,39 @@ func NewServer(pk cipher.PubKey, sk cipher.SecKey, dc disc.APIClient, conf *Serv
 
 	s := new(Server)
 	s.EntityCommon.init(pk, sk, dc, log, conf.UpdateInterval)
+	s.EntityCommon.rekey = conf.Rekey
 	s.m = m
 	s.ready = make(chan struct{})
 	s.done = make(chan struct{})
+	s.drain = make(chan struct{})
 	s.addrDone = make(chan struct{})
 	s.maxSessions = conf.MaxSessions
+	s.forwardStreams = conf.ForwardStreams
+	s.transport = conf.Transport
+	s.acl = conf.ACL
+	if s.transport == nil {
+		s.transport = NewTCPTransport()
+	}
+	if conf.ClientLimits.Enabled() {
+		s.limits = newClientLimiters(conf.ClientLimits, m)
+	}
+	s.entries = disc.NewCachingClient(dc, nil)
+	s.peers = make(map[cipher.PubKey]ServerSession)
+	s.peerDials = make(map[cipher.PubKey]*peerDial)
+	s.peerCache = make(map[cipher.PubKey]peerLookup)
+	if len(conf.Peers) > 0 {
+		s.peerPKs = make(map[cipher.PubKey]struct{}, len(conf.Peers))
+		for _, pk := range conf.Peers {
+			s.peerPKs[pk] = struct{}{}
+		}
+	}
+	s.dgramChs = make(map[cipher.PubKey]*serverDatagramChannel)
+	s.bans = make(map[cipher.PubKey]time.Time)
 	s.setSessionCallback = func(ctx context.Context) error {
-		return s.updateServerEntry(ctx, s.AdvertisedAddr(), s.maxSessions)
+		return s.updateEntry(ctx)
 	}
 	s.delSessionCallback = func(ctx context.Context) error {
-		return s.updateServerEntry(ctx, s.AdvertisedAddr(), s.maxSessions)
+		return s.updateEntry(ctx)
 	}
 	return s
 }
@@ -96,6 +187,7 @@ func (s *Server) Close() error {
 	}
 	s.once.Do(func() {
 		close(s.done)
+		s.closePeers()
 		s.wg.Wait()
 	})
 	err := s.delEntry(context.Background())
@@ -105,7 +197,48 @@ func (s *Server) Close() error {
 	return nil
 }
 
+// ACL returns the access control list of the server (which is nil if everything is allowed).
+func (s *Server) ACL() *ACL {
+	return s.acl
+}
+
+// ReloadACL reloads the rules of the server's file-backed ACL.
+// Established sessions which are no longer allowed are closed.
+func (s *Server) ReloadACL() error {
+	if s.acl == nil {
+		return errors.New("server has no acl")
+	}
+	if err := s.acl.Reload(); err != nil {
+		return err
+	}
+	for pk, ses := range s.GetSessions() {
+		if !s.acl.AllowSession(pk) {
+			s.log.
+				WithField("remote_pk", pk).
+				WithError(ses.Close()).
+				Info("Closed session which is no longer allowed by acl.")
+		}
+	}
+	return nil
+}
+
+// Transport returns the session transport which the server accepts sessions over.
+func (s *Server) Transport() SessionTransport {
+	return s.transport
+}
+
+// ListenAndServe listens on the local address 'lAddr' with the server's session transport and serves the server.
+// The server is advertised in discovery with the address 'addr'.
+func (s *Server) ListenAndServe(lAddr, addr string) error {
+	lis, err := s.transport.Listen(lAddr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(lis, addr)
+}
+
 // Serve serves the server.
+// The listener is expected to accept connections of the server's session transport.
 func (s *Server) Serve(lis net.Listener, addr string) error {
 	s.SetAdvertisedAddr(lis, &addr)
 
@@ -130,9 +263,68 @@ func (s *Server) Serve(lis net.Listener, addr string) error {
 	if err := s.startUpdateEntryLoop(ctx); err != nil {
 		return err
 	}
+	go s.refreshAlternativesLoop(ctx)
+
+	// Transports which are served before this point, but after the entry is updated, are advertised before the server
+	// is ready. Transports which are served afterwards are advertised by ServeTransport.
+	s.transportsMx.Lock()
+	s.serving = true
+	stale := s.advertised < len(s.transports)
+	s.transportsMx.Unlock()
+	if stale {
+		s.sessionsMx.Lock()
+		err := s.updateEntry(ctx)
+		s.sessionsMx.Unlock()
+		if err != nil {
+			log.WithError(err).Warn("Failed to advertise server transports.")
+		}
+	}
 
 	log.Info("Accepting sessions...")
 	s.readyOnce.Do(func() { close(s.ready) })
+	return s.acceptSessions(lis, log)
+}
+
+// ServeTransport accepts sessions from an additional listener of the session transport type 'tpType'.
+// The transport is advertised in discovery with the address 'addr'.
+// It blocks until the server is closed.
+func (s *Server) ServeTransport(lis net.Listener, tpType, addr string) error {
+	log := s.log.
+		WithField("transport", tpType).
+		WithField("advertised_addr", addr).
+		WithField("local_pk", s.pk)
+
+	s.transportsMx.Lock()
+	s.transports = append(s.transports, disc.Transport{Type: tpType, Address: addr})
+	serving := s.serving
+	s.transportsMx.Unlock()
+
+	log.Info("Serving server transport.")
+	s.wg.Add(1)
+	defer func() {
+		log.Info("Stopped server transport.")
+		s.wg.Done()
+	}()
+
+	go func() {
+		<-s.done
+		log.WithError(lis.Close()).Info("Stopping server transport...")
+	}()
+
+	// Advertise the transport straight away if the server is already serving.
+	if serving {
+		s.sessionsMx.Lock()
+		err := s.updateEntry(context.Background())
+		s.sessionsMx.Unlock()
+		if err != nil {
+			log.WithError(err).Warn("Failed to advertise server transport.")
+		}
+	}
+
+	return s.acceptSessions(lis, log)
+}
+
+func (s *Server) acceptSessions(lis net.Listener, log logrus.FieldLogger) error {
 	for {
 		conn, err := lis.Accept()
 		if err != nil {
@@ -143,14 +335,6 @@ func (s *Server) Serve(lis net.Listener, addr string) error {
 			return err
 		}
 
-		// TODO(evanlinjin): Implement proper load-balancing.
-		if s.SessionCount() >= s.maxSessions {
-			s.log.
-				WithField("max_sessions", s.maxSessions).
-				WithField("remote_tcp", conn.RemoteAddr()).
-				Debug("Max sessions is reached, but still accepting so clients who delegated us can still listen.")
-		}
-
 		s.wg.Add(1)
 		go func(conn net.Conn) {
 			defer func() {
@@ -167,13 +351,13 @@ func (s *Server) Serve(lis net.Listener, addr string) error {
 
 func (s *Server) startUpdateEntryLoop(ctx context.Context) error {
 	err := netutil.NewDefaultRetrier(s.log).Do(ctx, func() error {
-		return s.updateServerEntry(ctx, s.AdvertisedAddr(), s.maxSessions)
+		return s.updateEntry(ctx)
 	})
 	if err != nil {
 		return err
 	}
 
-	go s.updateServerEntryLoop(ctx, s.AdvertisedAddr(), s.maxSessions)
+	go s.updateServerEntryLoop(ctx, s.updateEntry)
 	return nil
 }
 
@@ -195,7 +379,35 @@ func (s *Server) SetAdvertisedAddr(lis net.Listener, addr *string) {
 	close(s.addrDone)
 }
 
+// updateEntry updates the server's entry in discovery.
+// It is expected that sessionsMx is locked.
+func (s *Server) updateEntry(ctx context.Context) error {
+	transports := s.advertisedTransports()
+	if err := s.updateServerEntry(ctx, s.AdvertisedAddr(), transports, s.maxSessions, s.isDraining()); err != nil {
+		return err
+	}
+
+	s.transportsMx.Lock()
+	if n := len(transports) - 1; n > s.advertised {
+		s.advertised = n
+	}
+	s.transportsMx.Unlock()
+	return nil
+}
+
+// advertisedTransports returns the session transports which are advertised in the server's discovery entry.
+func (s *Server) advertisedTransports() []disc.Transport {
+	s.transportsMx.Lock()
+	defer s.transportsMx.Unlock()
+
+	transports := make([]disc.Transport, 0, len(s.transports)+1)
+	transports = append(transports, disc.Transport{Type: s.transport.Type(), Address: s.AdvertisedAddr()})
+	return append(transports, s.transports...)
+}
+
 // Ready returns a chan which blocks until the server begins serving.
+// Once ready, the entry of the server advertises all transports which are served before the server is (see
+// ServeTransport).
 func (s *Server) Ready() <-chan struct{} {
 	return s.ready
 }
@@ -203,7 +415,7 @@ func (s *Server) Ready() <-chan struct{} {
 func (s *Server) handleSession(conn net.Conn) {
 	log := s.log.WithField("remote_tcp", conn.RemoteAddr())
 
-	dSes, err := makeServerSession(s.m, &s.EntityCommon, conn)
+	dSes, err := makeServerSession(s, conn)
 	if err != nil {
 		if err := conn.Close(); err != nil {
 			log.WithError(err).Warn("On handleSession() failure, close connection resulted in error.")
@@ -212,7 +424,20 @@ func (s *Server) handleSession(conn net.Conn) {
 	}
 
 	log = log.WithField("remote_pk", dSes.RemotePK())
-	log.Info("Started session.")
+
+	if !s.allowSession(dSes.RemotePK()) {
+		s.m.RecordSession(servermetrics.DeltaFailed) // record failed connection
+		log.WithError(ErrSessionDenied).
+			WithField("close_error", dSes.Close()).
+			Warn("Rejected session.")
+		return
+	}
+	if s.shouldRedirect(dSes.RemotePK()) {
+		s.redirectSession(log, dSes)
+		return
+	}
+	dSes.openGate()
+	log.WithField("capabilities", dSes.Capabilities()).Info("Started session.")
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
@@ -221,7 +446,14 @@ func (s *Server) handleSession(conn net.Conn) {
 	}()
 
 	if s.setSession(ctx, dSes.SessionCommon) {
-		dSes.Serve()
+		if err := s.admitSession(dSes); err != nil {
+			log.WithError(err).Warn("Failed to admit session.")
+		} else {
+			s.events.emit(Event{Type: EventSessionEstablished, RemotePK: dSes.RemotePK()})
+			start := time.Now()
+			dSes.Serve()
+			s.events.emit(Event{Type: EventSessionClosed, RemotePK: dSes.RemotePK(), Duration: time.Since(start)})
+		}
 	}
 
 	s.delSession(ctx, dSes.RemotePK())
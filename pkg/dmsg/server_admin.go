@@ -0,0 +1,191 @@
+// Package dmsg pkg/dmsg/server_admin.go
+package dmsg
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+)
+
+// SessionInfo describes a session which is served by a dmsg server.
+type SessionInfo struct {
+	RemotePK      cipher.PubKey `json:"remote_pk"`
+	RemoteTCPAddr string        `json:"remote_tcp_addr"`
+	Uptime        time.Duration `json:"uptime"`
+	Streams       int           `json:"streams"`
+	BytesSent     uint64        `json:"bytes_sent"`
+	BytesReceived uint64        `json:"bytes_received"`
+}
+
+// StreamInfo describes a stream which is forwarded by a dmsg server.
+type StreamInfo struct {
+	ID       uint64        `json:"id"`
+	SrcAddr  Addr          `json:"src_addr"`
+	DstAddr  Addr          `json:"dst_addr"`
+	Duration time.Duration `json:"duration"`
+}
+
+// serverStream is a stream which is being forwarded by the server.
+type serverStream struct {
+	info  StreamInfo // Duration is not set
+	start time.Time
+	close func()
+}
+
+// serverStreams keeps track of the streams which are being forwarded by the server.
+type serverStreams struct {
+	nextID  uint64
+	streams map[uint64]*serverStream
+	mx      sync.Mutex
+}
+
+func (ss *serverStreams) add(src, dst Addr, close func()) (remove func()) {
+	ss.mx.Lock()
+	if ss.streams == nil {
+		ss.streams = make(map[uint64]*serverStream)
+	}
+	ss.nextID++
+	id := ss.nextID
+	ss.streams[id] = &serverStream{
+		info:  StreamInfo{ID: id, SrcAddr: src, DstAddr: dst},
+		start: time.Now(),
+		close: close,
+	}
+	ss.mx.Unlock()
+
+	return func() {
+		ss.mx.Lock()
+		delete(ss.streams, id)
+		ss.mx.Unlock()
+	}
+}
+
+// Streams returns the streams which are being forwarded by the server, ordered by ID.
+func (s *Server) Streams() []StreamInfo {
+	s.fwdStreams.mx.Lock()
+	out := make([]StreamInfo, 0, len(s.fwdStreams.streams))
+	for _, str := range s.fwdStreams.streams {
+		info := str.info
+		info.Duration = time.Since(str.start)
+		out = append(out, info)
+	}
+	s.fwdStreams.mx.Unlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Sessions returns the sessions which are served by the server.
+// The stream count of a session includes the streams of which the remote entity is the source or the destination.
+func (s *Server) Sessions() []SessionInfo {
+	streams := make(map[cipher.PubKey]int)
+	for _, str := range s.Streams() {
+		streams[str.SrcAddr.PK]++
+		if str.DstAddr.PK != str.SrcAddr.PK {
+			streams[str.DstAddr.PK]++
+		}
+	}
+
+	sessions := s.GetSessions()
+	out := make([]SessionInfo, 0, len(sessions))
+	for pk, ses := range sessions {
+		stats := ses.Stats()
+		out = append(out, SessionInfo{
+			RemotePK:      pk,
+			RemoteTCPAddr: ses.RemoteTCPAddr().String(),
+			Uptime:        time.Since(stats.OpenedAt),
+			Streams:       streams[pk],
+			BytesSent:     stats.BytesSent,
+			BytesReceived: stats.BytesReceived,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].RemotePK.Hex() < out[j].RemotePK.Hex() })
+	return out
+}
+
+// CloseSession closes the session with the remote public key 'pk'.
+func (s *Server) CloseSession(pk cipher.PubKey) error {
+	ses, ok := s.GetSessions()[pk]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	s.log.WithField("remote_pk", pk).WithError(ses.Close()).Info("Closed session on request.")
+	return nil
+}
+
+// CloseStream closes the forwarded stream of the given ID.
+func (s *Server) CloseStream(id uint64) error {
+	s.fwdStreams.mx.Lock()
+	str, ok := s.fwdStreams.streams[id]
+	s.fwdStreams.mx.Unlock()
+	if !ok {
+		return ErrStreamNotFound
+	}
+	str.close()
+	s.log.WithField("src_addr", str.info.SrcAddr).WithField("dst_addr", str.info.DstAddr).Info("Closed stream on request.")
+	return nil
+}
+
+// Ban denies sessions with, and streams from or to, the public key 'pk' for the duration 'd'.
+// An established session with 'pk' is closed. Banning a banned public key replaces the expiry of the ban.
+func (s *Server) Ban(pk cipher.PubKey, d time.Duration) {
+	s.bansMx.Lock()
+	s.bans[pk] = time.Now().Add(d)
+	s.bansMx.Unlock()
+
+	if ses, ok := s.GetSessions()[pk]; ok {
+		s.log.WithField("remote_pk", pk).WithError(ses.Close()).Info("Closed session of banned public key.")
+	}
+}
+
+// Unban lifts the ban of the public key 'pk'. It returns false if the public key is not banned.
+func (s *Server) Unban(pk cipher.PubKey) bool {
+	s.bansMx.Lock()
+	defer s.bansMx.Unlock()
+
+	expiry, ok := s.bans[pk]
+	delete(s.bans, pk)
+	return ok && time.Now().Before(expiry)
+}
+
+// Bans returns the banned public keys and when their bans expire.
+func (s *Server) Bans() map[cipher.PubKey]time.Time {
+	s.bansMx.Lock()
+	defer s.bansMx.Unlock()
+
+	now := time.Now()
+	out := make(map[cipher.PubKey]time.Time, len(s.bans))
+	for pk, expiry := range s.bans {
+		if now.After(expiry) {
+			delete(s.bans, pk)
+			continue
+		}
+		out[pk] = expiry
+	}
+	return out
+}
+
+// isBanned returns true if the public key is banned.
+func (s *Server) isBanned(pk cipher.PubKey) bool {
+	s.bansMx.Lock()
+	defer s.bansMx.Unlock()
+
+	expiry, ok := s.bans[pk]
+	if ok && time.Now().After(expiry) {
+		delete(s.bans, pk)
+		return false
+	}
+	return ok
+}
+
+// allowSession returns true if a session with the remote public key 'pk' is allowed by the acl and bans.
+func (s *Server) allowSession(pk cipher.PubKey) bool {
+	return s.acl.AllowSession(pk) && !s.isBanned(pk)
+}
+
+// allowStream returns true if a stream from 'srcPK' to 'dstPK' is allowed by the acl and bans.
+func (s *Server) allowStream(srcPK, dstPK cipher.PubKey) bool {
+	return s.acl.AllowStream(srcPK, dstPK) && !s.isBanned(srcPK) && !s.isBanned(dstPK)
+}
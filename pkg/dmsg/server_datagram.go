@@ -0,0 +1,117 @@
+// Package dmsg pkg/dmsg/server_datagram.go
+package dmsg
+
+import (
+	"errors"
+
+	"github.com/hashicorp/yamux"
+	"github.com/sirupsen/logrus"
+)
+
+// DatagramQueueSize defines the number of datagrams which a dmsg server queues for each client before further
+// datagrams to the client are dropped.
+var DatagramQueueSize = 256
+
+var (
+	errDatagramQueueFull   = errors.New("datagram queue of destination client is full")
+	errDatagramRateLimited = errors.New("datagram rejected as client exceeded bandwidth limit")
+)
+
+// serverDatagramChannel is the datagram channel of a client, from the perspective of the dmsg server.
+// Datagrams to the client are queued, so that a slow client does not hold back datagrams to other clients.
+type serverDatagramChannel struct {
+	*datagramChannel
+	queue chan datagramFrame
+	done  chan struct{}
+}
+
+// enqueue queues the datagram frame to be written to the client.
+// It returns false if the frame is dropped as the queue is full.
+func (ch *serverDatagramChannel) enqueue(f datagramFrame) bool {
+	select {
+	case ch.queue <- f:
+		return true
+	default:
+		return false
+	}
+}
+
+func (ch *serverDatagramChannel) serveQueue(log logrus.FieldLogger) {
+	for {
+		select {
+		case <-ch.done:
+			return
+		case f := <-ch.queue:
+			if err := ch.write(f); err != nil {
+				log.WithError(err).Debug("Failed to write datagram.")
+				return
+			}
+		}
+	}
+}
+
+// serveDatagrams serves the datagram channel which the client opened over 'yStr'.
+// Datagrams from the client are forwarded best-effort to the datagram channels of the destination clients (datagrams
+// are not forwarded to other dmsg servers).
+func (ss *ServerSession) serveDatagrams(log logrus.FieldLogger, yStr *yamux.Stream, dc DatagramChannel) error {
+	if err := dc.Verify(ss.rPK); err != nil {
+		return err
+	}
+	log = log.WithField("datagram_channel", true)
+	log.Info("Serving datagram channel.")
+
+	ch := &serverDatagramChannel{
+		datagramChannel: &datagramChannel{ses: ss.SessionCommon, yStr: yStr},
+		queue:           make(chan datagramFrame, DatagramQueueSize),
+		done:            make(chan struct{}),
+	}
+	ss.srv.dgramChsMx.Lock()
+	ss.srv.dgramChs[ss.rPK] = ch
+	ss.srv.dgramChsMx.Unlock()
+
+	defer func() {
+		ss.srv.dgramChsMx.Lock()
+		if ss.srv.dgramChs[ss.rPK] == ch {
+			delete(ss.srv.dgramChs, ss.rPK)
+		}
+		ss.srv.dgramChsMx.Unlock()
+		close(ch.done)
+		log.WithError(yStr.Close()).Debug("Datagram channel closed.")
+	}()
+	go ch.serveQueue(log)
+
+	for {
+		f, err := ch.read()
+		if err != nil {
+			return err
+		}
+		if err := ss.forwardDatagram(f); err != nil {
+			log.WithError(err).WithField("dst_pk", f.pk).Debug("Dropped datagram.")
+		}
+	}
+}
+
+// forwardDatagram forwards a datagram from the client of the session to the destination client.
+// The payload of the datagram is charged to the bandwidth of the client (see ClientLimits).
+func (ss *ServerSession) forwardDatagram(f datagramFrame) error {
+	if !ss.srv.allowStream(ss.rPK, f.pk) {
+		return ErrReqDenied
+	}
+	if ss.srv.limits != nil && !ss.srv.limits.allowBytes(ss.rPK, len(f.payload)) {
+		return errDatagramRateLimited
+	}
+
+	ss.srv.dgramChsMx.RLock()
+	dstCh, ok := ss.srv.dgramChs[f.pk]
+	ss.srv.dgramChsMx.RUnlock()
+	if !ok {
+		return ErrReqNoNextSession
+	}
+
+	// The frame now carries the public key of the source client.
+	f.pk = ss.rPK
+	if !dstCh.enqueue(f) {
+		return errDatagramQueueFull
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// Package dmsg pkg/dmsg/server_drain.go
+package dmsg
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+)
+
+// drainPollInterval is the interval in which a draining server checks whether all streams have finished.
+const drainPollInterval = time.Second
+
+// Drain gracefully shuts down the server.
+// The server's discovery entry is marked as draining, new sessions are redirected to other servers and connected
+// clients are notified so that they migrate to other servers. The server is closed once all streams have finished,
+// or when the context is done (in which case the context's error is returned).
+func (s *Server) Drain(ctx context.Context) error {
+	if isClosed(s.done) {
+		return ErrEntityClosed
+	}
+	s.drainOnce.Do(func() { close(s.drain) })
+	log := s.log.WithField("func", "Server.Drain")
+
+	if isClosed(s.addrDone) {
+		s.sessionsMx.Lock()
+		err := s.updateEntry(ctx)
+		s.sessionsMx.Unlock()
+		if err != nil {
+			log.WithError(err).Warn("Failed to mark discovery entry as draining.")
+		}
+	}
+
+	s.refreshAlternatives(ctx)
+	alternatives := s.alternativeServers()
+	for pk, ses := range s.GetSessions() {
+		go s.notifyDrain(pk, ServerSession{SessionCommon: ses}, alternatives)
+	}
+	log.WithField("sessions", s.SessionCount()).Info("Draining server...")
+
+	t := time.NewTicker(drainPollInterval)
+	defer t.Stop()
+
+	for atomic.LoadInt64(&s.streams) > 0 {
+		select {
+		case <-ctx.Done():
+			log.WithField("streams", atomic.LoadInt64(&s.streams)).Warn("Closing server before all streams have finished.")
+			_ = s.Close() //nolint:errcheck
+			return ctx.Err()
+		case <-s.done:
+			return nil
+		case <-t.C:
+		}
+	}
+	log.Info("All streams have finished, closing server.")
+	return s.Close()
+}
+
+// Draining returns a chan which is closed once the server starts draining.
+func (s *Server) Draining() <-chan struct{} {
+	return s.drain
+}
+
+func (s *Server) isDraining() bool {
+	return isClosed(s.drain)
+}
+
+// notifyDrain informs the client of the session that the server is draining.
+// The client is expected to establish a session with one of the alternative servers, but may still use this session
+// for its existing streams.
+func (s *Server) notifyDrain(pk cipher.PubKey, ses ServerSession, alternatives []cipher.PubKey) {
+	log := s.log.WithField("remote_pk", pk)
+
+	redirect := SessionRedirect{
+		IssuedAt:     time.Now().UnixNano(),
+		Alternatives: alternatives,
+	}
+	yStr, err := ses.ys.OpenStream()
+	if err != nil {
+		log.WithError(err).Debug("Failed to open stream to notify client of draining.")
+		return
+	}
+	if err := ses.writeObject(yStr, MakeSignedSessionRedirect(&redirect, s.sk)); err != nil {
+		log.WithError(err).Debug("Failed to notify client of draining.")
+	}
+	log.WithError(yStr.Close()).Debug("Notified client of draining.")
+}
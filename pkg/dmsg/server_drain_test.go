@@ -0,0 +1,106 @@
+// Package dmsg pkg/dmsg/server_drain_test.go
+package dmsg
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Ensure that draining dmsg servers let clients migrate before they close.
+// Arrange:
+// - Dmsg servers A and B.
+// - Clients 1 and 2 with sessions to server A, and a stream between them.
+// Act:
+// - Drain server A.
+// Assert:
+// - Server A is marked as draining in discovery, and redirects new sessions to server B.
+// - Clients migrate to server B, and new streams are dialed via server B.
+// - The existing stream is served until it is closed, after which server A closes.
+func TestServer_Drain(t *testing.T) {
+	const port = uint16(80)
+
+	env := newTestEnv(t)
+	srvA := env.newServer("drain server A", nil)
+	srvB := env.newServer("drain server B", nil)
+	client1 := env.connectClient("drain client 1", nil, srvA)
+	client2 := env.connectClient("drain client 2", nil, srvA)
+
+	lis, err := client2.Listen(port)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, lis.Close()) }()
+
+	str1, err := client1.DialStream(context.TODO(), Addr{PK: client2.LocalPK(), Port: port})
+	require.NoError(t, err)
+	str2, err := lis.AcceptStream()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	chDrain := make(chan error, 1)
+	go func() { chDrain <- srvA.Drain(ctx) }()
+	<-srvA.Draining()
+
+	// Clients migrate to server B.
+	for _, c := range []*Client{client1, client2} {
+		require.Eventually(t, func() bool {
+			entry, err := env.dc.Entry(context.TODO(), c.LocalPK())
+			if err != nil {
+				return false
+			}
+			return len(entry.Client.DelegatedServers) == 1 && entry.Client.DelegatedServers[0] == srvB.LocalPK()
+		}, 10*time.Second, 50*time.Millisecond)
+
+		dSes, ok := c.Session(srvA.LocalPK())
+		require.True(t, ok)
+		assert.True(t, dSes.IsDraining())
+	}
+
+	entryA := env.entry(srvA.LocalPK())
+	assert.True(t, entryA.Server.Draining)
+	assert.Equal(t, 0, entryA.Server.AvailableSessions)
+
+	// New sessions are redirected.
+	pk3, sk3 := GenKeyPair(t, "drain client 3")
+	client3 := NewClient(pk3, sk3, env.dc, &Config{Transport: env.tp})
+	t.Cleanup(func() { _ = client3.Close() }) //nolint:errcheck
+	var rErr *RedirectError
+	require.True(t, errors.As(client3.EnsureSession(context.TODO(), entryA), &rErr))
+	assert.Equal(t, []cipher.PubKey{srvB.LocalPK()}, rErr.Alternatives)
+
+	// New streams are dialed via server B.
+	str3, err := client1.DialStream(context.TODO(), Addr{PK: client2.LocalPK(), Port: port})
+	require.NoError(t, err)
+	assert.NoError(t, str3.Close())
+
+	// The existing stream is still served.
+	data := cipher.RandByte(1024)
+	_, err = str1.Write(data)
+	require.NoError(t, err)
+	readData := make([]byte, len(data))
+	_, err = io.ReadFull(str2, readData)
+	require.NoError(t, err)
+	require.Equal(t, data, readData)
+
+	select {
+	case err := <-chDrain:
+		t.Fatalf("server closed before streams have finished: %v", err)
+	default:
+	}
+
+	// Server A closes once the existing stream finishes.
+	require.NoError(t, str1.Close())
+	require.NoError(t, str2.Close())
+	select {
+	case err := <-chDrain:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for server to drain")
+	}
+}
@@ -0,0 +1,222 @@
+// Package dmsg pkg/dmsg/server_limits.go
+package dmsg
+
+import (
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"golang.org/x/time/rate"
+
+	"github.com/skycoin/dmsg/internal/servermetrics"
+)
+
+// ClientLimits configures the limits which a dmsg server enforces on each client.
+// Limits are tracked per public key of the client which initiates streams.
+// A zero value disables the associated limit.
+type ClientLimits struct {
+	// MaxStreams is the maximum number of concurrent streams a client can initiate.
+	MaxStreams int
+
+	// StreamRequestsPerSecond is the rate at which a client can request new streams.
+	// StreamRequestsBurst is the number of requests which can exceed this rate at once (defaults to the rate).
+	StreamRequestsPerSecond float64
+	StreamRequestsBurst     int
+
+	// BytesPerSecond is the rate at which data is forwarded over the streams of a client (in both directions combined),
+	// and of the datagrams which the client sends. Datagrams beyond this rate are dropped.
+	// BytesBurst is the number of bytes which can exceed this rate at once (defaults to the rate).
+	BytesPerSecond int64
+	BytesBurst     int
+}
+
+// Enabled returns true if any of the limits are set.
+func (cl ClientLimits) Enabled() bool {
+	return cl.MaxStreams > 0 || cl.StreamRequestsPerSecond > 0 || cl.BytesPerSecond > 0
+}
+
+func (cl ClientLimits) requestLimiter() *rate.Limiter {
+	if cl.StreamRequestsPerSecond <= 0 {
+		return nil
+	}
+	burst := cl.StreamRequestsBurst
+	if burst <= 0 {
+		burst = int(math.Ceil(cl.StreamRequestsPerSecond))
+	}
+	return rate.NewLimiter(rate.Limit(cl.StreamRequestsPerSecond), burst)
+}
+
+func (cl ClientLimits) bytesLimiter() *rate.Limiter {
+	if cl.BytesPerSecond <= 0 {
+		return nil
+	}
+	burst := cl.BytesBurst
+	if burst <= 0 {
+		burst = int(cl.BytesPerSecond)
+		if int64(burst) != cl.BytesPerSecond {
+			burst = math.MaxInt32
+		}
+	}
+	return rate.NewLimiter(rate.Limit(cl.BytesPerSecond), burst)
+}
+
+// refillTime returns the duration in which the token buckets of the limits refill completely.
+func (cl ClientLimits) refillTime() time.Duration {
+	var d time.Duration
+	if lim := cl.requestLimiter(); lim != nil {
+		d = bucketRefillTime(lim)
+	}
+	if lim := cl.bytesLimiter(); lim != nil {
+		if bd := bucketRefillTime(lim); bd > d {
+			d = bd
+		}
+	}
+	return d
+}
+
+func bucketRefillTime(lim *rate.Limiter) time.Duration {
+	return time.Duration(float64(lim.Burst()) / float64(lim.Limit()) * float64(time.Second))
+}
+
+// minLimiterIdleTTL is the minimum duration for which the limiting state of a client is kept once it is idle.
+// The state is kept for at least the refill time of its token buckets (after which it is the same as new state), so
+// that clients cannot reset their limits by reconnecting.
+const minLimiterIdleTTL = time.Minute
+
+// clientLimiter holds the limiting state of a single client.
+type clientLimiter struct {
+	streams  int
+	lastUsed time.Time     // when a stream is last acquired or released
+	requests *rate.Limiter // nil if unlimited
+	bytes    *rate.Limiter // nil if unlimited
+}
+
+// clientLimiters enforces ClientLimits for all clients of a dmsg server.
+type clientLimiters struct {
+	conf    ClientLimits
+	m       servermetrics.Metrics
+	idleTTL time.Duration // duration for which idle limiters are kept
+	lims    map[cipher.PubKey]*clientLimiter
+	pruned  time.Time // when idle limiters are last removed
+	mx      sync.Mutex
+}
+
+func newClientLimiters(conf ClientLimits, m servermetrics.Metrics) *clientLimiters {
+	idleTTL := conf.refillTime()
+	if idleTTL < minLimiterIdleTTL {
+		idleTTL = minLimiterIdleTTL
+	}
+	return &clientLimiters{
+		conf:    conf,
+		m:       m,
+		idleTTL: idleTTL,
+		lims:    make(map[cipher.PubKey]*clientLimiter),
+		pruned:  time.Now(),
+	}
+}
+
+// prune removes limiters of clients which have no streams, and have not used them for idleTTL.
+// It only scans the limiters once per idleTTL.
+func (cls *clientLimiters) prune(now time.Time) {
+	if now.Sub(cls.pruned) < cls.idleTTL {
+		return
+	}
+	cls.pruned = now
+	for pk, cl := range cls.lims {
+		if cl.streams <= 0 && now.Sub(cl.lastUsed) >= cls.idleTTL {
+			delete(cls.lims, pk)
+		}
+	}
+}
+
+// limiter returns the limiter of the client of public key 'pk', which is created if there is none.
+// cls.mx must be held.
+func (cls *clientLimiters) limiter(pk cipher.PubKey, now time.Time) *clientLimiter {
+	cls.prune(now)
+	cl, ok := cls.lims[pk]
+	if !ok {
+		cl = &clientLimiter{
+			requests: cls.conf.requestLimiter(),
+			bytes:    cls.conf.bytesLimiter(),
+		}
+		cls.lims[pk] = cl
+	}
+	cl.lastUsed = now
+	return cl
+}
+
+// acquire reserves a stream for the client of public key 'pk'.
+// The returned limiter shapes the bandwidth of the stream, and is nil if bandwidth is unlimited.
+// Each successful call to acquire should be followed by a call to release.
+func (cls *clientLimiters) acquire(pk cipher.PubKey) (*rate.Limiter, error) {
+	cls.mx.Lock()
+	defer cls.mx.Unlock()
+
+	cl := cls.limiter(pk, time.Now())
+	if cl.requests != nil && !cl.requests.Allow() {
+		cls.m.RecordLimit(servermetrics.LimitStreamRequests)
+		return nil, ErrReqRateLimited
+	}
+	if cls.conf.MaxStreams > 0 && cl.streams >= cls.conf.MaxStreams {
+		cls.m.RecordLimit(servermetrics.LimitStreams)
+		return nil, ErrReqMaxStreams
+	}
+	cl.streams++
+	return cl.bytes, nil
+}
+
+// release frees a stream reserved with acquire.
+func (cls *clientLimiters) release(pk cipher.PubKey) {
+	cls.mx.Lock()
+	if cl, ok := cls.lims[pk]; ok {
+		cl.streams--
+		cl.lastUsed = time.Now()
+	}
+	cls.mx.Unlock()
+}
+
+// allowBytes charges 'n' bytes of a datagram to the bandwidth of the client of public key 'pk'.
+// It returns false if the datagram is to be dropped, as the token bucket of the client does not hold enough bytes.
+func (cls *clientLimiters) allowBytes(pk cipher.PubKey, n int) bool {
+	cls.mx.Lock()
+	defer cls.mx.Unlock()
+
+	now := time.Now()
+	cl := cls.limiter(pk, now)
+	if cl.bytes != nil && !cl.bytes.AllowN(now, n) {
+		cls.m.RecordLimit(servermetrics.LimitBandwidth)
+		return false
+	}
+	return true
+}
+
+// shapedStream limits the rate at which data is read from the underlying stream with a token bucket.
+type shapedStream struct {
+	io.ReadWriteCloser
+	lim *rate.Limiter
+	m   servermetrics.Metrics
+}
+
+func shapeStream(rwc io.ReadWriteCloser, lim *rate.Limiter, m servermetrics.Metrics) io.ReadWriteCloser {
+	if lim == nil {
+		return rwc
+	}
+	return &shapedStream{ReadWriteCloser: rwc, lim: lim, m: m}
+}
+
+// Read implements io.Reader
+func (s *shapedStream) Read(p []byte) (int, error) {
+	if burst := s.lim.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := s.ReadWriteCloser.Read(p)
+	if n > 0 {
+		if d := s.lim.ReserveN(time.Now(), n).Delay(); d > 0 {
+			s.m.RecordLimit(servermetrics.LimitBandwidth)
+			time.Sleep(d)
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,217 @@
+// Package dmsg pkg/dmsg/server_limits_test.go
+package dmsg
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/dmsg/internal/servermetrics"
+)
+
+// Ensure that dmsg servers enforce per-client limits.
+// Arrange:
+// - Dmsg server with client limits, and clients A and B connected to it.
+// Act:
+// - Client A dials streams to client B beyond the limits.
+// Assert:
+// - Client A is informed of the reason that it is throttled.
+// - The server reports the triggered limits.
+func TestServer_ClientLimits(t *testing.T) {
+	const port = uint16(80)
+
+	t.Run("max_streams", func(t *testing.T) {
+		m, clientA, clientB := prepareLimitedServer(t, ClientLimits{MaxStreams: 2})
+
+		lis, err := clientB.Listen(port)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, lis.Close()) }()
+
+		var strs []*Stream
+		for i := 0; i < 2; i++ {
+			str, err := clientA.DialStream(context.TODO(), Addr{PK: clientB.LocalPK(), Port: port})
+			require.NoError(t, err)
+			strs = append(strs, str)
+		}
+
+		_, err = clientA.DialStream(context.TODO(), Addr{PK: clientB.LocalPK(), Port: port})
+		require.Equal(t, ErrReqMaxStreams, err)
+		require.Equal(t, 1, m.count(servermetrics.LimitStreams))
+
+		// Streams are released once closed.
+		require.NoError(t, strs[0].Close())
+		require.Eventually(t, func() bool {
+			str, err := clientA.DialStream(context.TODO(), Addr{PK: clientB.LocalPK(), Port: port})
+			if err != nil {
+				return false
+			}
+			strs[0] = str
+			return true
+		}, 5*time.Second, 100*time.Millisecond)
+
+		for _, str := range strs {
+			assert.NoError(t, str.Close())
+		}
+	})
+
+	t.Run("stream_requests", func(t *testing.T) {
+		m, clientA, clientB := prepareLimitedServer(t, ClientLimits{StreamRequestsPerSecond: 0.1, StreamRequestsBurst: 2})
+
+		lis, err := clientB.Listen(port)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, lis.Close()) }()
+
+		for i := 0; i < 2; i++ {
+			str, err := clientA.DialStream(context.TODO(), Addr{PK: clientB.LocalPK(), Port: port})
+			require.NoError(t, err)
+			assert.NoError(t, str.Close())
+		}
+
+		_, err = clientA.DialStream(context.TODO(), Addr{PK: clientB.LocalPK(), Port: port})
+		require.Equal(t, ErrReqRateLimited, err)
+		require.Equal(t, 1, m.count(servermetrics.LimitStreamRequests))
+
+		// Other clients are not affected.
+		lis2, err := clientA.Listen(port)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, lis2.Close()) }()
+
+		str, err := clientB.DialStream(context.TODO(), Addr{PK: clientA.LocalPK(), Port: port})
+		require.NoError(t, err)
+		assert.NoError(t, str.Close())
+	})
+
+	t.Run("bandwidth", func(t *testing.T) {
+		const bytesPerSecond = 16 * 1024
+
+		m, clientA, clientB := prepareLimitedServer(t, ClientLimits{BytesPerSecond: bytesPerSecond})
+
+		lis, err := clientB.Listen(port)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, lis.Close()) }()
+
+		strA, err := clientA.DialStream(context.TODO(), Addr{PK: clientB.LocalPK(), Port: port})
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, strA.Close()) }()
+
+		strB, err := lis.AcceptStream()
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, strB.Close()) }()
+
+		// The initial burst is served immediately, the rest is shaped to the configured rate.
+		data := cipher.RandByte(3 * bytesPerSecond)
+		start := time.Now()
+		go func() {
+			_, err := strA.Write(data)
+			assert.NoError(t, err)
+		}()
+
+		readData := make([]byte, len(data))
+		_, err = io.ReadFull(strB, readData)
+		require.NoError(t, err)
+		require.Equal(t, data, readData)
+		require.GreaterOrEqual(t, time.Since(start), 1500*time.Millisecond)
+		require.Positive(t, m.count(servermetrics.LimitBandwidth))
+	})
+}
+
+// Ensure that the limiting state of clients is kept until it is idle for at least the refill time of its buckets.
+// Arrange:
+// - Client limiters with a stream request limit of which the bucket refills in 2 minutes.
+// Act:
+// - A client exhausts its stream requests and releases its streams, then its limiter is idle for some time.
+// Assert:
+// - The client is still limited before the limiter is idle for the refill time.
+// - The limiter is removed once it is idle for the refill time.
+func TestClientLimiters_Idle(t *testing.T) {
+	cls := newClientLimiters(ClientLimits{StreamRequestsPerSecond: 0.05, StreamRequestsBurst: 6}, servermetrics.NewEmpty())
+	require.Equal(t, 2*time.Minute, cls.idleTTL)
+
+	pk, _ := GenKeyPair(t, "idle client")
+	for i := 0; i < 6; i++ {
+		_, err := cls.acquire(pk)
+		require.NoError(t, err)
+		cls.release(pk)
+	}
+
+	idle := func(d time.Duration) {
+		cls.mx.Lock()
+		cls.lims[pk].lastUsed = cls.lims[pk].lastUsed.Add(-d)
+		cls.pruned = cls.pruned.Add(-d)
+		cls.mx.Unlock()
+	}
+
+	idle(time.Minute)
+	_, err := cls.acquire(pk)
+	require.Equal(t, ErrReqRateLimited, err)
+
+	idle(2 * time.Minute)
+	other, _ := GenKeyPair(t, "other client")
+	_, err = cls.acquire(other)
+	require.NoError(t, err)
+	cls.mx.Lock()
+	_, ok := cls.lims[pk]
+	cls.mx.Unlock()
+	assert.False(t, ok)
+}
+
+// Ensure that datagrams are charged to the same bandwidth limit as the streams of the client.
+// Arrange:
+// - Client limiters with a bandwidth limit of which the bucket holds 2KiB.
+// Act:
+// - A client sends datagrams of 1KiB beyond the limit, then acquires a stream.
+// Assert:
+// - Datagrams beyond the limit are dropped, and the server reports the triggered limit.
+// - Other clients are not affected.
+// - The stream of the client is shaped with the drained bucket.
+func TestClientLimiters_Datagrams(t *testing.T) {
+	m := &limitMetrics{limits: make(map[servermetrics.LimitType]int)}
+	cls := newClientLimiters(ClientLimits{BytesPerSecond: 1, BytesBurst: 2048}, m)
+
+	pk, _ := GenKeyPair(t, "datagram client")
+	require.True(t, cls.allowBytes(pk, 1024))
+	require.True(t, cls.allowBytes(pk, 1024))
+	require.False(t, cls.allowBytes(pk, 1024))
+	require.Equal(t, 1, m.count(servermetrics.LimitBandwidth))
+
+	other, _ := GenKeyPair(t, "other datagram client")
+	require.True(t, cls.allowBytes(other, 1024))
+
+	lim, err := cls.acquire(pk)
+	require.NoError(t, err)
+	defer cls.release(pk)
+	assert.False(t, lim.AllowN(time.Now(), 1024))
+}
+
+func prepareLimitedServer(t *testing.T, limits ClientLimits) (*limitMetrics, *Client, *Client) {
+	m := &limitMetrics{limits: make(map[servermetrics.LimitType]int)}
+	env := newTestEnv(t)
+	env.metrics = m
+	env.newServer("limited server", &ServerConfig{MaxSessions: 10, ClientLimits: limits})
+	return m, env.serveClient("limited client A", nil), env.serveClient("limited client B", nil)
+}
+
+// limitMetrics records the limits which are triggered.
+type limitMetrics struct {
+	servermetrics.Empty
+	limits map[servermetrics.LimitType]int
+	mx     sync.Mutex
+}
+
+func (m *limitMetrics) RecordLimit(limit servermetrics.LimitType) {
+	m.mx.Lock()
+	m.limits[limit]++
+	m.mx.Unlock()
+}
+
+func (m *limitMetrics) count(limit servermetrics.LimitType) int {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	return m.limits[limit]
+}
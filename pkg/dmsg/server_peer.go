@@ -0,0 +1,239 @@
+// Package dmsg pkg/dmsg/server_peer.go
+package dmsg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/yamux"
+	"github.com/sirupsen/logrus"
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+)
+
+// forwardRequestToPeers forwards a stream request to one of the delegated servers of the destination client.
+// The delegated servers are attempted in the order advertised in the destination client's discovery entry.
+func (s *Server) forwardRequestToPeers(log logrus.FieldLogger, req StreamRequest) (*yamux.Stream, SignedObject, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout)
+	defer cancel()
+
+	entry, err := getClientEntry(ctx, s.dc, req.DstAddr.PK)
+	if err != nil {
+		return nil, nil, ErrReqNoNextSession.Wrap(err)
+	}
+
+	// If a peer does not support the wire version of the request, it is reported once all peers are attempted.
+	var wireErr error
+	for _, srvPK := range entry.Client.DelegatedServers {
+		if srvPK == s.pk || !s.peerAllowed(srvPK) {
+			continue
+		}
+		log := log.WithField("peer_pk", srvPK)
+
+		pSes, err := s.peerSession(ctx, srvPK)
+		if err != nil {
+			log.WithError(err).Debug("Failed to obtain peer session.")
+			continue
+		}
+		yStr, resp, err := pSes.forwardRequest(req)
+		if err != nil && resp != nil {
+			return nil, resp, err
+		}
+		if err != nil {
+			if errors.Is(err, ErrReqUnsupportedWire) {
+				wireErr = err
+			}
+			log.WithError(err).Debug("Failed to forward stream request to peer.")
+			continue
+		}
+		log.Debug("Obtained peer session.")
+		return yStr, resp, nil
+	}
+
+	if wireErr != nil {
+		return nil, nil, wireErr
+	}
+	return nil, nil, ErrReqNoNextSession
+}
+
+// peerDial is a dial of a peer session which is in progress.
+// Concurrent callers of peerSession for the same peer wait for the same dial.
+type peerDial struct {
+	done chan struct{}
+	ses  ServerSession
+	err  error
+}
+
+// peerSession obtains a session with the dmsg server of public key 'srvPK'.
+// If the remote server has already dialed us, that session is reused. Otherwise, a new session is dialed.
+func (s *Server) peerSession(ctx context.Context, srvPK cipher.PubKey) (ServerSession, error) {
+	if ses, ok := s.session(srvPK); ok {
+		return ServerSession{SessionCommon: ses, m: s.m, srv: s}, nil
+	}
+
+	s.peersMx.Lock()
+	if isClosed(s.done) {
+		s.peersMx.Unlock()
+		return ServerSession{}, ErrEntityClosed
+	}
+	if pSes, ok := s.peers[srvPK]; ok {
+		s.peersMx.Unlock()
+		return pSes, nil
+	}
+	if d, ok := s.peerDials[srvPK]; ok {
+		s.peersMx.Unlock()
+		select {
+		case <-d.done:
+			return d.ses, d.err
+		case <-ctx.Done():
+			return ServerSession{}, ctx.Err()
+		}
+	}
+	d := &peerDial{done: make(chan struct{})}
+	s.peerDials[srvPK] = d
+	s.peersMx.Unlock()
+
+	d.ses, d.err = s.dialPeer(ctx, srvPK)
+
+	s.peersMx.Lock()
+	delete(s.peerDials, srvPK)
+	if d.err == nil {
+		if isClosed(s.done) {
+			d.ses, d.err = ServerSession{}, ErrEntityClosed
+		} else {
+			s.peers[srvPK] = d.ses
+		}
+	}
+	s.peersMx.Unlock()
+	close(d.done)
+
+	if d.err != nil {
+		if d.ses.SessionCommon != nil {
+			s.log.WithError(d.ses.Close()).Debug("Server closed, peer session closed.")
+		}
+		return ServerSession{}, d.err
+	}
+
+	log := s.log.WithField("peer_pk", srvPK)
+	log.Info("Started peer session.")
+
+	pSes := d.ses
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		pSes.Serve()
+
+		s.peersMx.Lock()
+		delete(s.peers, srvPK)
+		s.peersMx.Unlock()
+
+		log.WithError(pSes.Close()).Info("Stopped peer session.")
+	}()
+
+	return pSes, nil
+}
+
+// dialPeer dials a session with the dmsg server of public key 'srvPK'.
+func (s *Server) dialPeer(ctx context.Context, srvPK cipher.PubKey) (ServerSession, error) {
+	entry, err := getServerEntry(ctx, s.dc, srvPK)
+	if err != nil {
+		return ServerSession{}, err
+	}
+
+	addr, ok := entry.Server.TransportAddr(s.transport.Type())
+	if !ok {
+		return ServerSession{}, fmt.Errorf("peer does not support session transport '%s'", s.transport.Type())
+	}
+	conn, err := s.transport.Dial(ctx, addr)
+	if err != nil {
+		return ServerSession{}, err
+	}
+
+	pSes, err := makePeerSession(s, conn, srvPK)
+	if err != nil {
+		s.log.WithError(conn.Close()).Debug("On makePeerSession() failure, connection closed.")
+		return ServerSession{}, err
+	}
+	if pSes.Capabilities().Has(FeatureAdmission) {
+		if err := pSes.awaitAdmission(); err != nil {
+			s.log.WithError(pSes.Close()).Debug("On awaitAdmission() failure, peer session closed.")
+			return ServerSession{}, err
+		}
+	}
+	return pSes, nil
+}
+
+const (
+	// peerCacheTTL is the duration for which the result of looking up whether a public key belongs to a dmsg server
+	// is cached.
+	peerCacheTTL = time.Minute
+
+	// peerCacheSize is the number of lookups which are cached before expired lookups are removed.
+	peerCacheSize = 1024
+)
+
+// peerAllowed returns true if streams may be forwarded to (and accepted from) the dmsg server of the given public
+// key. If peers are not configured, any dmsg server is allowed.
+func (s *Server) peerAllowed(pk cipher.PubKey) bool {
+	if len(s.peerPKs) == 0 {
+		return true
+	}
+	_, ok := s.peerPKs[pk]
+	return ok
+}
+
+// isPeer returns true if the given public key belongs to a configured peer. If peers are not configured, it returns
+// true if the public key belongs to a dmsg server which is registered in discovery. Results of looking up discovery
+// are cached for peerCacheTTL, so that stream requests do not query discovery every time.
+func (s *Server) isPeer(pk cipher.PubKey) bool {
+	if len(s.peerPKs) > 0 {
+		return s.peerAllowed(pk)
+	}
+
+	now := time.Now()
+	s.peerCacheMx.Lock()
+	c, ok := s.peerCache[pk]
+	s.peerCacheMx.Unlock()
+	if ok && now.Before(c.expiry) {
+		return c.ok
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout)
+	defer cancel()
+	_, err := getServerEntry(ctx, s.dc, pk)
+
+	s.peerCacheMx.Lock()
+	defer s.peerCacheMx.Unlock()
+	if len(s.peerCache) >= peerCacheSize {
+		for cPK, c := range s.peerCache {
+			if now.After(c.expiry) {
+				delete(s.peerCache, cPK)
+			}
+		}
+		if len(s.peerCache) >= peerCacheSize {
+			s.peerCache = make(map[cipher.PubKey]peerLookup)
+		}
+	}
+	s.peerCache[pk] = peerLookup{ok: err == nil, expiry: now.Add(peerCacheTTL)}
+	return err == nil
+}
+
+// peerLookup is the cached result of looking up whether a public key belongs to a dmsg server.
+type peerLookup struct {
+	ok     bool
+	expiry time.Time
+}
+
+// closePeers closes all sessions dialed to other dmsg servers.
+func (s *Server) closePeers() {
+	s.peersMx.Lock()
+	defer s.peersMx.Unlock()
+
+	for pk, pSes := range s.peers {
+		s.log.
+			WithField("peer_pk", pk).
+			WithError(pSes.Close()).
+			Debug("Peer session closed.")
+	}
+}
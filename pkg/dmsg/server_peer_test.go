@@ -0,0 +1,109 @@
+// Package dmsg pkg/dmsg/server_peer_test.go
+package dmsg
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/dmsg/pkg/disc"
+)
+
+// countingDisc counts the entries which are looked up in discovery.
+type countingDisc struct {
+	disc.APIClient
+	lookups int64
+}
+
+func (d *countingDisc) Entry(ctx context.Context, pk cipher.PubKey) (*disc.Entry, error) {
+	atomic.AddInt64(&d.lookups, 1)
+	return d.APIClient.Entry(ctx, pk)
+}
+
+// countingTransport counts the connections which are dialed.
+type countingTransport struct {
+	SessionTransport
+	dials int64
+}
+
+func (tp *countingTransport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	atomic.AddInt64(&tp.dials, 1)
+	return tp.SessionTransport.Dial(ctx, addr)
+}
+
+// Ensure that servers cache whether public keys belong to peers, and only accept configured peers if any.
+// Arrange:
+// - Dmsg servers A and B, and server C which is configured with server A as its only peer.
+// Act:
+// - Servers look up whether servers and clients are peers several times.
+// Assert:
+// - Discovery is only looked up once per public key.
+// - Server C only accepts server A, without looking up discovery.
+func TestServer_isPeer(t *testing.T) {
+	env := newTestEnv(t)
+	dc := &countingDisc{APIClient: env.dc}
+	env.dc = dc
+
+	newServer := func(seed string, peers []cipher.PubKey) *Server {
+		return env.newServer(seed, &ServerConfig{MaxSessions: 10, ForwardStreams: true, Peers: peers})
+	}
+	srvA := newServer("peer server A", nil)
+	srvB := newServer("peer server B", nil)
+	srvC := newServer("peer server C", []cipher.PubKey{srvA.LocalPK()})
+	clientPK, _ := GenKeyPair(t, "peer client")
+
+	before := atomic.LoadInt64(&dc.lookups)
+	for i := 0; i < 3; i++ {
+		assert.True(t, srvA.isPeer(srvB.LocalPK()))
+		assert.False(t, srvA.isPeer(clientPK))
+	}
+	assert.Equal(t, before+2, atomic.LoadInt64(&dc.lookups))
+
+	before = atomic.LoadInt64(&dc.lookups)
+	assert.True(t, srvC.isPeer(srvA.LocalPK()))
+	assert.False(t, srvC.isPeer(srvB.LocalPK()))
+	assert.False(t, srvC.isPeer(clientPK))
+	assert.Equal(t, before, atomic.LoadInt64(&dc.lookups))
+}
+
+// Ensure that concurrent requests for a peer session share a single dial.
+// Arrange:
+// - Dmsg servers A and B, of which server A dials with a transport which counts dials.
+// Act:
+// - Server A concurrently obtains peer sessions with server B.
+// Assert:
+// - All obtain the same session, which is dialed once.
+func TestServer_peerSession(t *testing.T) {
+	env := newTestEnv(t)
+	tp := &countingTransport{SessionTransport: env.tp}
+	env.tp = tp
+
+	srvA := env.newServer("peer session server A", &ServerConfig{MaxSessions: 10, ForwardStreams: true})
+	srvB := env.newServer("peer session server B", &ServerConfig{MaxSessions: 10, ForwardStreams: true})
+
+	const n = 10
+	sessions := make([]ServerSession, n)
+	wg := new(sync.WaitGroup)
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			pSes, err := srvA.peerSession(context.Background(), srvB.LocalPK())
+			assert.NoError(t, err)
+			sessions[i] = pSes
+		}(i)
+	}
+	wg.Wait()
+
+	require.NotNil(t, sessions[0].SessionCommon)
+	for _, pSes := range sessions {
+		assert.Equal(t, sessions[0].SessionCommon, pSes.SessionCommon)
+	}
+	assert.Equal(t, int64(1), atomic.LoadInt64(&tp.dials))
+}
@@ -0,0 +1,156 @@
+// Package dmsg pkg/dmsg/server_redirect.go
+package dmsg
+
+import (
+	"context"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+
+	"github.com/skycoin/dmsg/internal/servermetrics"
+)
+
+const (
+	// maxRedirectAlternatives is the maximum number of alternative dmsg servers which a session redirect contains.
+	maxRedirectAlternatives = 5
+
+	// alternativesInterval is the interval in which the alternative dmsg servers are obtained from discovery.
+	alternativesInterval = 30 * time.Second
+)
+
+// shouldRedirect returns true if the session of remote public key 'rPK' should be redirected as the server is full or
+// draining. Unless the server is draining, clients which delegate the server (and other dmsg servers) are always
+// accepted so that they remain reachable. Entries are looked up through a cache, so that clients which reconnect do not
+// query discovery every time.
+func (s *Server) shouldRedirect(rPK cipher.PubKey) bool {
+	if s.isDraining() {
+		return true
+	}
+	if s.SessionCount() < s.maxSessions {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout)
+	defer cancel()
+
+	entry, err := s.entries.Entry(ctx, rPK)
+	if err != nil {
+		return true
+	}
+	if entry.Server != nil {
+		return false
+	}
+	if entry.Client != nil {
+		for _, pk := range entry.Client.DelegatedServers {
+			if pk == s.pk {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// alternativeServers returns the public keys of the least loaded dmsg servers in discovery (other than ourselves), as
+// last obtained by refreshAlternatives.
+func (s *Server) alternativeServers() []cipher.PubKey {
+	s.altsMx.Lock()
+	defer s.altsMx.Unlock()
+	return append([]cipher.PubKey(nil), s.alts...)
+}
+
+// refreshAlternativesLoop refreshes the alternative dmsg servers every alternativesInterval until the context is done.
+// Sessions are redirected to the servers obtained last, so that redirecting does not wait for discovery.
+func (s *Server) refreshAlternativesLoop(ctx context.Context) {
+	t := time.NewTicker(alternativesInterval)
+	defer t.Stop()
+
+	for {
+		s.refreshAlternatives(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// refreshAlternatives obtains the least loaded dmsg servers from discovery.
+// Servers which are draining are excluded. The previous servers are kept if discovery cannot be reached.
+func (s *Server) refreshAlternatives(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, HandshakeTimeout)
+	defer cancel()
+
+	entries, err := s.dc.AvailableServers(ctx)
+	if err != nil {
+		s.log.WithError(err).Warn("Failed to obtain alternative servers from discovery.")
+		return
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Server.AvailableSessions > entries[j].Server.AvailableSessions
+	})
+
+	pks := make([]cipher.PubKey, 0, maxRedirectAlternatives)
+	for _, entry := range entries {
+		if len(pks) == maxRedirectAlternatives {
+			break
+		}
+		if entry.Static == s.pk || entry.Server.AvailableSessions <= 0 || entry.Server.Draining {
+			continue
+		}
+		pks = append(pks, entry.Static)
+	}
+
+	s.altsMx.Lock()
+	s.alts = pks
+	s.altsMx.Unlock()
+}
+
+// admitSession informs the client of a registered session that the session is admitted (see SessionAdmission).
+// Nothing is sent to clients which do not support FeatureAdmission.
+func (s *Server) admitSession(dSes ServerSession) error {
+	if !dSes.Capabilities().Has(FeatureAdmission) {
+		return nil
+	}
+	yStr, err := dSes.ys.OpenStream()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = yStr.Close() }() //nolint:errcheck
+
+	admission := SessionAdmission{AdmittedAt: time.Now().UnixNano()}
+	return dSes.writeObject(yStr, MakeSignedSessionAdmission(&admission, s.sk))
+}
+
+// redirectSession redirects the session to alternative dmsg servers and closes it.
+func (s *Server) redirectSession(log logrus.FieldLogger, dSes ServerSession) {
+	s.m.RecordSession(servermetrics.DeltaFailed) // record failed connection
+	defer func() { log.WithError(dSes.Close()).Info("Closed redirected session.") }()
+
+	redirect := SessionRedirect{
+		IssuedAt:     time.Now().UnixNano(),
+		Alternatives: s.alternativeServers(),
+	}
+	log = log.WithField("alternatives", len(redirect.Alternatives))
+
+	yStr, err := dSes.ys.OpenStream()
+	if err != nil {
+		log.WithError(err).Warn("Failed to open stream to redirect session.")
+		return
+	}
+	if err := dSes.writeObject(yStr, MakeSignedSessionRedirect(&redirect, s.sk)); err != nil {
+		log.WithError(err).Warn("Failed to redirect session.")
+		return
+	}
+
+	// Only now may the session respond to the client, so the client always sees the redirect before the response of
+	// its first ping. We give the client a chance to read the redirect before the session is closed (the client
+	// closes the stream once it does).
+	dSes.openGate()
+	if err := yStr.SetReadDeadline(time.Now().Add(HandshakeTimeout)); err == nil {
+		_, _ = io.Copy(io.Discard, yStr) //nolint:errcheck
+	}
+	log.Info("Redirected session as server is full or draining.")
+}
@@ -0,0 +1,73 @@
+// Package dmsg pkg/dmsg/server_redirect_test.go
+package dmsg
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/dmsg/pkg/disc"
+)
+
+// Ensure that full dmsg servers redirect new sessions to alternative servers.
+// Arrange:
+// - Dmsg server A which only accepts a single session, and dmsg server B.
+// - Client 1 which fills server A.
+// Act:
+// - Further clients establish sessions with server A.
+// Assert:
+// - Client 1 is admitted explicitly.
+// - New clients are redirected to server B, and follow the redirect when serving.
+// - Clients which delegate server A can still establish sessions with it.
+func TestServer_MaxSessions(t *testing.T) {
+	env := newTestEnv(t)
+	srvA := env.newServer("server A", &ServerConfig{MaxSessions: 1})
+	srvB := env.newServer("server B", nil)
+	pkA, pkB := srvA.LocalPK(), srvB.LocalPK()
+
+	// Server A obtains alternative servers once it is serving, which is before server B is.
+	srvA.refreshAlternatives(context.TODO())
+
+	entryA := env.entry(pkA)
+
+	client1 := env.connectClient("client 1", nil, srvA)
+	ses, ok := client1.Session(pkA)
+	require.True(t, ok)
+	assert.True(t, ses.Capabilities().Has(FeatureAdmission))
+
+	t.Run("redirect", func(t *testing.T) {
+		// The redirected client has no discovery entry to delete once closed.
+		pk, sk := GenKeyPair(t, "client 2")
+		c := NewClient(pk, sk, env.dc, &Config{Transport: env.tp})
+		t.Cleanup(func() { _ = c.Close() }) //nolint:errcheck
+		err := c.EnsureSession(context.TODO(), entryA)
+		require.True(t, errors.Is(err, ErrSessionRedirected))
+
+		var rErr *RedirectError
+		require.True(t, errors.As(err, &rErr))
+		assert.Equal(t, pkA, rErr.Server)
+		assert.Equal(t, []cipher.PubKey{pkB}, rErr.Alternatives)
+		_, ok := c.Session(pkA)
+		assert.False(t, ok)
+	})
+
+	t.Run("follow_redirect", func(t *testing.T) {
+		c := env.serveClient("client 3", nil)
+		_, ok := c.Session(pkB)
+		assert.True(t, ok)
+		_, ok = c.Session(pkA)
+		assert.False(t, ok)
+	})
+
+	t.Run("delegated", func(t *testing.T) {
+		pk, sk := GenKeyPair(t, "client 4")
+		entry := disc.NewClientEntry(pk, 0, []cipher.PubKey{pkA})
+		require.NoError(t, entry.Sign(sk))
+		require.NoError(t, env.dc.PostEntry(context.TODO(), entry))
+		env.connectClient("client 4", &Config{}, srvA)
+	})
+}
@@ -2,12 +2,18 @@
 package dmsg
 
 import (
+	"errors"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/hashicorp/yamux"
 	"github.com/sirupsen/logrus"
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
 	"github.com/skycoin/skywire-utilities/pkg/netutil"
+	"golang.org/x/time/rate"
 
 	"github.com/skycoin/dmsg/internal/servermetrics"
 	"github.com/skycoin/dmsg/pkg/noise"
@@ -16,29 +22,59 @@ import (
 // ServerSession represents a session from the perspective of a dmsg server.
 type ServerSession struct {
 	*SessionCommon
-	m servermetrics.Metrics
+	m   servermetrics.Metrics
+	srv *Server // back reference
+
+	// The session does not process anything from the client until gate is opened (see openGate).
+	// This allows a full server to redirect the session before the client sees any response from us.
+	gate     chan struct{}
+	gateOnce *sync.Once
 }
 
-func makeServerSession(m servermetrics.Metrics, entity *EntityCommon, conn net.Conn) (ServerSession, error) {
+func makeServerSession(srv *Server, conn net.Conn) (ServerSession, error) {
 	var sSes ServerSession
 	sSes.SessionCommon = new(SessionCommon)
 	sSes.nMap = make(noise.NonceMap)
-	if err := sSes.SessionCommon.initServer(entity, conn); err != nil {
-		m.RecordSession(servermetrics.DeltaFailed) // record failed connection
+	sSes.gate = make(chan struct{})
+	sSes.gateOnce = new(sync.Once)
+	if err := sSes.SessionCommon.initServer(&srv.EntityCommon, conn, sSes.gate); err != nil {
+		srv.m.RecordSession(servermetrics.DeltaFailed) // record failed connection
 		return sSes, err
 	}
-	sSes.m = m
+	sSes.m = srv.m
+	sSes.srv = srv
 	return sSes, nil
 }
 
+// makePeerSession makes a session to another dmsg server of public key 'rPK'.
+// The local server is the initiator of the session.
+func makePeerSession(srv *Server, conn net.Conn, rPK cipher.PubKey) (ServerSession, error) {
+	var pSes ServerSession
+	pSes.SessionCommon = new(SessionCommon)
+	if err := pSes.SessionCommon.initClient(&srv.EntityCommon, conn, rPK); err != nil {
+		return pSes, err
+	}
+	pSes.m = srv.m
+	pSes.srv = srv
+	return pSes, nil
+}
+
 // Close implements io.Closer
 func (ss *ServerSession) Close() error {
 	if ss == nil {
 		return nil
 	}
+	ss.openGate()
 	return ss.SessionCommon.Close()
 }
 
+// openGate lets the session process data from the client.
+func (ss *ServerSession) openGate() {
+	if ss.gateOnce != nil {
+		ss.gateOnce.Do(func() { close(ss.gate) })
+	}
+}
+
 // Serve serves the session.
 func (ss *ServerSession) Serve() {
 	ss.m.RecordSession(servermetrics.DeltaConnect)          // record successful connection
@@ -66,28 +102,49 @@ func (ss *ServerSession) Serve() {
 	}
 }
 
-func (ss *ServerSession) serveStream(log logrus.FieldLogger, yStr *yamux.Stream) error {
-	readRequest := func() (StreamRequest, error) {
-		obj, err := ss.readObject(yStr)
+func (ss *ServerSession) serveStream(log logrus.FieldLogger, yStr *yamux.Stream) (err error) {
+	// Close the stream on failure so that the initiating side does not need to wait for the handshake to time out.
+	defer func() {
 		if err != nil {
-			return StreamRequest{}, err
+			log.WithError(yStr.Close()).Debug("After serveStream failed, the yamux stream is closed.")
 		}
-		req, err := obj.ObtainStreamRequest()
+	}()
+
+	obj, err := ss.readObject(yStr)
+	if err != nil {
+		ss.m.RecordStream(servermetrics.DeltaFailed) // record failed stream
+		return err
+	}
+
+	// Clients may open a datagram channel instead of requesting a stream.
+	if ch, err := obj.ObtainDatagramChannel(); err == nil {
+		return ss.serveDatagrams(log, yStr, ch)
+	}
+
+	// Streams are counted from the moment they are requested, so that a draining server waits for them.
+	atomic.AddInt64(&ss.srv.streams, 1)
+	defer atomic.AddInt64(&ss.srv.streams, -1)
+
+	// fromPeer is true when the request is forwarded to us by another dmsg server.
+	readRequest := func() (req StreamRequest, fromPeer bool, err error) {
+		req, err = obj.ObtainStreamRequest()
 		if err != nil {
-			return StreamRequest{}, err
+			return StreamRequest{}, false, err
 		}
-		// TODO(evanlinjin): Implement timestamp tracker.
 		if err := req.Verify(0); err != nil {
-			return StreamRequest{}, err
+			return StreamRequest{}, false, err
 		}
 		if req.SrcAddr.PK != ss.rPK {
-			return StreamRequest{}, ErrReqInvalidSrcPK
+			if !ss.srv.forwardStreams || !ss.srv.isPeer(ss.rPK) {
+				return StreamRequest{}, false, ErrReqInvalidSrcPK
+			}
+			fromPeer = true
 		}
-		return req, nil
+		return req, fromPeer, nil
 	}
 
 	// Read request.
-	req, err := readRequest()
+	req, fromPeer, err := readRequest()
 	if err != nil {
 		ss.m.RecordStream(servermetrics.DeltaFailed) // record failed stream
 		return err
@@ -95,22 +152,68 @@ func (ss *ServerSession) serveStream(log logrus.FieldLogger, yStr *yamux.Stream)
 
 	log = log.
 		WithField("src_addr", req.SrcAddr).
-		WithField("dst_addr", req.DstAddr)
+		WithField("dst_addr", req.DstAddr).
+		WithField("from_peer", fromPeer)
 
 	log.Debug("Read stream request from initiating side.")
 
-	// Obtain next session.
-	ss2, ok := ss.entity.serverSession(req.DstAddr.PK)
-	if !ok {
+	// Stale and replayed requests are rejected (the request is verified, so the timestamp is authentic).
+	if err := ss.entity.reqs.check(req.SrcAddr.PK, req.Timestamp, time.Now()); err != nil {
+		ss.m.RecordStream(servermetrics.DeltaFailed) // record failed stream
+		log.WithError(err).Warn("Rejecting stale or replayed stream request.")
+		return ss.rejectRequest(yStr, req, err)
+	}
+
+	if ss.srv.isDraining() {
+		ss.m.RecordStream(servermetrics.DeltaFailed) // record failed stream
+		log.WithError(ErrReqServerDraining).Debug("Rejecting stream request.")
+		return ss.rejectRequest(yStr, req, ErrReqServerDraining)
+	}
+	if !ss.srv.allowStream(req.SrcAddr.PK, req.DstAddr.PK) {
 		ss.m.RecordStream(servermetrics.DeltaFailed) // record failed stream
-		return ErrReqNoNextSession
+		log.WithError(ErrReqDenied).Warn("Rejecting stream request.")
+		return ss.rejectRequest(yStr, req, ErrReqDenied)
+	}
+
+	// Enforce limits of the initiating client.
+	// Forwarded requests are already limited by the server which the initiating client is connected to.
+	var bwLim *rate.Limiter
+	if ss.srv.limits != nil && !fromPeer {
+		if bwLim, err = ss.srv.limits.acquire(req.SrcAddr.PK); err != nil {
+			ss.m.RecordStream(servermetrics.DeltaFailed) // record failed stream
+			log.WithError(err).Warn("Client limit reached, rejecting stream request.")
+			return ss.rejectRequest(yStr, req, err)
+		}
+		defer ss.srv.limits.release(req.SrcAddr.PK)
 	}
-	log.Debug("Obtained next session.")
 
 	// Forward request and obtain/check response.
-	yStr2, resp, err := ss2.forwardRequest(req)
+	// If the destination client is not connected to us, the request is forwarded to one of its delegated servers.
+	// Requests which are already forwarded by another server are never forwarded again.
+	var (
+		yStr2 *yamux.Stream
+		resp  SignedObject
+	)
+	if ss2, ok := ss.entity.serverSession(req.DstAddr.PK); ok {
+		log.Debug("Obtained next session.")
+		yStr2, resp, err = ss2.forwardRequest(req)
+	} else if fromPeer || !ss.srv.forwardStreams {
+		err = ErrReqNoNextSession
+	} else {
+		yStr2, resp, err = ss.srv.forwardRequestToPeers(log, req)
+	}
 	if err != nil {
 		ss.m.RecordStream(servermetrics.DeltaFailed) // record failed stream
+		if resp == nil && isRoutingErr(err) {
+			log.WithError(err).Debug("Rejecting stream request.")
+			return ss.rejectRequest(yStr, req, err)
+		}
+		if resp != nil {
+			log.WithError(err).Debug("Stream request rejected by destination, forwarding rejection.")
+			if wErr := ss.writeObject(yStr, resp); wErr != nil {
+				log.WithError(wErr).Debug("Failed to forward rejection of stream request.")
+			}
+		}
 		return err
 	}
 	log.Debug("Forwarded stream request.")
@@ -126,9 +229,39 @@ func (ss *ServerSession) serveStream(log logrus.FieldLogger, yStr *yamux.Stream)
 	log.Info("Serving stream.")
 	ss.m.RecordStream(servermetrics.DeltaConnect)          // record successful stream
 	defer ss.m.RecordStream(servermetrics.DeltaDisconnect) // record disconnection
-	return netutil.CopyReadWriteCloser(yStr, yStr2)
+
+	ss.srv.events.emit(Event{Type: EventStreamAccepted, RemotePK: ss.rPK, SrcAddr: req.SrcAddr, DstAddr: req.DstAddr})
+	defer ss.srv.fwdStreams.add(req.SrcAddr, req.DstAddr, func() {
+		_ = yStr.Close()  //nolint:errcheck
+		_ = yStr2.Close() //nolint:errcheck
+	})()
+	start := time.Now()
+	err = netutil.CopyReadWriteCloser(shapeStream(yStr, bwLim, ss.m), shapeStream(yStr2, bwLim, ss.m))
+	ss.srv.events.emit(Event{Type: EventStreamClosed, RemotePK: ss.rPK, SrcAddr: req.SrcAddr, DstAddr: req.DstAddr, Duration: time.Since(start), Err: err})
+	return err
 }
 
+// rejectRequest responds to the initiating side with a rejection of 'req' which is signed by the server.
+// The rejection is of the wire version of the request.
+// The returned error is always 'reason'.
+func (ss *ServerSession) rejectRequest(yStr *yamux.Stream, req StreamRequest, reason error) error {
+	resp := StreamResponse{
+		ReqHash:  req.raw.Hash(),
+		Accepted: false,
+		ErrCode:  ErrDialRespNotAccepted.code,
+	}
+	if dErr, ok := reason.(Error); ok {
+		resp.ErrCode = dErr.code
+	}
+	if err := ss.writeObject(yStr, makeSignedStreamResponse(&resp, ss.localSK(), req.wire)); err != nil {
+		ss.log.WithError(err).Debug("Failed to write rejection of stream request.")
+	}
+	return reason
+}
+
+// forwardRequest forwards the request to the remote entity of the session and returns the response.
+// If the destination client rejects the request, the signed rejection is returned alongside the error.
+// Requests of a wire version which the session does not support are not forwarded (ErrReqUnsupportedWire).
 func (ss *ServerSession) forwardRequest(req StreamRequest) (yStr *yamux.Stream, respObj SignedObject, err error) {
 	defer func() {
 		if err != nil && yStr != nil {
@@ -138,6 +271,10 @@ func (ss *ServerSession) forwardRequest(req StreamRequest) (yStr *yamux.Stream,
 		}
 	}()
 
+	if req.wire > ss.caps.WireVersion {
+		return nil, nil, ErrReqUnsupportedWire
+	}
+
 	if yStr, err = ss.ys.OpenStream(); err != nil {
 		return nil, nil, err
 	}
@@ -152,7 +289,16 @@ func (ss *ServerSession) forwardRequest(req StreamRequest) (yStr *yamux.Stream,
 		return nil, nil, err
 	}
 	if err = resp.Verify(req); err != nil {
-		return nil, nil, err
+		// Rejections which are signed by the destination client are returned, so that they can be forwarded to the
+		// initiating side.
+		if ok, _ := resp.VerifyServerRejection(req, req.DstAddr.PK); ok {
+			return yStr, respObj, err
+		}
+		// Peer servers reject requests which the session with the destination client does not support.
+		if ok, rErr := resp.VerifyServerRejection(req, ss.rPK); ok && errors.Is(rErr, ErrReqUnsupportedWire) {
+			return yStr, nil, rErr
+		}
+		return yStr, nil, err
 	}
 	return yStr, respObj, nil
 }
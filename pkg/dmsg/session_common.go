@@ -2,10 +2,13 @@
 package dmsg
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/yamux"
@@ -18,6 +21,10 @@ import (
 // SessionCommon contains the common fields and methods used by a session, whether it be it from the client or server
 // perspective.
 type SessionCommon struct {
+	// atomic requires 64-bit alignment for struct field access
+	framesSent     uint64
+	framesReceived uint64
+
 	entity *EntityCommon // back reference
 	rPK    cipher.PubKey // remote pk
 
@@ -28,6 +35,14 @@ type SessionCommon struct {
 	rMx     sync.Mutex
 	wMx     sync.Mutex
 
+	caps Capabilities // negotiated within the handshake
+
+	draining int32 // set to 1 once the remote server informs us that it is draining (accessed atomically)
+
+	stats     *statsConn // counts the bytes of netConn
+	openedAt  time.Time
+	hsLatency time.Duration
+
 	log logrus.FieldLogger
 }
 
@@ -36,6 +51,24 @@ func (sc *SessionCommon) GetConn() net.Conn {
 	return sc.netConn
 }
 
+// Stats returns the traffic statistics of the session.
+func (sc *SessionCommon) Stats() Stats {
+	return Stats{
+		BytesSent:        atomic.LoadUint64(&sc.stats.bytesSent),
+		BytesReceived:    atomic.LoadUint64(&sc.stats.bytesReceived),
+		FramesSent:       atomic.LoadUint64(&sc.framesSent),
+		FramesReceived:   atomic.LoadUint64(&sc.framesReceived),
+		OpenedAt:         sc.openedAt,
+		LastActivity:     lastActivityOr(atomic.LoadInt64(&sc.stats.lastActivity), sc.openedAt),
+		HandshakeLatency: sc.hsLatency,
+	}
+}
+
+// Capabilities returns the capabilities which are negotiated with the remote within the session handshake.
+func (sc *SessionCommon) Capabilities() Capabilities {
+	return sc.caps
+}
+
 // GetDecNonce returns value of DecNonce of underlying `*noise.Noise`.
 func (sc *SessionCommon) GetDecNonce() uint64 {
 	sc.rMx.Lock()
@@ -56,20 +89,23 @@ func (sc *SessionCommon) initClient(entity *EntityCommon, conn net.Conn, rPK cip
 		LocalSK:   entity.sk,
 		RemotePK:  rPK,
 		Initiator: true,
+		Rekey:     entity.rekey,
 	})
 	if err != nil {
 		return err
 	}
+	ns.SetHandshakePayload(makeHandshakePayload())
 
-	rw := noise.NewReadWriter(conn, ns)
+	sConn := &statsConn{Conn: conn}
+	rw := noise.NewReadWriter(sConn, ns)
+	start := time.Now()
 	if err := rw.Handshake(time.Second * 5); err != nil {
 		return err
 	}
-	if rw.Buffered() > 0 {
-		return ErrSessionHandshakeExtraBytes
-	}
+	hsLatency := time.Since(start)
+	caps := negotiateCaps(ns)
 
-	ySes, err := yamux.Client(conn, yamux.DefaultConfig())
+	ySes, err := yamux.Client(drainedConn(sConn, rw), yamux.DefaultConfig())
 	if err != nil {
 		return err
 	}
@@ -80,29 +116,42 @@ func (sc *SessionCommon) initClient(entity *EntityCommon, conn net.Conn, rPK cip
 	sc.ys = ySes
 	sc.ns = ns
 	sc.nMap = make(noise.NonceMap)
+	sc.caps = caps
+	sc.stats = sConn
+	sc.openedAt = time.Now()
+	sc.hsLatency = hsLatency
 	sc.log = entity.log.WithField("session", ns.RemoteStatic())
 	return nil
 }
 
-func (sc *SessionCommon) initServer(entity *EntityCommon, conn net.Conn) error {
+// initServer performs the server side of the session handshake.
+// If 'gate' is non-nil, the session does not read from the connection until the gate is closed.
+func (sc *SessionCommon) initServer(entity *EntityCommon, conn net.Conn, gate chan struct{}) error {
 	ns, err := noise.New(noise.HandshakeXK, noise.Config{
 		LocalPK:   entity.pk,
 		LocalSK:   entity.sk,
 		Initiator: false,
+		Rekey:     entity.rekey,
 	})
 	if err != nil {
 		return err
 	}
+	ns.SetHandshakePayload(makeHandshakePayload())
 
-	rw := noise.NewReadWriter(conn, ns)
+	sConn := &statsConn{Conn: conn}
+	rw := noise.NewReadWriter(sConn, ns)
+	start := time.Now()
 	if err := rw.Handshake(time.Second * 5); err != nil {
 		return err
 	}
-	if rw.Buffered() > 0 {
-		return ErrSessionHandshakeExtraBytes
-	}
+	hsLatency := time.Since(start)
+	caps := negotiateCaps(ns)
 
-	ySes, err := yamux.Server(conn, yamux.DefaultConfig())
+	yConn := drainedConn(sConn, rw)
+	if gate != nil {
+		yConn = &gatedConn{Conn: yConn, gate: gate}
+	}
+	ySes, err := yamux.Server(yConn, yamux.DefaultConfig())
 	if err != nil {
 		return err
 	}
@@ -113,22 +162,95 @@ func (sc *SessionCommon) initServer(entity *EntityCommon, conn net.Conn) error {
 	sc.ys = ySes
 	sc.ns = ns
 	sc.nMap = make(noise.NonceMap)
+	sc.caps = caps
+	sc.stats = sConn
+	sc.openedAt = time.Now()
+	sc.hsLatency = hsLatency
 	sc.log = entity.log.WithField("session", ns.RemoteStatic())
 	return nil
 }
 
+// negotiateCaps negotiates the capabilities of the session once the noise handshake is complete.
+// Rekeying is disabled if the remote does not support it.
+func negotiateCaps(ns *noise.Noise) Capabilities {
+	caps := negotiateCapabilities(ns.RemoteHandshakePayload())
+	if !caps.Has(FeatureRekey) {
+		ns.SetRekey(noise.RekeyConfig{})
+	}
+	return caps
+}
+
+// drainedConn returns a net.Conn which firstly reads the bytes that were buffered during the noise handshake.
+// The remote may begin writing yamux frames immediately after it's side of the handshake completes, so these
+// frames may already be buffered by the time our side of the handshake completes.
+func drainedConn(conn net.Conn, rw *noise.ReadWriter) net.Conn {
+	b := rw.Drain()
+	if len(b) == 0 {
+		return conn
+	}
+	return &bufferedConn{Conn: conn, r: io.MultiReader(bytes.NewReader(b), conn)}
+}
+
+type bufferedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+// Read implements io.Reader
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// gatedConn holds back reads from the underlying connection until the gate is closed.
+type gatedConn struct {
+	net.Conn
+	gate chan struct{}
+}
+
+// Read implements io.Reader
+func (c *gatedConn) Read(b []byte) (int, error) {
+	<-c.gate
+	return c.Conn.Read(b)
+}
+
 // writeEncryptedGob encrypts with noise and prefixed with uint16 (2 additional bytes).
+// If the session is due to be rekeyed, the object is preceded by a rekey frame.
 func (sc *SessionCommon) writeObject(w io.Writer, obj SignedObject) error {
+	var p []byte
 	sc.wMx.Lock()
-	p := sc.ns.EncryptUnsafe(obj)
+	if sc.ns.RekeyDue() {
+		p = appendFrame(p, sc.ns.RekeyUnsafe())
+	}
+	p = appendFrame(p, sc.ns.EncryptUnsafe(obj))
 	sc.wMx.Unlock()
-	p = append(make([]byte, 2), p...)
-	binary.BigEndian.PutUint16(p, uint16(len(p)-2))
-	_, err := w.Write(p)
-	return err
+	if _, err := w.Write(p); err != nil {
+		return err
+	}
+	atomic.AddUint64(&sc.framesSent, 1)
+	return nil
 }
 
+// appendFrame appends the frame prefixed with its uint16 length.
+func appendFrame(p, frame []byte) []byte {
+	p = append(p, byte(len(frame)>>8), byte(len(frame)))
+	return append(p, frame...)
+}
+
+// readObject reads and decrypts the next object. Rekey frames are skipped.
 func (sc *SessionCommon) readObject(r io.Reader) (SignedObject, error) {
+	for {
+		obj, err := sc.readFrame(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(obj) > 0 {
+			atomic.AddUint64(&sc.framesReceived, 1)
+			return obj, nil
+		}
+	}
+}
+
+func (sc *SessionCommon) readFrame(r io.Reader) ([]byte, error) {
 	lb := make([]byte, 2)
 	if _, err := io.ReadFull(r, lb); err != nil {
 		return nil, err
@@ -143,10 +265,9 @@ func (sc *SessionCommon) readObject(r io.Reader) (SignedObject, error) {
 		sc.rMx.Unlock()
 		return nil, ErrSessionClosed
 	}
-	obj, err := sc.ns.DecryptWithNonceMap(sc.nMap, pb)
+	p, err := sc.ns.DecryptWithNonceMap(sc.nMap, pb)
 	sc.rMx.Unlock()
-
-	return obj, err
+	return p, err
 }
 
 func (sc *SessionCommon) localSK() cipher.SecKey { return sc.entity.sk }
@@ -166,6 +287,60 @@ func (sc *SessionCommon) RemoteTCPAddr() net.Addr { return sc.netConn.RemoteAddr
 // Ping obtains the round trip latency of the session.
 func (sc *SessionCommon) Ping() (time.Duration, error) { return sc.ys.Ping() }
 
+// errAdmissionTimeout occurs when the dmsg server neither admits nor redirects a session within HandshakeTimeout.
+var errAdmissionTimeout = errors.New("timed out waiting for dmsg server to admit session")
+
+// awaitAdmission waits for the remote dmsg server to admit the session (see SessionAdmission).
+// A *RedirectError is returned if the server redirects the session instead. The session should be closed on failure.
+func (sc *SessionCommon) awaitAdmission() error {
+	type accepted struct {
+		yStr *yamux.Stream
+		err  error
+	}
+	ch := make(chan accepted, 1)
+	go func() {
+		yStr, err := sc.ys.AcceptStream()
+		ch <- accepted{yStr: yStr, err: err}
+	}()
+
+	var yStr *yamux.Stream
+	select {
+	case a := <-ch:
+		if a.err != nil {
+			return a.err
+		}
+		yStr = a.yStr
+	case <-time.After(HandshakeTimeout):
+		return errAdmissionTimeout
+	}
+	defer func() { _ = yStr.Close() }() //nolint:errcheck
+
+	if err := yStr.SetReadDeadline(time.Now().Add(HandshakeTimeout)); err != nil {
+		return err
+	}
+	obj, err := sc.readObject(yStr)
+	if err != nil {
+		return err
+	}
+	if admission, err := obj.ObtainSessionAdmission(); err == nil {
+		return admission.Verify(sc.rPK)
+	}
+	redirect, err := obj.ObtainSessionRedirect()
+	if err != nil {
+		return ErrSignedObjectInvalid
+	}
+	if err := redirect.Verify(sc.rPK); err != nil {
+		return err
+	}
+	return &RedirectError{Server: sc.rPK, Alternatives: redirect.Alternatives}
+}
+
+// IsDraining returns true if the remote dmsg server of the session is draining.
+// Draining servers still serve existing streams, but new streams should be dialed via other servers.
+func (sc *SessionCommon) IsDraining() bool { return atomic.LoadInt32(&sc.draining) == 1 }
+
+func (sc *SessionCommon) setDraining() { atomic.StoreInt32(&sc.draining, 1) }
+
 // Close closes the session.
 func (sc *SessionCommon) Close() error {
 	if sc == nil {
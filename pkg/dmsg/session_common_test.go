@@ -0,0 +1,80 @@
+// Package dmsg pkg/dmsg/session_common_test.go
+package dmsg
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/dmsg/pkg/noise"
+)
+
+// Ensure that sessions and streams rekey their noise cipher states, and still deliver data.
+// Arrange:
+// - Dmsg server, and clients 1 and 2 with sessions to the server, which all rekey after every object/frame.
+// Act:
+// - Client 1 concurrently dials streams to client 2, and writes data which client 2 echoes back.
+// Assert:
+// - Data is echoed on all streams.
+// - Sessions and streams are rekeyed.
+func TestSessionCommon_Rekey(t *testing.T) {
+	const port = uint16(80)
+	const streams = 10
+	rekey := noise.RekeyConfig{Bytes: 1}
+
+	env := newTestEnv(t)
+	srv := env.newServer("rekey server", &ServerConfig{MaxSessions: 10, Rekey: rekey})
+	client1 := env.connectClient("rekey client 1", &Config{Rekey: rekey}, srv)
+	client2 := env.connectClient("rekey client 2", &Config{Rekey: rekey}, srv)
+
+	lis, err := client2.Listen(port)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, lis.Close()) }()
+	go func() {
+		for {
+			str, err := lis.AcceptStream()
+			if err != nil {
+				return
+			}
+			go func() { _, _ = io.Copy(str, str) }() //nolint:errcheck
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(streams)
+	for i := 0; i < streams; i++ {
+		go func() {
+			defer wg.Done()
+			str, err := client1.DialStream(context.TODO(), Addr{PK: client2.LocalPK(), Port: port})
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() { assert.NoError(t, str.Close()) }()
+
+			data := cipher.RandByte(10000)
+			errCh := make(chan error, 1)
+			go func() {
+				_, err := str.Write(data)
+				errCh <- err
+			}()
+			got := make([]byte, len(data))
+			_, err = io.ReadFull(str, got)
+			assert.NoError(t, err)
+			assert.NoError(t, <-errCh)
+			assert.Equal(t, data, got)
+			assert.True(t, str.ns.GetEncEpoch() > 0)
+		}()
+	}
+	wg.Wait()
+
+	ses, ok := client1.session(srv.LocalPK())
+	require.True(t, ok)
+	ses.wMx.Lock()
+	assert.True(t, ses.ns.GetEncEpoch() > 0)
+	ses.wMx.Unlock()
+}
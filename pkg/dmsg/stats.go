@@ -0,0 +1,63 @@
+// Package dmsg pkg/dmsg/stats.go
+package dmsg
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Stats contains the traffic statistics of a stream or session.
+//
+// For streams, bytes are payload bytes and frames are the stream's noise frames.
+// For sessions, bytes are all bytes of the underlying connection (including the streams which are served over the
+// session), and frames are the session's own noise frames (stream requests and responses, datagrams and control
+// messages).
+type Stats struct {
+	BytesSent      uint64
+	BytesReceived  uint64
+	FramesSent     uint64
+	FramesReceived uint64
+
+	OpenedAt         time.Time     // When the handshake completed.
+	LastActivity     time.Time     // When data was last sent or received (OpenedAt if no data is transferred yet).
+	HandshakeLatency time.Duration // Duration of the handshake.
+}
+
+// statsConn counts the bytes which are read from and written to the underlying net.Conn.
+type statsConn struct {
+	// atomic requires 64-bit alignment for struct field access
+	bytesSent     uint64
+	bytesReceived uint64
+	lastActivity  int64 // unix nano
+
+	net.Conn
+}
+
+// Read implements io.Reader
+func (c *statsConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		atomic.AddUint64(&c.bytesReceived, uint64(n))
+		atomic.StoreInt64(&c.lastActivity, time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// Write implements io.Writer
+func (c *statsConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		atomic.AddUint64(&c.bytesSent, uint64(n))
+		atomic.StoreInt64(&c.lastActivity, time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// lastActivityOr returns the time of the last read or write, or 't' if there is none.
+func lastActivityOr(unixNano int64, t time.Time) time.Time {
+	if unixNano == 0 {
+		return t
+	}
+	return time.Unix(0, unixNano)
+}
@@ -0,0 +1,82 @@
+// Package dmsg pkg/dmsg/stats_test.go
+package dmsg
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Ensure that streams and sessions keep traffic statistics.
+// Arrange:
+// - Dmsg server, and clients 1 and 2 with sessions to the server.
+// Act:
+// - Client 1 dials a stream to client 2 and writes data, which client 2 reads and echoes back.
+// Assert:
+// - Stream statistics of both sides count the payload bytes and frames in the right direction.
+// - Session statistics count the bytes of the underlying connection, and the stream request/response frames.
+func TestStream_Stats(t *testing.T) {
+	const port = uint16(80)
+
+	env := newTestEnv(t)
+	srv := env.newServer("stats server", nil)
+	client1 := env.connectClient("stats client 1", &Config{}, srv)
+	client2 := env.connectClient("stats client 2", &Config{}, srv)
+
+	lis, err := client2.Listen(port)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, lis.Close()) }()
+
+	str1, err := client1.DialStream(context.TODO(), Addr{PK: client2.LocalPK(), Port: port})
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, str1.Close()) }()
+	str2, err := lis.AcceptStream()
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, str2.Close()) }()
+
+	stats := str1.Stats()
+	assert.Zero(t, stats.BytesSent)
+	assert.False(t, stats.OpenedAt.IsZero())
+	assert.Equal(t, stats.OpenedAt, stats.LastActivity)
+	assert.True(t, stats.HandshakeLatency > 0)
+
+	// Writes larger than a noise frame are split into multiple frames.
+	data := cipher.RandByte(10000)
+	go func() {
+		_, err := str1.Write(data)
+		assert.NoError(t, err)
+	}()
+	buf := make([]byte, len(data))
+	_, err = io.ReadFull(str2, buf)
+	require.NoError(t, err)
+	_, err = str2.Write(buf[:100])
+	require.NoError(t, err)
+	_, err = io.ReadFull(str1, buf[:100])
+	require.NoError(t, err)
+
+	stats1, stats2 := str1.Stats(), str2.Stats()
+	assert.Equal(t, uint64(len(data)), stats1.BytesSent)
+	assert.Equal(t, uint64(100), stats1.BytesReceived)
+	assert.Equal(t, stats1.BytesSent, stats2.BytesReceived)
+	assert.Equal(t, stats1.BytesReceived, stats2.BytesSent)
+	assert.Equal(t, uint64(3), stats1.FramesSent)
+	assert.Equal(t, stats1.FramesSent, stats2.FramesReceived)
+	assert.Equal(t, uint64(1), stats2.FramesSent)
+	assert.True(t, stats1.LastActivity.After(stats1.OpenedAt))
+
+	// Sessions carry the stream data, the stream request/response and the session admission.
+	dSes, ok := client1.Session(srv.LocalPK())
+	require.True(t, ok)
+	sesStats := dSes.Stats()
+	assert.True(t, sesStats.BytesSent > uint64(len(data)))
+	assert.True(t, sesStats.BytesReceived > 100)
+	assert.Equal(t, uint64(1), sesStats.FramesSent)
+	assert.Equal(t, uint64(2), sesStats.FramesReceived)
+	assert.True(t, sesStats.HandshakeLatency > 0)
+	assert.WithinDuration(t, time.Now(), sesStats.LastActivity, 10*time.Second)
+}
@@ -4,6 +4,7 @@ package dmsg
 import (
 	"context"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/yamux"
@@ -25,6 +26,11 @@ type Stream struct {
 	nsConn *noise.ReadWriter
 	close  func() // to be called when closing
 	log    logrus.FieldLogger
+
+	opened    time.Time // set once the handshake completes
+	hsLatency time.Duration
+	dialed    bool // whether the stream is dialed by us
+	closeOnce sync.Once
 }
 
 func newInitiatingStream(cSes *ClientSession) (*Stream, error) {
@@ -51,7 +57,52 @@ func (s *Stream) Close() error {
 	if s.close != nil {
 		s.close()
 	}
-	return s.yStr.Close()
+	err := s.yStr.Close()
+	if !s.opened.IsZero() {
+		s.closeOnce.Do(func() {
+			s.emit(Event{Type: EventStreamClosed, Duration: time.Since(s.opened), Err: err})
+		})
+	}
+	return err
+}
+
+// markOpened records that the stream handshake (which started at 'hsStart') completed, and emits the given event type.
+func (s *Stream) markOpened(t EventType, hsStart time.Time) {
+	s.opened = time.Now()
+	s.hsLatency = s.opened.Sub(hsStart)
+	s.dialed = t == EventStreamDialed
+	s.emit(Event{Type: t})
+}
+
+// emit emits an event of the stream to the entity which the stream belongs to.
+func (s *Stream) emit(e Event) {
+	e.RemotePK = s.ses.RemotePK()
+	e.SrcAddr, e.DstAddr = s.rAddr, s.lAddr
+	if s.dialed {
+		e.SrcAddr, e.DstAddr = s.lAddr, s.rAddr
+	}
+	s.ses.entity.events.emit(e)
+}
+
+// Stats returns the traffic statistics of the stream.
+func (s *Stream) Stats() Stats {
+	var ns noise.Stats
+	if s.nsConn != nil {
+		ns = s.nsConn.Stats()
+	}
+	lastActivity := ns.LastActivity
+	if lastActivity.IsZero() {
+		lastActivity = s.opened
+	}
+	return Stats{
+		BytesSent:        ns.BytesSent,
+		BytesReceived:    ns.BytesReceived,
+		FramesSent:       ns.FramesSent,
+		FramesReceived:   ns.FramesReceived,
+		OpenedAt:         s.opened,
+		LastActivity:     lastActivity,
+		HandshakeLatency: s.hsLatency,
+	}
 }
 
 // Logger returns the internal logrus.FieldLogger instance.
@@ -59,7 +110,8 @@ func (s *Stream) Logger() logrus.FieldLogger {
 	return s.log
 }
 
-func (s *Stream) writeRequest(rAddr Addr) (req StreamRequest, err error) {
+// writeRequest writes a request of wire version 'ver' to dial the remote address.
+func (s *Stream) writeRequest(rAddr Addr, ver uint8) (req StreamRequest, err error) {
 	// Reserve stream in porter.
 	var lPort uint16
 	if lPort, s.close, err = s.ses.porter.ReserveEphemeral(context.Background(), s); err != nil {
@@ -79,8 +131,10 @@ func (s *Stream) writeRequest(rAddr Addr) (req StreamRequest, err error) {
 		SrcAddr:   s.lAddr,
 		DstAddr:   s.rAddr,
 		NoiseMsg:  nsMsg,
+		frameSize: noise.MaxFrameSize,
+		rekey:     true,
 	}
-	obj := MakeSignedStreamRequest(&req, s.ses.localSK())
+	obj := makeSignedStreamRequest(&req, s.ses.localSK(), ver)
 
 	// Write request.
 	err = s.ses.writeObject(s.yStr, obj)
@@ -93,6 +147,10 @@ func (s *Stream) readRequest() (req StreamRequest, err error) {
 		return
 	}
 	if req, err = obj.ObtainStreamRequest(); err != nil {
+		// The dmsg server may instead redirect our session to alternative dmsg servers.
+		if redirect, rErr := obj.ObtainSessionRedirect(); rErr == nil && redirect.Verify(s.ses.RemotePK()) == nil {
+			err = &RedirectError{Server: s.ses.RemotePK(), Alternatives: redirect.Alternatives}
+		}
 		return
 	}
 	if err = req.Verify(0); err != nil {
@@ -112,34 +170,56 @@ func (s *Stream) readRequest() (req StreamRequest, err error) {
 	return
 }
 
-func (s *Stream) writeResponse(reqHash cipher.SHA256) error {
-	// Obtain associated local listener.
+// listener obtains the local listener associated with the stream.
+func (s *Stream) listener() (*Listener, error) {
 	pVal, ok := s.ses.porter.PortValue(s.lAddr.Port)
 	if !ok {
-		return ErrReqNoListener
+		return nil, ErrReqNoListener
 	}
 	lis, ok := pVal.(*Listener)
 	if !ok {
-		return ErrReqNoListener
+		return nil, ErrReqNoListener
 	}
+	return lis, nil
+}
+
+// writeRejection rejects the request with the error code of 'reason' (see rejectCode).
+// Responses are of the wire version of the request.
+func (s *Stream) writeRejection(req StreamRequest, reason error) error {
+	resp := StreamResponse{
+		ReqHash:  req.raw.Hash(),
+		Accepted: false,
+		ErrCode:  rejectCode(reason),
+	}
+	obj := makeSignedStreamResponse(&resp, s.ses.localSK(), req.wire)
+	return s.ses.writeObject(s.yStr, obj)
+}
 
+// writeResponse accepts the request and introduces the stream to the local listener.
+// 'hsStart' is when the stream handshake started.
+func (s *Stream) writeResponse(req StreamRequest, lis *Listener, hsStart time.Time) error {
 	// Prepare and write response.
 	nsMsg, err := s.ns.MakeHandshakeMessage()
 	if err != nil {
 		return err
 	}
 	resp := StreamResponse{
-		ReqHash:  reqHash,
-		Accepted: true,
-		NoiseMsg: nsMsg,
+		ReqHash:   req.raw.Hash(),
+		Accepted:  true,
+		NoiseMsg:  nsMsg,
+		frameSize: noise.MaxFrameSize,
+		rekey:     true,
 	}
-	obj := MakeSignedStreamResponse(&resp, s.ses.localSK())
+	obj := makeSignedStreamResponse(&resp, s.ses.localSK(), req.wire)
 
 	if err := s.ses.writeObject(s.yStr, obj); err != nil {
 		return err
 	}
+	s.nsConn.SetFrameSize(s.ses.entity.writeFrameSize(int(req.frameSize)))
+	s.enableRekey(req.rekey)
 
 	// Push stream to listener.
+	s.markOpened(EventStreamAccepted, hsStart)
 	return lis.introduceStream(s)
 }
 
@@ -153,9 +233,26 @@ func (s *Stream) readResponse(req StreamRequest) error {
 		return err
 	}
 	if err := resp.Verify(req); err != nil {
+		// The request may be rejected by the dmsg server itself (i.e. when the client is being limited).
+		if ok, rErr := resp.VerifyServerRejection(req, s.ses.RemotePK()); ok {
+			return rErr
+		}
 		return err
 	}
-	return s.ns.ProcessHandshakeMessage(resp.NoiseMsg)
+	if err := s.ns.ProcessHandshakeMessage(resp.NoiseMsg); err != nil {
+		return err
+	}
+	s.nsConn.SetFrameSize(s.ses.entity.writeFrameSize(int(resp.frameSize)))
+	s.enableRekey(resp.rekey)
+	return nil
+}
+
+// enableRekey enables rekeying of the stream if the remote supports it (as advertised within the stream handshake).
+// Remotes which do not support it cannot decrypt rekey frames, so the stream is never rekeyed.
+func (s *Stream) enableRekey(remoteRekey bool) {
+	if remoteRekey {
+		s.ns.SetRekey(s.ses.entity.rekey)
+	}
 }
 
 func (s *Stream) prepareFields(init bool, lAddr, rAddr Addr) {
@@ -164,6 +261,7 @@ func (s *Stream) prepareFields(init bool, lAddr, rAddr Addr) {
 		LocalSK:   s.ses.localSK(),
 		RemotePK:  rAddr.PK,
 		Initiator: init,
+		// Rekeying is enabled once both ends advertise it (see enableRekey).
 	})
 	if err != nil {
 		s.log.WithError(err).Panic("Failed to prepare stream noise object.")
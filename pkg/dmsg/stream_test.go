@@ -8,7 +8,6 @@ import (
 	"net"
 	"sync"
 	"testing"
-	"time"
 
 	"github.com/skycoin/skywire-utilities/pkg/cipher"
 	"github.com/skycoin/skywire-utilities/pkg/logging"
@@ -52,7 +51,8 @@ func TestStream(t *testing.T) {
 	go clientB.Serve(context.Background())
 
 	// Ensure all entities are registered in discovery before continuing.
-	time.Sleep(time.Second * 2)
+	<-clientA.Ready()
+	<-clientB.Ready()
 
 	// Helper functions.
 	makePiper := func(dialer, listener *Client, port uint16) (net.Listener, nettest.MakePipe) {
@@ -213,3 +213,122 @@ func GenKeyPair(t *testing.T, seed string) (cipher.PubKey, cipher.SecKey) {
 	require.NoError(t, err)
 	return pk, sk
 }
+
+// Ensure that streams write frames of the negotiated frame size.
+// Arrange:
+// - Dmsg server, client 1 which writes frames of noise.MaxFrameSize, and client 2 which writes frames of 16KiB.
+// Act:
+// - Client 1 dials streams to client 2, with a binary and a gob-encoded request, and writes data which client 2 echoes.
+// Assert:
+// - Streams of binary requests write frames of the configured sizes, and data is echoed.
+// - Streams of gob-encoded requests (of which the frame size is unknown) write frames of noise.DefaultFrameSize.
+func TestStream_FrameSize(t *testing.T) {
+	const port = uint16(80)
+
+	env := newTestEnv(t)
+	srv := env.newServer("frame server", nil)
+	client1 := env.connectClient("frame client 1", &Config{FrameSize: noise.MaxFrameSize}, srv)
+	client2 := env.connectClient("frame client 2", &Config{FrameSize: 16 * 1024}, srv)
+
+	lis, err := client2.Listen(port)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, lis.Close()) }()
+
+	cSes1, ok := client1.clientSession(client1.porter, srv.LocalPK())
+	require.True(t, ok)
+
+	for _, tc := range []struct {
+		ver       uint8
+		wantSize1 int
+		wantSize2 int
+	}{
+		{ver: wireV1, wantSize1: noise.MaxFrameSize, wantSize2: 16 * 1024},
+		{ver: wireGob, wantSize1: noise.DefaultFrameSize, wantSize2: noise.DefaultFrameSize},
+	} {
+		str1, err := cSes1.dialStream(Addr{PK: client2.LocalPK(), Port: port}, tc.ver)
+		require.NoError(t, err)
+		str2, err := lis.AcceptStream()
+		require.NoError(t, err)
+		go func() { _, _ = io.Copy(str2, str2) }() //nolint:errcheck
+
+		require.Equal(t, tc.wantSize1, str1.nsConn.FrameSize())
+		require.Equal(t, tc.wantSize2, str2.nsConn.FrameSize())
+
+		data := cipher.RandByte(200 * 1024)
+		errCh := make(chan error, 1)
+		go func() {
+			_, err := str1.Write(data)
+			errCh <- err
+		}()
+		got := make([]byte, len(data))
+		_, err = io.ReadFull(str1, got)
+		require.NoError(t, err)
+		require.NoError(t, <-errCh)
+		require.Equal(t, data, got)
+
+		require.NoError(t, str1.Close())
+		require.NoError(t, str2.Close())
+	}
+}
+
+// Ensure that streams are only rekeyed if both ends advertise support within the stream handshake.
+// Arrange:
+// - Dmsg server, and clients 1 and 2 which rekey after every 1KiB.
+// Act:
+// - Client 1 dials streams to client 2, with a binary and a gob-encoded request, and writes data which client 2 echoes.
+// Assert:
+// - Streams of binary requests are rekeyed in both directions, and data is echoed.
+// - Streams of gob-encoded requests (which cannot advertise support) are never rekeyed.
+func TestStream_Rekey(t *testing.T) {
+	const port = uint16(80)
+	rekey := noise.RekeyConfig{Bytes: 1024}
+
+	env := newTestEnv(t)
+	srv := env.newServer("rekey server", nil)
+	client1 := env.connectClient("rekey client 1", &Config{Rekey: rekey}, srv)
+	client2 := env.connectClient("rekey client 2", &Config{Rekey: rekey}, srv)
+
+	lis, err := client2.Listen(port)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, lis.Close()) }()
+
+	cSes1, ok := client1.clientSession(client1.porter, srv.LocalPK())
+	require.True(t, ok)
+
+	for _, tc := range []struct {
+		ver       uint8
+		wantRekey bool
+	}{
+		{ver: wireV1, wantRekey: true},
+		{ver: wireGob, wantRekey: false},
+	} {
+		str1, err := cSes1.dialStream(Addr{PK: client2.LocalPK(), Port: port}, tc.ver)
+		require.NoError(t, err)
+		str2, err := lis.AcceptStream()
+		require.NoError(t, err)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = io.Copy(str2, str2) //nolint:errcheck
+		}()
+
+		data := cipher.RandByte(16 * 1024)
+		errCh := make(chan error, 1)
+		go func() {
+			_, err := str1.Write(data)
+			errCh <- err
+		}()
+		got := make([]byte, len(data))
+		_, err = io.ReadFull(str1, got)
+		require.NoError(t, err)
+		require.NoError(t, <-errCh)
+		require.Equal(t, data, got)
+
+		require.NoError(t, str1.Close())
+		<-done
+		require.NoError(t, str2.Close())
+
+		require.Equal(t, tc.wantRekey, str1.ns.GetEncEpoch() > 0)
+		require.Equal(t, tc.wantRekey, str2.ns.GetEncEpoch() > 0)
+	}
+}
@@ -0,0 +1,109 @@
+// Package dmsg pkg/dmsg/testenv_test.go
+package dmsg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/skycoin/skywire-utilities/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/dmsg/internal/servermetrics"
+	"github.com/skycoin/dmsg/pkg/disc"
+)
+
+// testEnv is an environment of dmsg servers and clients which register in a mock discovery, and connect with each
+// other over an in-memory pipe transport.
+// The fields may be replaced before servers and clients are started. Everything which is started in the environment
+// is closed on cleanup of the test.
+type testEnv struct {
+	t       *testing.T
+	dc      disc.APIClient
+	tp      SessionTransport      // transport of servers and clients, unless set in their config (nil for TCP)
+	metrics servermetrics.Metrics // metrics of servers (nil for none)
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	return &testEnv{t: t, dc: disc.NewMock(0), tp: NewPipeTransport()}
+}
+
+// makeServer creates a dmsg server with the key pair of 'seed'.
+// If 'conf' is nil, the server accepts up to 10 sessions.
+func (env *testEnv) makeServer(seed string, conf *ServerConfig) *Server {
+	if conf == nil {
+		conf = &ServerConfig{MaxSessions: 10}
+	}
+	if conf.Transport == nil {
+		conf.Transport = env.tp
+	}
+	pk, sk := GenKeyPair(env.t, seed)
+	srv := NewServer(pk, sk, env.dc, conf, env.metrics)
+	srv.SetLogger(logging.MustGetLogger(seed))
+	return srv
+}
+
+// startServer serves the server with 'serve', and waits for it to be ready.
+func (env *testEnv) startServer(srv *Server, serve func() error) {
+	chSrv := make(chan error, 1)
+	go func() { chSrv <- serve() }()
+	env.t.Cleanup(func() {
+		assert.NoError(env.t, srv.Close())
+		assert.NoError(env.t, <-chSrv)
+	})
+	<-srv.Ready()
+}
+
+// newServer starts a dmsg server with the key pair of 'seed' (see makeServer), and returns it once it is ready.
+func (env *testEnv) newServer(seed string, conf *ServerConfig) *Server {
+	srv := env.makeServer(seed, conf)
+	env.startServer(srv, func() error { return srv.ListenAndServe(seed, seed) })
+	return srv
+}
+
+// entry returns the discovery entry of 'pk'.
+func (env *testEnv) entry(pk cipher.PubKey) *disc.Entry {
+	entry, err := env.dc.Entry(context.TODO(), pk)
+	require.NoError(env.t, err)
+	return entry
+}
+
+// newClient creates a dmsg client with the key pair of 'seed', which is not served.
+// If 'conf' is nil, DefaultConfig is used.
+func (env *testEnv) newClient(seed string, conf *Config) *Client {
+	if conf == nil {
+		conf = DefaultConfig()
+	}
+	if conf.Transport == nil {
+		conf.Transport = env.tp
+	}
+	pk, sk := GenKeyPair(env.t, seed)
+	c := NewClient(pk, sk, env.dc, conf)
+	c.SetLogger(logging.MustGetLogger(seed))
+	env.t.Cleanup(func() { assert.NoError(env.t, c.Close()) })
+	return c
+}
+
+// connectClient creates a dmsg client (see newClient) which establishes sessions with the given servers.
+func (env *testEnv) connectClient(seed string, conf *Config, srvs ...*Server) *Client {
+	c := env.newClient(seed, conf)
+	for _, srv := range srvs {
+		require.NoError(env.t, c.EnsureSession(context.TODO(), env.entry(srv.LocalPK())))
+	}
+	return c
+}
+
+// serveClient creates and serves a dmsg client (see newClient), and returns it once it is ready.
+func (env *testEnv) serveClient(seed string, conf *Config) *Client {
+	c := env.newClient(seed, conf)
+	go c.Serve(context.Background())
+
+	select {
+	case <-c.Ready():
+	case <-time.After(10 * time.Second):
+		env.t.Fatal("timed out waiting for client to be ready")
+	}
+	return c
+}
@@ -0,0 +1,85 @@
+// Package dmsg pkg/dmsg/transport.go
+package dmsg
+
+import (
+	"context"
+	"net"
+
+	"golang.org/x/net/proxy"
+
+	"github.com/skycoin/dmsg/pkg/disc"
+)
+
+// SessionTransport dials and listens for the underlying connections which dmsg sessions are established over.
+type SessionTransport interface {
+	// Type returns the transport type, as advertised in the discovery entries of dmsg servers.
+	Type() string
+
+	// Dial dials a connection to the given address.
+	Dial(ctx context.Context, addr string) (net.Conn, error)
+
+	// Listen listens for connections on the given address.
+	Listen(addr string) (net.Listener, error)
+}
+
+// Session transport types.
+const (
+	TransportTCP       = disc.DefaultTransportType
+	TransportUnix      = "unix"
+	TransportPipe      = "pipe"
+	TransportWebSocket = "ws"
+)
+
+// netTransport is a SessionTransport which uses the 'net' package.
+type netTransport struct {
+	network string
+	dialer  proxy.ContextDialer
+}
+
+// NewTCPTransport returns a SessionTransport which establishes sessions over TCP.
+// This is the default session transport.
+func NewTCPTransport() SessionTransport {
+	return &netTransport{network: TransportTCP, dialer: &net.Dialer{}}
+}
+
+// NewUnixTransport returns a SessionTransport which establishes sessions over Unix domain sockets.
+func NewUnixTransport() SessionTransport {
+	return &netTransport{network: TransportUnix, dialer: &net.Dialer{}}
+}
+
+// Type implements SessionTransport.
+func (t *netTransport) Type() string { return t.network }
+
+// Dial implements SessionTransport.
+func (t *netTransport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	return t.dialer.DialContext(ctx, t.network, addr)
+}
+
+// Listen implements SessionTransport.
+func (t *netTransport) Listen(addr string) (net.Listener, error) {
+	return net.Listen(t.network, addr)
+}
+
+// transportAddr implements net.Addr for session transports which are not provided by the 'net' package.
+type transportAddr struct {
+	network string
+	addr    string
+}
+
+// Network implements net.Addr.
+func (a transportAddr) Network() string { return a.network }
+
+// String implements net.Addr.
+func (a transportAddr) String() string { return a.addr }
+
+func transportsEqual(a, b []disc.Transport) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
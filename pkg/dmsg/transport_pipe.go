@@ -0,0 +1,103 @@
+// Package dmsg pkg/dmsg/transport_pipe.go
+package dmsg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// PipeTransport is a SessionTransport which establishes sessions over in-memory pipes.
+// Dialing entities and listening entities need to share the same PipeTransport instance.
+type PipeTransport struct {
+	listeners map[string]*pipeListener
+	mx        sync.Mutex
+}
+
+// NewPipeTransport creates a new PipeTransport.
+func NewPipeTransport() *PipeTransport {
+	return &PipeTransport{listeners: make(map[string]*pipeListener)}
+}
+
+// Type implements SessionTransport.
+func (*PipeTransport) Type() string { return TransportPipe }
+
+// Dial implements SessionTransport.
+func (t *PipeTransport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	t.mx.Lock()
+	lis, ok := t.listeners[addr]
+	t.mx.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no pipe listener on address %q", addr)
+	}
+
+	c1, c2 := net.Pipe()
+	select {
+	case lis.accept <- c2:
+		return c1, nil
+	case <-lis.done:
+		return nil, fmt.Errorf("no pipe listener on address %q", addr)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Listen implements SessionTransport.
+func (t *PipeTransport) Listen(addr string) (net.Listener, error) {
+	if addr == "" {
+		return nil, errors.New("pipe listener address cannot be empty")
+	}
+
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	if _, ok := t.listeners[addr]; ok {
+		return nil, fmt.Errorf("pipe listener address %q is already in use", addr)
+	}
+
+	lis := &pipeListener{
+		addr:   transportAddr{network: TransportPipe, addr: addr},
+		accept: make(chan net.Conn),
+		done:   make(chan struct{}),
+	}
+	lis.onClose = func() {
+		t.mx.Lock()
+		delete(t.listeners, addr)
+		t.mx.Unlock()
+	}
+	t.listeners[addr] = lis
+	return lis, nil
+}
+
+type pipeListener struct {
+	addr    transportAddr
+	accept  chan net.Conn
+	done    chan struct{}
+	once    sync.Once
+	onClose func()
+}
+
+// Accept implements net.Listener.
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.accept:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener.
+func (l *pipeListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+		l.onClose()
+	})
+	return nil
+}
+
+// Addr implements net.Listener.
+func (l *pipeListener) Addr() net.Addr { return l.addr }
@@ -0,0 +1,170 @@
+// Package dmsg pkg/dmsg/transport_test.go
+package dmsg
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/nettest"
+
+	"github.com/skycoin/dmsg/pkg/noise"
+)
+
+// Ensure that dmsg sessions can be established over a non-TCP session transport.
+// Arrange:
+// - Dmsg server and clients which share an in-memory pipe transport.
+// Act:
+// - Client A dials a stream to client B.
+// Assert:
+// - The server advertises the pipe transport in discovery.
+// - Data passes through the stream both ways.
+func TestSessionTransport_Pipe(t *testing.T) {
+	const port = uint16(80)
+
+	env := newTestEnv(t)
+	srv := env.newServer("pipe server", nil)
+	clientA := env.serveClient("pipe client A", nil)
+	clientB := env.serveClient("pipe client B", nil)
+
+	entry := env.entry(srv.LocalPK())
+	addr, ok := entry.Server.TransportAddr(TransportPipe)
+	require.True(t, ok)
+	require.Equal(t, "pipe server", addr)
+	_, ok = entry.Server.TransportAddr(TransportTCP)
+	require.False(t, ok)
+
+	lis, err := clientB.Listen(port)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, lis.Close()) }()
+
+	strA, err := clientA.DialStream(context.TODO(), Addr{PK: clientB.LocalPK(), Port: port})
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, strA.Close()) }()
+
+	strB, err := lis.AcceptStream()
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, strB.Close()) }()
+
+	for _, pair := range [][2]io.ReadWriter{{strA, strB}, {strB, strA}} {
+		data := cipher.RandByte(1024)
+		_, err := pair[0].Write(data)
+		require.NoError(t, err)
+
+		readData := make([]byte, len(data))
+		_, err = io.ReadFull(pair[1], readData)
+		require.NoError(t, err)
+		require.Equal(t, data, readData)
+	}
+}
+
+// Ensure that clients only use dmsg servers which support their session transport.
+func TestSessionTransport_Unsupported(t *testing.T) {
+	env := newTestEnv(t)
+	srv := env.newServer("pipe server", nil)
+
+	// The client has no discovery entry to delete once closed.
+	pk, sk := GenKeyPair(t, "tcp client")
+	c := NewClient(pk, sk, env.dc, DefaultConfig())
+	t.Cleanup(func() { _ = c.Close() }) //nolint:errcheck
+
+	entries, err := c.discoverServers(context.TODO(), true)
+	require.NoError(t, err)
+	require.Len(t, entries, 0)
+	require.Error(t, c.EnsureSession(context.TODO(), env.entry(srv.LocalPK())))
+}
+
+// Ensure that clients of different session transports can reach one another via the same dmsg server.
+// Arrange:
+// - Dmsg server which accepts sessions over TCP, and over WebSocket via a HTTP server.
+// - Client A which uses WebSocket and client B which uses TCP.
+// Act:
+// - Client A dials a stream to client B.
+// Assert:
+// - The server advertises both transports in discovery.
+// - Data passes through the stream both ways.
+func TestSessionTransport_WebSocket(t *testing.T) {
+	const port = uint16(80)
+
+	// The server listens on TCP and WebSocket, and clients set their own transports.
+	env := newTestEnv(t)
+	env.tp = nil
+	srv := env.makeServer("ws server", nil)
+	pkSrv := srv.LocalPK()
+
+	lis, err := nettest.NewLocalListener("tcp")
+	require.NoError(t, err)
+
+	wsLis := NewWebSocketListener(lis.Addr())
+	mux := http.NewServeMux()
+	mux.Handle("/dmsg", wsLis)
+	hs := httptest.NewServer(mux)
+	t.Cleanup(hs.Close)
+	wsAddr := "ws://" + strings.TrimPrefix(hs.URL, "http://") + "/dmsg"
+
+	chSrv := make(chan error, 2)
+	go func() { chSrv <- srv.Serve(lis, "") }()
+	go func() { chSrv <- srv.ServeTransport(wsLis, TransportWebSocket, wsAddr) }()
+	t.Cleanup(func() {
+		assert.NoError(t, srv.Close())
+		assert.NoError(t, <-chSrv)
+		assert.NoError(t, <-chSrv)
+	})
+	<-srv.Ready()
+
+	// The WebSocket transport may be served after the server is ready, in which case it is advertised afterwards.
+	require.Eventually(t, func() bool {
+		entry, err := env.dc.Entry(context.TODO(), pkSrv)
+		if err != nil {
+			return false
+		}
+		_, ok := entry.Server.TransportAddr(TransportWebSocket)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	newClient := func(seed string, tp SessionTransport) *Client {
+		conf := DefaultConfig()
+		conf.Transport = tp
+		return env.serveClient(seed, conf)
+	}
+	clientA := newClient("ws client A", NewWebSocketTransport(nil))
+	clientB := newClient("tcp client B", NewTCPTransport())
+
+	entry := env.entry(pkSrv)
+	addr, ok := entry.Server.TransportAddr(TransportWebSocket)
+	require.True(t, ok)
+	require.Equal(t, wsAddr, addr)
+	addr, ok = entry.Server.TransportAddr(TransportTCP)
+	require.True(t, ok)
+	require.Equal(t, lis.Addr().String(), addr)
+
+	dmsgLis, err := clientB.Listen(port)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, dmsgLis.Close()) }()
+
+	strA, err := clientA.DialStream(context.TODO(), Addr{PK: clientB.LocalPK(), Port: port})
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, strA.Close()) }()
+
+	strB, err := dmsgLis.AcceptStream()
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, strB.Close()) }()
+
+	for _, pair := range [][2]io.ReadWriter{{strA, strB}, {strB, strA}} {
+		data := cipher.RandByte(noise.MaxWriteSize * 4)
+		_, err := pair[0].Write(data)
+		require.NoError(t, err)
+
+		readData := make([]byte, len(data))
+		_, err = io.ReadFull(pair[1], readData)
+		require.NoError(t, err)
+		require.Equal(t, data, readData)
+	}
+}
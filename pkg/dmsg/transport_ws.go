@@ -0,0 +1,182 @@
+// Package dmsg pkg/dmsg/transport_ws.go
+package dmsg
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// wsReadLimit is the maximum size of a single WebSocket message that we accept.
+// Each message contains a single noise frame, so this comfortably fits the largest frame.
+const wsReadLimit = 1 << 20
+
+// wsTransport is a SessionTransport which establishes sessions over WebSocket connections.
+type wsTransport struct {
+	httpC *http.Client
+}
+
+// NewWebSocketTransport returns a SessionTransport which establishes sessions over WebSocket connections.
+// Addresses to dial are expected to be 'ws://' or 'wss://' URLs. If 'httpC' is nil, http.DefaultClient is used.
+func NewWebSocketTransport(httpC *http.Client) SessionTransport {
+	return &wsTransport{httpC: httpC}
+}
+
+// Type implements SessionTransport.
+func (*wsTransport) Type() string { return TransportWebSocket }
+
+// Dial implements SessionTransport.
+func (t *wsTransport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid websocket address: %w", err)
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return nil, fmt.Errorf("invalid websocket address scheme '%s'", u.Scheme)
+	}
+
+	ws, _, err := websocket.Dial(ctx, addr, &websocket.DialOptions{HTTPClient: t.httpC}) //nolint:bodyclose
+	if err != nil {
+		return nil, err
+	}
+	ws.SetReadLimit(wsReadLimit)
+
+	return &wsConn{
+		Conn:  websocket.NetConn(context.Background(), ws, websocket.MessageBinary),
+		lAddr: transportAddr{network: TransportWebSocket, addr: "websocket"},
+		rAddr: transportAddr{network: TransportWebSocket, addr: addr},
+	}, nil
+}
+
+// Listen implements SessionTransport.
+// It serves WebSocket connections via a HTTP server listening on the TCP address 'addr'.
+func (t *wsTransport) Listen(addr string) (net.Listener, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	wsLis := NewWebSocketListener(lis.Addr())
+	srv := &http.Server{
+		ReadHeaderTimeout: HandshakeTimeout,
+		Handler:           wsLis,
+	}
+	wsLis.onClose = srv.Close
+	go srv.Serve(lis) //nolint:errcheck
+
+	return wsLis, nil
+}
+
+// WebSocketListener is a net.Listener which accepts connections from WebSocket upgrade requests.
+// It implements http.Handler so that it can be served alongside other HTTP endpoints.
+type WebSocketListener struct {
+	addr    net.Addr
+	accept  chan net.Conn
+	done    chan struct{}
+	once    sync.Once
+	onClose func() error
+}
+
+// NewWebSocketListener creates a WebSocketListener which reports 'addr' as its local address.
+func NewWebSocketListener(addr net.Addr) *WebSocketListener {
+	return &WebSocketListener{
+		addr:    addr,
+		accept:  make(chan net.Conn),
+		done:    make(chan struct{}),
+		onClose: func() error { return nil },
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (l *WebSocketListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if isClosed(l.done) {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
+	ws, err := websocket.Accept(deadlineResetWriter{w}, r, nil)
+	if err != nil {
+		return
+	}
+	ws.SetReadLimit(wsReadLimit)
+
+	conn := &wsConn{
+		Conn:  websocket.NetConn(context.Background(), ws, websocket.MessageBinary),
+		lAddr: l.addr,
+		rAddr: transportAddr{network: TransportWebSocket, addr: r.RemoteAddr},
+	}
+
+	select {
+	case l.accept <- conn:
+	case <-l.done:
+		_ = conn.Close() //nolint:errcheck
+	case <-r.Context().Done():
+		_ = conn.Close() //nolint:errcheck
+	}
+}
+
+// Accept implements net.Listener.
+func (l *WebSocketListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.accept:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener.
+func (l *WebSocketListener) Close() error {
+	var err error
+	l.once.Do(func() {
+		close(l.done)
+		err = l.onClose()
+	})
+	return err
+}
+
+// Addr implements net.Listener.
+func (l *WebSocketListener) Addr() net.Addr { return l.addr }
+
+// wsConn overrides the placeholder addresses of connections returned by websocket.NetConn.
+type wsConn struct {
+	net.Conn
+	lAddr, rAddr net.Addr
+}
+
+// LocalAddr implements net.Conn.
+func (c *wsConn) LocalAddr() net.Addr { return c.lAddr }
+
+// RemoteAddr implements net.Conn.
+func (c *wsConn) RemoteAddr() net.Addr { return c.rAddr }
+
+// deadlineResetWriter clears the deadlines which the HTTP server may have set on a connection before it is hijacked.
+// Otherwise, the server's read and write timeouts would apply to the lifetime of the WebSocket connection.
+type deadlineResetWriter struct {
+	http.ResponseWriter
+}
+
+// Hijack implements http.Hijacker.
+func (w deadlineResetWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("http.ResponseWriter does not implement http.Hijacker")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		_ = conn.Close() //nolint:errcheck
+		return nil, nil, err
+	}
+	return conn, rw, nil
+}
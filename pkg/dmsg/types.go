@@ -97,24 +97,63 @@ func (Addr) Type() string {
 
 const sigLen = len(cipher.Sig{})
 
-// SignedObject represents a gob-encoded structure prepended with a signature.
+// SignedObject represents an encoded structure prepended with a signature.
+// Stream requests and responses are either gob-encoded or of the binary encoding (see docs/wire-format.md), other
+// structures are gob-encoded.
 type SignedObject []byte
 
 // MakeSignedStreamRequest encodes and signs a StreamRequest into a SignedObject format.
 func MakeSignedStreamRequest(req *StreamRequest, sk cipher.SecKey) SignedObject {
-	obj := encodeGob(req)
+	return makeSignedStreamRequest(req, sk, wireGob)
+}
+
+func makeSignedStreamRequest(req *StreamRequest, sk cipher.SecKey, ver uint8) SignedObject {
+	obj := encodeStreamRequest(req, ver)
 	sig := SignBytes(obj, sk)
 	signedObj := append(sig[:], obj...)
 	req.raw = signedObj
+	req.wire = ver
 	return signedObj
 }
 
 // MakeSignedStreamResponse encodes and signs a StreamResponse into a SignedObject format.
 func MakeSignedStreamResponse(resp *StreamResponse, sk cipher.SecKey) SignedObject {
-	obj := encodeGob(resp)
+	return makeSignedStreamResponse(resp, sk, wireGob)
+}
+
+func makeSignedStreamResponse(resp *StreamResponse, sk cipher.SecKey, ver uint8) SignedObject {
+	obj := encodeStreamResponse(resp, ver)
 	sig := SignBytes(obj, sk)
 	signedObj := append(sig[:], obj...)
 	resp.raw = signedObj
+	resp.wire = ver
+	return signedObj
+}
+
+// MakeSignedSessionRedirect encodes and signs a SessionRedirect into a SignedObject format.
+func MakeSignedSessionRedirect(redirect *SessionRedirect, sk cipher.SecKey) SignedObject {
+	obj := encodeGob(redirect)
+	sig := SignBytes(obj, sk)
+	signedObj := append(sig[:], obj...)
+	redirect.raw = signedObj
+	return signedObj
+}
+
+// MakeSignedSessionAdmission encodes and signs a SessionAdmission into a SignedObject format.
+func MakeSignedSessionAdmission(admission *SessionAdmission, sk cipher.SecKey) SignedObject {
+	obj := encodeGob(admission)
+	sig := SignBytes(obj, sk)
+	signedObj := append(sig[:], obj...)
+	admission.raw = signedObj
+	return signedObj
+}
+
+// MakeSignedDatagramChannel encodes and signs a DatagramChannel into a SignedObject format.
+func MakeSignedDatagramChannel(ch *DatagramChannel, sk cipher.SecKey) SignedObject {
+	obj := encodeGob(ch)
+	sig := SignBytes(obj, sk)
+	signedObj := append(sig[:], obj...)
+	ch.raw = signedObj
 	return signedObj
 }
 
@@ -140,28 +179,61 @@ func (so SignedObject) Object() []byte {
 	return so[sigLen:]
 }
 
-// ObtainStreamRequest obtains a StreamRequest from the encoded object bytes.
+// ObtainStreamRequest obtains a StreamRequest from the encoded object bytes, which are of any wire version.
 func (so SignedObject) ObtainStreamRequest() (StreamRequest, error) {
 	if !so.Valid() {
 		return StreamRequest{}, ErrSignedObjectInvalid
 	}
 	var req StreamRequest
-	err := decodeGob(&req, so[sigLen:])
+	err := decodeStreamRequest(&req, so[sigLen:])
 	req.raw = so
 	return req, err
 }
 
-// ObtainStreamResponse obtains a StreamResponse from the encoded object bytes.
+// ObtainStreamResponse obtains a StreamResponse from the encoded object bytes, which are of any wire version.
 func (so SignedObject) ObtainStreamResponse() (StreamResponse, error) {
 	if !so.Valid() {
 		return StreamResponse{}, ErrSignedObjectInvalid
 	}
 	var resp StreamResponse
-	err := decodeGob(&resp, so[sigLen:])
+	err := decodeStreamResponse(&resp, so[sigLen:])
 	resp.raw = so
 	return resp, err
 }
 
+// ObtainSessionRedirect obtains a SessionRedirect from the encoded object bytes.
+func (so SignedObject) ObtainSessionRedirect() (SessionRedirect, error) {
+	if !so.Valid() {
+		return SessionRedirect{}, ErrSignedObjectInvalid
+	}
+	var redirect SessionRedirect
+	err := decodeGob(&redirect, so[sigLen:])
+	redirect.raw = so
+	return redirect, err
+}
+
+// ObtainSessionAdmission obtains a SessionAdmission from the encoded object bytes.
+func (so SignedObject) ObtainSessionAdmission() (SessionAdmission, error) {
+	if !so.Valid() {
+		return SessionAdmission{}, ErrSignedObjectInvalid
+	}
+	var admission SessionAdmission
+	err := decodeGob(&admission, so[sigLen:])
+	admission.raw = so
+	return admission, err
+}
+
+// ObtainDatagramChannel obtains a DatagramChannel from the encoded object bytes.
+func (so SignedObject) ObtainDatagramChannel() (DatagramChannel, error) {
+	if !so.Valid() {
+		return DatagramChannel{}, ErrSignedObjectInvalid
+	}
+	var ch DatagramChannel
+	err := decodeGob(&ch, so[sigLen:])
+	ch.raw = so
+	return ch, err
+}
+
 // StreamRequest represents a stream dial request object.
 type StreamRequest struct {
 	Timestamp int64
@@ -169,7 +241,10 @@ type StreamRequest struct {
 	DstAddr   Addr
 	NoiseMsg  []byte
 
-	raw SignedObject `enc:"-"` // back reference.
+	raw       SignedObject `enc:"-"` // back reference.
+	wire      uint8        `enc:"-"` // wire version of raw.
+	frameSize uint32       `enc:"-"` // largest noise frame size which the source accepts (binary encoding only).
+	rekey     bool         `enc:"-"` // whether the source supports rekeying of the stream (binary encoding only).
 }
 
 // Verify verifies the StreamRequest.
@@ -206,7 +281,10 @@ type StreamResponse struct {
 	ErrCode  errorCode     // Check if not accepted.
 	NoiseMsg []byte
 
-	raw SignedObject `enc:"-"` // back reference.
+	raw       SignedObject `enc:"-"` // back reference.
+	wire      uint8        `enc:"-"` // wire version of raw.
+	frameSize uint32       `enc:"-"` // largest noise frame size which the destination accepts (binary encoding only).
+	rekey     bool         `enc:"-"` // whether the destination supports rekeying of the stream (binary encoding only).
 }
 
 // Verify verifies the StreamResponse.
@@ -223,13 +301,75 @@ func (resp StreamResponse) Verify(req StreamRequest) error {
 
 	// Check whether response states that the request is accepted.
 	if !resp.Accepted {
-		ok, err := ErrorFromCode(resp.ErrCode)
-		if !ok {
-			err = ErrDialRespNotAccepted
-		}
-		return err
+		return rejectError(resp.ErrCode)
+	}
+
+	return nil
+}
+
+// VerifyServerRejection verifies a StreamResponse which rejects the StreamRequest on behalf of the dmsg server of
+// public key 'srvPK' (the destination client never sees such requests).
+// It returns true alongside the reason of the rejection if the response is a valid rejection.
+func (resp StreamResponse) VerifyServerRejection(req StreamRequest, srvPK cipher.PubKey) (bool, error) {
+	if resp.Accepted || resp.ReqHash != req.raw.Hash() {
+		return false, nil
 	}
+	if err := cipher.VerifyPubKeySignedPayload(srvPK, resp.raw.Sig(), resp.raw.Object()); err != nil {
+		return false, nil
+	}
+	return true, rejectError(resp.ErrCode)
+}
+
+// SessionRedirect is sent by a dmsg server which is full to redirect a newly established session to alternative
+// dmsg servers. The server sends it over a stream which it opens straight after the session handshake.
+// Field names are distinct from those of StreamRequest, so that one cannot be decoded as the other.
+type SessionRedirect struct {
+	IssuedAt     int64
+	Alternatives []cipher.PubKey // Public keys of less-loaded dmsg servers.
+
+	raw SignedObject `enc:"-"` // back reference.
+}
 
+// Verify verifies the SessionRedirect against the public key of the dmsg server which sent it.
+func (r SessionRedirect) Verify(srvPK cipher.PubKey) error {
+	if err := cipher.VerifyPubKeySignedPayload(srvPK, r.raw.Sig(), r.raw.Object()); err != nil {
+		return ErrSignedObjectInvalid.Wrap(err)
+	}
+	return nil
+}
+
+// SessionAdmission is sent by a dmsg server to admit a newly established session, once the session is registered.
+// It is only sent within sessions of FeatureAdmission, over a stream which the server opens straight after the session
+// handshake. The server sends a SessionRedirect over this stream instead if the session is redirected.
+// Field names are distinct from those of the other signed objects, so that one cannot be decoded as another.
+type SessionAdmission struct {
+	AdmittedAt int64
+
+	raw SignedObject `enc:"-"` // back reference.
+}
+
+// Verify verifies the SessionAdmission against the public key of the dmsg server which sent it.
+func (a SessionAdmission) Verify(srvPK cipher.PubKey) error {
+	if err := cipher.VerifyPubKeySignedPayload(srvPK, a.raw.Sig(), a.raw.Object()); err != nil {
+		return ErrSignedObjectInvalid.Wrap(err)
+	}
+	return nil
+}
+
+// DatagramChannel is sent by a dmsg client over a newly opened stream of a session to turn the stream into a channel
+// which carries datagrams (see PacketConn) in both directions.
+// Field names are distinct from those of the other signed objects, so that one cannot be decoded as another.
+type DatagramChannel struct {
+	OpenedAt int64
+
+	raw SignedObject `enc:"-"` // back reference.
+}
+
+// Verify verifies the DatagramChannel against the public key of the client which opened it.
+func (ch DatagramChannel) Verify(clientPK cipher.PubKey) error {
+	if err := cipher.VerifyPubKeySignedPayload(clientPK, ch.raw.Sig(), ch.raw.Object()); err != nil {
+		return ErrSignedObjectInvalid.Wrap(err)
+	}
 	return nil
 }
 
@@ -0,0 +1,296 @@
+// Package dmsg pkg/dmsg/wire.go
+package dmsg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+)
+
+// Wire versions of the encoding of stream requests and responses (see docs/wire-format.md).
+// The wire version is negotiated per session within the session handshake. Peers which do not negotiate only
+// understand wireGob.
+const (
+	wireGob = uint8(0) // gob encoding
+	wireV1  = uint8(1) // binary encoding
+)
+
+// wireVersions are the wire versions which are supported, other than wireGob.
+var wireVersions = []uint8{wireV1}
+
+// wireMagic is the first byte of objects of the binary encoding.
+// Gob encodings never start with this byte, so objects of both encodings can be told apart.
+const wireMagic = 0xD3
+
+// Kinds of objects of the binary encoding.
+const (
+	wireKindRequest  = uint8(1)
+	wireKindResponse = uint8(2)
+)
+
+// Extension fields of stream requests and responses of the binary encoding.
+const (
+	wireExtFrameSize = uint8(1) // largest noise frame size which the sender accepts on the stream, a 4-byte integer
+	wireExtRekey     = uint8(2) // the sender supports rekeying of the stream, with an empty value
+)
+
+// wireHeaderLen is the length of the header of objects of the binary encoding: [ magic | version | kind ].
+const wireHeaderLen = 3
+
+var (
+	errWireTruncated   = errors.New("wire object is truncated")
+	errWireKind        = errors.New("wire object is of unexpected kind")
+	errWireVersion     = errors.New("wire object is of unsupported version")
+	errWireFieldTooBig = errors.New("wire field is too large")
+)
+
+// negotiateWire returns the latest wire version which is supported by both us and the remote, of which the
+// supported wire versions are given (a byte each). Remotes which do not negotiate only support wireGob.
+func negotiateWire(versions []byte) uint8 {
+	ver := wireGob
+	for _, rv := range versions {
+		for _, lv := range wireVersions {
+			if rv == lv && rv > ver {
+				ver = rv
+			}
+		}
+	}
+	return ver
+}
+
+// isBinaryWire returns true if the encoded object is of the binary encoding.
+func isBinaryWire(obj []byte) bool {
+	return len(obj) > 0 && obj[0] == wireMagic
+}
+
+// encodeStreamRequest encodes the request with the given wire version.
+func encodeStreamRequest(req *StreamRequest, ver uint8) []byte {
+	if ver == wireGob {
+		return encodeGob(req)
+	}
+	b := make([]byte, 0, wireHeaderLen+8+2*(len(cipher.PubKey{})+2)+2+len(req.NoiseMsg))
+	b = append(b, wireMagic, ver, wireKindRequest)
+	b = appendUint64(b, uint64(req.Timestamp))
+	b = appendAddr(b, req.SrcAddr)
+	b = appendAddr(b, req.DstAddr)
+	b = appendBytes(b, req.NoiseMsg)
+	b = appendFrameSizeExt(b, req.frameSize)
+	return appendRekeyExt(b, req.rekey)
+}
+
+// decodeStreamRequest decodes a request of any wire version.
+func decodeStreamRequest(req *StreamRequest, obj []byte) error {
+	if !isBinaryWire(obj) {
+		req.wire = wireGob
+		return decodeGob(req, obj)
+	}
+	r, err := readWireHeader(obj, wireKindRequest)
+	if err != nil {
+		return err
+	}
+	req.wire = obj[1]
+	req.Timestamp = int64(r.uint64())
+	req.SrcAddr = r.addr()
+	req.DstAddr = r.addr()
+	req.NoiseMsg = r.bytes()
+	exts, err := r.extensions()
+	req.frameSize = frameSizeExt(exts)
+	req.rekey = rekeyExt(exts)
+	return err
+}
+
+// encodeStreamResponse encodes the response with the given wire version.
+func encodeStreamResponse(resp *StreamResponse, ver uint8) []byte {
+	if ver == wireGob {
+		return encodeGob(resp)
+	}
+	b := make([]byte, 0, wireHeaderLen+len(cipher.SHA256{})+1+2+2+len(resp.NoiseMsg))
+	b = append(b, wireMagic, ver, wireKindResponse)
+	b = append(b, resp.ReqHash[:]...)
+	if resp.Accepted {
+		b = append(b, 1)
+	} else {
+		b = append(b, 0)
+	}
+	b = appendUint16(b, uint16(resp.ErrCode))
+	b = appendBytes(b, resp.NoiseMsg)
+	b = appendFrameSizeExt(b, resp.frameSize)
+	return appendRekeyExt(b, resp.rekey)
+}
+
+// decodeStreamResponse decodes a response of any wire version.
+func decodeStreamResponse(resp *StreamResponse, obj []byte) error {
+	if !isBinaryWire(obj) {
+		resp.wire = wireGob
+		return decodeGob(resp, obj)
+	}
+	r, err := readWireHeader(obj, wireKindResponse)
+	if err != nil {
+		return err
+	}
+	resp.wire = obj[1]
+	copy(resp.ReqHash[:], r.next(len(cipher.SHA256{})))
+	if accepted := r.next(1); len(accepted) == 1 {
+		resp.Accepted = accepted[0] != 0
+	}
+	resp.ErrCode = errorCode(r.uint16())
+	resp.NoiseMsg = r.bytes()
+	exts, err := r.extensions()
+	resp.frameSize = frameSizeExt(exts)
+	resp.rekey = rekeyExt(exts)
+	return err
+}
+
+// readWireHeader checks the header of an object of the binary encoding, and returns a reader of its fields.
+func readWireHeader(obj []byte, kind uint8) (*wireReader, error) {
+	if len(obj) < wireHeaderLen {
+		return nil, errWireTruncated
+	}
+	if obj[1] == wireGob || obj[1] > wireVersions[len(wireVersions)-1] {
+		return nil, fmt.Errorf("%w: %d", errWireVersion, obj[1])
+	}
+	if obj[2] != kind {
+		return nil, errWireKind
+	}
+	return &wireReader{b: obj[wireHeaderLen:]}, nil
+}
+
+// appendFrameSizeExt appends the frame size extension field, unless the frame size is unset.
+func appendFrameSizeExt(b []byte, frameSize uint32) []byte {
+	if frameSize == 0 {
+		return b
+	}
+	var v [4]byte
+	binary.BigEndian.PutUint32(v[:], frameSize)
+	return appendField(b, wireExtFrameSize, v[:])
+}
+
+// frameSizeExt returns the frame size of the frame size extension field, or 0 if there is none.
+func frameSizeExt(exts map[uint8][]byte) uint32 {
+	if v := exts[wireExtFrameSize]; len(v) == 4 {
+		return binary.BigEndian.Uint32(v)
+	}
+	return 0
+}
+
+// appendRekeyExt appends the rekey extension field, if rekeying is supported.
+func appendRekeyExt(b []byte, rekey bool) []byte {
+	if !rekey {
+		return b
+	}
+	return appendField(b, wireExtRekey, nil)
+}
+
+// rekeyExt returns true if there is the rekey extension field.
+func rekeyExt(exts map[uint8][]byte) bool {
+	_, ok := exts[wireExtRekey]
+	return ok
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendAddr(b []byte, addr Addr) []byte {
+	b = append(b, addr.PK[:]...)
+	return appendUint16(b, addr.Port)
+}
+
+// appendBytes appends the bytes prefixed with their uint16 length.
+func appendBytes(b, p []byte) []byte {
+	if len(p) > 0xFFFF {
+		panic(errWireFieldTooBig)
+	}
+	b = appendUint16(b, uint16(len(p)))
+	return append(b, p...)
+}
+
+// appendField appends a field of format [ type (1 byte) | len (2 bytes) | value ].
+func appendField(b []byte, typ uint8, value []byte) []byte {
+	return appendBytes(append(b, typ), value)
+}
+
+// readFields reads fields of format [ type (1 byte) | len (2 bytes) | value ] until the end of 'b'.
+// Fields of unknown types are kept as is, so that callers can ignore them.
+func readFields(b []byte) (map[uint8][]byte, error) {
+	fields := make(map[uint8][]byte)
+	r := &wireReader{b: b}
+	for len(r.b) > 0 && r.err == nil {
+		typ := r.next(1)
+		value := r.bytes()
+		if r.err == nil {
+			fields[typ[0]] = value
+		}
+	}
+	return fields, r.err
+}
+
+// wireReader reads fields of the binary encoding.
+// Once a read fails, further reads return zero values and finish returns the error.
+type wireReader struct {
+	b   []byte
+	err error
+}
+
+func (r *wireReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.b) < n {
+		r.err = errWireTruncated
+		return nil
+	}
+	p := r.b[:n]
+	r.b = r.b[n:]
+	return p
+}
+
+func (r *wireReader) uint16() uint16 {
+	if p := r.next(2); p != nil {
+		return binary.BigEndian.Uint16(p)
+	}
+	return 0
+}
+
+func (r *wireReader) uint64() uint64 {
+	if p := r.next(8); p != nil {
+		return binary.BigEndian.Uint64(p)
+	}
+	return 0
+}
+
+func (r *wireReader) addr() Addr {
+	var addr Addr
+	copy(addr.PK[:], r.next(len(addr.PK)))
+	addr.Port = r.uint16()
+	return addr
+}
+
+// bytes reads bytes which are prefixed with their uint16 length.
+func (r *wireReader) bytes() []byte {
+	n := r.uint16()
+	if r.err != nil {
+		return nil
+	}
+	if n == 0 {
+		return nil
+	}
+	return r.next(int(n))
+}
+
+// extensions returns the remaining extension fields (of format [ type (1 byte) | len (2 bytes) | value ]), or the
+// error of the reads. Extension fields of unknown types are to be ignored, but must be well-formed.
+func (r *wireReader) extensions() (map[uint8][]byte, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	return readFields(r.b)
+}
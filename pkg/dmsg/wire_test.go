@@ -0,0 +1,175 @@
+// Package dmsg pkg/dmsg/wire_test.go
+package dmsg
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWireFormat(t *testing.T) {
+	pk1, sk1 := GenKeyPair(t, "wire 1")
+	pk2, _ := GenKeyPair(t, "wire 2")
+
+	req := StreamRequest{
+		Timestamp: time.Now().UnixNano(),
+		SrcAddr:   Addr{PK: pk1, Port: 49152},
+		DstAddr:   Addr{PK: pk2, Port: 80},
+		NoiseMsg:  cipher.RandByte(48),
+	}
+	resp := StreamResponse{
+		ReqHash:  cipher.SumSHA256([]byte("request")),
+		Accepted: false,
+		ErrCode:  ErrReqDenied.code,
+		NoiseMsg: cipher.RandByte(48),
+	}
+
+	for _, ver := range []uint8{wireGob, wireV1} {
+		req, resp := req, resp
+
+		obj := makeSignedStreamRequest(&req, sk1, ver)
+		assert.Equal(t, ver != wireGob, isBinaryWire(obj.Object()))
+		gotReq, err := obj.ObtainStreamRequest()
+		require.NoError(t, err)
+		assert.Equal(t, req, gotReq)
+		assert.NoError(t, gotReq.Verify(0))
+
+		obj = makeSignedStreamResponse(&resp, sk1, ver)
+		gotResp, err := obj.ObtainStreamResponse()
+		require.NoError(t, err)
+		assert.Equal(t, resp, gotResp)
+	}
+
+	t.Run("extension_fields", func(t *testing.T) {
+		obj := encodeStreamRequest(&req, wireV1)
+		obj = appendField(obj, 0xFF, []byte("unknown extension"))
+		var got StreamRequest
+		require.NoError(t, decodeStreamRequest(&got, obj))
+		assert.Equal(t, req.DstAddr, got.DstAddr)
+		assert.Equal(t, req.NoiseMsg, got.NoiseMsg)
+
+		// Extension fields must still be well-formed.
+		assert.ErrorIs(t, decodeStreamRequest(&got, append(obj, 0x01, 0x00)), errWireTruncated)
+	})
+
+	t.Run("frame_size", func(t *testing.T) {
+		req, resp := req, resp
+		req.frameSize, resp.frameSize = 16*1024, 32*1024
+
+		var gotReq StreamRequest
+		require.NoError(t, decodeStreamRequest(&gotReq, encodeStreamRequest(&req, wireV1)))
+		assert.Equal(t, req.frameSize, gotReq.frameSize)
+		var gotResp StreamResponse
+		require.NoError(t, decodeStreamResponse(&gotResp, encodeStreamResponse(&resp, wireV1)))
+		assert.Equal(t, resp.frameSize, gotResp.frameSize)
+
+		// Gob cannot carry the frame size.
+		var gobReq StreamRequest
+		require.NoError(t, decodeStreamRequest(&gobReq, encodeStreamRequest(&req, wireGob)))
+		assert.Zero(t, gobReq.frameSize)
+	})
+
+	t.Run("rekey", func(t *testing.T) {
+		var gotReq StreamRequest
+		require.NoError(t, decodeStreamRequest(&gotReq, encodeStreamRequest(&req, wireV1)))
+		assert.False(t, gotReq.rekey)
+
+		req, resp := req, resp
+		req.rekey, resp.rekey = true, true
+
+		require.NoError(t, decodeStreamRequest(&gotReq, encodeStreamRequest(&req, wireV1)))
+		assert.True(t, gotReq.rekey)
+		var gotResp StreamResponse
+		require.NoError(t, decodeStreamResponse(&gotResp, encodeStreamResponse(&resp, wireV1)))
+		assert.True(t, gotResp.rekey)
+
+		// Gob cannot carry support of rekeying.
+		var gobReq StreamRequest
+		require.NoError(t, decodeStreamRequest(&gobReq, encodeStreamRequest(&req, wireGob)))
+		assert.False(t, gobReq.rekey)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		obj := encodeStreamRequest(&req, wireV1)
+		var gotReq StreamRequest
+		assert.ErrorIs(t, decodeStreamRequest(&gotReq, obj[:len(obj)-1]), errWireTruncated)
+
+		var gotResp StreamResponse
+		assert.ErrorIs(t, decodeStreamResponse(&gotResp, obj), errWireKind)
+
+		unknown := append([]byte{wireMagic, 0xFF}, obj[2:]...)
+		assert.ErrorIs(t, decodeStreamRequest(&gotReq, unknown), errWireVersion)
+	})
+}
+
+func TestNegotiateWire(t *testing.T) {
+	assert.Equal(t, wireGob, negotiateWire(nil))
+	assert.Equal(t, wireV1, negotiateWire(wireVersions))
+	assert.Equal(t, wireV1, negotiateWire([]byte{wireV1, 0xFF}))
+	assert.Equal(t, wireGob, negotiateWire([]byte{0xFF}))
+}
+
+// Ensure that stream requests fall back to gob when a session on their route does not support the binary encoding.
+// Arrange:
+// - Dmsg server, and clients 1 and 2 with sessions to the server.
+// - The server's session with client 2 is downgraded to gob (as if client 2 was an older client).
+// Act:
+// - Client 1 dials a stream to client 2.
+// Assert:
+// - All sessions negotiate the binary encoding before the downgrade.
+// - Binary requests to client 2 are rejected with ErrReqUnsupportedWire.
+// - The stream is dialed with a gob-encoded request, and delivers data.
+func TestStreamRequest_WireFallback(t *testing.T) {
+	const port = uint16(80)
+
+	env := newTestEnv(t)
+	srv := env.newServer("wire server", nil)
+	client1 := env.connectClient("wire client 1", &Config{}, srv)
+	client2 := env.connectClient("wire client 2", &Config{}, srv)
+
+	lis, err := client2.Listen(port)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, lis.Close()) }()
+	go func() {
+		for {
+			str, err := lis.AcceptStream()
+			if err != nil {
+				return
+			}
+			go func() { _, _ = io.Copy(str, str) }() //nolint:errcheck
+		}
+	}()
+
+	cSes1, ok := client1.clientSession(client1.porter, srv.LocalPK())
+	require.True(t, ok)
+	assert.Equal(t, wireV1, cSes1.caps.WireVersion)
+
+	var sSes2 *SessionCommon
+	require.Eventually(t, func() bool {
+		sSes2, ok = srv.session(client2.LocalPK())
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, wireV1, sSes2.caps.WireVersion)
+	sSes2.caps.WireVersion = wireGob
+
+	dst := Addr{PK: client2.LocalPK(), Port: port}
+	_, err = cSes1.dialStream(dst, wireV1)
+	assert.ErrorIs(t, err, ErrReqUnsupportedWire)
+
+	str, err := client1.DialStream(context.TODO(), dst)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, str.Close()) }()
+
+	data := []byte("hello over gob")
+	_, err = str.Write(data)
+	require.NoError(t, err)
+	got := make([]byte, len(data))
+	_, err = io.ReadFull(str, got)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+}
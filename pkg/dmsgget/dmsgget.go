@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"time"
@@ -194,7 +195,21 @@ func parseOutputFile(name string, urlPath string) (*os.File, error) {
 
 // StartDmsg create dsmg client instance
 func (dg *DmsgGet) StartDmsg(ctx context.Context, log *logging.Logger, pk cipher.PubKey, sk cipher.SecKey) (dmsgC *dmsg.Client, stop func(), err error) {
-	dmsgC = dmsg.NewClient(pk, sk, disc.NewHTTP(dg.dmsgF.Disc, &http.Client{}, log), &dmsg.Config{MinSessions: dg.dmsgF.Sessions})
+	var proxyURL *url.URL
+	if dg.dmsgF.Proxy != "" {
+		if proxyURL, err = url.Parse(dg.dmsgF.Proxy); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse proxy URL: %w", err)
+		}
+	}
+
+	dc := disc.NewHTTP(dg.dmsgF.Disc, &http.Client{}, log, disc.WithProxy(proxyURL))
+	dmsgC = dmsg.NewClient(pk, sk, dc, &dmsg.Config{
+		MinSessions:      dg.dmsgF.Sessions,
+		Proxy:            proxyURL,
+		PreferredServers: dg.dmsgF.PreferServers,
+		ExcludedServers:  dg.dmsgF.ExcludeServers,
+		StrictServers:    dg.dmsgF.StrictServers,
+	})
 	go dmsgC.Serve(context.Background())
 
 	stop = func() {
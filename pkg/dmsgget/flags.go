@@ -5,6 +5,7 @@ import (
 	"flag"
 
 	"github.com/skycoin/skywire-utilities/pkg/buildinfo"
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
 )
 
 // ExecName contains the execution name.
@@ -33,6 +34,11 @@ func (f *startupFlags) Init(fs *flag.FlagSet) {
 type dmsgFlags struct {
 	Disc     string
 	Sessions int
+	Proxy    string
+
+	PreferServers  cipher.PubKeys
+	ExcludeServers cipher.PubKeys
+	StrictServers  bool
 }
 
 func (f *dmsgFlags) Name() string { return "Dmsg" }
@@ -40,6 +46,10 @@ func (f *dmsgFlags) Name() string { return "Dmsg" }
 func (f *dmsgFlags) Init(fs *flag.FlagSet) {
 	fs.StringVar(&f.Disc, "dmsg-disc", "http://dmsgd.skywire.skycoin.com", "dmsg discovery `URL`")
 	fs.IntVar(&f.Sessions, "dmsg-sessions", 1, "connect to `NUMBER` of dmsg servers")
+	fs.StringVar(&f.Proxy, "proxy", "", "connect to dmsg via SOCKS5 or HTTP CONNECT proxy `URL`")
+	fs.Var(&f.PreferServers, "prefer-servers", "dmsg servers to use before any others")
+	fs.Var(&f.ExcludeServers, "exclude-servers", "dmsg servers to never use")
+	fs.BoolVar(&f.StrictServers, "strict-servers", false, "only use preferred dmsg servers")
 }
 
 type downloadFlags struct {
@@ -15,8 +15,9 @@ var (
 )
 
 // URL represents a dmsg http URL.
+// The host of the URL is either a public key, or a name which is registered in dmsg discovery.
 type URL struct {
-	dmsg.Addr
+	dmsg.NamedAddr
 	url.URL
 }
 
@@ -36,5 +37,5 @@ func (du *URL) Fill(str string) error {
 	}
 
 	du.URL = *u
-	return du.Addr.Set(u.Host)
+	return du.NamedAddr.Set(u.Host)
 }
@@ -33,9 +33,10 @@ func MakeHTTPTransport(ctx context.Context, dmsgC *dmsg.Client) HTTPTransport {
 // RoundTrip implements golang's http package support for alternative HTTP transport protocols.
 // In this case dmsg is used instead of TCP to initiate the communication with the server.
 func (t HTTPTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	var hostAddr dmsg.Addr
-	if err := hostAddr.Set(req.Host); err != nil {
-		return nil, fmt.Errorf("invalid host address: %w", err)
+	// The host may be a name which is registered in dmsg discovery.
+	hostAddr, err := t.dmsgC.ResolveAddr(req.Context(), req.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve host address '%s': %w", req.Host, err)
 	}
 	if hostAddr.Port == 0 {
 		hostAddr.Port = defaultHTTPPort
@@ -96,6 +96,25 @@ func TestHTTPTransport_RoundTrip(t *testing.T) {
 			(<-client3Results).Assert(t, i)
 		}
 	})
+
+	// Ensure that failures to resolve the host are reported as such.
+	// Arrange:
+	// - A dmsg client of a dmsg discovery in which no names are registered.
+	// Act:
+	// - The http client sends a request to a name.
+	// Assert:
+	// - The request fails with a resolution failure, which wraps the error of dmsg discovery.
+	t.Run("unresolved_host", func(t *testing.T) {
+		pk, sk := cipher.GenerateKeyPair()
+		dmsgC := dmsg.NewClient(pk, sk, disc.NewMock(0), &dmsg.Config{})
+		t.Cleanup(func() { _ = dmsgC.Close() }) //nolint:errcheck
+
+		httpC := http.Client{Transport: MakeHTTPTransport(context.Background(), dmsgC)}
+		_, err := httpC.Get("http://unregistered-name:80/") //nolint:bodyclose,noctx
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to resolve host address")
+		assert.ErrorIs(t, err, disc.ErrNameNotFound)
+	})
 }
 
 func startDmsgEnv(t *testing.T, nSrvs, maxSessions int) disc.APIClient {
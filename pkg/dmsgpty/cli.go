@@ -83,6 +83,28 @@ func (cli *CLI) StartRemotePty(ctx context.Context, rPK cipher.PubKey, rPort uin
 	return cli.servePty(ctx, ptyC, cmd, args)
 }
 
+// StartNamedRemotePty starts a pty on a remote host of which the public key is registered to the name in dmsg
+// discovery, proxied via the local pty.
+func (cli *CLI) StartNamedRemotePty(ctx context.Context, rName string, rPort uint16, cmd string, args ...string) error {
+	conn, err := cli.prepareConn()
+	if err != nil {
+		return err
+	}
+
+	ptyC, err := NewNamedProxyClient(conn, rName, rPort)
+	if err != nil {
+		return err
+	}
+
+	restore, err := cli.prepareStdin()
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	return cli.servePty(ctx, ptyC, cmd, args)
+}
+
 // prepareConn prepares a connection with the dmsgpty-host.
 func (cli *CLI) prepareConn() (net.Conn, error) {
 
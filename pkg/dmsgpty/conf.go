@@ -8,6 +8,8 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+
 	dmsg "github.com/skycoin/dmsg/pkg/dmsg"
 )
 
@@ -21,6 +23,11 @@ type Config struct {
 	SK           string   `json:"sk"`
 	PK           string   `json:"pk"`
 	WL           []string `json:"wl"`
+	Proxy        string   `json:"proxy,omitempty"`
+
+	PreferServers  []cipher.PubKey `json:"preferservers,omitempty"`
+	ExcludeServers []cipher.PubKey `json:"excludeservers,omitempty"`
+	StrictServers  bool            `json:"strictservers,omitempty"`
 }
 
 // DefaultConfig is used to populate the config struct with its default values
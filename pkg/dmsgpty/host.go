@@ -3,7 +3,6 @@ package dmsgpty
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -19,6 +18,13 @@ import (
 	dmsg "github.com/skycoin/dmsg/pkg/dmsg"
 )
 
+// RejectCodeNotWhitelisted is the code with which a dmsgpty-host rejects dmsg streams from public keys which are not
+// whitelisted.
+const RejectCodeNotWhitelisted = dmsg.MinRejectCode
+
+// ErrNotWhitelisted is returned when dialing a dmsgpty-host which has not whitelisted the local public key.
+var ErrNotWhitelisted = &dmsg.RejectError{Code: RejectCodeNotWhitelisted}
+
 // Host represents the main instance of dmsgpty.
 type Host struct {
 	dmsgC *dmsg.Client
@@ -101,6 +107,14 @@ func (h *Host) ListenAndServe(ctx context.Context, port uint16) error {
 		log = masterLogger.PackageLogger("dmsg_pty")
 	}
 
+	// Streams from public keys which are not whitelisted are rejected before they are accepted.
+	lis.SetAcceptFilter(func(remote dmsg.Addr) error {
+		if !h.authorize(log.WithField("remote_pk", remote.PK.String()), remote.PK) {
+			return ErrNotWhitelisted
+		}
+		return nil
+	})
+
 	go func() {
 		<-ctx.Done()
 		log.
@@ -129,21 +143,7 @@ func (h *Host) ListenAndServe(ctx context.Context, port uint16) error {
 			return err
 		}
 
-		rPK := stream.RawRemoteAddr().PK
-		log := log.WithField("remote_pk", rPK.String())
-		log.Debug("Processing dmsg.Stream...")
-
-		if !h.authorize(log, rPK) {
-			err := writeResponse(stream,
-				errors.New("dmsg stream rejected by whitelist"))
-			log.WithError(err).Warn()
-
-			if err := stream.Close(); err != nil {
-				log.WithError(err).Warn("Stream closed with error.")
-			}
-			continue
-		}
-
+		log := log.WithField("remote_pk", stream.RawRemoteAddr().PK.String())
 		log = log.WithField("conn_id", atomic.AddInt32(&h.connN, 1))
 		log.Debug("dmsg.Stream accepted.")
 		log = stream.Logger().WithField("dmsgpty", "stream")
@@ -233,8 +233,14 @@ func handleProxy(h *Host) handleFunc {
 		q := uri.Query()
 
 		// Get query values.
+		// The remote host is given either by its public key, or by a name which is registered in dmsg discovery.
 		var pk cipher.PubKey
-		if err := pk.Set(q.Get("pk")); err != nil {
+		if name := q.Get("name"); name != "" {
+			var err error
+			if pk, err = h.dmsgC.ResolveName(ctx, name); err != nil {
+				return fmt.Errorf("failed to resolve query value 'name': %v", err)
+			}
+		} else if err := pk.Set(q.Get("pk")); err != nil {
 			return fmt.Errorf("invalid query value 'pk': %v", err)
 		}
 		var port uint16
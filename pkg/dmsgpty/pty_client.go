@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/rpc"
+	"net/url"
 	"sync"
 
 	"github.com/sirupsen/logrus"
@@ -52,6 +53,23 @@ func NewProxyClient(conn io.ReadWriteCloser, rPK cipher.PubKey, rPort uint16) (*
 	}, nil
 }
 
+// NewNamedProxyClient creates a new pty client that interacts with a remote pty hosted on the given port of the public
+// key which the name is registered to in dmsg discovery. The name is resolved by the local dmsgpty-host.
+func NewNamedProxyClient(conn io.ReadWriteCloser, rName string, rPort uint16) (*PtyClient, error) {
+	uri := fmt.Sprintf("%s?name=%s&port=%d", PtyProxyURI, url.QueryEscape(rName), rPort)
+	if err := writeRequest(conn, uri); err != nil {
+		return nil, err
+	}
+	if err := readResponse(conn); err != nil {
+		return nil, err
+	}
+	return &PtyClient{
+		log:  logging.MustGetLogger("dmsgpty:proxy-client"),
+		rpcC: rpc.NewClient(conn),
+		done: make(chan struct{}),
+	}, nil
+}
+
 // Close closes the pty and closes the connection to the remote.
 func (sc *PtyClient) Close() error {
 	if closed := sc.close(); !closed {
@@ -25,15 +25,45 @@ const (
 type Config struct {
 	Path string `json:"-"`
 
-	PubKey         cipher.PubKey `json:"public_key"`
-	SecKey         cipher.SecKey `json:"secret_key"`
-	Discovery      string        `json:"discovery"`
-	PublicAddress  string        `json:"public_address"`
-	LocalAddress   string        `json:"local_address"`
-	HTTPAddress    string        `json:"health_endpoint_address"`
-	LogLevel       string        `json:"log_level"`
-	UpdateInterval time.Duration `json:"update_interval"`
-	MaxSessions    int           `json:"max_sessions"`
+	PubKey                 cipher.PubKey `json:"public_key"`
+	SecKey                 cipher.SecKey `json:"secret_key"`
+	Discovery              string        `json:"discovery"`
+	PublicAddress          string        `json:"public_address"`
+	LocalAddress           string        `json:"local_address"`
+	HTTPAddress            string        `json:"health_endpoint_address"`
+	PublicWebSocketAddress string        `json:"public_websocket_address"`
+	LogLevel               string        `json:"log_level"`
+	UpdateInterval         time.Duration `json:"update_interval"`
+	MaxSessions            int           `json:"max_sessions"`
+	ForwardStreams         bool          `json:"forward_streams"`
+
+	// Peers are the dmsg servers which streams are forwarded to and accepted from.
+	// If empty, any dmsg server which is registered in discovery is a peer.
+	Peers []cipher.PubKey `json:"peers,omitempty"`
+
+	// Per-client limits (zero values disable the associated limit).
+	MaxStreamsPerClient     int     `json:"max_streams_per_client,omitempty"`
+	StreamRequestsPerSecond float64 `json:"stream_requests_per_second,omitempty"`
+	StreamRequestsBurst     int     `json:"stream_requests_burst,omitempty"`
+	BytesPerSecond          int64   `json:"bytes_per_second,omitempty"`
+	BytesBurst              int     `json:"bytes_burst,omitempty"`
+
+	// Rekeying of the noise cipher states of sessions (zero values disable the associated threshold).
+	// Clients must support rekeying, so it is disabled by default.
+	RekeyBytes    uint64        `json:"rekey_bytes,omitempty"`
+	RekeyInterval time.Duration `json:"rekey_interval,omitempty"`
+
+	// ACLFile is the path of the JSON file containing the access control list rules of the server.
+	// The file is reloaded when the server receives SIGHUP.
+	ACLFile string `json:"acl_file,omitempty"`
+
+	// DrainTimeout is the maximum duration in which the server drains (waits for streams to finish while clients
+	// migrate to other servers) when it receives SIGINT or SIGTERM. If zero, the server closes immediately.
+	DrainTimeout time.Duration `json:"drain_timeout,omitempty"`
+
+	// AdminPKs are the public keys which may sign requests to the admin endpoints of the server api (see the
+	// 'dmsg-server admin' commands). The admin endpoints are disabled if empty.
+	AdminPKs []cipher.PubKey `json:"admin_pks,omitempty"`
 }
 
 // GenerateDefaultConfig generate default config for dmsg-server
@@ -49,6 +79,7 @@ func GenerateDefaultConfig(c *Config) {
 	c.HTTPAddress = defaultHTTPAddress
 	c.LogLevel = "info"
 	c.MaxSessions = 2048
+	c.ForwardStreams = true
 }
 
 // Flush trying to save config file
@@ -0,0 +1,276 @@
+// Package dmsgsocks pkg/dmsgsocks/dmsgsocks.go
+package dmsgsocks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"golang.org/x/net/proxy"
+
+	dmsg "github.com/skycoin/dmsg/pkg/dmsg"
+)
+
+// Defaults of HostConfig.
+const (
+	DefaultPort              = uint16(1080)
+	DefaultMaxConnsPerClient = 32
+)
+
+// Rejections of streams to a Host.
+var (
+	ErrNotWhitelisted = &dmsg.RejectError{Code: dmsg.MinRejectCode}
+	ErrConnLimit      = &dmsg.RejectError{Code: dmsg.MinRejectCode + 1}
+)
+
+// Errors of a Host.
+var (
+	ErrNoWhitelist      = errors.New("socks host requires a whitelist, unless all public keys are allowed")
+	ErrTargetNotAllowed = errors.New("target address is not allowed")
+)
+
+// HostConfig configures a Host.
+type HostConfig struct {
+	// Port is the dmsg port which the SOCKS5 proxy is served on.
+	Port uint16
+
+	// Whitelist contains the public keys which are allowed to use the proxy.
+	// The proxy is not served with an empty whitelist, unless AllowAll is set.
+	Whitelist []cipher.PubKey
+
+	// AllowAll allows all public keys to use the proxy if the whitelist is empty, which makes it an open proxy.
+	AllowAll bool
+
+	// AllowLocal allows targets of loopback, link-local and unspecified addresses, which reach the host itself and
+	// its local link.
+	AllowLocal bool
+
+	// MaxConnsPerClient is the maximum number of concurrent connections of a single public key. Zero is unlimited.
+	MaxConnsPerClient int
+}
+
+// DefaultHostConfig returns the default host config.
+func DefaultHostConfig() HostConfig {
+	return HostConfig{
+		Port:              DefaultPort,
+		MaxConnsPerClient: DefaultMaxConnsPerClient,
+	}
+}
+
+// Host serves a SOCKS5 proxy on a dmsg port, of which connections egress from the network of the host.
+type Host struct {
+	dmsgC *dmsg.Client
+	conf  HostConfig
+	srv   *Server
+	log   logrus.FieldLogger
+
+	conns map[cipher.PubKey]int // number of connections per public key
+	mx    sync.Mutex
+}
+
+// NewHost creates a Host which serves the SOCKS5 proxy over the dmsg client.
+func NewHost(dmsgC *dmsg.Client, conf HostConfig, log logrus.FieldLogger) *Host {
+	var dialer net.Dialer
+	if !conf.AllowLocal {
+		dialer.Control = refuseLocal
+	}
+	return &Host{
+		dmsgC: dmsgC,
+		conf:  conf,
+		srv:   NewServer(dialer.DialContext, nil, log),
+		log:   log,
+		conns: make(map[cipher.PubKey]int),
+	}
+}
+
+// ListenAndServe serves the SOCKS5 proxy on the dmsg port of the config, until the context is canceled.
+// It returns ErrNoWhitelist if the whitelist is empty and AllowAll is not set.
+func (h *Host) ListenAndServe(ctx context.Context) error {
+	if len(h.conf.Whitelist) == 0 && !h.conf.AllowAll {
+		return ErrNoWhitelist
+	}
+
+	lis, err := h.dmsgC.Listen(h.conf.Port)
+	if err != nil {
+		return err
+	}
+
+	// Streams of public keys which are not whitelisted, or which reached the connection limit, are rejected before
+	// they are accepted.
+	lis.SetAcceptFilter(func(remote dmsg.Addr) error {
+		if !h.allowed(remote.PK) {
+			return ErrNotWhitelisted
+		}
+		if !h.belowLimit(remote.PK) {
+			return ErrConnLimit
+		}
+		return nil
+	})
+
+	go func() {
+		<-ctx.Done()
+		if err := lis.Close(); err != nil {
+			h.log.WithError(err).Debug("Failed to close listener.")
+		}
+	}()
+	h.log.WithField("dmsg_addr", lis.Addr().String()).Info("Serving SOCKS5 proxy.")
+
+	for {
+		stream, err := lis.AcceptStream()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		pk := stream.RawRemoteAddr().PK
+		log := h.log.WithField("remote_pk", pk.String())
+
+		// The filter may pass concurrent streams of the same public key, so the limit is enforced again.
+		if !h.acquire(pk) {
+			log.Debug("Closed stream of public key which reached the connection limit.")
+			_ = stream.Close() //nolint:errcheck
+			continue
+		}
+		go func() {
+			defer h.release(pk)
+			log.WithError(h.srv.ServeConn(ctx, stream)).Debug("Connection closed.")
+		}()
+	}
+}
+
+// Conns returns the number of connections of the public key.
+func (h *Host) Conns(pk cipher.PubKey) int {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	return h.conns[pk]
+}
+
+func (h *Host) allowed(pk cipher.PubKey) bool {
+	if len(h.conf.Whitelist) == 0 {
+		return h.conf.AllowAll
+	}
+	for _, wlPK := range h.conf.Whitelist {
+		if wlPK == pk {
+			return true
+		}
+	}
+	return false
+}
+
+// refuseLocal is the control function of the dialer of a Host, which refuses connections to local addresses.
+// Addresses are checked once they are resolved, so that names of local addresses are refused too.
+func refuseLocal(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		host = host[:i] // zone of link-local IPv6 addresses
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s", ErrTargetNotAllowed, host)
+	}
+	return nil
+}
+
+func (h *Host) belowLimit(pk cipher.PubKey) bool {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	return h.conf.MaxConnsPerClient <= 0 || h.conns[pk] < h.conf.MaxConnsPerClient
+}
+
+func (h *Host) acquire(pk cipher.PubKey) bool {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	if h.conf.MaxConnsPerClient > 0 && h.conns[pk] >= h.conf.MaxConnsPerClient {
+		return false
+	}
+	h.conns[pk]++
+	return true
+}
+
+func (h *Host) release(pk cipher.PubKey) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	if h.conns[pk]--; h.conns[pk] <= 0 {
+		delete(h.conns, pk)
+	}
+}
+
+// Frontend serves a local SOCKS5 proxy, which tunnels CONNECT requests to the SOCKS5 proxy of a remote Host.
+type Frontend struct {
+	remote string
+	srv    *Server
+	log    logrus.FieldLogger
+}
+
+// NewFrontend creates a Frontend which tunnels CONNECT requests to the Host of the remote dmsg address, which is of
+// format '<pk|name>[:port]'. If the address has no port, DefaultPort is used.
+func NewFrontend(dmsgC *dmsg.Client, remote string, log logrus.FieldLogger) (*Frontend, error) {
+	var addr dmsg.NamedAddr
+	if err := addr.Set(remote); err != nil {
+		return nil, err
+	}
+	if addr.Port == 0 {
+		addr.Port = DefaultPort
+	}
+
+	// CONNECT requests are sent to the Host by a SOCKS5 client, which dials the Host over dmsg.
+	dialer, err := proxy.SOCKS5("dmsg", addr.String(), nil, streamDialer{dmsgC: dmsgC})
+	if err != nil {
+		return nil, err
+	}
+	return &Frontend{
+		remote: addr.String(),
+		srv:    NewServer(dialer.(proxy.ContextDialer).DialContext, frontendReply, log),
+		log:    log,
+	}, nil
+}
+
+// Serve accepts local connections from the listener, until the context is canceled.
+func (f *Frontend) Serve(ctx context.Context, lis net.Listener) error {
+	f.log.WithField("addr", lis.Addr().String()).WithField("remote", f.remote).Info("Serving local SOCKS5 proxy.")
+	return f.srv.Serve(ctx, lis)
+}
+
+// streamDialer dials streams to dmsg addresses of format '<pk|name>:port'.
+type streamDialer struct {
+	dmsgC *dmsg.Client
+}
+
+// Dial implements proxy.Dialer
+func (d streamDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext implements proxy.ContextDialer
+func (d streamDialer) DialContext(ctx context.Context, _, addr string) (net.Conn, error) {
+	dAddr, err := d.dmsgC.ResolveAddr(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	return d.dmsgC.DialStream(ctx, dAddr)
+}
+
+// frontendReply relays the reply of the remote Host, and replies to rejected streams as not allowed.
+func frontendReply(err error) byte {
+	if errors.Is(err, dmsg.ErrReqRejected) {
+		return replyNotAllowed
+	}
+	// Errors of SOCKS5 clients of x/net/proxy only contain the message of the reply code.
+	for code, msg := range replyMessages {
+		if strings.HasSuffix(err.Error(), "unknown error "+msg) {
+			return code
+		}
+	}
+	return replyGeneralFailure
+}
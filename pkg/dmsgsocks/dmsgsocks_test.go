@@ -0,0 +1,182 @@
+// Package dmsgsocks pkg/dmsgsocks/dmsgsocks_test.go
+package dmsgsocks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/skycoin/skywire-utilities/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/proxy"
+
+	dmsg "github.com/skycoin/dmsg/pkg/dmsg"
+	"github.com/skycoin/dmsg/pkg/dmsgtest"
+)
+
+// Ensure that CONNECT requests are tunneled from a local SOCKS5 front-end to the SOCKS5 proxy of a host.
+// Arrange:
+// - A dmsg environment with clients A, B and H, of which H is the host (which only whitelists A and B).
+// - A TCP echo server on the loopback address, which is reached through the host (which allows local targets).
+// Act:
+// - Clients A, B and C connect to the echo server via local front-ends.
+// Assert:
+// - Data is echoed through the proxy.
+// - Connections beyond the per-client connection limit are not allowed.
+// - Connections of public keys which are not whitelisted are not allowed.
+// - Hosts without a whitelist are not served, unless all public keys are allowed.
+func TestHost(t *testing.T) {
+	env := dmsgtest.NewEnv(t, dmsgtest.DefaultTimeout)
+	require.NoError(t, env.Startup(0, 1, 4, nil))
+	t.Cleanup(env.Shutdown)
+	clients := env.AllClients()
+	dcA, dcB, dcC, dcH := clients[0], clients[1], clients[2], clients[3]
+
+	echoLis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, echoLis.Close()) }()
+	go func() {
+		for {
+			conn, err := echoLis.Accept()
+			if err != nil {
+				return
+			}
+			go func() { _, _ = io.Copy(conn, conn) }() //nolint:errcheck
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	host := NewHost(dcH, HostConfig{
+		Port:              DefaultPort,
+		Whitelist:         []cipher.PubKey{dcA.LocalPK(), dcB.LocalPK()},
+		MaxConnsPerClient: 1,
+		AllowLocal:        true,
+	}, logging.MustGetLogger("socks_host"))
+	hostErr := make(chan error, 1)
+	go func() { hostErr <- host.ListenAndServe(ctx) }()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-hostErr)
+	}()
+
+	// newDialer serves a local front-end of the client, and returns a SOCKS5 dialer of it.
+	newDialer := func(c *dmsg.Client) proxy.Dialer {
+		f, err := NewFrontend(c, dcH.LocalPK().Hex(), logging.MustGetLogger("socks_frontend"))
+		require.NoError(t, err)
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		go func() { _ = f.Serve(ctx, lis) }() //nolint:errcheck
+
+		dialer, err := proxy.SOCKS5("tcp", lis.Addr().String(), nil, proxy.Direct)
+		require.NoError(t, err)
+		return dialer
+	}
+	echo := func(t *testing.T, conn net.Conn, msg string) {
+		_, err := conn.Write([]byte(msg))
+		require.NoError(t, err)
+		buf := make([]byte, len(msg))
+		_, err = io.ReadFull(conn, buf)
+		require.NoError(t, err)
+		assert.Equal(t, msg, string(buf))
+	}
+
+	dialerA, dialerB := newDialer(dcA), newDialer(dcB)
+
+	// The host may not be listening yet.
+	var connA net.Conn
+	require.Eventually(t, func() bool {
+		connA, err = dialerA.Dial("tcp", echoLis.Addr().String())
+		return err == nil
+	}, 10*time.Second, 50*time.Millisecond)
+	echo(t, connA, "hello from A")
+
+	t.Run("conn_limit", func(t *testing.T) {
+		_, err := dialerA.Dial("tcp", echoLis.Addr().String())
+		assert.Error(t, err)
+
+		// Other clients have their own limits.
+		connB, err := dialerB.Dial("tcp", echoLis.Addr().String())
+		require.NoError(t, err)
+		echo(t, connB, "hello from B")
+		assert.NoError(t, connB.Close())
+
+		// Closing the connection frees it up for another one.
+		assert.NoError(t, connA.Close())
+		require.Eventually(t, func() bool { return host.Conns(dcA.LocalPK()) == 0 }, 5*time.Second, 10*time.Millisecond)
+		connA, err = dialerA.Dial("tcp", echoLis.Addr().String())
+		require.NoError(t, err)
+		echo(t, connA, "hello again from A")
+		assert.NoError(t, connA.Close())
+	})
+
+	t.Run("not_whitelisted", func(t *testing.T) {
+		_, err := newDialer(dcC).Dial("tcp", echoLis.Addr().String())
+		assert.Error(t, err)
+	})
+
+	t.Run("no_whitelist", func(t *testing.T) {
+		err := NewHost(dcH, HostConfig{Port: DefaultPort + 1}, logging.MustGetLogger("socks_host")).ListenAndServe(ctx)
+		assert.ErrorIs(t, err, ErrNoWhitelist)
+	})
+
+	t.Run("connection_refused", func(t *testing.T) {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := lis.Addr().String()
+		require.NoError(t, lis.Close())
+
+		_, err = dialerB.Dial("tcp", addr)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "connection refused")
+	})
+}
+
+func TestFrontendReply(t *testing.T) {
+	cases := []struct {
+		err  error
+		want byte
+	}{
+		{err: errors.New("socks connect tcp 127.0.0.1:1080->example.com:80: unknown error host unreachable"), want: replyHostUnreachable},
+		{err: errors.New("socks connect tcp 127.0.0.1:1080->127.0.0.1:80: unknown error connection not allowed by ruleset"), want: replyNotAllowed},
+		{err: fmt.Errorf("dial: %w", ErrNotWhitelisted), want: replyNotAllowed},
+		{err: dmsg.ErrReqRejected, want: replyNotAllowed},
+		{err: dmsg.ErrCannotConnectToDelegated, want: replyGeneralFailure},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, frontendReply(tc.err), tc.err.Error())
+	}
+}
+
+func TestRefuseLocal(t *testing.T) {
+	cases := []struct {
+		addr    string
+		refused bool
+	}{
+		{addr: "127.0.0.1:80", refused: true},
+		{addr: "127.1.2.3:80", refused: true},
+		{addr: "[::1]:80", refused: true},
+		{addr: "0.0.0.0:80", refused: true},
+		{addr: "[::]:80", refused: true},
+		{addr: "169.254.169.254:80", refused: true},
+		{addr: "[fe80::1%eth0]:80", refused: true},
+		{addr: "1.1.1.1:80", refused: false},
+		{addr: "[2606:4700::1111]:80", refused: false},
+	}
+	for _, tc := range cases {
+		err := refuseLocal("tcp", tc.addr, nil)
+		if tc.refused {
+			assert.ErrorIs(t, err, ErrTargetNotAllowed, tc.addr)
+			assert.Equal(t, byte(replyNotAllowed), netReply(err), tc.addr)
+		} else {
+			assert.NoError(t, err, tc.addr)
+		}
+	}
+}
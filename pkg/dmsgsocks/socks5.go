@@ -0,0 +1,255 @@
+// Package dmsgsocks pkg/dmsgsocks/socks5.go
+package dmsgsocks
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skycoin/skywire-utilities/pkg/netutil"
+)
+
+// SOCKS5 protocol values (RFC 1928).
+const (
+	socksVersion = 0x05
+
+	methodNoAuth       = 0x00
+	methodNoAcceptable = 0xFF
+
+	cmdConnect = 0x01
+
+	atypIPv4   = 0x01
+	atypDomain = 0x03
+	atypIPv6   = 0x04
+)
+
+// Reply codes of SOCKS5 requests.
+const (
+	replySucceeded           = 0x00
+	replyGeneralFailure      = 0x01
+	replyNotAllowed          = 0x02
+	replyNetworkUnreachable  = 0x03
+	replyHostUnreachable     = 0x04
+	replyConnectionRefused   = 0x05
+	replyTTLExpired          = 0x06
+	replyCmdNotSupported     = 0x07
+	replyAddrTypeUnsupported = 0x08
+)
+
+// replyMessages are the messages of failure reply codes, as of x/net/internal/socks.
+var replyMessages = map[byte]string{
+	replyGeneralFailure:      "general SOCKS server failure",
+	replyNotAllowed:          "connection not allowed by ruleset",
+	replyNetworkUnreachable:  "network unreachable",
+	replyHostUnreachable:     "host unreachable",
+	replyConnectionRefused:   "connection refused",
+	replyTTLExpired:          "TTL expired",
+	replyCmdNotSupported:     "command not supported",
+	replyAddrTypeUnsupported: "address type not supported",
+}
+
+// HandshakeTimeout is the duration in which the client of a SOCKS5 connection must complete its request.
+const HandshakeTimeout = 30 * time.Second
+
+// Errors of SOCKS5 requests.
+var (
+	ErrInvalidVersion      = errors.New("invalid socks version")
+	ErrNoAcceptableMethod  = errors.New("no acceptable socks authentication method")
+	ErrCmdNotSupported     = errors.New("socks command not supported")
+	ErrAddrTypeUnsupported = errors.New("socks address type not supported")
+)
+
+// DialFunc dials the target address of a SOCKS5 CONNECT request.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// ReplyFunc returns the SOCKS5 reply code of an error of a DialFunc.
+type ReplyFunc func(err error) byte
+
+// Server serves SOCKS5 connections, which are limited to the CONNECT command without authentication.
+type Server struct {
+	dial  DialFunc
+	reply ReplyFunc
+	log   logrus.FieldLogger
+}
+
+// NewServer creates a SOCKS5 server which dials targets with 'dial'.
+// If 'reply' is nil, dial errors are replied with codes of network errors.
+func NewServer(dial DialFunc, reply ReplyFunc, log logrus.FieldLogger) *Server {
+	if reply == nil {
+		reply = netReply
+	}
+	return &Server{
+		dial:  dial,
+		reply: reply,
+		log:   log,
+	}
+}
+
+// Serve accepts connections from the listener, and serves them until the context is canceled.
+// The listener is closed once the context is canceled.
+func (s *Server) Serve(ctx context.Context, lis net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		if err := lis.Close(); err != nil {
+			s.log.WithError(err).Debug("Failed to close listener.")
+		}
+	}()
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			log := s.log.WithField("remote_addr", conn.RemoteAddr().String())
+			log.WithError(s.ServeConn(ctx, conn)).Debug("Connection closed.")
+		}()
+	}
+}
+
+// ServeConn serves a single SOCKS5 connection, and closes it once it is done.
+func (s *Server) ServeConn(ctx context.Context, conn net.Conn) error {
+	target, err := s.handshake(conn)
+	if err != nil {
+		_ = conn.Close() //nolint:errcheck
+		return err
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, HandshakeTimeout)
+	tConn, err := s.dial(dialCtx, "tcp", target)
+	cancel()
+	if err != nil {
+		_ = writeReply(conn, s.reply(err)) //nolint:errcheck
+		_ = conn.Close()                   //nolint:errcheck
+		return fmt.Errorf("failed to dial '%s': %w", target, err)
+	}
+	if err := writeReply(conn, replySucceeded); err != nil {
+		_ = conn.Close()  //nolint:errcheck
+		_ = tConn.Close() //nolint:errcheck
+		return err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		_ = conn.Close()  //nolint:errcheck
+		_ = tConn.Close() //nolint:errcheck
+		return err
+	}
+
+	s.log.WithField("target", target).Debug("Forwarding connection.")
+	return netutil.CopyReadWriteCloser(conn, tConn)
+}
+
+// handshake negotiates the authentication method, and reads the request of the client.
+// It returns the target address of a CONNECT request.
+func (s *Server) handshake(conn net.Conn) (string, error) {
+	if err := conn.SetDeadline(time.Now().Add(HandshakeTimeout)); err != nil {
+		return "", err
+	}
+
+	// Greeting: VER, NMETHODS, METHODS.
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(conn, hdr); err != nil {
+		return "", err
+	}
+	if hdr[0] != socksVersion {
+		return "", ErrInvalidVersion
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+	method := byte(methodNoAcceptable)
+	for _, m := range methods {
+		if m == methodNoAuth {
+			method = methodNoAuth
+		}
+	}
+	if _, err := conn.Write([]byte{socksVersion, method}); err != nil {
+		return "", err
+	}
+	if method == methodNoAcceptable {
+		return "", ErrNoAcceptableMethod
+	}
+
+	// Request: VER, CMD, RSV, ATYP, DST.ADDR, DST.PORT.
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return "", err
+	}
+	if req[0] != socksVersion {
+		return "", ErrInvalidVersion
+	}
+
+	var host string
+	switch req[3] {
+	case atypIPv4, atypIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if req[3] == atypIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case atypDomain:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return "", err
+		}
+		domain := make([]byte, n[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		_ = writeReply(conn, replyAddrTypeUnsupported) //nolint:errcheck
+		return "", ErrAddrTypeUnsupported
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", err
+	}
+	if req[1] != cmdConnect {
+		_ = writeReply(conn, replyCmdNotSupported) //nolint:errcheck
+		return "", ErrCmdNotSupported
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// writeReply writes a reply of the given code. The bound address is always reported as '0.0.0.0:0'.
+func writeReply(conn net.Conn, code byte) error {
+	_, err := conn.Write([]byte{socksVersion, code, 0x00, atypIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// netReply returns the reply code of an error of dialing a target over the network.
+func netReply(err error) byte {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrTargetNotAllowed):
+		return replyNotAllowed
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return replyConnectionRefused
+	case errors.Is(err, syscall.ENETUNREACH):
+		return replyNetworkUnreachable
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return replyHostUnreachable
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return replyTTLExpired
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return replyHostUnreachable
+	}
+	return replyGeneralFailure
+}
@@ -0,0 +1,87 @@
+// Package dmsgtest pkg/dmsgtest/dmsg_server_test.go
+package dmsgtest
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	dmsg "github.com/skycoin/dmsg/pkg/dmsg"
+)
+
+// Ensure that clients which are delegated to different dmsg servers can reach one another.
+// Arrange:
+// - Dmsg environment of two servers (which forward streams).
+// - Client A delegated to server 0 and client B delegated to server 1.
+// Act:
+// - Each client dials a stream to the other.
+// Assert:
+// - Streams are established via the dialing client's server and data passes through both ways.
+func TestServer_ForwardStreams(t *testing.T) {
+	const port = uint16(22)
+
+	env := NewEnv(t, DefaultTimeout)
+	require.NoError(t, env.Startup(0, 2, 0, nil))
+	t.Cleanup(env.Shutdown)
+
+	srvs := env.AllServers()
+	require.Len(t, srvs, 2)
+
+	cA := newDelegatedClient(t, env, srvs[0].LocalPK())
+	cB := newDelegatedClient(t, env, srvs[1].LocalPK())
+
+	check := func(t *testing.T, src, dst *dmsg.Client, srvPK cipher.PubKey) {
+		lis, err := dst.Listen(port)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, lis.Close()) }()
+
+		srcStr, err := src.DialStream(context.TODO(), dmsg.Addr{PK: dst.LocalPK(), Port: port})
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, srcStr.Close()) }()
+		require.Equal(t, srvPK, srcStr.ServerPK())
+
+		dstStr, err := lis.AcceptStream()
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, dstStr.Close()) }()
+		require.Equal(t, src.LocalPK(), dstStr.RawRemoteAddr().PK)
+
+		for _, pair := range [][2]io.ReadWriter{{srcStr, dstStr}, {dstStr, srcStr}} {
+			data := cipher.RandByte(1024)
+			_, err := pair[0].Write(data)
+			require.NoError(t, err)
+
+			readData := make([]byte, len(data))
+			_, err = io.ReadFull(pair[1], readData)
+			require.NoError(t, err)
+			require.Equal(t, data, readData)
+		}
+	}
+
+	t.Run("A_to_B", func(t *testing.T) { check(t, cA, cB, srvs[0].LocalPK()) })
+	t.Run("B_to_A", func(t *testing.T) { check(t, cB, cA, srvs[1].LocalPK()) })
+}
+
+// newDelegatedClient creates a client which only has a session with the server of the given public key.
+func newDelegatedClient(t *testing.T, env *Env, srvPK cipher.PubKey) *dmsg.Client {
+	ctx, cancel := timeoutContext(DefaultTimeout)
+	defer cancel()
+
+	pk, sk := cipher.GenerateKeyPair()
+	c := dmsg.NewClient(pk, sk, env.Discovery(), nil)
+	t.Cleanup(func() { assert.NoError(t, c.Close()) })
+
+	entry, err := env.Discovery().Entry(ctx, srvPK)
+	require.NoError(t, err)
+	require.NoError(t, c.EnsureSession(ctx, entry))
+
+	select {
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	case <-c.Ready():
+	}
+	return c
+}
@@ -90,6 +90,7 @@ func (env *Env) newServer(ctx context.Context, updateInterval time.Duration) (*d
 	conf := dmsg.ServerConfig{
 		MaxSessions:    maxSessions,
 		UpdateInterval: updateInterval,
+		ForwardStreams: true,
 	}
 	srv := dmsg.NewServer(pk, sk, env.d, &conf, nil)
 	env.s[pk] = srv
@@ -0,0 +1,183 @@
+// Package dmsgtunnel pkg/dmsgtunnel/config.go
+package dmsgtunnel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+
+	dmsg "github.com/skycoin/dmsg/pkg/dmsg"
+)
+
+// defaultBindHost is the host which forwards bind to (or connect to) if none is specified.
+const defaultBindHost = "127.0.0.1"
+
+// ErrNoWhitelist occurs if a remote forward has no whitelist, and is not public.
+var ErrNoWhitelist = errors.New("remote forward requires a whitelist, unless it is public")
+
+// Config configures the forwards of a tunnel.
+type Config struct {
+	// Local forwards connections of local TCP addresses to remote dmsg addresses.
+	Local []LocalForward `json:"local,omitempty"`
+
+	// Remote exposes local TCP services on dmsg ports.
+	Remote []RemoteForward `json:"remote,omitempty"`
+}
+
+// LocalForward forwards connections to a local TCP address, to a remote dmsg address (like 'ssh -L').
+type LocalForward struct {
+	// Listen is the local TCP address which connections are accepted from.
+	Listen string `json:"listen"`
+
+	// Remote is the dmsg address which connections are forwarded to, of format '<pk|name>:<port>'.
+	Remote string `json:"remote"`
+}
+
+// RemoteForward exposes a local TCP service on a dmsg port (like 'ssh -R').
+type RemoteForward struct {
+	// Port is the dmsg port which streams are accepted from.
+	Port uint16 `json:"port"`
+
+	// Target is the local TCP address which streams are forwarded to.
+	Target string `json:"target"`
+
+	// Whitelist contains the public keys which are allowed to connect.
+	// A remote forward with an empty whitelist is not served, unless it is public.
+	Whitelist []cipher.PubKey `json:"whitelist,omitempty"`
+
+	// Public allows all public keys to connect if the whitelist is empty, which exposes the target to the whole dmsg
+	// network.
+	Public bool `json:"public,omitempty"`
+}
+
+// ReadConfig reads a JSON-encoded Config from the file of the given path.
+func ReadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	var conf Config
+	if err := json.Unmarshal(b, &conf); err != nil {
+		return nil, fmt.Errorf("failed to decode config file '%s': %w", path, err)
+	}
+	return &conf, nil
+}
+
+// Validate checks if the Config is valid.
+func (c *Config) Validate() error {
+	if len(c.Local) == 0 && len(c.Remote) == 0 {
+		return errors.New("no forwards are configured")
+	}
+	for _, fwd := range c.Local {
+		if err := fwd.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, fwd := range c.Remote {
+		if err := fwd.Validate(); err != nil {
+			return err
+		}
+		if !fwd.restricted() {
+			return fmt.Errorf("%w: %s", ErrNoWhitelist, fwd)
+		}
+	}
+	return nil
+}
+
+// ParseLocalForward parses a local forward of format '[bind_address:]port:<pk|name>:dmsg_port'.
+func ParseLocalForward(s string) (LocalForward, error) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return LocalForward{}, fmt.Errorf("invalid local forward '%s'", s)
+	}
+	j := strings.LastIndex(s[:i], ":")
+	if j < 0 {
+		return LocalForward{}, fmt.Errorf("invalid local forward '%s'", s)
+	}
+
+	fwd := LocalForward{Listen: withHost(s[:j]), Remote: s[j+1:]}
+	return fwd, fwd.Validate()
+}
+
+// Validate checks if the LocalForward is valid.
+func (f LocalForward) Validate() error {
+	if _, _, err := net.SplitHostPort(f.Listen); err != nil {
+		return fmt.Errorf("invalid listen address of local forward: %w", err)
+	}
+	var addr dmsg.NamedAddr
+	if err := addr.Set(f.Remote); err != nil {
+		return fmt.Errorf("invalid remote address of local forward: %w", err)
+	}
+	if addr.Port == 0 {
+		return fmt.Errorf("remote address '%s' of local forward has no port", f.Remote)
+	}
+	return nil
+}
+
+// String implements fmt.Stringer
+func (f LocalForward) String() string {
+	return fmt.Sprintf("%s -> %s", f.Listen, f.Remote)
+}
+
+// ParseRemoteForward parses a remote forward of format 'dmsg_port:[host:]port'.
+func ParseRemoteForward(s string) (RemoteForward, error) {
+	i := strings.Index(s, ":")
+	if i < 0 {
+		return RemoteForward{}, fmt.Errorf("invalid remote forward '%s'", s)
+	}
+	port, err := strconv.ParseUint(s[:i], 10, 16)
+	if err != nil {
+		return RemoteForward{}, fmt.Errorf("invalid dmsg port of remote forward '%s': %w", s, err)
+	}
+
+	fwd := RemoteForward{Port: uint16(port), Target: withHost(s[i+1:])}
+	return fwd, fwd.Validate()
+}
+
+// Validate checks if the RemoteForward is valid.
+func (f RemoteForward) Validate() error {
+	if f.Port == 0 {
+		return errors.New("remote forward has no dmsg port")
+	}
+	if _, _, err := net.SplitHostPort(f.Target); err != nil {
+		return fmt.Errorf("invalid target address of remote forward: %w", err)
+	}
+	return nil
+}
+
+// String implements fmt.Stringer
+func (f RemoteForward) String() string {
+	return fmt.Sprintf("dmsg port %d -> %s", f.Port, f.Target)
+}
+
+// restricted returns true if the forward has a whitelist, or is explicitly public.
+func (f RemoteForward) restricted() bool {
+	return len(f.Whitelist) > 0 || f.Public
+}
+
+// allowed returns true if the public key is allowed to connect.
+func (f RemoteForward) allowed(pk cipher.PubKey) bool {
+	if len(f.Whitelist) == 0 {
+		return f.Public
+	}
+	for _, wlPK := range f.Whitelist {
+		if wlPK == pk {
+			return true
+		}
+	}
+	return false
+}
+
+// withHost prepends the default bind host to an address which is only a port.
+func withHost(addr string) string {
+	if !strings.Contains(addr, ":") {
+		return net.JoinHostPort(defaultBindHost, addr)
+	}
+	return addr
+}
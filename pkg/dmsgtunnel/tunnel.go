@@ -0,0 +1,226 @@
+// Package dmsgtunnel pkg/dmsgtunnel/tunnel.go
+package dmsgtunnel
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skycoin/skywire-utilities/pkg/netutil"
+
+	dmsg "github.com/skycoin/dmsg/pkg/dmsg"
+)
+
+// Timeouts of a tunnel.
+const (
+	// DialTimeout is the duration in which a stream of a local forward must be established.
+	// Dials are retried within the timeout, so that connections survive while the dmsg client reconnects sessions.
+	DialTimeout = 30 * time.Second
+
+	// TargetDialTimeout is the duration in which the connection to the target of a remote forward must be established.
+	TargetDialTimeout = 10 * time.Second
+)
+
+// Backoffs of retries.
+const (
+	retryInitBO = time.Second
+	retryMaxBO  = 20 * time.Second
+)
+
+// ErrNotWhitelisted is the rejection of streams from public keys which are not whitelisted by a remote forward.
+var ErrNotWhitelisted = &dmsg.RejectError{Code: dmsg.MinRejectCode}
+
+// Tunnel forwards TCP connections over dmsg.
+type Tunnel struct {
+	dmsgC *dmsg.Client
+	conf  Config
+	log   logrus.FieldLogger
+}
+
+// New creates a tunnel which serves the forwards of 'conf' over the dmsg client.
+func New(dmsgC *dmsg.Client, conf Config, log logrus.FieldLogger) *Tunnel {
+	return &Tunnel{
+		dmsgC: dmsgC,
+		conf:  conf,
+		log:   log,
+	}
+}
+
+// Serve serves all forwards of the tunnel until the context is canceled.
+// It returns early if the local address of a local forward cannot be listened on.
+func (t *Tunnel) Serve(ctx context.Context) error {
+	if err := t.conf.Validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errCh := make(chan error, len(t.conf.Local)+len(t.conf.Remote))
+	var wg sync.WaitGroup
+
+	for _, fwd := range t.conf.Local {
+		lis, err := net.Listen("tcp", fwd.Listen)
+		if err != nil {
+			cancel()
+			wg.Wait()
+			return err
+		}
+		wg.Add(1)
+		go func(fwd LocalForward) {
+			defer wg.Done()
+			errCh <- t.ServeLocal(ctx, lis, fwd)
+		}(fwd)
+	}
+	for _, fwd := range t.conf.Remote {
+		wg.Add(1)
+		go func(fwd RemoteForward) {
+			defer wg.Done()
+			errCh <- t.ServeRemote(ctx, fwd)
+		}(fwd)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errCh:
+	}
+	cancel()
+	wg.Wait()
+	return err
+}
+
+// ServeLocal accepts TCP connections from the listener, and forwards them to the remote dmsg address of the forward.
+// The listener is closed once the context is canceled.
+func (t *Tunnel) ServeLocal(ctx context.Context, lis net.Listener, fwd LocalForward) error {
+	log := t.log.WithField("local_forward", fwd.String())
+	log.Info("Serving local forward.")
+
+	go func() {
+		<-ctx.Done()
+		if err := lis.Close(); err != nil {
+			log.WithError(err).Debug("Failed to close listener.")
+		}
+	}()
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go t.forwardLocal(ctx, log.WithField("remote_addr", conn.RemoteAddr().String()), conn, fwd)
+	}
+}
+
+func (t *Tunnel) forwardLocal(ctx context.Context, log logrus.FieldLogger, conn net.Conn, fwd LocalForward) {
+	dialCtx, cancel := context.WithTimeout(ctx, DialTimeout)
+	defer cancel()
+
+	var stream *dmsg.Stream
+	var dialErr error
+	err := netutil.NewRetrier(log, retryInitBO, retryMaxBO, 0, netutil.DefaultFactor).
+		WithErrWhitelist(dmsg.ErrReqRejected, dmsg.ErrEntityClosed).
+		Do(dialCtx, func() error {
+			addr, err := t.dmsgC.ResolveAddr(dialCtx, fwd.Remote)
+			if err == nil {
+				stream, err = t.dmsgC.DialStream(dialCtx, addr)
+			}
+			// Rejections (which may have application-defined codes) are not retried.
+			if dialErr = err; errors.Is(err, dmsg.ErrReqRejected) {
+				return dmsg.ErrReqRejected
+			}
+			return err
+		})
+	if err != nil {
+		if dialErr == nil {
+			dialErr = err
+		}
+		log.WithError(dialErr).Warn("Failed to dial remote dmsg address.")
+		if err := conn.Close(); err != nil {
+			log.WithError(err).Debug("Failed to close connection.")
+		}
+		return
+	}
+
+	log = log.WithField("stream", stream.RawLocalAddr().String())
+	log.Debug("Forwarding connection.")
+	log.WithError(netutil.CopyReadWriteCloser(conn, stream)).Debug("Connection closed.")
+}
+
+// ServeRemote accepts streams on the dmsg port of the forward, and forwards them to the local target address.
+// Listening is retried (with backoff) if it fails, or if the listener stops accepting streams before the context is
+// canceled. It returns ErrNoWhitelist if the forward has no whitelist, and is not public.
+func (t *Tunnel) ServeRemote(ctx context.Context, fwd RemoteForward) error {
+	log := t.log.WithField("remote_forward", fwd.String())
+	if !fwd.restricted() {
+		return ErrNoWhitelist
+	}
+	if len(fwd.Whitelist) == 0 {
+		log.Warn("Remote forward is public: all public keys of the dmsg network can connect to its target.")
+	}
+
+	return netutil.NewRetrier(log, retryInitBO, retryMaxBO, 0, netutil.DefaultFactor).
+		WithErrWhitelist(dmsg.ErrEntityClosed).
+		Do(ctx, func() error {
+			err := t.serveRemote(ctx, log, fwd)
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		})
+}
+
+func (t *Tunnel) serveRemote(ctx context.Context, log logrus.FieldLogger, fwd RemoteForward) error {
+	lis, err := t.dmsgC.Listen(fwd.Port)
+	if err != nil {
+		return err
+	}
+	lis.SetAcceptFilter(func(remote dmsg.Addr) error {
+		if !fwd.allowed(remote.PK) {
+			log.WithField("remote_pk", remote.PK).Debug("Rejected stream of public key which is not whitelisted.")
+			return ErrNotWhitelisted
+		}
+		return nil
+	})
+	log.Info("Serving remote forward.")
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		if err := lis.Close(); err != nil {
+			log.WithError(err).Debug("Failed to close listener.")
+		}
+	}()
+
+	for {
+		stream, err := lis.AcceptStream()
+		if err != nil {
+			return err
+		}
+		go t.forwardRemote(log.WithField("remote_addr", stream.RawRemoteAddr().String()), stream, fwd)
+	}
+}
+
+func (t *Tunnel) forwardRemote(log logrus.FieldLogger, stream *dmsg.Stream, fwd RemoteForward) {
+	conn, err := net.DialTimeout("tcp", fwd.Target, TargetDialTimeout)
+	if err != nil {
+		log.WithError(err).Warn("Failed to dial target address.")
+		if err := stream.Close(); err != nil {
+			log.WithError(err).Debug("Failed to close stream.")
+		}
+		return
+	}
+
+	log.Debug("Forwarding stream.")
+	log.WithError(netutil.CopyReadWriteCloser(stream, conn)).Debug("Stream closed.")
+}
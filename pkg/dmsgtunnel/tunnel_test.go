@@ -0,0 +1,167 @@
+// Package dmsgtunnel pkg/dmsgtunnel/tunnel_test.go
+package dmsgtunnel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/skycoin/skywire-utilities/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	dmsg "github.com/skycoin/dmsg/pkg/dmsg"
+	"github.com/skycoin/dmsg/pkg/dmsgtest"
+)
+
+func TestParseForwards(t *testing.T) {
+	pk, _ := cipher.GenerateKeyPair()
+
+	local, err := ParseLocalForward("5432:" + pk.Hex() + ":80")
+	require.NoError(t, err)
+	assert.Equal(t, LocalForward{Listen: "127.0.0.1:5432", Remote: pk.Hex() + ":80"}, local)
+
+	local, err = ParseLocalForward("0.0.0.0:5432:my-db:80")
+	require.NoError(t, err)
+	assert.Equal(t, LocalForward{Listen: "0.0.0.0:5432", Remote: "my-db:80"}, local)
+
+	_, err = ParseLocalForward("5432:my-db")
+	assert.Error(t, err)
+
+	remote, err := ParseRemoteForward("80:5432")
+	require.NoError(t, err)
+	assert.Equal(t, RemoteForward{Port: 80, Target: "127.0.0.1:5432"}, remote)
+
+	remote, err = ParseRemoteForward("80:db.local:5432")
+	require.NoError(t, err)
+	assert.Equal(t, RemoteForward{Port: 80, Target: "db.local:5432"}, remote)
+
+	_, err = ParseRemoteForward("0:5432")
+	assert.Error(t, err)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	pk, _ := cipher.GenerateKeyPair()
+
+	conf := Config{Remote: []RemoteForward{{Port: 80, Target: "127.0.0.1:5432"}}}
+	assert.ErrorIs(t, conf.Validate(), ErrNoWhitelist)
+
+	conf.Remote[0].Whitelist = []cipher.PubKey{pk}
+	assert.NoError(t, conf.Validate())
+
+	conf.Remote[0].Whitelist, conf.Remote[0].Public = nil, true
+	assert.NoError(t, conf.Validate())
+}
+
+// Ensure that TCP connections are forwarded over dmsg.
+// Arrange:
+// - A dmsg environment with clients A and B.
+// - A TCP echo server which is exposed by a remote forward of client B.
+// - A local forward of client A to the remote forward of client B.
+// Act:
+// - Connections are made to the local forward.
+// Assert:
+// - Data is echoed through the forwards.
+// - Connections of public keys which are not whitelisted by the remote forward are closed.
+func TestTunnel(t *testing.T) {
+	const port = uint16(5432)
+
+	env := dmsgtest.NewEnv(t, dmsgtest.DefaultTimeout)
+	require.NoError(t, env.Startup(0, 1, 2, nil))
+	t.Cleanup(env.Shutdown)
+	dcA, dcB := env.AllClients()[0], env.AllClients()[1]
+
+	echoLis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, echoLis.Close()) }()
+	go func() {
+		for {
+			conn, err := echoLis.Accept()
+			if err != nil {
+				return
+			}
+			go func() { _, _ = io.Copy(conn, conn) }() //nolint:errcheck
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	serve := func(c *dmsg.Client, conf Config) chan error {
+		errCh := make(chan error, 1)
+		go func() { errCh <- New(c, conf, logging.MustGetLogger("tunnel")).Serve(ctx) }()
+		return errCh
+	}
+	serveLocal := func(fwd LocalForward) string {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		go func() {
+			_ = New(dcA, Config{}, logging.MustGetLogger("tunnel")).ServeLocal(ctx, lis, fwd) //nolint:errcheck
+		}()
+		return lis.Addr().String()
+	}
+
+	errB := serve(dcB, Config{Remote: []RemoteForward{
+		{Port: port, Target: echoLis.Addr().String(), Public: true},
+		{Port: port + 1, Target: echoLis.Addr().String(), Whitelist: []cipher.PubKey{dcB.LocalPK()}},
+	}})
+	defer func() {
+		cancel()
+		assert.NoError(t, <-errB)
+	}()
+
+	t.Run("forward", func(t *testing.T) {
+		addr := serveLocal(LocalForward{Remote: fmt.Sprintf("%s:%d", dcB.LocalPK(), port)})
+
+		for i := 0; i < 3; i++ {
+			conn := dialEventually(t, addr)
+
+			msg := []byte(fmt.Sprintf("hello %d", i))
+			_, err := conn.Write(msg)
+			require.NoError(t, err)
+			buf := make([]byte, len(msg))
+			_, err = io.ReadFull(conn, buf)
+			require.NoError(t, err)
+			assert.Equal(t, msg, buf)
+			assert.NoError(t, conn.Close())
+		}
+	})
+
+	t.Run("not_whitelisted", func(t *testing.T) {
+		addr := serveLocal(LocalForward{Remote: fmt.Sprintf("%s:%d", dcB.LocalPK(), port+1)})
+
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, conn.Close()) }()
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(10*time.Second)))
+		_, err = conn.Read(make([]byte, 1))
+		assert.Equal(t, io.EOF, err)
+	})
+}
+
+// dialEventually dials the local forward, and retries until data is echoed (the remote forward may not be listening
+// yet).
+func dialEventually(t *testing.T, addr string) net.Conn {
+	var conn net.Conn
+	require.Eventually(t, func() bool {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		if _, err := c.Write([]byte{0}); err != nil {
+			_ = c.Close() //nolint:errcheck
+			return false
+		}
+		if _, err := io.ReadFull(c, make([]byte, 1)); err != nil {
+			_ = c.Close() //nolint:errcheck
+			return false
+		}
+		conn = c
+		return true
+	}, 10*time.Second, 50*time.Millisecond)
+	return conn
+}
@@ -35,6 +35,14 @@ var (
 	//	<- e, ee, se
 	HandshakeKK = noise.HandshakeKK
 
+	// HandshakeK is the one-way K handshake pattern.
+	// 		legend: s(static) e(ephemeral)
+	//	-> s
+	//	<- s
+	//	...
+	//	-> e, es, ss
+	HandshakeK = noise.HandshakeK
+
 	// AcceptHandshakeTimeout determines how long a noise hs should take.
 	AcceptHandshakeTimeout = time.Second * 10
 )
@@ -6,6 +6,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/skycoin/noise"
 	"github.com/skycoin/skywire-utilities/pkg/cipher"
@@ -26,6 +27,7 @@ type Config struct {
 	LocalSK   cipher.SecKey // Local instance static secret key.
 	RemotePK  cipher.PubKey // Remote instance static public key.
 	Initiator bool          // Whether the local instance initiates the connection.
+	Rekey     RekeyConfig   // When the local instance rekeys its encrypting cipher state.
 }
 
 // Noise handles the handshake and the frame's cryptography.
@@ -42,6 +44,18 @@ type Noise struct {
 
 	encNonce uint64 // increment after encryption
 	decNonce uint64 // expect increment with each subsequent packet
+
+	rekey      RekeyConfig
+	encBytes   uint64               // plaintext bytes encrypted since the last rekey
+	encKeyedAt time.Time            // time of the last rekey (or of the handshake)
+	encEpoch   uint64               // number of times enc is rekeyed
+	decEpoch   uint64               // number of times dec is rekeyed
+	decPrev    []*noise.CipherState // dec of previous epochs, latest first (only kept for DecryptWithNonceMap)
+	decKeyedAt time.Time            // time of the last rekey of dec
+	decFrames  uint64               // frames decrypted with dec since its last rekey
+
+	localPayload  []byte // sent within handshake messages
+	remotePayload []byte // received within handshake messages
 }
 
 // New creates a new Noise with:
@@ -72,6 +86,7 @@ func New(pattern noise.HandshakePattern, config Config) (*Noise, error) {
 		init:    config.Initiator,
 		pattern: pattern,
 		hs:      hs,
+		rekey:   config.Rekey,
 	}, nil
 }
 
@@ -102,25 +117,43 @@ func (ns *Noise) GetDecNonce() uint64 {
 // MakeHandshakeMessage generates handshake message for a current handshake state.
 func (ns *Noise) MakeHandshakeMessage() (res []byte, err error) {
 	if ns.hs.MessageIndex() < len(ns.pattern.Messages)-1 {
-		res, _, _, err = ns.hs.WriteMessage(nil, nil)
+		res, _, _, err = ns.hs.WriteMessage(nil, ns.localPayload)
 		return
 	}
 
-	res, ns.dec, ns.enc, err = ns.hs.WriteMessage(nil, nil)
+	res, ns.dec, ns.enc, err = ns.hs.WriteMessage(nil, ns.localPayload)
+	ns.encKeyedAt = time.Now()
 	return res, err
 }
 
 // ProcessHandshakeMessage processes a received handshake message and appends the payload.
 func (ns *Noise) ProcessHandshakeMessage(msg []byte) (err error) {
+	var payload []byte
 	if ns.hs.MessageIndex() < len(ns.pattern.Messages)-1 {
-		_, _, _, err = ns.hs.ReadMessage(nil, msg)
-		return
+		payload, _, _, err = ns.hs.ReadMessage(nil, msg)
+	} else {
+		payload, ns.enc, ns.dec, err = ns.hs.ReadMessage(nil, msg)
+		ns.encKeyedAt = time.Now()
+	}
+	if err == nil && len(payload) > 0 {
+		ns.remotePayload = payload
 	}
-
-	_, ns.enc, ns.dec, err = ns.hs.ReadMessage(nil, msg)
 	return err
 }
 
+// SetHandshakePayload sets the payload which is sent within the handshake messages that are made afterwards.
+// Payloads are encrypted once the handshake state has a key (i.e. from the first message of the XK pattern).
+// Remote instances which do not expect payloads ignore them.
+func (ns *Noise) SetHandshakePayload(payload []byte) {
+	ns.localPayload = payload
+}
+
+// RemoteHandshakePayload returns the payload of the last received handshake message which has one.
+// It is nil if the remote sent no payloads.
+func (ns *Noise) RemoteHandshakePayload() []byte {
+	return ns.remotePayload
+}
+
 // HandshakeFinished indicate whether handshake was completed.
 func (ns *Noise) HandshakeFinished() bool {
 	return ns.hs.MessageIndex() == len(ns.pattern.Messages)
@@ -143,30 +176,54 @@ func (ns *Noise) RemoteStatic() cipher.PubKey {
 // EncryptUnsafe encrypts plaintext without interlocking, should only
 // be used with external lock.
 func (ns *Noise) EncryptUnsafe(plaintext []byte) []byte {
+	return ns.EncryptUnsafeTo(make([]byte, 0, authSize+len(plaintext)), plaintext)
+}
+
+// EncryptUnsafeTo is EncryptUnsafe, but appends the nonce and ciphertext to 'dst'.
+// If 'dst' has the capacity, the plaintext is encrypted into it without allocating (i.e. into a preallocated frame).
+func (ns *Noise) EncryptUnsafeTo(dst, plaintext []byte) []byte {
 	ns.encNonce++
-	buf := make([]byte, nonceSize)
-	binary.BigEndian.PutUint64(buf, ns.encNonce)
-	return append(buf, ns.enc.Cipher().Encrypt(nil, ns.encNonce, nil, plaintext)...)
+	ns.encBytes += uint64(len(plaintext))
+	seq := ns.encNonce | epochBits(ns.encEpoch)
+	var nonce [nonceSize]byte
+	binary.BigEndian.PutUint64(nonce[:], seq)
+	return ns.enc.Cipher().Encrypt(append(dst, nonce[:]...), seq, nil, plaintext)
 }
 
 // DecryptUnsafe decrypts ciphertext without interlocking, should only
 // be used with external lock.
+// Rekey frames are decrypted to an empty plaintext, and rekey the decrypting cipher state.
 func (ns *Noise) DecryptUnsafe(ciphertext []byte) ([]byte, error) {
+	return ns.decryptUnsafe(ciphertext, false)
+}
+
+// DecryptUnsafeInPlace is DecryptUnsafe, but decrypts into the storage of the ciphertext, which is overwritten.
+func (ns *Noise) DecryptUnsafeInPlace(ciphertext []byte) ([]byte, error) {
+	return ns.decryptUnsafe(ciphertext, true)
+}
+
+func (ns *Noise) decryptUnsafe(ciphertext []byte, inPlace bool) ([]byte, error) {
 	if len(ciphertext) < nonceSize {
 		return nil, ErrInvalidCipherText
 	}
 	recvSeq := binary.BigEndian.Uint64(ciphertext[:nonceSize])
-	if recvSeq <= ns.decNonce {
-		return nil, fmt.Errorf("received decryption nonce (%d) is not larger than previous (%d)", recvSeq, ns.decNonce)
+	seq := recvSeq & seqMask
+	if seq <= ns.decNonce {
+		return nil, fmt.Errorf("received decryption nonce (%d) is not larger than previous (%d)", seq, ns.decNonce)
+	}
+	ns.decNonce = seq
+	var dst []byte
+	if inPlace {
+		dst = ciphertext[nonceSize:nonceSize]
 	}
-	ns.decNonce = recvSeq
-	return ns.dec.Cipher().Decrypt(nil, recvSeq, nil, ciphertext[nonceSize:])
+	return ns.decrypt(dst, recvSeq, ciphertext[nonceSize:], 0)
 }
 
 // NonceMap is a map of used nonces.
 type NonceMap map[uint64]struct{}
 
 // DecryptWithNonceMap is equivalent to DecryptNonce, instead it uses NonceMap to track nonces instead of a counter.
+// As frames may be decrypted out of order, frames of recent previous epochs are still decrypted after a rekey.
 func (ns *Noise) DecryptWithNonceMap(nm NonceMap, ciphertext []byte) ([]byte, error) {
 	if len(ciphertext) < nonceSize {
 		return nil, ErrInvalidCipherText
@@ -175,5 +232,5 @@ func (ns *Noise) DecryptWithNonceMap(nm NonceMap, ciphertext []byte) ([]byte, er
 	if _, ok := nm[recvSeq]; ok {
 		return nil, fmt.Errorf("received decryption nonce (%d) is repeated", recvSeq)
 	}
-	return ns.dec.Cipher().Decrypt(nil, recvSeq, nil, ciphertext[nonceSize:])
+	return ns.decrypt(nil, recvSeq, ciphertext[nonceSize:], rekeyWindow)
 }
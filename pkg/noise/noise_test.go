@@ -138,3 +138,31 @@ func TestXKAndSecp256k1(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, []byte("baz"), decrypted)
 }
+
+func TestNoise_HandshakePayload(t *testing.T) {
+	pkI, skI := cipher.GenerateKeyPair()
+	pkR, skR := cipher.GenerateKeyPair()
+
+	nI, err := XKAndSecp256k1(Config{LocalPK: pkI, LocalSK: skI, RemotePK: pkR, Initiator: true})
+	require.NoError(t, err)
+	nR, err := XKAndSecp256k1(Config{LocalPK: pkR, LocalSK: skR, Initiator: false})
+	require.NoError(t, err)
+
+	// The responder sends no payload (as if it was an older instance).
+	nI.SetHandshakePayload([]byte("initiator payload"))
+
+	for !nI.HandshakeFinished() || !nR.HandshakeFinished() {
+		msg, err := nI.MakeHandshakeMessage()
+		require.NoError(t, err)
+		require.NoError(t, nR.ProcessHandshakeMessage(msg))
+		if nR.HandshakeFinished() {
+			break
+		}
+		msg, err = nR.MakeHandshakeMessage()
+		require.NoError(t, err)
+		require.NoError(t, nI.ProcessHandshakeMessage(msg))
+	}
+
+	assert.Equal(t, []byte("initiator payload"), nR.RemoteHandshakePayload())
+	assert.Nil(t, nI.RemoteHandshakePayload())
+}
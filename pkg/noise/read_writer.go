@@ -9,6 +9,7 @@ import (
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/skycoin/skywire-utilities/pkg/cipher"
@@ -16,19 +17,32 @@ import (
 	"github.com/skycoin/dmsg/pkg/ioutil"
 )
 
-// MaxWriteSize is the largest amount for a single write.
+// MaxWriteSize is the largest payload of a single frame of DefaultFrameSize.
 const MaxWriteSize = maxPayloadSize
 
-// Frame format: [ len (2 bytes) | auth & nonce (24 bytes) | payload (<= maxPayloadSize bytes) ]
+// Frame format: [ len (2 bytes) | auth & nonce (24 bytes) | payload (<= frame size - 26 bytes) ]
 const (
-	maxFrameSize   = 4096                                 // maximum frame size (4096)
-	maxPayloadSize = maxFrameSize - prefixSize - authSize // maximum payload size
-	maxPrefixValue = maxFrameSize - prefixSize            // maximum value contained in the 'len' prefix
+	// DefaultFrameSize is the size of frames which are written by a ReadWriter, unless it is set with SetFrameSize.
+	// Remotes of all versions accept frames of this size.
+	DefaultFrameSize = 4096
+	// MaxFrameSize is the largest frame size. ReadWriters accept frames of up to this size.
+	MaxFrameSize = 64 * 1024
+
+	maxPayloadSize = DefaultFrameSize - prefixSize - authSize // maximum payload size of frames of DefaultFrameSize
+	maxPrefixValue = DefaultFrameSize - prefixSize            // maximum value contained in the 'len' prefix of raw frames
 
 	prefixSize = 2  // len prefix size
 	authSize   = 24 // noise auth data size
 )
 
+// framePool contains buffers of MaxFrameSize, which frames are encrypted into and decrypted in.
+var framePool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, MaxFrameSize)
+		return &b
+	},
+}
+
 type timeoutError struct{}
 
 func (timeoutError) Error() string   { return "deadline exceeded" }
@@ -46,30 +60,72 @@ func (e *netError) Timeout() bool   { return e.timeout }
 func (e *netError) Temporary() bool { return e.temp }
 func (e *netError) Unwrap() error   { return e.err }
 
+// Stats contains the traffic statistics of a ReadWriter.
+// Bytes are payload (plaintext) bytes, frames are noise frames. The handshake is not included.
+type Stats struct {
+	BytesSent      uint64
+	BytesReceived  uint64
+	FramesSent     uint64
+	FramesReceived uint64
+	LastActivity   time.Time // zero if no frames are sent or received yet
+}
+
 // ReadWriter implements noise encrypted read writer.
 type ReadWriter struct {
+	// atomic requires 64-bit alignment for struct field access
+	bytesSent      uint64
+	bytesReceived  uint64
+	framesSent     uint64
+	framesReceived uint64
+	lastActivity   int64 // unix nano
+
 	origin io.ReadWriter
 	ns     *Noise
 
 	rawInput *bufio.Reader
 	input    bytes.Buffer
+	frame    *[]byte // frame which is being read (from framePool)
+	frameN   int     // number of bytes of frame which are read
 
 	rErr error
 	rMx  sync.Mutex
 
-	wErr error
-	wMx  sync.Mutex
+	wErr      error
+	wMx       sync.Mutex
+	frameSize int // size of written frames
 }
 
 // NewReadWriter constructs a new ReadWriter.
 func NewReadWriter(rw io.ReadWriter, ns *Noise) *ReadWriter {
 	return &ReadWriter{
-		origin:   rw,
-		ns:       ns,
-		rawInput: bufio.NewReaderSize(rw, maxFrameSize*2), // can fit 2 frames.
+		origin:    rw,
+		ns:        ns,
+		rawInput:  bufio.NewReaderSize(rw, DefaultFrameSize*2), // can fit 2 frames of the default size.
+		frameSize: DefaultFrameSize,
 	}
 }
 
+// SetFrameSize sets the size of frames which are written, which is bounded by DefaultFrameSize and MaxFrameSize.
+// Frames larger than DefaultFrameSize should only be written if the remote is known to accept them.
+func (rw *ReadWriter) SetFrameSize(size int) {
+	if size < DefaultFrameSize {
+		size = DefaultFrameSize
+	}
+	if size > MaxFrameSize {
+		size = MaxFrameSize
+	}
+	rw.wMx.Lock()
+	rw.frameSize = size
+	rw.wMx.Unlock()
+}
+
+// FrameSize returns the size of frames which are written.
+func (rw *ReadWriter) FrameSize() int {
+	rw.wMx.Lock()
+	defer rw.wMx.Unlock()
+	return rw.frameSize
+}
+
 func (rw *ReadWriter) Read(p []byte) (int, error) {
 	rw.rMx.Lock()
 	defer rw.rMx.Unlock()
@@ -83,24 +139,79 @@ func (rw *ReadWriter) Read(p []byte) (int, error) {
 	}
 
 	for {
-		ciphertext, err := ReadRawFrame(rw.rawInput)
+		ciphertext, err := rw.readFrame()
 		if err != nil {
 			return 0, rw.processReadError(err)
 		}
 
-		plaintext, err := rw.ns.DecryptUnsafe(ciphertext)
+		// The frame is decrypted in place, and released once the plaintext is read.
+		plaintext, err := rw.ns.DecryptUnsafeInPlace(ciphertext)
 		if err != nil {
+			rw.releaseFrame()
 			return 0, rw.processReadError(err)
 		}
+		atomic.AddUint64(&rw.framesReceived, 1)
+		atomic.AddUint64(&rw.bytesReceived, uint64(len(plaintext)))
+		atomic.StoreInt64(&rw.lastActivity, time.Now().UnixNano())
 
+		// Rekey frames have no payload.
 		if len(plaintext) == 0 {
+			rw.releaseFrame()
 			continue
 		}
 
-		return ioutil.BufRead(&rw.input, plaintext, p)
+		n, err := ioutil.BufRead(&rw.input, plaintext, p)
+		rw.releaseFrame()
+		return n, err
 	}
 }
 
+// readFrame reads the next frame of up to MaxFrameSize into a buffer of framePool, and returns its contents.
+// Frames which are partially read (i.e. as the read deadline is exceeded) are resumed by the next call.
+func (rw *ReadWriter) readFrame() ([]byte, error) {
+	if rw.frame == nil {
+		rw.frame = framePool.Get().(*[]byte)
+		rw.frameN = 0
+	}
+	if err := rw.fillFrame(prefixSize); err != nil {
+		return nil, err
+	}
+
+	// obtain payload size
+	prefix := int(binary.BigEndian.Uint16(*rw.frame))
+	if prefix > MaxFrameSize-prefixSize {
+		return nil, &netError{
+			err:     fmt.Errorf("noise prefix value %dB exceeds maximum %dB", prefix, MaxFrameSize-prefixSize),
+			timeout: false,
+			temp:    false,
+		}
+	}
+
+	if err := rw.fillFrame(prefixSize + prefix); err != nil {
+		return nil, err
+	}
+	return (*rw.frame)[prefixSize : prefixSize+prefix], nil
+}
+
+// fillFrame reads into the frame until it has 'n' bytes.
+func (rw *ReadWriter) fillFrame(n int) error {
+	for rw.frameN < n {
+		m, err := rw.rawInput.Read((*rw.frame)[rw.frameN:n])
+		rw.frameN += m
+		if err != nil && rw.frameN < n {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseFrame returns the frame which is read to framePool.
+func (rw *ReadWriter) releaseFrame() {
+	framePool.Put(rw.frame)
+	rw.frame = nil
+	rw.frameN = 0
+}
+
 // processReadError processes error before returning.
 // * Ensure error implements net.Error
 // * If error is non-temporary, save error in state so further reads will fail.
@@ -134,20 +245,38 @@ func (rw *ReadWriter) Write(p []byte) (n int, err error) {
 		return 0, err
 	}
 
-	p = p[:]
+	// Frames are encrypted into a buffer of framePool.
+	bufP := framePool.Get().(*[]byte)
+	defer framePool.Put(bufP)
+	maxPayload := rw.frameSize - prefixSize - authSize
 
 	for len(p) > 0 {
-		// Enforce max frame size.
+		// Enforce frame size.
 		wn := len(p)
-		if len(p) > maxPayloadSize {
-			wn = maxPayloadSize
+		if len(p) > maxPayload {
+			wn = maxPayload
 		}
 
-		wb, err := WriteRawFrame(rw.origin, rw.ns.EncryptUnsafe(p[:wn]))
+		if rw.ns.RekeyDue() {
+			if _, err := WriteRawFrame(rw.origin, rw.ns.RekeyUnsafe()); err != nil {
+				// the remote cannot decrypt further frames without the rekey frame, so the error is permanent
+				rw.wErr = &netError{
+					err:     fmt.Errorf("failed to write rekey frame: %w", err),
+					timeout: false,
+					temp:    false,
+				}
+				return n, rw.wErr
+			}
+			atomic.AddUint64(&rw.framesSent, 1)
+		}
+
+		frame := rw.ns.EncryptUnsafeTo((*bufP)[:prefixSize], p[:wn])
+		binary.BigEndian.PutUint16(frame, uint16(len(frame)-prefixSize))
+		wn2, err := rw.origin.Write(frame)
 		if err != nil {
 			// when a short write occurs, it is hard to recover from so we
 			// consider it a permanent error
-			if len(wb) != 0 {
+			if wn2 != 0 {
 				err = &netError{
 					err:     fmt.Errorf("%v: %w", io.ErrShortWrite, err),
 					timeout: false,
@@ -164,6 +293,10 @@ func (rw *ReadWriter) Write(p []byte) (n int, err error) {
 			return n, err
 		}
 
+		atomic.AddUint64(&rw.framesSent, 1)
+		atomic.AddUint64(&rw.bytesSent, uint64(wn))
+		atomic.StoreInt64(&rw.lastActivity, time.Now().UnixNano())
+
 		n += wn
 		p = p[wn:]
 	}
@@ -190,11 +323,33 @@ func (rw *ReadWriter) Handshake(hsTimeout time.Duration) error {
 	}
 }
 
+// Stats returns the traffic statistics of the ReadWriter.
+func (rw *ReadWriter) Stats() Stats {
+	stats := Stats{
+		BytesSent:      atomic.LoadUint64(&rw.bytesSent),
+		BytesReceived:  atomic.LoadUint64(&rw.bytesReceived),
+		FramesSent:     atomic.LoadUint64(&rw.framesSent),
+		FramesReceived: atomic.LoadUint64(&rw.framesReceived),
+	}
+	if t := atomic.LoadInt64(&rw.lastActivity); t != 0 {
+		stats.LastActivity = time.Unix(0, t)
+	}
+	return stats
+}
+
 // Buffered returns the number of bytes that can be read from the buffer rawInput.
 func (rw *ReadWriter) Buffered() int {
 	return rw.rawInput.Buffered()
 }
 
+// Drain returns and discards the bytes that are buffered in rawInput.
+// This is useful when the underlying io.ReadWriter is to be used directly after the handshake.
+func (rw *ReadWriter) Drain() []byte {
+	b := make([]byte, rw.rawInput.Buffered())
+	n, _ := rw.rawInput.Read(b) //nolint:errcheck
+	return b[:n]
+}
+
 // LocalStatic returns the local static public key.
 func (rw *ReadWriter) LocalStatic() cipher.PubKey {
 	return rw.ns.LocalStatic()
@@ -2,7 +2,9 @@
 package noise
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"net"
 	"testing"
 	"time"
@@ -214,3 +216,148 @@ func TestReadWriterXKPattern(t *testing.T) {
 	assert.Equal(t, 3, n)
 	assert.Equal(t, []byte("bar"), buf)
 }
+
+// Ensure that frames of all sizes are written and read.
+// Arrange:
+// - ReadWriters of a KK handshake over net.Pipe, of which the initiator sets the frame size.
+// Act:
+// - The initiator writes data of several frames.
+// Assert:
+// - The responder reads the data.
+// - The frame size is bounded by DefaultFrameSize and MaxFrameSize, and the data is split into frames of that size.
+func TestReadWriter_FrameSize(t *testing.T) {
+	cases := []struct {
+		size int
+		want int
+	}{
+		{size: 0, want: DefaultFrameSize},
+		{size: DefaultFrameSize, want: DefaultFrameSize},
+		{size: 16 * 1024, want: 16 * 1024},
+		{size: MaxFrameSize, want: MaxFrameSize},
+		{size: 1 << 20, want: MaxFrameSize},
+	}
+	for _, tc := range cases {
+		t.Run(fmt.Sprintf("frame_size_%d", tc.size), func(t *testing.T) {
+			nI, nR := handshakeKK(t, RekeyConfig{})
+			connI, connR := net.Pipe()
+			defer func() {
+				assert.NoError(t, connI.Close())
+				assert.NoError(t, connR.Close())
+			}()
+			rwI, rwR := NewReadWriter(connI, nI), NewReadWriter(connR, nR)
+			rwI.SetFrameSize(tc.size)
+			require.Equal(t, tc.want, rwI.FrameSize())
+
+			data := cipher.RandByte(3*MaxFrameSize + 1)
+			errCh := make(chan error, 1)
+			go func() {
+				_, err := rwI.Write(data)
+				errCh <- err
+			}()
+
+			got := make([]byte, len(data))
+			_, err := io.ReadFull(rwR, got)
+			require.NoError(t, err)
+			require.NoError(t, <-errCh)
+			assert.Equal(t, data, got)
+
+			maxPayload := tc.want - prefixSize - authSize
+			wantFrames := uint64((len(data) + maxPayload - 1) / maxPayload)
+			assert.Equal(t, wantFrames, rwI.Stats().FramesSent)
+			assert.Equal(t, wantFrames, rwR.Stats().FramesReceived)
+		})
+	}
+}
+
+// stepReader returns the given steps one at a time, with a timeout error after each step (as if the read deadline
+// is exceeded in between).
+type stepReader struct {
+	steps   [][]byte
+	timeout bool
+}
+
+func (r *stepReader) Read(p []byte) (int, error) {
+	if r.timeout {
+		r.timeout = false
+		return 0, timeoutError{}
+	}
+	if len(r.steps) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.steps[0])
+	if r.steps[0] = r.steps[0][n:]; len(r.steps[0]) == 0 {
+		r.steps, r.timeout = r.steps[1:], true
+	}
+	return n, nil
+}
+
+func (r *stepReader) Write(p []byte) (int, error) { return len(p), nil }
+
+// Ensure that frames which are partially read before a timeout are resumed by the next read.
+// Arrange:
+// - Frames of MaxFrameSize, which are split into steps with timeout errors in between.
+// Act:
+// - Read from the steps until all data is read.
+// Assert:
+// - Reads in between steps fail with temporary errors.
+// - All data is read.
+func TestReadWriter_PartialFrame(t *testing.T) {
+	nI, nR := handshakeKK(t, RekeyConfig{})
+
+	var raw bytes.Buffer
+	rwI := NewReadWriter(&raw, nI)
+	rwI.SetFrameSize(MaxFrameSize)
+	data := cipher.RandByte(2 * MaxFrameSize)
+	_, err := rwI.Write(data)
+	require.NoError(t, err)
+
+	b := raw.Bytes()
+	rwR := NewReadWriter(&stepReader{steps: [][]byte{b[:1], b[1:1000], b[1000 : MaxFrameSize+10], b[MaxFrameSize+10:]}}, nR)
+
+	var got []byte
+	buf := make([]byte, MaxFrameSize)
+	for len(got) < len(data) {
+		n, err := rwR.Read(buf)
+		if err != nil {
+			require.True(t, isTemp(err), err)
+			continue
+		}
+		got = append(got, buf[:n]...)
+	}
+	assert.Equal(t, data, got)
+}
+
+// BenchmarkReadWriter measures the throughput of bulk transfers (i.e. dmsgget) over a ReadWriter per frame size.
+func BenchmarkReadWriter(b *testing.B) {
+	const writeSize = 32 * 1024 // buffer size of io.Copy
+
+	for _, size := range []int{DefaultFrameSize, 16 * 1024, MaxFrameSize} {
+		b.Run(fmt.Sprintf("frame_size_%d", size), func(b *testing.B) {
+			nI, nR := handshakeKK(b, RekeyConfig{})
+			connI, connR := net.Pipe()
+			rwI, rwR := NewReadWriter(connI, nI), NewReadWriter(connR, nR)
+			rwI.SetFrameSize(size)
+
+			done := make(chan struct{})
+			go func() {
+				_, _ = io.Copy(io.Discard, rwR) //nolint:errcheck
+				close(done)
+			}()
+
+			data := cipher.RandByte(writeSize)
+			b.SetBytes(writeSize)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := rwI.Write(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+
+			_ = connI.Close() //nolint:errcheck
+			<-done
+			_ = connR.Close() //nolint:errcheck
+		})
+	}
+}
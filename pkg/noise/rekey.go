@@ -0,0 +1,165 @@
+// Package noise pkg/noise/rekey.go
+package noise
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/skycoin/noise"
+)
+
+// Nonce format: [ rekey flag (1 bit) | epoch (15 bits) | sequence (48 bits) ]
+// The nonce is authenticated, so the flag and the epoch cannot be forged.
+// Frames of epoch 0 (without rekeying) are equivalent to frames of peers which do not support rekeying.
+const (
+	rekeyFlag  = uint64(1) << 63
+	epochShift = 48
+	epochMask  = uint64(1)<<15 - 1
+	seqMask    = uint64(1)<<epochShift - 1
+
+	// rekeyWindow is the number of epochs which frames decrypted with DecryptWithNonceMap may be out of order.
+	rekeyWindow = 16
+
+	// Cipher states of previous epochs are dropped once this many frames of the current epoch are decrypted, or
+	// once this duration elapsed since the last rekey (whichever comes first).
+	// Frames which are delayed for longer than this are not expected, and keeping the states defeats forward secrecy.
+	rekeyGraceFrames = 64
+	rekeyGracePeriod = 10 * time.Second
+)
+
+// RekeyConfig configures when the encrypting cipher state is rekeyed (with the 'Rekey' function of the noise spec).
+// The remote is informed with a rekey frame, so the remote must support rekeying.
+// Rekeying provides forward secrecy within long-lived sessions: keys of previous epochs cannot be derived from the
+// current key.
+type RekeyConfig struct {
+	Bytes    uint64        // Rekey after encrypting this many plaintext bytes. Zero disables.
+	Interval time.Duration // Rekey after this duration since the last rekey. Zero disables.
+}
+
+// Enabled returns true if any of the thresholds are set.
+func (c RekeyConfig) Enabled() bool {
+	return c.Bytes > 0 || c.Interval > 0
+}
+
+// SetRekey sets the rekey config, i.e. to disable rekeying once the handshake shows that the remote does not support
+// it. It should be called before encrypting.
+func (ns *Noise) SetRekey(conf RekeyConfig) {
+	ns.rekey = conf
+}
+
+// GetEncEpoch returns the number of times the encrypting cipher state is rekeyed.
+func (ns *Noise) GetEncEpoch() uint64 {
+	return ns.encEpoch
+}
+
+// GetDecEpoch returns the number of times the decrypting cipher state is rekeyed.
+func (ns *Noise) GetDecEpoch() uint64 {
+	return ns.decEpoch
+}
+
+// RekeyDue returns true if a threshold of the rekey config is reached, and the encrypting cipher state should be
+// rekeyed with RekeyUnsafe before encrypting further.
+func (ns *Noise) RekeyDue() bool {
+	if ns.enc == nil {
+		return false
+	}
+	return (ns.rekey.Bytes > 0 && ns.encBytes >= ns.rekey.Bytes) ||
+		(ns.rekey.Interval > 0 && time.Since(ns.encKeyedAt) >= ns.rekey.Interval)
+}
+
+// RekeyUnsafe rekeys the encrypting cipher state without interlocking, should only be used with external lock.
+// It returns the rekey frame (encrypted with the previous key), which rekeys the decrypting cipher state of the
+// remote once it is decrypted. The rekey frame is to be sent before any frame which is encrypted afterwards.
+func (ns *Noise) RekeyUnsafe() []byte {
+	ns.encNonce++
+	seq := ns.encNonce | epochBits(ns.encEpoch) | rekeyFlag
+	buf := make([]byte, nonceSize)
+	binary.BigEndian.PutUint64(buf, seq)
+	frame := append(buf, ns.enc.Cipher().Encrypt(nil, seq, nil, nil)...)
+
+	ns.enc.Rekey()
+	ns.encBytes = 0
+	ns.encKeyedAt = time.Now()
+	ns.encEpoch++
+	return frame
+}
+
+// decrypt decrypts the ciphertext with the cipher state of the epoch of the nonce, and appends the plaintext to 'dst'.
+// Frames of up to 'window' epochs before or after the current epoch are decrypted, as frames may be out of order.
+func (ns *Noise) decrypt(dst []byte, recvSeq uint64, ciphertext []byte, window int) ([]byte, error) {
+	epoch := (recvSeq >> epochShift) & epochMask
+	cur := ns.decEpoch & epochMask
+	ahead, behind := (epoch-cur)&epochMask, (cur-epoch)&epochMask
+	isRekey := recvSeq&rekeyFlag != 0
+	ns.expireDecPrev()
+
+	switch {
+	case ahead == 0:
+		plaintext, err := ns.dec.Cipher().Decrypt(dst, recvSeq, nil, ciphertext)
+		if err == nil {
+			ns.decFrames++
+			if isRekey {
+				ns.rekeyDec(window)
+			}
+		}
+		return plaintext, err
+
+	case behind <= uint64(len(ns.decPrev)):
+		// The rekey frames of previous epochs are already applied.
+		return ns.decPrev[behind-1].Cipher().Decrypt(dst, recvSeq, nil, ciphertext)
+
+	case ahead <= uint64(window):
+		// The rekey frames of the following epochs are not decrypted yet.
+		next := *ns.dec
+		for i := uint64(0); i < ahead; i++ {
+			next.Rekey()
+		}
+		plaintext, err := next.Cipher().Decrypt(dst, recvSeq, nil, ciphertext)
+		if err != nil {
+			return nil, err
+		}
+		for i := uint64(0); i < ahead; i++ {
+			ns.rekeyDec(window)
+		}
+		ns.decFrames++
+		if isRekey {
+			ns.rekeyDec(window)
+		}
+		return plaintext, nil
+
+	default:
+		return nil, fmt.Errorf("received decryption epoch (%d) is out of range of current epoch (%d)", epoch, cur)
+	}
+}
+
+// rekeyDec rekeys the decrypting cipher state, and keeps up to 'window' cipher states of previous epochs (until they
+// expire, see expireDecPrev).
+func (ns *Noise) rekeyDec(window int) {
+	if window > 0 {
+		prev := *ns.dec
+		ns.decPrev = append([]*noise.CipherState{&prev}, ns.decPrev...)
+		if len(ns.decPrev) > window {
+			ns.decPrev = ns.decPrev[:window]
+		}
+	}
+	ns.dec.Rekey()
+	ns.decEpoch++
+	ns.decKeyedAt = time.Now()
+	ns.decFrames = 0
+}
+
+// expireDecPrev drops the cipher states of previous epochs once the grace period of the last rekey is over.
+func (ns *Noise) expireDecPrev() {
+	if len(ns.decPrev) == 0 {
+		return
+	}
+	if ns.decFrames >= rekeyGraceFrames || time.Since(ns.decKeyedAt) >= rekeyGracePeriod {
+		ns.decPrev = nil
+	}
+}
+
+// epochBits returns the epoch bits of nonces.
+func epochBits(epoch uint64) uint64 {
+	return (epoch & epochMask) << epochShift
+}
@@ -0,0 +1,196 @@
+// Package noise pkg/noise/rekey_test.go
+package noise
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/skycoin/skywire-utilities/pkg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// handshakeKK returns an initiator and a responder which completed a KK handshake.
+func handshakeKK(t testing.TB, rekey RekeyConfig) (*Noise, *Noise) {
+	pkI, skI := cipher.GenerateKeyPair()
+	pkR, skR := cipher.GenerateKeyPair()
+
+	nI, err := KKAndSecp256k1(Config{LocalPK: pkI, LocalSK: skI, RemotePK: pkR, Initiator: true, Rekey: rekey})
+	require.NoError(t, err)
+	nR, err := KKAndSecp256k1(Config{LocalPK: pkR, LocalSK: skR, RemotePK: pkI, Initiator: false, Rekey: rekey})
+	require.NoError(t, err)
+
+	msg, err := nI.MakeHandshakeMessage()
+	require.NoError(t, err)
+	require.NoError(t, nR.ProcessHandshakeMessage(msg))
+	msg, err = nR.MakeHandshakeMessage()
+	require.NoError(t, err)
+	require.NoError(t, nI.ProcessHandshakeMessage(msg))
+	return nI, nR
+}
+
+func TestNoise_Rekey(t *testing.T) {
+	t.Run("thresholds", func(t *testing.T) {
+		nI, _ := handshakeKK(t, RekeyConfig{Bytes: 6})
+		assert.False(t, nI.RekeyDue())
+		nI.EncryptUnsafe([]byte("foo"))
+		assert.False(t, nI.RekeyDue())
+		nI.EncryptUnsafe([]byte("bar"))
+		assert.True(t, nI.RekeyDue())
+		nI.RekeyUnsafe()
+		assert.False(t, nI.RekeyDue())
+		assert.Equal(t, uint64(1), nI.GetEncEpoch())
+
+		nI, _ = handshakeKK(t, RekeyConfig{Interval: 50 * time.Millisecond})
+		assert.False(t, nI.RekeyDue())
+		assert.Eventually(t, nI.RekeyDue, time.Second, 10*time.Millisecond)
+
+		nI, _ = handshakeKK(t, RekeyConfig{})
+		nI.EncryptUnsafe(make([]byte, 1<<16))
+		assert.False(t, nI.RekeyDue())
+	})
+
+	t.Run("in_order", func(t *testing.T) {
+		nI, nR := handshakeKK(t, RekeyConfig{})
+
+		for i := 0; i < 3; i++ {
+			decrypted, err := nR.DecryptUnsafe(nI.EncryptUnsafe([]byte("foo")))
+			require.NoError(t, err)
+			assert.Equal(t, []byte("foo"), decrypted)
+
+			decrypted, err = nR.DecryptUnsafe(nI.RekeyUnsafe())
+			require.NoError(t, err)
+			assert.Empty(t, decrypted)
+		}
+		assert.Equal(t, uint64(3), nI.GetEncEpoch())
+		assert.Equal(t, uint64(3), nR.GetDecEpoch())
+
+		decrypted, err := nR.DecryptUnsafe(nI.EncryptUnsafe([]byte("bar")))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("bar"), decrypted)
+	})
+
+	t.Run("missed_rekey_frame", func(t *testing.T) {
+		nI, nR := handshakeKK(t, RekeyConfig{})
+		nI.RekeyUnsafe()
+		_, err := nR.DecryptUnsafe(nI.EncryptUnsafe([]byte("foo")))
+		assert.Error(t, err)
+	})
+
+	t.Run("forged_rekey_flag", func(t *testing.T) {
+		nI, nR := handshakeKK(t, RekeyConfig{})
+		frame := nI.EncryptUnsafe([]byte("foo"))
+		binary.BigEndian.PutUint64(frame, binary.BigEndian.Uint64(frame)|rekeyFlag)
+		_, err := nR.DecryptUnsafe(frame)
+		assert.Error(t, err)
+		assert.Equal(t, uint64(0), nR.GetDecEpoch())
+	})
+
+	t.Run("out_of_order", func(t *testing.T) {
+		nI, nR := handshakeKK(t, RekeyConfig{})
+		nm := make(NonceMap)
+
+		a := nI.EncryptUnsafe([]byte("a"))
+		rekey1 := nI.RekeyUnsafe()
+		b := nI.EncryptUnsafe([]byte("b"))
+		c := nI.EncryptUnsafe([]byte("c"))
+		rekey2 := nI.RekeyUnsafe()
+		d := nI.EncryptUnsafe([]byte("d"))
+
+		// Frames of following epochs are decrypted before the rekey frames.
+		for _, frame := range [][]byte{d, c, a, rekey2, rekey1, b} {
+			decrypted, err := nR.DecryptWithNonceMap(nm, frame)
+			require.NoError(t, err)
+			if bytes.Equal(frame, rekey1) || bytes.Equal(frame, rekey2) {
+				assert.Empty(t, decrypted)
+			} else {
+				assert.Len(t, decrypted, 1)
+			}
+		}
+		assert.Equal(t, uint64(2), nR.GetDecEpoch())
+
+		// Frames of epochs out of the window are not decrypted.
+		for i := 0; i < rekeyWindow; i++ {
+			nI.RekeyUnsafe()
+		}
+		_, err := nR.DecryptWithNonceMap(nm, nI.EncryptUnsafe([]byte("e")))
+		require.NoError(t, err)
+		_, err = nR.DecryptWithNonceMap(nm, a)
+		assert.Error(t, err)
+
+		for i := 0; i <= rekeyWindow; i++ {
+			nI.RekeyUnsafe()
+		}
+		_, err = nR.DecryptWithNonceMap(nm, nI.EncryptUnsafe([]byte("f")))
+		assert.Error(t, err)
+	})
+
+	t.Run("grace", func(t *testing.T) {
+		nI, nR := handshakeKK(t, RekeyConfig{})
+		nm := make(NonceMap)
+
+		// Cipher states of previous epochs are dropped once enough frames of the current epoch are decrypted.
+		a := nI.EncryptUnsafe([]byte("a"))
+		_, err := nR.DecryptWithNonceMap(nm, nI.RekeyUnsafe())
+		require.NoError(t, err)
+		for i := 0; i < rekeyGraceFrames; i++ {
+			_, err := nR.DecryptWithNonceMap(nm, nI.EncryptUnsafe([]byte("b")))
+			require.NoError(t, err)
+		}
+		_, err = nR.DecryptWithNonceMap(nm, a)
+		assert.Error(t, err)
+
+		// Cipher states of previous epochs are dropped once the grace period is over.
+		c := nI.EncryptUnsafe([]byte("c"))
+		_, err = nR.DecryptWithNonceMap(nm, nI.RekeyUnsafe())
+		require.NoError(t, err)
+		nR.decKeyedAt = nR.decKeyedAt.Add(-rekeyGracePeriod)
+		_, err = nR.DecryptWithNonceMap(nm, c)
+		assert.Error(t, err)
+	})
+}
+
+// Ensure that the read writers rekey when the thresholds are reached, and data is still delivered.
+func TestReadWriter_Rekey(t *testing.T) {
+	nI, nR := handshakeKK(t, RekeyConfig{Bytes: 1000})
+
+	connI, connR := net.Pipe()
+	defer func() {
+		assert.NoError(t, connI.Close())
+		assert.NoError(t, connR.Close())
+	}()
+	rwI := NewReadWriter(connI, nI)
+	rwR := NewReadWriter(connR, nR)
+
+	data := make([]byte, 10*maxPayloadSize)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		for i := 0; i < len(data); i += 100 {
+			if _, err := rwI.Write(data[i : i+100]); err != nil {
+				errCh <- err
+				return
+			}
+		}
+		_, err := rwI.Write(data)
+		errCh <- err
+	}()
+
+	got := make([]byte, 2*len(data))
+	_, err := io.ReadFull(rwR, got)
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+	assert.Equal(t, data, got[:len(data)])
+	assert.Equal(t, data, got[len(data):])
+
+	assert.True(t, nI.GetEncEpoch() > 0)
+	assert.Equal(t, nI.GetEncEpoch(), nR.GetDecEpoch())
+	assert.Equal(t, uint64(2*len(data)), rwR.Stats().BytesReceived)
+}